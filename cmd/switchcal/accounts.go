@@ -0,0 +1,605 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+	"github.com/djwarf/switchcal/pkg/providers/gnome"
+)
+
+// syncHistoryShown is the number of sync records listed per account
+const syncHistoryShown = 20
+
+// showAccountsDialog lists every account with its sync status and management actions
+func (app *App) showAccountsDialog() {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Accounts")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(520, 520)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	scrolled := gtk.NewScrolledWindow()
+	scrolled.SetVExpand(true)
+	scrolled.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	content.Append(scrolled)
+
+	var reload func()
+	reload = func() {
+		list := gtk.NewBox(gtk.OrientationVertical, 12)
+		app.fillAccounts(list, reload)
+		scrolled.SetChild(list)
+	}
+	reload()
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	closeBtn := gtk.NewButtonWithLabel("Close")
+	closeBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(closeBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+}
+
+// fillAccounts appends a section for each account to box
+func (app *App) fillAccounts(box *gtk.Box, reload func()) {
+	accounts, err := app.store.GetAllAccounts()
+	if err != nil {
+		log.Printf("Error loading accounts: %v", err)
+		return
+	}
+
+	calendarNames := make(map[string]string)
+	if calendars, err := app.store.GetAllCalendars(); err == nil {
+		for _, cal := range calendars {
+			calendarNames[cal.ID] = cal.Name
+		}
+	}
+
+	if len(accounts) == 0 {
+		label := gtk.NewLabel("No accounts")
+		label.AddCSSClass("dim-label")
+		label.SetMarginTop(20)
+		box.Append(label)
+		return
+	}
+
+	for _, account := range accounts {
+		reg, ok := providers.Lookup(account.Type)
+		if !ok {
+			continue
+		}
+		box.Append(app.accountSection(account, reg, calendarNames, reload))
+	}
+}
+
+// accountSection renders one account's status, actions and sync history
+func (app *App) accountSection(account *calendar.Account, reg *providers.Registration, calendarNames map[string]string, reload func()) *gtk.Box {
+	section := gtk.NewBox(gtk.OrientationVertical, 4)
+
+	header := gtk.NewBox(gtk.OrientationHorizontal, 8)
+
+	title := gtk.NewLabel(account.Name)
+	title.AddCSSClass("heading")
+	title.SetXAlign(0)
+	title.SetHExpand(true)
+	title.SetEllipsize(3) // PANGO_ELLIPSIZE_END
+	header.Append(title)
+
+	enabled := gtk.NewSwitch()
+	enabled.SetActive(account.Enabled)
+	enabled.SetVAlign(gtk.AlignCenter)
+	enabled.SetTooltipText("Enable or disable this account")
+	enabled.ConnectStateSet(func(state bool) bool {
+		account.Enabled = state
+		if err := app.store.SaveAccount(account); err != nil {
+			log.Printf("Error saving account: %v", err)
+		}
+		if state && reg.IsRemote() {
+			go app.syncAccount(account)
+		}
+		app.loadCalendars()
+		app.refreshMonthView()
+		app.refreshDayDetail()
+		glib.IdleAdd(reload)
+		return false
+	})
+	header.Append(enabled)
+	section.Append(header)
+
+	typeLabel := gtk.NewLabel(reg.DisplayName)
+	typeLabel.SetXAlign(0)
+	typeLabel.AddCSSClass("dim-label")
+	section.Append(typeLabel)
+
+	var history []*calendar.SyncRecord
+	if reg.IsRemote() {
+		var err error
+		history, err = app.store.GetSyncHistory(account.ID, syncHistoryShown)
+		if err != nil {
+			log.Printf("Error loading sync history for %s: %v", account.Name, err)
+		}
+
+		status := gtk.NewLabel(syncSummary(account, history))
+		status.SetXAlign(0)
+		status.SetWrap(true)
+		if lastRunFailed(history) {
+			status.AddCSSClass("error")
+		} else {
+			status.AddCSSClass("dim-label")
+		}
+		section.Append(status)
+	}
+
+	actions := gtk.NewBox(gtk.OrientationHorizontal, 6)
+
+	if reg.IsRemote() {
+		syncBtn := gtk.NewButtonWithLabel("Sync Now")
+		syncBtn.SetSensitive(account.Enabled)
+		syncBtn.ConnectClicked(func() {
+			syncBtn.SetSensitive(false)
+			syncBtn.SetLabel("Syncing...")
+			go func() {
+				app.syncAccount(account)
+				glib.IdleAdd(reload)
+			}()
+		})
+		actions.Append(syncBtn)
+	}
+
+	switch {
+	case account.GOAID != "":
+		managed := gtk.NewLabel("Signed in through GNOME Online Accounts")
+		managed.AddCSSClass("dim-label")
+		actions.Append(managed)
+	case reg.Auth == providers.AuthPassword:
+		editBtn := gtk.NewButtonWithLabel("Edit Credentials…")
+		editBtn.ConnectClicked(func() {
+			app.showEditCredentialsDialog(account, reg, reload)
+		})
+		actions.Append(editBtn)
+	case reg.Auth == providers.AuthOAuth:
+		signInBtn := gtk.NewButtonWithLabel("Sign In Again…")
+		signInBtn.ConnectClicked(func() {
+			app.showReauthDialog(account, reload)
+		})
+		actions.Append(signInBtn)
+	}
+
+	removeBtn := gtk.NewButtonWithLabel("Remove…")
+	removeBtn.AddCSSClass("destructive-action")
+	removeBtn.ConnectClicked(func() {
+		app.confirmRemoveAccount(account, reload)
+	})
+	actions.Append(removeBtn)
+	section.Append(actions)
+
+	if len(history) > 0 {
+		expander := gtk.NewExpander("Sync history")
+		rows := gtk.NewBox(gtk.OrientationVertical, 4)
+		rows.SetMarginTop(4)
+		for _, rec := range history {
+			rows.Append(syncRecordRow(rec, calendarNames))
+		}
+		expander.SetChild(rows)
+		section.Append(expander)
+	}
+
+	return section
+}
+
+// latestRun returns the records written by an account's most recent sync
+func latestRun(history []*calendar.SyncRecord) []*calendar.SyncRecord {
+	if len(history) == 0 {
+		return nil
+	}
+	// Records of one run are written within moments of each other
+	runStart := history[0].Started.Add(-time.Minute)
+	for i, rec := range history {
+		if rec.Started.Before(runStart) {
+			return history[:i]
+		}
+	}
+	return history
+}
+
+// lastRunFailed reports whether any record of the most recent sync failed
+func lastRunFailed(history []*calendar.SyncRecord) bool {
+	for _, rec := range latestRun(history) {
+		if rec.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// syncSummary describes when an account last synced and whether it succeeded
+func syncSummary(account *calendar.Account, history []*calendar.SyncRecord) string {
+	if !account.Enabled {
+		return "Disabled — not syncing"
+	}
+	if account.LastSync.IsZero() && len(history) == 0 {
+		return "Never synced"
+	}
+
+	last := account.LastSync
+	if len(history) > 0 && history[0].Started.After(last) {
+		last = history[0].Started
+	}
+
+	status := "OK"
+	for _, rec := range latestRun(history) {
+		if rec.Failed() {
+			status = "Error: " + rec.Errors[0]
+			break
+		}
+	}
+	return fmt.Sprintf("Last sync: %s — %s", last.Format("Jan 2, 15:04"), status)
+}
+
+// syncRecordRow renders one sync history record
+func syncRecordRow(rec *calendar.SyncRecord, calendarNames map[string]string) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationVertical, 2)
+	row.SetMarginStart(12)
+
+	name := calendarNames[rec.CalendarID]
+	if rec.CalendarID == "" {
+		name = "Account"
+	} else if name == "" {
+		name = rec.CalendarID
+	}
+
+	line := gtk.NewLabel(fmt.Sprintf("%s  %s  +%d ~%d -%d  (%s)",
+		rec.Started.Format("Jan 2 15:04:05"), name,
+		rec.EventsCreated, rec.EventsUpdated, rec.EventsDeleted,
+		rec.Duration.Round(time.Millisecond)))
+	line.SetXAlign(0)
+	line.SetEllipsize(3) // PANGO_ELLIPSIZE_END
+	row.Append(line)
+
+	if rec.Failed() {
+		errLabel := gtk.NewLabel(strings.Join(rec.Errors, "\n"))
+		errLabel.SetXAlign(0)
+		errLabel.SetWrap(true)
+		errLabel.SetSelectable(true)
+		errLabel.AddCSSClass("error")
+		row.Append(errLabel)
+	}
+	return row
+}
+
+// showEditCredentialsDialog changes the credentials of a password-based account,
+// checking them against the server before saving
+func (app *App) showEditCredentialsDialog(account *calendar.Account, reg *providers.Registration, onDone func()) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Edit Credentials")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(380, 250)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	accountLabel := gtk.NewLabel("Account: " + account.Name)
+	accountLabel.SetXAlign(0)
+	accountLabel.AddCSSClass("dim-label")
+	content.Append(accountLabel)
+
+	fieldEntries := make(map[string]*gtk.Entry)
+	for _, field := range reg.Fields {
+		if field.Fixed {
+			continue
+		}
+		label := gtk.NewLabel(field.Label)
+		label.SetXAlign(0)
+		content.Append(label)
+
+		entry := gtk.NewEntry()
+		entry.SetVisibility(!field.Secret)
+		if field.Secret {
+			entry.SetPlaceholderText("Leave empty to keep the current password")
+		} else {
+			entry.SetPlaceholderText(field.Placeholder)
+			entry.SetText(providers.FieldValue(account, field.Key))
+		}
+		content.Append(entry)
+		fieldEntries[field.Key] = entry
+	}
+
+	statusLabel := gtk.NewLabel("")
+	statusLabel.SetXAlign(0)
+	statusLabel.SetWrap(true)
+	statusLabel.AddCSSClass("dim-label")
+	content.Append(statusLabel)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	cancelBtn := gtk.NewButtonWithLabel("Cancel")
+	cancelBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(cancelBtn)
+
+	saveBtn := gtk.NewButtonWithLabel("Save")
+	saveBtn.AddCSSClass("suggested-action")
+	saveBtn.ConnectClicked(func() {
+		values := make(map[string]string)
+		for _, field := range reg.Fields {
+			entry, ok := fieldEntries[field.Key]
+			if !ok {
+				continue
+			}
+			values[field.Key] = strings.TrimSpace(entry.Text())
+			if field.Secret && values[field.Key] == "" {
+				values[field.Key] = providers.FieldValue(account, field.Key)
+			}
+		}
+
+		updated := *account
+		if err := reg.ApplyFields(&updated, values); err != nil {
+			statusLabel.SetText(err.Error())
+			return
+		}
+
+		saveBtn.SetSensitive(false)
+		statusLabel.SetText("Checking credentials...")
+
+		go func() {
+			_, err := app.providerForAccount(context.Background(), &updated)
+			if err == nil {
+				err = app.store.SaveAccount(&updated)
+			}
+
+			glib.IdleAdd(func() {
+				if err != nil {
+					statusLabel.SetText("Error: " + err.Error())
+					saveBtn.SetSensitive(true)
+					return
+				}
+				*account = updated
+				go app.syncAccount(account)
+				onDone()
+				dialog.Close()
+			})
+		}()
+	})
+	btnBox.Append(saveBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+}
+
+// showReauthDialog repeats the OAuth sign-in of an account whose tokens were revoked
+func (app *App) showReauthDialog(account *calendar.Account, onDone func()) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Sign In Again")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(380, 150)
+	dialog.ConnectCloseRequest(func() bool {
+		onDone()
+		return false
+	})
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	statusLabel := gtk.NewLabel("")
+	statusLabel.SetXAlign(0)
+	statusLabel.SetWrap(true)
+	content.Append(statusLabel)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	cancelBtn := gtk.NewButtonWithLabel("Cancel")
+	cancelBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(cancelBtn)
+
+	reg, _ := providers.Lookup(account.Type)
+	if reg != nil && reg.DeviceSignIn != nil && reg.BrowserSignIn != nil {
+		codeBtn := gtk.NewButtonWithLabel("Use a Code Instead")
+		codeBtn.SetTooltipText("Approve the sign-in from another device")
+		codeBtn.ConnectClicked(func() {
+			codeBtn.SetSensitive(false)
+			app.startDeviceSignIn(dialog, statusLabel, reg, account)
+		})
+		btnBox.Append(codeBtn)
+	}
+
+	content.Append(btnBox)
+	dialog.Show()
+
+	switch {
+	case reg != nil && reg.BrowserSignIn != nil:
+		app.startBrowserSignIn(dialog, statusLabel, reg, account)
+	case reg != nil && reg.DeviceSignIn != nil:
+		app.startDeviceSignIn(dialog, statusLabel, reg, account)
+	default:
+		statusLabel.SetText("Signing in again is not supported for this account type.")
+	}
+}
+
+// fillOnlineAccounts lists the GNOME Online Accounts that can be linked
+// instead of signing in again. The box stays hidden when there are none.
+func (app *App) fillOnlineAccounts(box *gtk.Box, dialog *gtk.Dialog, statusLabel *gtk.Label) {
+	box.SetVisible(false)
+
+	go func() {
+		online, err := gnome.ListAccounts()
+		if err != nil {
+			log.Printf("GNOME Online Accounts unavailable: %v", err)
+			return
+		}
+
+		linked := make(map[string]bool)
+		if accounts, err := app.store.GetAllAccounts(); err == nil {
+			for _, a := range accounts {
+				if a.GOAID != "" {
+					linked[a.GOAID] = true
+				}
+			}
+		}
+
+		var linkable []*gnome.OnlineAccount
+		for _, oa := range online {
+			if _, ok := oa.AccountType(); ok && !linked[oa.ID] {
+				linkable = append(linkable, oa)
+			}
+		}
+		if len(linkable) == 0 {
+			return
+		}
+
+		glib.IdleAdd(func() {
+			header := gtk.NewLabel("From GNOME Online Accounts:")
+			header.SetXAlign(0)
+			header.AddCSSClass("heading")
+			box.Append(header)
+
+			for _, oa := range linkable {
+				box.Append(app.onlineAccountRow(oa, dialog, statusLabel))
+			}
+			box.Append(gtk.NewSeparator(gtk.OrientationHorizontal))
+			box.SetVisible(true)
+		})
+	}()
+}
+
+// onlineAccountRow shows a GNOME Online Account with a button that links it
+func (app *App) onlineAccountRow(oa *gnome.OnlineAccount, dialog *gtk.Dialog, statusLabel *gtk.Label) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationHorizontal, 8)
+
+	label := gtk.NewLabel(oa.ProviderName + ": " + oa.PresentationIdentity)
+	label.SetXAlign(0)
+	label.SetHExpand(true)
+	label.SetEllipsize(3) // PANGO_ELLIPSIZE_END
+	row.Append(label)
+
+	linkBtn := gtk.NewButtonWithLabel("Add")
+	switch {
+	case oa.CalendarDisabled:
+		linkBtn.SetSensitive(false)
+		linkBtn.SetTooltipText("Calendars are turned off for this account in Settings")
+	case oa.AttentionNeeded:
+		linkBtn.SetSensitive(false)
+		linkBtn.SetTooltipText("Sign in to this account again in Settings first")
+	}
+	linkBtn.ConnectClicked(func() {
+		account, err := oa.NewAccount()
+		if err != nil {
+			statusLabel.SetText(err.Error())
+			return
+		}
+
+		linkBtn.SetSensitive(false)
+		statusLabel.SetText("Connecting to " + oa.PresentationIdentity + "...")
+
+		// Check the borrowed credentials against the server before saving
+		go func() {
+			_, err := app.providerForAccount(context.Background(), account)
+			glib.IdleAdd(func() {
+				if err != nil {
+					linkBtn.SetSensitive(true)
+					statusLabel.SetText("Could not connect: " + err.Error())
+					return
+				}
+				if err := app.saveSignedInAccount(account); err != nil {
+					statusLabel.SetText("Error saving: " + err.Error())
+					return
+				}
+				dialog.Close()
+			})
+		}()
+	})
+	row.Append(linkBtn)
+
+	return row
+}
+
+// confirmRemoveAccount asks before removing an account with its calendars and events
+func (app *App) confirmRemoveAccount(account *calendar.Account, onDone func()) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Remove Account")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(350, 150)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	message := gtk.NewLabel(fmt.Sprintf("Remove \"%s\" from SwitchCal?", account.Name))
+	message.SetXAlign(0)
+	message.SetWrap(true)
+	content.Append(message)
+
+	note := gtk.NewLabel("Its calendars and events are removed from this device. Nothing is deleted on the server.")
+	note.SetXAlign(0)
+	note.SetWrap(true)
+	note.AddCSSClass("dim-label")
+	content.Append(note)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	cancelBtn := gtk.NewButtonWithLabel("Cancel")
+	cancelBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(cancelBtn)
+
+	removeBtn := gtk.NewButtonWithLabel("Remove")
+	removeBtn.AddCSSClass("destructive-action")
+	removeBtn.ConnectClicked(func() {
+		if err := app.store.DeleteAccount(account.ID); err != nil {
+			log.Printf("Error removing account: %v", err)
+			message.SetText("Error: " + err.Error())
+			return
+		}
+		app.loadCalendars()
+		app.refreshMonthView()
+		app.refreshDayDetail()
+		onDone()
+		dialog.Close()
+	})
+	btnBox.Append(removeBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+}
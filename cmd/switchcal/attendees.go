@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+)
+
+// participationMark returns a symbol for an attendee's reply
+func participationMark(status calendar.ParticipationStatus) string {
+	switch status {
+	case calendar.ParticipationAccepted:
+		return "✓"
+	case calendar.ParticipationTentative:
+		return "?"
+	case calendar.ParticipationDeclined:
+		return "✗"
+	default:
+		return "…"
+	}
+}
+
+// participationText describes an attendee's reply
+func participationText(status calendar.ParticipationStatus) string {
+	switch status {
+	case calendar.ParticipationAccepted:
+		return "accepted"
+	case calendar.ParticipationTentative:
+		return "maybe"
+	case calendar.ParticipationDeclined:
+		return "declined"
+	default:
+		return "not replied"
+	}
+}
+
+// guestSummary describes who organizes an event, how many are invited and
+// the user's own reply, or returns an empty string for events without guests
+func guestSummary(event *calendar.Event) string {
+	if len(event.Attendees) == 0 {
+		return ""
+	}
+
+	var parts []string
+	if o := event.Organizer; o != nil && !o.Self {
+		parts = append(parts, "Organised by "+o.DisplayName())
+	}
+
+	accepted := 0
+	for _, a := range event.Attendees {
+		if a.Status == calendar.ParticipationAccepted {
+			accepted++
+		}
+	}
+	guests := fmt.Sprintf("%d guests", len(event.Attendees))
+	if len(event.Attendees) == 1 {
+		guests = "1 guest"
+	}
+	parts = append(parts, fmt.Sprintf("%s, %d accepted", guests, accepted))
+
+	if self := event.SelfAttendee(); self != nil {
+		parts = append(parts, "You: "+participationText(self.Status))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// declined reports whether the user declined an event they are invited to
+func declined(event *calendar.Event) bool {
+	self := event.SelfAttendee()
+	return self != nil && self.Status == calendar.ParticipationDeclined
+}
+
+// visibleEvents leaves out declined events if the user chose to hide them
+func (app *App) visibleEvents(events []*calendar.Event) []*calendar.Event {
+	if !app.config.HideDeclined {
+		return events
+	}
+	visible := events[:0:0]
+	for _, e := range events {
+		if !declined(e) {
+			visible = append(visible, e)
+		}
+	}
+	return visible
+}
+
+// attendeeText describes one attendee in a guest list
+func attendeeText(a *calendar.Attendee) string {
+	text := participationMark(a.Status) + " " + a.DisplayName()
+	if a.Name != "" {
+		text += " <" + a.Email + ">"
+	}
+	if a.Self {
+		text += " (you)"
+	}
+	if a.Optional {
+		text += " · optional"
+	}
+	return text
+}
+
+// buildGuestList shows an event's organizer and attendees. If editable,
+// guests can be added and those added can be removed again. The returned
+// function reads the resulting attendees.
+func (app *App) buildGuestList(event *calendar.Event, editable bool) (*gtk.Box, func() []calendar.Attendee) {
+	attendees := append([]calendar.Attendee(nil), event.Attendees...)
+	added := make(map[string]bool)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+
+	label := gtk.NewLabel("Guests:")
+	label.SetXAlign(0)
+	box.Append(label)
+
+	if o := event.Organizer; o != nil {
+		organizer := gtk.NewLabel("Organizer: " + o.DisplayName())
+		organizer.SetXAlign(0)
+		organizer.SetTooltipText(o.Email)
+		organizer.AddCSSClass("dim-label")
+		box.Append(organizer)
+	}
+
+	list := gtk.NewBox(gtk.OrientationVertical, 2)
+	box.Append(list)
+
+	var render func()
+	render = func() {
+		for {
+			child := list.FirstChild()
+			if child == nil {
+				break
+			}
+			list.Remove(child)
+		}
+		if len(attendees) == 0 {
+			none := gtk.NewLabel("No guests")
+			none.SetXAlign(0)
+			none.AddCSSClass("dim-label")
+			list.Append(none)
+		}
+		for i := range attendees {
+			a := attendees[i]
+			row := gtk.NewBox(gtk.OrientationHorizontal, 6)
+			name := gtk.NewLabel(attendeeText(&a))
+			name.SetXAlign(0)
+			name.SetHExpand(true)
+			name.SetEllipsize(3) // PANGO_ELLIPSIZE_END
+			name.SetTooltipText(a.Email + " — " + participationText(a.Status))
+			row.Append(name)
+
+			// Only guests added now can be taken off again; the server keeps
+			// track of everyone already invited
+			if added[strings.ToLower(a.Email)] {
+				removeBtn := gtk.NewButtonFromIconName("list-remove-symbolic")
+				removeBtn.AddCSSClass("flat")
+				removeBtn.SetTooltipText("Remove guest")
+				removeBtn.ConnectClicked(func() {
+					delete(added, strings.ToLower(a.Email))
+					for j := range attendees {
+						if strings.EqualFold(attendees[j].Email, a.Email) {
+							attendees = append(attendees[:j], attendees[j+1:]...)
+							break
+						}
+					}
+					render()
+				})
+				row.Append(removeBtn)
+			}
+			list.Append(row)
+		}
+	}
+	render()
+
+	if editable {
+		addBox := gtk.NewBox(gtk.OrientationHorizontal, 6)
+		guestEntry := gtk.NewEntry()
+		guestEntry.SetPlaceholderText("Add guest by email")
+		guestEntry.SetHExpand(true)
+		addBox.Append(guestEntry)
+		addBtn := gtk.NewButtonWithLabel("Add")
+		addBox.Append(addBtn)
+		box.Append(addBox)
+
+		errorLabel := gtk.NewLabel("")
+		errorLabel.SetXAlign(0)
+		errorLabel.AddCSSClass("dim-label")
+		errorLabel.SetVisible(false)
+		box.Append(errorLabel)
+
+		addGuest := func() {
+			text := strings.TrimSpace(guestEntry.Text())
+			if text == "" {
+				return
+			}
+			// Accepts "name@example.com" and "Name <name@example.com>"
+			addr, err := mail.ParseAddress(text)
+			if err != nil {
+				errorLabel.SetText("Not an email address: " + text)
+				errorLabel.SetVisible(true)
+				return
+			}
+			for _, a := range attendees {
+				if strings.EqualFold(a.Email, addr.Address) {
+					errorLabel.SetText(addr.Address + " is already invited")
+					errorLabel.SetVisible(true)
+					return
+				}
+			}
+			attendees = append(attendees, calendar.Attendee{
+				Email:  addr.Address,
+				Name:   addr.Name,
+				Status: calendar.ParticipationNeedsAction,
+			})
+			added[strings.ToLower(addr.Address)] = true
+			guestEntry.SetText("")
+			errorLabel.SetVisible(false)
+			render()
+		}
+		addBtn.ConnectClicked(addGuest)
+		guestEntry.ConnectActivate(addGuest)
+	}
+
+	return box, func() []calendar.Attendee {
+		return attendees
+	}
+}
+
+// buildReplyBox lets the user accept, tentatively accept or decline an event
+// they are invited to. The reply is sent to the organizer through the
+// event's provider and done is called once it has been saved.
+func (app *App) buildReplyBox(event *calendar.Event, done func()) *gtk.Box {
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+	box.SetMarginTop(4)
+
+	self := event.SelfAttendee()
+	label := gtk.NewLabel("Going? Your reply: " + participationText(self.Status))
+	label.SetXAlign(0)
+	box.Append(label)
+
+	commentEntry := gtk.NewEntry()
+	commentEntry.SetPlaceholderText("Add a note for the organizer")
+	box.Append(commentEntry)
+
+	btnRow := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	box.Append(btnRow)
+
+	statusLabel := gtk.NewLabel("")
+	statusLabel.SetXAlign(0)
+	statusLabel.SetWrap(true)
+	statusLabel.AddCSSClass("dim-label")
+	box.Append(statusLabel)
+
+	var buttons []*gtk.Button
+	reply := func(status calendar.ParticipationStatus) {
+		comment := strings.TrimSpace(commentEntry.Text())
+		for _, b := range buttons {
+			b.SetSensitive(false)
+		}
+		statusLabel.SetText("Sending reply...")
+
+		go func() {
+			// Local calendars have no organizer to tell; the reply is only stored
+			err := app.withProvider(event.CalendarID, func(ctx context.Context, p providers.Provider) error {
+				responder, ok := p.(providers.InvitationResponder)
+				if !ok {
+					return fmt.Errorf("replying to invitations is not supported for this account")
+				}
+				return responder.RespondToInvitation(ctx, event.CalendarID, event, status, comment)
+			})
+			if err == nil {
+				if self := event.SelfAttendee(); self != nil {
+					self.Status = status
+				}
+				if err = app.store.SaveEvent(event); err != nil {
+					log.Printf("Error saving event: %v", err)
+				}
+			}
+
+			glib.IdleAdd(func() {
+				if err != nil {
+					statusLabel.SetText("Error: " + err.Error())
+					for _, b := range buttons {
+						b.SetSensitive(true)
+					}
+					return
+				}
+				done()
+			})
+		}()
+	}
+
+	for _, choice := range []struct {
+		label  string
+		status calendar.ParticipationStatus
+	}{
+		{"Accept", calendar.ParticipationAccepted},
+		{"Maybe", calendar.ParticipationTentative},
+		{"Decline", calendar.ParticipationDeclined},
+	} {
+		status := choice.status
+		btn := gtk.NewButtonWithLabel(choice.label)
+		btn.SetHExpand(true)
+		if status == self.Status {
+			btn.AddCSSClass("suggested-action")
+		}
+		btn.ConnectClicked(func() {
+			reply(status)
+		})
+		btnRow.Append(btn)
+		buttons = append(buttons, btn)
+	}
+
+	return box
+}
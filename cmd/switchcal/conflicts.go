@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// conflictFieldNames labels the fields compared in the conflict dialog
+var conflictFieldNames = map[calendar.ConflictField]string{
+	calendar.ConflictTitle:       "Title",
+	calendar.ConflictTime:        "Time",
+	calendar.ConflictLocation:    "Location",
+	calendar.ConflictDescription: "Description",
+}
+
+// loadConflicts returns the unresolved sync conflicts keyed by event ID
+func (app *App) loadConflicts() map[string]*calendar.Conflict {
+	conflicts, err := app.store.GetConflicts()
+	if err != nil {
+		log.Printf("Error loading sync conflicts: %v", err)
+	}
+	byEvent := make(map[string]*calendar.Conflict, len(conflicts))
+	for _, c := range conflicts {
+		byEvent[c.EventID] = c
+	}
+	return byEvent
+}
+
+// updateConflictsButton shows the sidebar button when there are conflicts to resolve
+func (app *App) updateConflictsButton() {
+	app.conflictsBtn.SetVisible(len(app.conflicts) > 0)
+	app.conflictsBtn.SetLabel(fmt.Sprintf("Resolve Conflicts (%d)", len(app.conflicts)))
+}
+
+// conflictLocal returns the local version of a conflicting event, or nil if
+// it was deleted (or moved to another calendar) on this device
+func (app *App) conflictLocal(c *calendar.Conflict) *calendar.Event {
+	local, err := app.store.GetEvent(c.EventID)
+	if err != nil || local.CalendarID != c.CalendarID {
+		return nil
+	}
+	return local
+}
+
+// showConflictsDialog lists the events changed both locally and on the server
+func (app *App) showConflictsDialog() {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Sync Conflicts")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(420, 360)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	intro := gtk.NewLabel("These events were changed on this device and on the server since the last sync. Their changes are not uploaded until you choose which version to keep.")
+	intro.SetXAlign(0)
+	intro.SetWrap(true)
+	intro.AddCSSClass("dim-label")
+	content.Append(intro)
+
+	scrolled := gtk.NewScrolledWindow()
+	scrolled.SetVExpand(true)
+	scrolled.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	content.Append(scrolled)
+
+	var reload func()
+	reload = func() {
+		list := gtk.NewBox(gtk.OrientationVertical, 8)
+		conflicts, err := app.store.GetConflicts()
+		if err != nil {
+			log.Printf("Error loading sync conflicts: %v", err)
+		}
+		if len(conflicts) == 0 {
+			label := gtk.NewLabel("No conflicts")
+			label.AddCSSClass("dim-label")
+			label.SetMarginTop(20)
+			list.Append(label)
+		}
+		for _, c := range conflicts {
+			list.Append(app.conflictRow(c, reload))
+		}
+		scrolled.SetChild(list)
+	}
+	reload()
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	closeBtn := gtk.NewButtonWithLabel("Close")
+	closeBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(closeBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+}
+
+// conflictRow renders one conflict with a button to resolve it
+func (app *App) conflictRow(c *calendar.Conflict, reload func()) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationHorizontal, 8)
+
+	local := app.conflictLocal(c)
+	title := "Untitled event"
+	switch {
+	case local != nil:
+		title = local.Title
+	case c.Remote != nil:
+		title = c.Remote.Title
+	}
+
+	info := gtk.NewBox(gtk.OrientationVertical, 2)
+	info.SetHExpand(true)
+	name := gtk.NewLabel(title)
+	name.SetXAlign(0)
+	name.SetEllipsize(3) // PANGO_ELLIPSIZE_END
+	info.Append(name)
+
+	detail := "Changed on both sides"
+	if local == nil {
+		detail = "Deleted here, changed on the server"
+	} else if c.Remote == nil {
+		detail = "Changed here, deleted on the server"
+	}
+	if cal, err := app.store.GetCalendar(c.CalendarID); err == nil {
+		detail = cal.Name + " — " + detail
+	}
+	detailLabel := gtk.NewLabel(detail)
+	detailLabel.SetXAlign(0)
+	detailLabel.AddCSSClass("dim-label")
+	info.Append(detailLabel)
+	row.Append(info)
+
+	resolveBtn := gtk.NewButtonWithLabel("Resolve…")
+	resolveBtn.SetVAlign(gtk.AlignCenter)
+	resolveBtn.ConnectClicked(func() {
+		app.showConflictDialog(c, reload)
+	})
+	row.Append(resolveBtn)
+
+	return row
+}
+
+// showConflictDialog compares the local and server versions of an event side
+// by side and lets the user keep either one or merge them field by field
+func (app *App) showConflictDialog(c *calendar.Conflict, onDone func()) {
+	local := app.conflictLocal(c)
+	remote := c.Remote
+
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Resolve Conflict")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(560, 320)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	grid := gtk.NewGrid()
+	grid.SetColumnSpacing(12)
+	grid.SetRowSpacing(8)
+	grid.SetColumnHomogeneous(false)
+
+	for col, heading := range []string{"", "On this device", "On the server"} {
+		label := gtk.NewLabel(heading)
+		label.AddCSSClass("heading")
+		label.SetXAlign(0)
+		grid.Attach(label, col, 0, 1, 1)
+	}
+
+	// Fields whose local value is selected for a merge
+	var fields []calendar.ConflictField
+	localChoices := make(map[calendar.ConflictField]*gtk.CheckButton)
+
+	if local != nil && remote != nil {
+		fields = calendar.DiffEvents(local, remote)
+		for i, f := range fields {
+			name := gtk.NewLabel(conflictFieldNames[f])
+			name.SetXAlign(0)
+			name.SetVAlign(gtk.AlignStart)
+			name.AddCSSClass("dim-label")
+			grid.Attach(name, 0, i+1, 1, 1)
+
+			localBtn := gtk.NewCheckButtonWithLabel(app.conflictValue(local, f))
+			remoteBtn := gtk.NewCheckButtonWithLabel(app.conflictValue(remote, f))
+			remoteBtn.SetGroup(localBtn)
+			localBtn.SetActive(true)
+			localBtn.SetHExpand(true)
+			remoteBtn.SetHExpand(true)
+			grid.Attach(localBtn, 1, i+1, 1, 1)
+			grid.Attach(remoteBtn, 2, i+1, 1, 1)
+			localChoices[f] = localBtn
+		}
+		if len(fields) == 0 {
+			same := gtk.NewLabel("Both versions are the same.")
+			same.SetXAlign(0)
+			grid.Attach(same, 0, 1, 3, 1)
+		}
+	} else {
+		grid.Attach(app.conflictSummary(local), 1, 1, 1, 1)
+		grid.Attach(app.conflictSummary(remote), 2, 1, 1, 1)
+	}
+	content.Append(grid)
+
+	statusLabel := gtk.NewLabel("")
+	statusLabel.SetXAlign(0)
+	statusLabel.SetWrap(true)
+	statusLabel.AddCSSClass("error")
+	content.Append(statusLabel)
+
+	// resolve applies a resolution in the background, then uploads it
+	resolve := func(apply func() error) {
+		go func() {
+			err := apply()
+			glib.IdleAdd(func() {
+				if err != nil {
+					statusLabel.SetText(fmt.Sprintf("Failed to resolve the conflict: %v", err))
+					return
+				}
+				dialog.Close()
+				app.refreshMonthView()
+				app.refreshDayDetail()
+				if onDone != nil {
+					onDone()
+				}
+			})
+			if err == nil {
+				if account, err := app.store.GetAccount(c.AccountID); err == nil {
+					app.syncAccount(account)
+				}
+			}
+		}()
+	}
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	laterBtn := gtk.NewButtonWithLabel("Later")
+	laterBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(laterBtn)
+
+	remoteBtn := gtk.NewButtonWithLabel("Keep Server Version")
+	remoteBtn.ConnectClicked(func() {
+		resolve(func() error {
+			return app.store.AcceptRemote(c)
+		})
+	})
+	btnBox.Append(remoteBtn)
+
+	if len(fields) > 1 {
+		mergeBtn := gtk.NewButtonWithLabel("Merge Selected")
+		mergeBtn.ConnectClicked(func() {
+			var fromLocal []calendar.ConflictField
+			for _, f := range fields {
+				if localChoices[f].Active() {
+					fromLocal = append(fromLocal, f)
+				}
+			}
+			resolve(func() error {
+				return app.store.ResolveConflict(c, calendar.MergeEvents(local, remote, fromLocal))
+			})
+		})
+		btnBox.Append(mergeBtn)
+	}
+
+	localBtn := gtk.NewButtonWithLabel("Keep This Device's Version")
+	localBtn.AddCSSClass("suggested-action")
+	localBtn.ConnectClicked(func() {
+		resolve(func() error {
+			return app.store.ResolveConflict(c, local)
+		})
+	})
+	btnBox.Append(localBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+}
+
+// conflictSummary describes one version of an event, or its deletion
+func (app *App) conflictSummary(e *calendar.Event) *gtk.Label {
+	text := "Deleted"
+	if e != nil {
+		text = e.Title + "\n" + app.conflictValue(e, calendar.ConflictTime)
+		if e.Location != "" {
+			text += "\n" + e.Location
+		}
+	}
+	label := gtk.NewLabel(text)
+	label.SetXAlign(0)
+	label.SetVAlign(gtk.AlignStart)
+	label.SetWrap(true)
+	label.SetHExpand(true)
+	return label
+}
+
+// conflictValue formats a field of an event for comparison
+func (app *App) conflictValue(e *calendar.Event, f calendar.ConflictField) string {
+	var value string
+	switch f {
+	case calendar.ConflictTitle:
+		value = e.Title
+	case calendar.ConflictTime:
+		if e.AllDay {
+			value = e.Start.Local().Format("Mon 2 Jan 2006") + ", all day"
+		} else {
+			value = e.Start.Local().Format("Mon 2 Jan 2006, "+app.config.TimeFormat()) +
+				" — " + e.End.Local().Format(app.config.TimeFormat())
+		}
+	case calendar.ConflictLocation:
+		value = e.Location
+	case calendar.ConflictDescription:
+		value = truncate(e.Description, 200)
+	}
+	if value == "" {
+		return "(empty)"
+	}
+	return value
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// exportEvents asks where to save an .ics file, then writes the events load
+// returns to it
+func (app *App) exportEvents(fileName string, load func() ([]*calendar.Event, error)) {
+	chooser := gtk.NewFileChooserNative("Export Calendar File", &app.window.Window, gtk.FileChooserActionSave, "Export", "Cancel")
+	chooser.SetCurrentName(fileName)
+	chooser.ConnectResponse(func(response int) {
+		defer chooser.Destroy()
+		if response != int(gtk.ResponseAccept) {
+			return
+		}
+		file := chooser.File()
+		if file == nil {
+			return
+		}
+		path := file.Path()
+
+		go func() {
+			err := writeICalFile(path, load)
+			if err != nil {
+				log.Printf("Error exporting %s: %v", path, err)
+				glib.IdleAdd(func() {
+					app.showMessageDialog("Export Failed", err.Error())
+				})
+			}
+		}()
+	})
+	chooser.Show()
+}
+
+// writeICalFile writes the events load returns to an .ics file
+func writeICalFile(path string, load func() ([]*calendar.Event, error)) error {
+	events, err := load()
+	if err != nil {
+		return fmt.Errorf("failed to load events: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := calendar.WriteICal(&buf, events); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// exportCalendar saves every event of a calendar as an .ics file
+func (app *App) exportCalendar(cal *calendar.Calendar) {
+	app.exportEvents(icsFileName(cal.Name), func() ([]*calendar.Event, error) {
+		return app.store.GetEventsByCalendar(cal.ID)
+	})
+}
+
+// copyEventAsICal puts an event on the clipboard as iCalendar text, to paste
+// into an email or another calendar app
+func (app *App) copyEventAsICal(event *calendar.Event) {
+	var buf bytes.Buffer
+	if err := calendar.WriteICal(&buf, []*calendar.Event{event}); err != nil {
+		log.Printf("Error copying event: %v", err)
+		return
+	}
+	app.window.Clipboard().SetText(buf.String())
+}
+
+// icsFileName suggests a file name for exported events
+func icsFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		name = "calendar"
+	}
+	return name + ".ics"
+}
+
+// showExportRangeDialog exports the events between two dates, of one
+// calendar or of all shown calendars
+func (app *App) showExportRangeDialog() {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Export Range")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(360, -1)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	calLabel := gtk.NewLabel("Calendar:")
+	calLabel.SetXAlign(0)
+	content.Append(calLabel)
+
+	calCombo := gtk.NewComboBoxText()
+	calCombo.AppendText("All shown calendars")
+	allCalendars, _ := app.store.GetVisibleCalendars()
+	for _, cal := range allCalendars {
+		calCombo.AppendText(cal.Name)
+	}
+	calCombo.SetActive(0)
+	content.Append(calCombo)
+
+	// The month on screen, in UK format like the event dialog
+	first := time.Date(app.currentDate.Year(), app.currentDate.Month(), 1, 0, 0, 0, 0, app.viewLocation())
+	last := first.AddDate(0, 1, -1)
+
+	fromLabel := gtk.NewLabel("From (DD/MM/YYYY):")
+	fromLabel.SetXAlign(0)
+	content.Append(fromLabel)
+	fromEntry := gtk.NewEntry()
+	fromEntry.SetText(first.Format("02/01/2006"))
+	content.Append(fromEntry)
+
+	toLabel := gtk.NewLabel("To (DD/MM/YYYY):")
+	toLabel.SetXAlign(0)
+	content.Append(toLabel)
+	toEntry := gtk.NewEntry()
+	toEntry.SetText(last.Format("02/01/2006"))
+	content.Append(toEntry)
+
+	errorLabel := gtk.NewLabel("")
+	errorLabel.SetXAlign(0)
+	errorLabel.SetWrap(true)
+	content.Append(errorLabel)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	cancelBtn := gtk.NewButtonWithLabel("Cancel")
+	cancelBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(cancelBtn)
+
+	exportBtn := gtk.NewButtonWithLabel("Export…")
+	exportBtn.AddCSSClass("suggested-action")
+	exportBtn.ConnectClicked(func() {
+		from, err1 := time.ParseInLocation("02/01/2006", strings.TrimSpace(fromEntry.Text()), app.viewLocation())
+		to, err2 := time.ParseInLocation("02/01/2006", strings.TrimSpace(toEntry.Text()), app.viewLocation())
+		if err1 != nil || err2 != nil {
+			errorLabel.SetText("Invalid date")
+			return
+		}
+		if to.Before(from) {
+			errorLabel.SetText("The end date is before the start date")
+			return
+		}
+
+		name := "SwitchCal"
+		calendarID := ""
+		if i := calCombo.Active(); i > 0 {
+			name = allCalendars[i-1].Name
+			calendarID = allCalendars[i-1].ID
+		}
+		dialog.Close()
+
+		fileName := icsFileName(fmt.Sprintf("%s %s to %s", name, from.Format("2006-01-02"), to.Format("2006-01-02")))
+		app.exportEvents(fileName, func() ([]*calendar.Event, error) {
+			events, err := app.store.GetEventsInRange(from, to.AddDate(0, 0, 1))
+			if err != nil || calendarID == "" {
+				return events, err
+			}
+			var inCalendar []*calendar.Event
+			for _, e := range events {
+				if e.CalendarID == calendarID {
+					inCalendar = append(inCalendar, e)
+				}
+			}
+			return inCalendar, nil
+		})
+	})
+	btnBox.Append(exportBtn)
+	content.Append(btnBox)
+
+	dialog.Show()
+}
+
+// showMessageDialog tells the user about something that went wrong
+func (app *App) showMessageDialog(title, text string) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle(title)
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(320, -1)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	label := gtk.NewLabel(text)
+	label.SetXAlign(0)
+	label.SetWrap(true)
+	content.Append(label)
+
+	closeBtn := gtk.NewButtonWithLabel("Close")
+	closeBtn.SetHAlign(gtk.AlignEnd)
+	closeBtn.SetMarginTop(12)
+	closeBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	content.Append(closeBtn)
+
+	dialog.Show()
+}
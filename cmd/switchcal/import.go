@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/internal/config"
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+)
+
+// readICalFile reads the events of an .ics file
+func readICalFile(path string) ([]*calendar.Event, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return calendar.ReadICalEvents(f)
+}
+
+// importSummary describes what importing a file into a calendar does
+func importSummary(preview *calendar.ImportPreview, calName string) string {
+	text := fmt.Sprintf("%s to add to %s", eventsText(len(preview.New)), calName)
+	if n := len(preview.Duplicates); n > 0 {
+		text += fmt.Sprintf(", %s already there", eventsText(n))
+	}
+	if preview.Skipped > 0 {
+		text += fmt.Sprintf(", %s could not be read", eventsText(preview.Skipped))
+	}
+	return text
+}
+
+// eventsText counts events, e.g. "1 event" or "3 events"
+func eventsText(n int) string {
+	if n == 1 {
+		return "1 event"
+	}
+	return fmt.Sprintf("%d events", n)
+}
+
+// showImportDialog lets the user pick an .ics file, or takes the one given,
+// previews it and imports its events into a calendar
+func (app *App) showImportDialog(path string) {
+	if path == "" {
+		chooser := gtk.NewFileChooserNative("Import Calendar File", &app.window.Window, gtk.FileChooserActionOpen, "Open", "Cancel")
+		filter := gtk.NewFileFilter()
+		filter.SetName("Calendar files")
+		filter.AddPattern("*.ics")
+		filter.AddMIMEType("text/calendar")
+		chooser.AddFilter(filter)
+		chooser.ConnectResponse(func(response int) {
+			if response == int(gtk.ResponseAccept) {
+				if file := chooser.File(); file != nil {
+					app.showImportDialog(file.Path())
+				}
+			}
+			chooser.Destroy()
+		})
+		chooser.Show()
+		return
+	}
+
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Import " + filepath.Base(path))
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(400, -1)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	cancelBtn := gtk.NewButtonWithLabel("Cancel")
+	cancelBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(cancelBtn)
+
+	events, skipped, err := readICalFile(path)
+	if err != nil {
+		log.Printf("Error reading %s: %v", path, err)
+		errorLabel := gtk.NewLabel(err.Error())
+		errorLabel.SetXAlign(0)
+		errorLabel.SetWrap(true)
+		content.Append(errorLabel)
+		cancelBtn.SetLabel("Close")
+		content.Append(btnBox)
+		dialog.Show()
+		return
+	}
+
+	calLabel := gtk.NewLabel("Import into:")
+	calLabel.SetXAlign(0)
+	content.Append(calLabel)
+
+	calCombo := gtk.NewComboBoxText()
+	allCalendars, _ := app.store.GetAllCalendars()
+	var calendars []*calendar.Calendar
+	for _, cal := range allCalendars {
+		if !cal.ReadOnly {
+			calendars = append(calendars, cal)
+			calCombo.AppendText(cal.Name)
+		}
+	}
+	content.Append(calCombo)
+
+	summaryLabel := gtk.NewLabel("")
+	summaryLabel.SetXAlign(0)
+	summaryLabel.SetWrap(true)
+	content.Append(summaryLabel)
+
+	importBtn := gtk.NewButtonWithLabel("Import")
+	importBtn.AddCSSClass("suggested-action")
+	btnBox.Append(importBtn)
+	content.Append(btnBox)
+
+	var preview *calendar.ImportPreview
+	updatePreview := func() {
+		preview = nil
+		i := calCombo.Active()
+		if i < 0 || i >= len(calendars) {
+			summaryLabel.SetText("No calendar to import into.")
+			importBtn.SetSensitive(false)
+			return
+		}
+		p, err := app.store.PreviewImport(calendars[i].ID, events)
+		if err != nil {
+			summaryLabel.SetText("Error: " + err.Error())
+			importBtn.SetSensitive(false)
+			return
+		}
+		p.Skipped = skipped
+		preview = p
+		summaryLabel.SetText(importSummary(p, calendars[i].Name) + ".")
+		importBtn.SetSensitive(len(p.New) > 0)
+	}
+	calCombo.Connect("changed", updatePreview)
+	if len(calendars) > 0 {
+		calCombo.SetActive(0)
+	}
+	updatePreview()
+
+	importBtn.ConnectClicked(func() {
+		cal := calendars[calCombo.Active()]
+		newEvents := preview.New
+		dialog.Close()
+
+		go func() {
+			account := app.remoteAccount(cal.ID)
+			accountID := ""
+			if account != nil {
+				accountID = account.ID
+			}
+			if err := app.store.ImportEvents(cal.ID, accountID, newEvents); err != nil {
+				log.Printf("Error importing %s: %v", path, err)
+			}
+			glib.IdleAdd(func() {
+				app.refreshMonthView()
+				app.refreshDayDetail()
+			})
+			if account != nil {
+				app.syncAccount(account)
+			}
+		}()
+	})
+
+	dialog.Show()
+}
+
+// runImport implements "switchcal import", which imports the events of .ics
+// files into a calendar and uploads them to its provider. It returns the
+// process exit code.
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: switchcal import -calendar <calendar> [options] <file.ics>...")
+		fmt.Fprintln(os.Stderr, "\nAdds the events of iCalendar files to a calendar, skipping those it already has.")
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	calendarRef := flags.String("calendar", "", "calendar to import into (name or ID)")
+	dryRun := flags.Bool("dry-run", false, "only show what would be imported")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to load config: %v\n", err)
+		cfg = config.DefaultConfig()
+	}
+	applyOAuthClients(cfg)
+
+	store, err := calendar.NewStore(cfg.DatabasePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	if *calendarRef == "" || flags.NArg() == 0 {
+		flags.Usage()
+		printCalendars(store)
+		return 2
+	}
+	cal, err := findCalendar(store, *calendarRef)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printCalendars(store)
+		return 1
+	}
+	if cal.ReadOnly {
+		fmt.Fprintf(os.Stderr, "Calendar %q is read-only\n", cal.Name)
+		return 1
+	}
+
+	var imported []*calendar.Event
+	for _, path := range flags.Args() {
+		events, skipped, err := readICalFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		preview, err := store.PreviewImport(cal.ID, append(imported, events...))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		// Events of earlier files count as already in the calendar
+		preview.New = preview.New[len(imported):]
+		preview.Skipped = skipped
+		fmt.Printf("%s: %s\n", path, importSummary(preview, cal.Name))
+		imported = append(imported, preview.New...)
+	}
+	if *dryRun || len(imported) == 0 {
+		return 0
+	}
+
+	account := remoteAccount(store, cal.ID)
+	accountID := ""
+	if account != nil {
+		accountID = account.ID
+	}
+	if err := store.ImportEvents(cal.ID, accountID, imported); err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Imported %s.\n", eventsText(len(imported)))
+	if account == nil {
+		return 0
+	}
+
+	// Upload right away; anything that fails stays queued for the next sync
+	secretStore, err := openSecretStoreCLI(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open credential storage, the events will be uploaded on the next sync: %v\n", err)
+		return 1
+	}
+	if err := store.SetSecretStore(secretStore); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to move credentials to secure storage: %v\n", err)
+	}
+	if err := applyOAuthClientSecrets(cfg, secretStore); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if account, err = store.GetAccount(account.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load account: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	before := *account
+	provider, err := connectAccount(ctx, account)
+	if err == nil && provider != nil {
+		start := time.Now().AddDate(0, -1, 0)
+		end := time.Now().AddDate(0, 6, 0)
+		var results []*providers.SyncResult
+		results, err = providers.SyncAccount(ctx, provider, store, start, end)
+		for _, r := range results {
+			store.SaveSyncRecord(r.Record())
+		}
+		if saveErr := store.SaveSyncState(&before, provider.GetAccount()); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Upload failed, the events will be uploaded on the next sync: %v\n", err)
+		return 1
+	}
+	waiting := 0
+	if pending, err := store.GetPendingEvents(); err == nil {
+		for _, e := range imported {
+			if _, ok := pending[e.ID]; ok {
+				waiting++
+			}
+		}
+	}
+	if waiting > 0 {
+		fmt.Fprintf(os.Stderr, "%s could not be uploaded yet and will be retried on the next sync.\n", eventsText(waiting))
+		return 1
+	}
+	fmt.Printf("Uploaded to %s.\n", account.Name)
+	return 0
+}
+
+// findCalendar looks up a calendar by ID or name
+func findCalendar(store *calendar.Store, ref string) (*calendar.Calendar, error) {
+	calendars, err := store.GetAllCalendars()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load calendars: %w", err)
+	}
+	var found *calendar.Calendar
+	for _, c := range calendars {
+		if c.ID == ref {
+			return c, nil
+		}
+		if strings.EqualFold(c.Name, ref) {
+			if found != nil {
+				return nil, fmt.Errorf("more than one calendar is called %q; use its ID", ref)
+			}
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no calendar %q", ref)
+	}
+	return found, nil
+}
+
+// printCalendars lists the calendars events can be imported into
+func printCalendars(store *calendar.Store) {
+	calendars, err := store.GetAllCalendars()
+	if err != nil || len(calendars) == 0 {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "\nCalendars:")
+	for _, c := range calendars {
+		if !c.ReadOnly {
+			fmt.Fprintf(os.Stderr, "  %-30s %s\n", c.Name, c.ID)
+		}
+	}
+}
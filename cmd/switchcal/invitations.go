@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// invitationPlan is what applying an invitation to a calendar would do
+type invitationPlan struct {
+	text  string // Shown in the preview
+	apply func() // Nil if there is nothing to do
+}
+
+// planInvitation works out how an invitation changes a calendar: a request
+// adds or updates its events, a cancellation removes them and a reply
+// records an attendee's answer on the meeting the user organizes
+func (app *App) planInvitation(inv *calendar.Invitation, cal *calendar.Calendar) invitationPlan {
+	var self string
+	if account, err := app.store.GetAccount(cal.AccountID); err == nil {
+		self = account.Email
+	}
+
+	var added, updated, found []*calendar.Event
+	for _, incoming := range inv.Events {
+		existing, _ := app.store.GetEventByUID(cal.ID, incoming.UID, incoming.RecurrenceID)
+		switch inv.Method {
+		case calendar.ITIPRequest, calendar.ITIPPublish:
+			if existing == nil {
+				event := &calendar.Event{
+					ID:           calendar.NewEventID(),
+					CalendarID:   cal.ID,
+					UID:          incoming.UID,
+					RecurrenceID: incoming.RecurrenceID,
+					Created:      incoming.Created,
+					Modified:     incoming.Modified,
+				}
+				updateFromInvitation(event, incoming)
+				event.MarkSelf(self)
+				added = append(added, event)
+			} else {
+				updateFromInvitation(existing, incoming)
+				existing.MarkSelf(self)
+				updated = append(updated, existing)
+			}
+		case calendar.ITIPReply:
+			if existing != nil {
+				recordReplies(existing, incoming)
+				found = append(found, existing)
+			}
+		case calendar.ITIPCancel:
+			if existing != nil {
+				found = append(found, existing)
+			}
+		}
+	}
+
+	switch inv.Method {
+	case calendar.ITIPReply:
+		if len(found) == 0 {
+			return invitationPlan{text: "The meeting this reply is for is not in " + cal.Name + "."}
+		}
+		var replies []string
+		for _, a := range inv.Events[0].Attendees {
+			replies = append(replies, a.DisplayName()+" "+participationText(a.Status))
+		}
+		return invitationPlan{
+			text: "Records the reply in " + cal.Name + ": " + strings.Join(replies, ", ") + ".",
+			apply: func() {
+				for _, e := range found {
+					app.saveEventChange(e, false, e.CalendarID)
+				}
+			},
+		}
+
+	case calendar.ITIPCancel:
+		if len(found) == 0 {
+			return invitationPlan{text: "This meeting is not in " + cal.Name + "."}
+		}
+		return invitationPlan{
+			text: fmt.Sprintf("Removes %s from %s.", eventCount(len(found), "the meeting"), cal.Name),
+			apply: func() {
+				for _, e := range found {
+					app.deleteEventChange(e.CalendarID, e.ID)
+				}
+			},
+		}
+	}
+
+	var parts []string
+	if len(added) > 0 {
+		parts = append(parts, "Adds "+eventCount(len(added), "the event")+" to "+cal.Name)
+	}
+	if len(updated) > 0 {
+		parts = append(parts, "Updates "+eventCount(len(updated), "the event")+" in "+cal.Name)
+	}
+	return invitationPlan{
+		text: strings.Join(parts, "; ") + ".",
+		apply: func() {
+			for _, e := range added {
+				app.saveEventChange(e, true, "")
+			}
+			for _, e := range updated {
+				app.saveEventChange(e, false, e.CalendarID)
+			}
+		},
+	}
+}
+
+// eventCount names one event as single, or counts several
+func eventCount(n int, single string) string {
+	if n == 1 {
+		return single
+	}
+	return fmt.Sprintf("%d events", n)
+}
+
+// updateFromInvitation copies the details an organizer sent into the copy of
+// an event in a calendar, keeping its local settings
+func updateFromInvitation(existing, incoming *calendar.Event) {
+	existing.Title = incoming.Title
+	existing.Description = incoming.Description
+	existing.Location = incoming.Location
+	existing.Start = incoming.Start
+	existing.End = incoming.End
+	existing.AllDay = incoming.AllDay
+	existing.TimeZone = incoming.TimeZone
+	existing.EndTimeZone = incoming.EndTimeZone
+	existing.Floating = incoming.Floating
+	existing.Organizer = nil
+	if incoming.Organizer != nil {
+		organizer := *incoming.Organizer
+		existing.Organizer = &organizer
+	}
+	existing.Attendees = append([]calendar.Attendee(nil), incoming.Attendees...)
+	existing.Status = incoming.Status
+	existing.Cancelled = incoming.Cancelled
+}
+
+// recordReplies sets the status of the attendees who replied to an event
+func recordReplies(existing, reply *calendar.Event) {
+	for _, r := range reply.Attendees {
+		for i := range existing.Attendees {
+			if strings.EqualFold(existing.Attendees[i].Email, r.Email) {
+				existing.Attendees[i].Status = r.Status
+			}
+		}
+	}
+}
+
+// invitationTitle describes what kind of message an invitation is
+func invitationTitle(inv *calendar.Invitation) string {
+	switch inv.Method {
+	case calendar.ITIPRequest:
+		return "Meeting Invitation"
+	case calendar.ITIPCancel:
+		return "Meeting Cancelled"
+	case calendar.ITIPReply:
+		return "Reply to Invitation"
+	default:
+		return "Event"
+	}
+}
+
+// defaultInvitationCalendar picks the calendar that already has an
+// invitation's event, or else one of the account it was sent to
+func (app *App) defaultInvitationCalendar(inv *calendar.Invitation, calendars []*calendar.Calendar) int {
+	for i, cal := range calendars {
+		for _, e := range inv.Events {
+			if existing, _ := app.store.GetEventByUID(cal.ID, e.UID, e.RecurrenceID); existing != nil {
+				return i
+			}
+		}
+	}
+	for i, cal := range calendars {
+		account, err := app.store.GetAccount(cal.AccountID)
+		if err != nil || account.Email == "" {
+			continue
+		}
+		for _, a := range inv.Events[0].Attendees {
+			if strings.EqualFold(a.Email, account.Email) {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// showInvitationDialog previews a meeting invitation, cancellation or reply
+// from an .ics file or an email saved as .eml, and applies it to a calendar
+func (app *App) showInvitationDialog(path string) {
+	dialog := gtk.NewDialog()
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(400, -1)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	cancelBtn := gtk.NewButtonWithLabel("Cancel")
+	cancelBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(cancelBtn)
+
+	inv, err := readInvitationFile(path)
+	if err != nil {
+		log.Printf("Error opening %s: %v", path, err)
+		dialog.SetTitle("Open Invitation")
+		errorLabel := gtk.NewLabel(err.Error())
+		errorLabel.SetXAlign(0)
+		errorLabel.SetWrap(true)
+		content.Append(errorLabel)
+		cancelBtn.SetLabel("Close")
+		content.Append(btnBox)
+		dialog.Show()
+		return
+	}
+	dialog.SetTitle(invitationTitle(inv))
+
+	// The events, in the zone the calendar is shown in
+	for _, event := range inv.Events {
+		shown := *event
+		shown.Start, shown.End = event.In(app.viewLocation())
+
+		title := gtk.NewLabel(shown.Title)
+		title.AddCSSClass("sc-event-title")
+		title.SetXAlign(0)
+		title.SetWrap(true)
+		content.Append(title)
+
+		when := shown.Start.Format("Monday, 2 January 2006")
+		if !shown.AllDay {
+			when += ", " + app.timeRangeText(shown.Start, shown.End) + " " + zoneName(shown.Start)
+		}
+		if shown.Cancelled {
+			when += " (cancelled)"
+		}
+		whenLabel := gtk.NewLabel(when)
+		whenLabel.SetXAlign(0)
+		whenLabel.SetTooltipText(app.eventTooltip(&shown))
+		content.Append(whenLabel)
+
+		if shown.Location != "" {
+			locLabel := gtk.NewLabel(shown.Location)
+			locLabel.AddCSSClass("dim-label")
+			locLabel.SetXAlign(0)
+			locLabel.SetWrap(true)
+			content.Append(locLabel)
+		}
+		if summary := guestSummary(&shown); summary != "" {
+			guestLabel := gtk.NewLabel(summary)
+			guestLabel.AddCSSClass("dim-label")
+			guestLabel.SetXAlign(0)
+			guestLabel.SetWrap(true)
+			content.Append(guestLabel)
+		}
+	}
+
+	calLabel := gtk.NewLabel("Calendar:")
+	calLabel.SetXAlign(0)
+	calLabel.SetMarginTop(8)
+	content.Append(calLabel)
+
+	calCombo := gtk.NewComboBoxText()
+	allCalendars, _ := app.store.GetAllCalendars()
+	var calendars []*calendar.Calendar
+	for _, cal := range allCalendars {
+		if !cal.ReadOnly {
+			calendars = append(calendars, cal)
+			calCombo.AppendText(cal.Name)
+		}
+	}
+	content.Append(calCombo)
+
+	planLabel := gtk.NewLabel("")
+	planLabel.AddCSSClass("dim-label")
+	planLabel.SetXAlign(0)
+	planLabel.SetWrap(true)
+	content.Append(planLabel)
+
+	applyBtn := gtk.NewButtonWithLabel("Apply")
+	applyBtn.AddCSSClass("suggested-action")
+	btnBox.Append(applyBtn)
+	content.Append(btnBox)
+
+	var plan invitationPlan
+	updatePlan := func() {
+		plan = invitationPlan{text: "No calendar to add events to."}
+		if i := calCombo.Active(); i >= 0 && i < len(calendars) {
+			plan = app.planInvitation(inv, calendars[i])
+		}
+		planLabel.SetText(plan.text)
+		applyBtn.SetSensitive(plan.apply != nil)
+	}
+	calCombo.Connect("changed", updatePlan)
+	if len(calendars) > 0 {
+		calCombo.SetActive(app.defaultInvitationCalendar(inv, calendars))
+	}
+	updatePlan()
+
+	applyBtn.ConnectClicked(func() {
+		apply := plan.apply
+		dialog.Close()
+
+		go func() {
+			apply()
+			glib.IdleAdd(func() {
+				app.refreshMonthView()
+				app.refreshDayDetail()
+			})
+		}()
+	})
+
+	dialog.Show()
+}
+
+// openFile opens a file given on the command line or by the desktop:
+// scheduling messages such as meeting invites are previewed as invitations,
+// other calendar files are imported
+func (app *App) openFile(path string) {
+	if strings.EqualFold(filepath.Ext(path), ".eml") {
+		app.showInvitationDialog(path)
+		return
+	}
+	if inv, err := readInvitationFile(path); err != nil || inv.Method == calendar.ITIPPublish {
+		app.showImportDialog(path)
+		return
+	}
+	app.showInvitationDialog(path)
+}
+
+// readInvitationFile reads an invitation from an .ics or .eml file
+func readInvitationFile(path string) (*calendar.Invitation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return calendar.ReadInvitation(f)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/djwarf/switchcal/internal/config"
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+)
+
+// runLogin implements "switchcal login", which signs an account in with a
+// device code so machines without a browser can be set up over SSH. It
+// returns the process exit code.
+func runLogin(args []string) int {
+	flags := flag.NewFlagSet("login", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: switchcal login [options] <provider>")
+		fmt.Fprintln(os.Stderr, "\nSigns in with a code entered on any device with a browser.")
+		fmt.Fprintln(os.Stderr, "\nProviders:")
+		for _, reg := range providers.Registered() {
+			if reg.DeviceSignIn != nil {
+				fmt.Fprintf(os.Stderr, "  %-10s %s\n", reg.Type, reg.DisplayName)
+			}
+		}
+		fmt.Fprintln(os.Stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	accountRef := flags.String("account", "", "sign an existing account in again (ID or email address)")
+	clientID := flags.String("client-id", "", "OAuth client ID to use instead of the configured one")
+	clientSecret := flags.String("client-secret", "", "OAuth client secret for -client-id")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to load config: %v\n", err)
+		cfg = config.DefaultConfig()
+	}
+	applyOAuthClients(cfg)
+
+	store, err := calendar.NewStore(cfg.DatabasePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	secretStore, err := openSecretStoreCLI(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open credential storage: %v\n", err)
+		return 1
+	}
+	if err := store.SetSecretStore(secretStore); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to move credentials to secure storage: %v\n", err)
+	}
+	if err := applyOAuthClientSecrets(cfg, secretStore); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	var account *calendar.Account
+	if *accountRef != "" {
+		if account, err = findAccount(store, *accountRef); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	} else {
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return 2
+		}
+		account = &calendar.Account{Type: calendar.AccountType(strings.ToLower(flags.Arg(0)))}
+	}
+	if *clientID != "" {
+		account.ClientID = *clientID
+		account.ClientSecret = *clientSecret
+	}
+
+	reg, ok := providers.Lookup(account.Type)
+	if !ok || reg.DeviceSignIn == nil {
+		fmt.Fprintf(os.Stderr, "Device sign-in is not supported for %q; add the account from the SwitchCal window instead\n", account.Type)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	err = reg.DeviceSignIn(ctx, account, func(code *providers.DeviceCode) {
+		fmt.Printf("On any device, open %s\nand enter the code: %s\n", code.VerificationURI, code.UserCode)
+		if code.VerificationURIComplete != "" {
+			fmt.Printf("(or open %s)\n", code.VerificationURIComplete)
+		}
+		fmt.Printf("Waiting for approval until %s...\n", code.Expires.Local().Format(cfg.TimeFormat()))
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Sign-in failed: %v\n", err)
+		return 1
+	}
+
+	initSignedInAccount(account)
+	if err := store.SaveAccount(account); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save account: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Signed in as %s.\n", account.Email)
+
+	// Fetch the account's calendars right away so it is usable without the GUI
+	provider, err := providers.New(account)
+	if err != nil || provider == nil {
+		return 0
+	}
+	start := time.Now().AddDate(0, -1, 0)
+	end := time.Now().AddDate(0, 6, 0)
+	results, err := providers.SyncAccount(ctx, provider, store, start, end)
+	for _, r := range results {
+		store.SaveSyncRecord(r.Record())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Initial sync failed: %v\n", err)
+		return 1
+	}
+	if err := store.SaveAccount(account); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save account: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Synced %d calendars.\n", len(results))
+	return 0
+}
+
+// findAccount looks up an account by ID or email address
+func findAccount(store *calendar.Store, ref string) (*calendar.Account, error) {
+	accounts, err := store.GetAllAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load accounts: %w", err)
+	}
+	for _, a := range accounts {
+		if a.ID == ref || strings.EqualFold(a.Email, ref) {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("no account %q", ref)
+}
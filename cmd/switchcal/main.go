@@ -1,14 +1,11 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
 	"os/exec"
 	"runtime"
@@ -18,11 +15,17 @@ import (
 	"time"
 
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/djwarf/switchcal/internal/config"
 	"github.com/djwarf/switchcal/pkg/calendar"
-	"github.com/djwarf/switchcal/pkg/providers/caldav"
+	"github.com/djwarf/switchcal/pkg/providers"
+	_ "github.com/djwarf/switchcal/pkg/providers/caldav"
+	"github.com/djwarf/switchcal/pkg/providers/gnome"
+	"github.com/djwarf/switchcal/pkg/providers/google"
+	"github.com/djwarf/switchcal/pkg/providers/microsoft"
+	calsync "github.com/djwarf/switchcal/pkg/sync"
 )
 
 // Custom CSS theme for SwitchCal
@@ -49,6 +52,11 @@ const switchcalCSS = `
     background: none;
     background-color: transparent;
 }
+.sc-sync-status {
+    font-size: 11px;
+    color: @sc_muted;
+    padding: 4px 8px;
+}
 .sc-sidebar scrolledwindow {
     background: none;
     background-color: transparent;
@@ -77,6 +85,11 @@ const switchcalCSS = `
 .sc-cal-name {
     font-size: 13px;
 }
+.sc-new-calendar {
+    font-size: 12px;
+    color: @sc_muted;
+    padding: 2px 4px;
+}
 
 /* ── Month header ── */
 .sc-header {
@@ -210,11 +223,29 @@ const switchcalCSS = `
     color: @sc_muted;
     margin-top: 2px;
 }
+.sc-event-secondary-time {
+    font-style: italic;
+}
 .sc-event-location {
     font-size: 12px;
     color: @sc_muted;
     margin-top: 2px;
 }
+.sc-event-pending {
+    font-size: 11px;
+    font-weight: 600;
+    color: @sc_muted;
+    margin-top: 4px;
+}
+.sc-event-pending.sc-failed {
+    color: @error_color;
+}
+.sc-declined {
+    opacity: 0.5;
+}
+.sc-declined .sc-event-title {
+    text-decoration: line-through;
+}
 .sc-add-event-day {
     border-radius: 8px;
     padding: 8px;
@@ -233,36 +264,38 @@ const switchcalCSS = `
     min-width: 4px;
     margin-right: 10px;
 }
+
+/* ── Undo toast ── */
+.sc-toast {
+    background: @theme_bg_color;
+    border: 1px solid @sc_border;
+    border-radius: 8px;
+    padding: 6px 6px 6px 14px;
+    margin-bottom: 16px;
+    box-shadow: 0 2px 8px alpha(black, 0.25);
+}
 `
 
-// Google OAuth configuration
-const (
-	googleClientID     = "707683257072-qhapb7fq21cc2too73ovopdobrpigdr9.apps.googleusercontent.com"
-	googleClientSecret = "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"
-	googleAuthURL      = "https://accounts.google.com/o/oauth2/v2/auth"
-	googleTokenURL     = "https://oauth2.googleapis.com/token"
-	googleCalDAVURL    = "https://apidata.googleusercontent.com/caldav/v2/"
-	googleScope        = "https://www.googleapis.com/auth/calendar https://www.googleapis.com/auth/userinfo.email"
-	redirectPort       = 8085
-)
+// browserSignInTimeout is how long to wait for a browser sign-in
+const browserSignInTimeout = 5 * time.Minute
 
 // App holds the application state
 type App struct {
-	config    *config.Config
-	store     *calendar.Store
-	window    *gtk.ApplicationWindow
+	config *config.Config
+	store  *calendar.Store
+	window *gtk.ApplicationWindow
 
 	// UI components
-	sidebar       *gtk.Box
-	sidebarSep    *gtk.Separator
-	calendarList  *gtk.ListBox
-	monthBox      *gtk.Box
-	monthView     *gtk.Grid
-	monthLabel    *gtk.Label
-	dayDetail     *gtk.Box
-	contentPaned  *gtk.Paned
-	sidebarBtn    *gtk.ToggleButton
-	detailBtn     *gtk.ToggleButton
+	sidebar      *gtk.Box
+	sidebarSep   *gtk.Separator
+	calendarList *gtk.ListBox
+	monthBox     *gtk.Box
+	monthView    *gtk.Grid
+	monthLabel   *gtk.Label
+	dayDetail    *gtk.Box
+	contentPaned *gtk.Paned
+	sidebarBtn   *gtk.ToggleButton
+	detailBtn    *gtk.ToggleButton
 
 	// Day cell tracking for efficient updates
 	dayWidgets        map[int]*gtk.Button // day number -> button widget
@@ -283,9 +316,23 @@ type App struct {
 	// Calendar color cache (calendarID → hex color)
 	calendarColors map[string]string
 
-	// Background sync
-	syncTicker *time.Ticker
-	syncDone   chan struct{}
+	// Events with changes waiting in the outbox (eventID → latest change)
+	pendingEvents map[string]*calendar.PendingChange
+
+	// Events changed both locally and on the server (eventID → conflict)
+	conflicts    map[string]*calendar.Conflict
+	conflictsBtn *gtk.Button
+
+	// Background sync, started once credentials are available
+	syncEngine  *calsync.Engine
+	syncMonitor *calsync.Monitor // Pauses syncing while offline or asleep
+	syncStatus  *gtk.Label
+
+	// Toast offering to undo the last deletion
+	toast        *gtk.Revealer
+	toastLabel   *gtk.Label
+	toastUndo    func()
+	toastTimeout glib.SourceHandle
 }
 
 // WaybarOutput is the JSON structure for waybar custom modules
@@ -302,8 +349,36 @@ func main() {
 		return
 	}
 
-	app := gtk.NewApplication("com.djwarf.switchcal", 0)
-	app.ConnectActivate(func() { activate(app) })
+	// Device sign-in from a terminal
+	if len(os.Args) > 1 && os.Args[1] == "login" {
+		os.Exit(runLogin(os.Args[2:]))
+	}
+
+	// Import .ics files from a terminal
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+
+	// Files given on the command line or opened from the desktop, such as
+	// meeting invites, are passed to the running instance
+	app := gtk.NewApplication("com.djwarf.switchcal", gio.ApplicationHandlesOpen)
+	var ui *App
+	app.ConnectActivate(func() {
+		if ui != nil {
+			ui.window.Present()
+			return
+		}
+		ui = activate(app)
+	})
+	app.ConnectOpen(func(files []gio.Filer, hint string) {
+		if ui == nil {
+			ui = activate(app)
+		}
+		ui.window.Present()
+		for _, f := range files {
+			ui.openFile(f.Path())
+		}
+	})
 
 	if code := app.Run(os.Args); code > 0 {
 		os.Exit(code)
@@ -379,7 +454,24 @@ func runWaybarMode() {
 	json.NewEncoder(os.Stdout).Encode(output)
 }
 
-func activate(gtkApp *gtk.Application) {
+// applyOAuthClients makes the OAuth clients set in the configuration the
+// default for accounts without their own
+func applyOAuthClients(cfg *config.Config) {
+	if cfg.GoogleClientID != "" {
+		google.DefaultOAuthConfig = &google.OAuthConfig{
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+		}
+	}
+	if cfg.MicrosoftClientID != "" || cfg.MicrosoftTenant != "" {
+		microsoft.DefaultOAuthConfig = &microsoft.OAuthConfig{
+			ClientID: cfg.MicrosoftClientID,
+			Tenant:   cfg.MicrosoftTenant,
+		}
+	}
+}
+
+func activate(gtkApp *gtk.Application) *App {
 	// Load config
 	cfg, err := config.Load()
 	if err != nil {
@@ -387,6 +479,8 @@ func activate(gtkApp *gtk.Application) {
 		cfg = config.DefaultConfig()
 	}
 
+	applyOAuthClients(cfg)
+
 	// Open store
 	store, err := calendar.NewStore(cfg.DatabasePath())
 	if err != nil {
@@ -407,55 +501,26 @@ func activate(gtkApp *gtk.Application) {
 	// Close database and stop background sync on app shutdown
 	gtkApp.ConnectShutdown(func() {
 		log.Printf("App shutting down, closing database...")
-		if app.syncTicker != nil {
-			app.syncTicker.Stop()
-			close(app.syncDone)
+		if app.syncMonitor != nil {
+			app.syncMonitor.Close()
+		}
+		if app.syncEngine != nil {
+			app.syncEngine.Stop()
 		}
 		store.Close()
 	})
 
 	// Ensure a default local calendar exists
 	app.ensureDefaultCalendar()
+	app.purgeTrash()
 
 	app.buildUI(gtkApp)
 	app.loadCalendars()
 	app.refreshMonthView()
 
-	// Sync all Google accounts on startup
-	go app.syncAllAccounts()
-
-	// Start periodic background sync
-	if app.config.SyncIntervalSeconds > 0 {
-		interval := time.Duration(app.config.SyncIntervalSeconds) * time.Second
-		app.syncTicker = time.NewTicker(interval)
-		app.syncDone = make(chan struct{})
-		go func() {
-			for {
-				select {
-				case <-app.syncTicker.C:
-					app.syncAllAccounts()
-				case <-app.syncDone:
-					return
-				}
-			}
-		}()
-		log.Printf("Background sync enabled: every %ds", app.config.SyncIntervalSeconds)
-	}
-}
-
-// syncAllAccounts syncs calendars from all configured accounts
-func (app *App) syncAllAccounts() {
-	accounts, err := app.store.GetAllAccounts()
-	if err != nil {
-		log.Printf("Error loading accounts for sync: %v", err)
-		return
-	}
-
-	for _, account := range accounts {
-		if account.Type == calendar.AccountTypeGoogle && account.AccessToken != "" {
-			app.syncCalDAVAccount(account)
-		}
-	}
+	// Credentials are needed before anything can sync
+	app.openSecretStore(app.startSync)
+	return app
 }
 
 // ensureDefaultCalendar creates a default local calendar if none exist
@@ -548,7 +613,12 @@ func (app *App) buildUI(gtkApp *gtk.Application) {
 
 	mainBox.Append(app.contentPaned)
 
-	app.window.SetChild(mainBox)
+	// The undo toast floats over the bottom of the window
+	overlay := gtk.NewOverlay()
+	overlay.SetChild(mainBox)
+	app.toast = app.buildToast()
+	overlay.AddOverlay(app.toast)
+	app.window.SetChild(overlay)
 
 	// Handle window resize for responsive layout
 	app.window.Object.NotifyProperty("default-width", func() {
@@ -581,6 +651,47 @@ func (app *App) buildSidebar() *gtk.Box {
 	})
 	sidebar.Append(addBtn)
 
+	// Account management button
+	statusBtn := gtk.NewButtonWithLabel("Accounts")
+	statusBtn.AddCSSClass("sc-add-account")
+	statusBtn.ConnectClicked(func() {
+		app.showAccountsDialog()
+	})
+	sidebar.Append(statusBtn)
+
+	// Import events from an .ics file
+	importBtn := gtk.NewButtonWithLabel("Import…")
+	importBtn.AddCSSClass("sc-add-account")
+	importBtn.ConnectClicked(func() {
+		app.showImportDialog("")
+	})
+	sidebar.Append(importBtn)
+
+	// Export the events between two dates to an .ics file
+	exportBtn := gtk.NewButtonWithLabel("Export Range…")
+	exportBtn.AddCSSClass("sc-add-account")
+	exportBtn.ConnectClicked(func() {
+		app.showExportRangeDialog()
+	})
+	sidebar.Append(exportBtn)
+
+	// Deleted events, until they are purged
+	trashBtn := gtk.NewButtonWithLabel("Trash")
+	trashBtn.AddCSSClass("sc-add-account")
+	trashBtn.ConnectClicked(func() {
+		app.showTrashDialog()
+	})
+	sidebar.Append(trashBtn)
+
+	// Shown while sync conflicts wait to be resolved
+	app.conflictsBtn = gtk.NewButtonWithLabel("Resolve Conflicts")
+	app.conflictsBtn.AddCSSClass("sc-add-account")
+	app.conflictsBtn.SetVisible(false)
+	app.conflictsBtn.ConnectClicked(func() {
+		app.showConflictsDialog()
+	})
+	sidebar.Append(app.conflictsBtn)
+
 	// Calendar list
 	scrolled := gtk.NewScrolledWindow()
 	scrolled.SetVExpand(true)
@@ -593,6 +704,24 @@ func (app *App) buildSidebar() *gtk.Box {
 	scrolled.SetChild(app.calendarList)
 	sidebar.Append(scrolled)
 
+	// Declined invitations are dimmed unless hidden altogether
+	hideDeclined := gtk.NewCheckButtonWithLabel("Hide declined events")
+	hideDeclined.SetActive(app.config.HideDeclined)
+	hideDeclined.ConnectToggled(func() {
+		app.config.HideDeclined = hideDeclined.Active()
+		if err := app.config.Save(); err != nil {
+			log.Printf("Error saving config: %v", err)
+		}
+		app.scheduleRefresh()
+	})
+	sidebar.Append(hideDeclined)
+
+	app.syncStatus = gtk.NewLabel("")
+	app.syncStatus.AddCSSClass("sc-sync-status")
+	app.syncStatus.SetXAlign(0)
+	app.syncStatus.SetEllipsize(3) // PANGO_ELLIPSIZE_END
+	sidebar.Append(app.syncStatus)
+
 	return sidebar
 }
 
@@ -637,8 +766,8 @@ func (app *App) buildMonthView() *gtk.Box {
 	todayBtn := gtk.NewButtonWithLabel("Today")
 	todayBtn.AddCSSClass("sc-today-btn")
 	todayBtn.ConnectClicked(func() {
-		app.currentDate = time.Now()
-		app.selectedDate = time.Now()
+		app.currentDate = time.Now().In(app.viewLocation())
+		app.selectedDate = app.currentDate
 		app.refreshMonthView()
 		app.refreshDayDetail()
 	})
@@ -653,6 +782,15 @@ func (app *App) buildMonthView() *gtk.Box {
 	headerBox.Append(todayBtn)
 	headerBox.Append(app.monthLabel)
 
+	// Time zone switch, e.g. to see the calendar in local time while travelling
+	zoneBtn := gtk.NewButtonWithLabel(app.zoneButtonText())
+	zoneBtn.AddCSSClass("sc-today-btn")
+	zoneBtn.SetTooltipText("Time zones")
+	zoneBtn.ConnectClicked(func() {
+		app.showTimeZoneDialog(zoneBtn)
+	})
+	headerBox.Append(zoneBtn)
+
 	// Add event button
 	addEventBtn := gtk.NewButtonWithLabel("+ Event")
 	addEventBtn.AddCSSClass("sc-add-event-btn")
@@ -706,14 +844,17 @@ func (app *App) buildDayDetail() *gtk.Box {
 func (app *App) refreshMonthView() {
 	// Run database query in background to avoid blocking UI
 	go func() {
-		// Get first day of month
-		firstOfMonth := time.Date(app.currentDate.Year(), app.currentDate.Month(), 1, 0, 0, 0, 0, app.currentDate.Location())
+		// Get first day of month, in the zone the calendar is shown in
+		firstOfMonth := time.Date(app.currentDate.Year(), app.currentDate.Month(), 1, 0, 0, 0, 0, app.viewLocation())
 		lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
 
 		// Get events for this month (background thread)
 		monthStart := firstOfMonth
 		monthEnd := lastOfMonth.Add(24 * time.Hour)
 		events, _ := app.store.GetEventsInRange(monthStart, monthEnd)
+		events = app.visibleEvents(events)
+		pending := app.loadPendingEvents()
+		conflicts := app.loadConflicts()
 
 		// Create event map by date
 		eventsByDate := make(map[string][]*calendar.Event)
@@ -724,6 +865,9 @@ func (app *App) refreshMonthView() {
 
 		// Update UI on main thread
 		glib.IdleAdd(func() {
+			app.pendingEvents = pending
+			app.conflicts = conflicts
+			app.updateConflictsButton()
 			app.updateMonthViewWithEvents(eventsByDate)
 		})
 	}()
@@ -770,7 +914,7 @@ func (app *App) updateMonthViewWithEvents(eventsByDate map[string][]*calendar.Ev
 	daysInMonth := lastOfMonth.Day()
 
 	// Fill in days
-	today := time.Now()
+	today := time.Now().In(app.viewLocation())
 	row := 1
 	col := weekday
 
@@ -841,6 +985,17 @@ func (app *App) createDayCell(day int, date time.Time, events []*calendar.Event,
 		pill.SetXAlign(0)
 		pill.SetEllipsize(3) // PANGO_ELLIPSIZE_END
 		pill.AddCSSClass("sc-event-pill")
+		pill.SetTooltipText(app.eventTooltip(event))
+		if declined(event) {
+			pill.AddCSSClass("sc-declined")
+		}
+		if _, ok := app.conflicts[event.ID]; ok {
+			pill.SetText("⇄ " + truncate(event.Title, 10))
+			pill.SetTooltipText("Changed here and on the server")
+		} else if change, ok := app.pendingEvents[event.ID]; ok {
+			pill.SetText(pendingMark(change) + truncate(event.Title, 10))
+			pill.SetTooltipText(app.pendingText(change))
+		}
 
 		// Apply calendar color as inline CSS
 		color := app.calendarColors[event.CalendarID]
@@ -908,16 +1063,23 @@ func (app *App) refreshDayDetail() {
 	// Capture selected date to avoid race conditions
 	selectedDate := app.selectedDate
 
-	// Fetch events in background
+	// Fetch events in background, in the zone the calendar is shown in
+	day := time.Date(selectedDate.Year(), selectedDate.Month(), selectedDate.Day(), 0, 0, 0, 0, app.viewLocation())
 	go func() {
-		events, err := app.store.GetEventsForDate(selectedDate)
+		events, err := app.store.GetEventsForDate(day)
 		if err != nil {
 			log.Printf("Error loading events: %v", err)
 			events = []*calendar.Event{}
 		}
+		events = app.visibleEvents(events)
+		pending := app.loadPendingEvents()
+		conflicts := app.loadConflicts()
 
 		// Update UI on main thread
 		glib.IdleAdd(func() {
+			app.pendingEvents = pending
+			app.conflicts = conflicts
+			app.updateConflictsButton()
 			app.updateDayDetailWithEvents(selectedDate, events)
 		})
 	}()
@@ -969,6 +1131,9 @@ func (app *App) createEventCard(event *calendar.Event) *gtk.Box {
 	// Outer horizontal box: color stripe + content
 	card := gtk.NewBox(gtk.OrientationHorizontal, 0)
 	card.AddCSSClass("sc-event-card")
+	if declined(event) {
+		card.AddCSSClass("sc-declined")
+	}
 
 	// Color stripe
 	color := app.calendarColors[event.CalendarID]
@@ -994,12 +1159,24 @@ func (app *App) createEventCard(event *calendar.Event) *gtk.Box {
 	if event.AllDay {
 		timeStr = "All day"
 	} else {
-		timeStr = event.Start.Format(app.config.TimeFormat()) + " — " + event.End.Format(app.config.TimeFormat())
+		timeStr = app.timeRangeText(event.Start, event.End)
 	}
 	timeLabel := gtk.NewLabel(timeStr)
 	timeLabel.AddCSSClass("sc-event-time")
 	timeLabel.SetXAlign(0)
-	content.Append(timeLabel)
+	timeLabel.SetHExpand(true)
+
+	// Times in the secondary zone form a second column
+	timeRow := gtk.NewBox(gtk.OrientationHorizontal, 12)
+	timeRow.Append(timeLabel)
+	if text := app.secondaryTimeText(event); text != "" {
+		secondaryLabel := gtk.NewLabel(text)
+		secondaryLabel.AddCSSClass("sc-event-time")
+		secondaryLabel.AddCSSClass("sc-event-secondary-time")
+		secondaryLabel.SetXAlign(1)
+		timeRow.Append(secondaryLabel)
+	}
+	content.Append(timeRow)
 
 	if event.Location != "" {
 		locLabel := gtk.NewLabel(event.Location)
@@ -1008,7 +1185,45 @@ func (app *App) createEventCard(event *calendar.Event) *gtk.Box {
 		content.Append(locLabel)
 	}
 
+	if summary := guestSummary(event); summary != "" {
+		guestLabel := gtk.NewLabel(summary)
+		guestLabel.AddCSSClass("sc-event-location")
+		guestLabel.SetXAlign(0)
+		guestLabel.SetWrap(true)
+		content.Append(guestLabel)
+	}
+
+	if conflict, ok := app.conflicts[event.ID]; ok {
+		conflictBox := gtk.NewBox(gtk.OrientationHorizontal, 6)
+		conflictLabel := gtk.NewLabel("⇄ Changed here and on the server")
+		conflictLabel.AddCSSClass("sc-event-pending")
+		conflictLabel.AddCSSClass("sc-failed")
+		conflictLabel.SetXAlign(0)
+		conflictLabel.SetHExpand(true)
+		conflictBox.Append(conflictLabel)
+
+		resolveBtn := gtk.NewButtonWithLabel("Resolve…")
+		resolveBtn.AddCSSClass("flat")
+		resolveBtn.ConnectClicked(func() {
+			app.showConflictDialog(conflict, nil)
+		})
+		conflictBox.Append(resolveBtn)
+		content.Append(conflictBox)
+	} else if change, ok := app.pendingEvents[event.ID]; ok {
+		pendingLabel := gtk.NewLabel(pendingMark(change) + app.pendingText(change))
+		pendingLabel.AddCSSClass("sc-event-pending")
+		if change.Failed() {
+			pendingLabel.AddCSSClass("sc-failed")
+			pendingLabel.SetTooltipText(change.LastError)
+		}
+		pendingLabel.SetXAlign(0)
+		pendingLabel.SetWrap(true)
+		content.Append(pendingLabel)
+	}
+
+	content.SetHExpand(true)
 	card.Append(content)
+	card.SetTooltipText(app.eventTooltip(event))
 
 	// Click to edit/delete
 	click := gtk.NewGestureClick()
@@ -1021,6 +1236,31 @@ func (app *App) createEventCard(event *calendar.Event) *gtk.Box {
 	return card
 }
 
+// loadPendingEvents returns the events with changes waiting to be uploaded
+func (app *App) loadPendingEvents() map[string]*calendar.PendingChange {
+	pending, err := app.store.GetPendingEvents()
+	if err != nil {
+		log.Printf("Error loading pending changes: %v", err)
+	}
+	return pending
+}
+
+// pendingMark returns the badge prefixed to events with changes waiting to be uploaded
+func pendingMark(change *calendar.PendingChange) string {
+	if change.Failed() {
+		return "⚠ "
+	}
+	return "↑ "
+}
+
+// pendingText describes a change waiting to be uploaded
+func (app *App) pendingText(change *calendar.PendingChange) string {
+	if change.Failed() {
+		return "Upload failed, retrying at " + change.NextAttempt.Local().Format(app.config.TimeFormat())
+	}
+	return "Waiting to upload"
+}
+
 func (app *App) loadCalendars() {
 	// Clear existing
 	for {
@@ -1072,25 +1312,55 @@ func (app *App) loadCalendars() {
 			continue
 		}
 
-		// Create expander for this account
-		expander := gtk.NewExpander(account.Name)
-		expander.SetExpanded(true)
+		// Create expander for this account; disabled accounts start collapsed
+		title := account.Name
+		if !account.Enabled {
+			title += " (disabled)"
+		}
+		expander := gtk.NewExpander(title)
+		expander.SetExpanded(account.Enabled)
 
 		// Box to hold calendars
 		calBox := gtk.NewBox(gtk.OrientationVertical, 2)
 		calBox.SetMarginStart(12)
 
+		canCreate, canEdit := app.calendarActions(account)
+
 		for _, cal := range cals {
-			row := app.createCalendarRow(cal)
+			row := app.createCalendarRow(account, cal, canCreate, canEdit)
 			calBox.Append(row)
 		}
 
+		// Offer calendar creation where the provider supports it
+		if canCreate {
+			newCalBtn := gtk.NewButtonWithLabel("+ New Calendar")
+			newCalBtn.SetHasFrame(false)
+			newCalBtn.SetHAlign(gtk.AlignStart)
+			newCalBtn.AddCSSClass("sc-new-calendar")
+			newCalBtn.ConnectClicked(func() {
+				app.showCalendarDialog(account, nil)
+			})
+			calBox.Append(newCalBtn)
+		}
+
 		expander.SetChild(calBox)
 		app.calendarList.Append(expander)
 	}
 }
 
-func (app *App) createCalendarRow(cal *calendar.Calendar) *gtk.Box {
+// calendarActions reports whether calendars can be created on and edited in an
+// account. Local calendars live only in the Store and support both.
+func (app *App) calendarActions(account *calendar.Account) (canCreate, canEdit bool) {
+	if reg, ok := providers.Lookup(account.Type); ok && !reg.IsRemote() {
+		return true, true
+	}
+	provider := app.accountProvider(account)
+	_, canCreate = provider.(providers.CalendarCreator)
+	_, canEdit = provider.(providers.CalendarEditor)
+	return canCreate, canEdit
+}
+
+func (app *App) createCalendarRow(account *calendar.Account, cal *calendar.Calendar, canCreate, canEdit bool) *gtk.Box {
 	row := gtk.NewBox(gtk.OrientationHorizontal, 8)
 	row.SetMarginTop(4)
 	row.SetMarginBottom(4)
@@ -1127,9 +1397,285 @@ func (app *App) createCalendarRow(cal *calendar.Calendar) *gtk.Box {
 	name.SetEllipsize(3) // PANGO_ELLIPSIZE_END
 	row.Append(name)
 
+	// Right-click for calendar management actions
+	menuClick := gtk.NewGestureClick()
+	menuClick.SetButton(3) // GDK_BUTTON_SECONDARY
+	menuClick.ConnectPressed(func(nPress int, x, y float64) {
+		app.showCalendarMenu(row, account, cal, canCreate, canEdit)
+	})
+	row.AddController(menuClick)
+
 	return row
 }
 
+// showCalendarMenu shows the context menu of a sidebar calendar row
+func (app *App) showCalendarMenu(row *gtk.Box, account *calendar.Account, cal *calendar.Calendar, canCreate, canEdit bool) {
+	popover := gtk.NewPopover()
+	popover.SetParent(row)
+	popover.SetHasArrow(false)
+
+	menu := gtk.NewBox(gtk.OrientationVertical, 0)
+	addItem := func(label string, action func()) {
+		text := gtk.NewLabel(label)
+		text.SetXAlign(0)
+		btn := gtk.NewButton()
+		btn.SetChild(text)
+		btn.SetHasFrame(false)
+		btn.ConnectClicked(func() {
+			popover.Popdown()
+			action()
+		})
+		menu.Append(btn)
+	}
+
+	if canCreate {
+		addItem("New Calendar…", func() { app.showCalendarDialog(account, nil) })
+	}
+	if canEdit && !cal.ReadOnly {
+		addItem("Rename or Recolour…", func() { app.showCalendarDialog(account, cal) })
+		addItem("Delete…", func() { app.confirmDeleteCalendar(account, cal) })
+	}
+	if _, ok := app.accountProvider(account).(providers.TaskProvider); ok {
+		addItem("Tasks…", func() { app.showTasksDialog(account, cal) })
+	}
+	addItem("Export Calendar…", func() { app.exportCalendar(cal) })
+
+	popover.SetChild(menu)
+	popover.ConnectClosed(func() {
+		// Unparent once closed so the popover does not outlive its row
+		glib.IdleAdd(popover.Unparent)
+	})
+	popover.Popup()
+}
+
+// showCalendarDialog creates a calendar, or renames and recolours cal when it is not nil
+func (app *App) showCalendarDialog(account *calendar.Account, cal *calendar.Calendar) {
+	isNew := cal == nil
+	if isNew {
+		cal = &calendar.Calendar{
+			AccountID: account.ID,
+			Color:     "#4285f4",
+			Visible:   true,
+		}
+	}
+
+	dialog := gtk.NewDialog()
+	if isNew {
+		dialog.SetTitle("New Calendar")
+	} else {
+		dialog.SetTitle("Edit Calendar")
+	}
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(350, 200)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	accountLabel := gtk.NewLabel("Account: " + account.Name)
+	accountLabel.SetXAlign(0)
+	accountLabel.AddCSSClass("dim-label")
+	content.Append(accountLabel)
+
+	nameLabel := gtk.NewLabel("Name:")
+	nameLabel.SetXAlign(0)
+	content.Append(nameLabel)
+
+	nameEntry := gtk.NewEntry()
+	nameEntry.SetText(cal.Name)
+	nameEntry.SetPlaceholderText("Calendar name")
+	content.Append(nameEntry)
+
+	colorBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	colorLabel := gtk.NewLabel("Colour:")
+	colorLabel.SetXAlign(0)
+	colorBox.Append(colorLabel)
+	colorBtn := newColorButton(cal.Color)
+	colorBox.Append(colorBtn)
+	content.Append(colorBox)
+
+	statusLabel := gtk.NewLabel("")
+	statusLabel.SetXAlign(0)
+	statusLabel.SetWrap(true)
+	statusLabel.AddCSSClass("dim-label")
+	content.Append(statusLabel)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	cancelBtn := gtk.NewButtonWithLabel("Cancel")
+	cancelBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(cancelBtn)
+
+	saveBtn := gtk.NewButtonWithLabel("Save")
+	if isNew {
+		saveBtn.SetLabel("Create")
+	}
+	saveBtn.AddCSSClass("suggested-action")
+	saveBtn.ConnectClicked(func() {
+		name := strings.TrimSpace(nameEntry.Text())
+		if name == "" {
+			statusLabel.SetText("Please enter a name.")
+			return
+		}
+
+		updated := *cal
+		updated.Name = name
+		updated.Color = rgbaToHex(colorBtn.RGBA())
+
+		saveBtn.SetSensitive(false)
+		if isNew {
+			statusLabel.SetText("Creating calendar...")
+		} else {
+			statusLabel.SetText("Saving calendar...")
+		}
+
+		go func() {
+			err := app.withAccountProvider(account, func(ctx context.Context, p providers.Provider) error {
+				if isNew {
+					creator, ok := p.(providers.CalendarCreator)
+					if !ok {
+						return fmt.Errorf("%s does not support creating calendars", account.Name)
+					}
+					return creator.CreateCalendar(ctx, &updated)
+				}
+				editor, ok := p.(providers.CalendarEditor)
+				if !ok {
+					return fmt.Errorf("%s does not support editing calendars", account.Name)
+				}
+				return editor.UpdateCalendar(ctx, &updated)
+			})
+			if err == nil {
+				// Local calendars get their ID here; remote ones from the provider
+				if updated.ID == "" {
+					updated.ID = fmt.Sprintf("cal-%d", time.Now().UnixNano())
+				}
+				err = app.store.SaveCalendar(&updated)
+			}
+
+			glib.IdleAdd(func() {
+				if err != nil {
+					statusLabel.SetText("Error: " + err.Error())
+					saveBtn.SetSensitive(true)
+					return
+				}
+				app.loadCalendars()
+				app.refreshMonthView()
+				dialog.Close()
+			})
+		}()
+	})
+	btnBox.Append(saveBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+}
+
+// confirmDeleteCalendar asks before deleting a calendar and its events
+func (app *App) confirmDeleteCalendar(account *calendar.Account, cal *calendar.Calendar) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Delete Calendar")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(350, 150)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	message := gtk.NewLabel(fmt.Sprintf("Delete \"%s\" and all of its events?", cal.Name))
+	message.SetXAlign(0)
+	message.SetWrap(true)
+	content.Append(message)
+
+	if reg, ok := providers.Lookup(account.Type); ok && reg.IsRemote() {
+		note := gtk.NewLabel("The calendar will also be removed from " + account.Name + ".")
+		note.SetXAlign(0)
+		note.SetWrap(true)
+		note.AddCSSClass("dim-label")
+		content.Append(note)
+	}
+
+	statusLabel := gtk.NewLabel("")
+	statusLabel.SetXAlign(0)
+	statusLabel.SetWrap(true)
+	statusLabel.AddCSSClass("dim-label")
+	content.Append(statusLabel)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	cancelBtn := gtk.NewButtonWithLabel("Cancel")
+	cancelBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(cancelBtn)
+
+	deleteBtn := gtk.NewButtonWithLabel("Delete")
+	deleteBtn.AddCSSClass("destructive-action")
+	deleteBtn.ConnectClicked(func() {
+		deleteBtn.SetSensitive(false)
+		statusLabel.SetText("Deleting calendar...")
+
+		go func() {
+			err := app.withAccountProvider(account, func(ctx context.Context, p providers.Provider) error {
+				editor, ok := p.(providers.CalendarEditor)
+				if !ok {
+					return fmt.Errorf("%s does not support deleting calendars", account.Name)
+				}
+				return editor.DeleteCalendar(ctx, cal.ID)
+			})
+			if err == nil {
+				err = app.store.DeleteCalendar(cal.ID)
+			}
+
+			glib.IdleAdd(func() {
+				if err != nil {
+					statusLabel.SetText("Error: " + err.Error())
+					deleteBtn.SetSensitive(true)
+					return
+				}
+				app.loadCalendars()
+				app.refreshMonthView()
+				app.refreshDayDetail()
+				dialog.Close()
+			})
+		}()
+	})
+	btnBox.Append(deleteBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+}
+
+// newColorButton creates a colour picker initialised to a hex colour
+func newColorButton(hex string) *gtk.ColorButton {
+	rgba := gdk.NewRGBA(0, 0, 0, 1)
+	if !rgba.Parse(hex) {
+		rgba.Parse("#4285f4")
+	}
+	btn := gtk.NewColorButtonWithRGBA(&rgba)
+	btn.SetUseAlpha(false)
+	return btn
+}
+
+// rgbaToHex formats a colour as #rrggbb
+func rgbaToHex(c *gdk.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x",
+		int(c.Red()*255+0.5), int(c.Green()*255+0.5), int(c.Blue()*255+0.5))
+}
+
 func (app *App) showAddAccountDialog() {
 	dialog := gtk.NewDialog()
 	dialog.SetTitle("Add Calendar Account")
@@ -1144,90 +1690,88 @@ func (app *App) showAddAccountDialog() {
 	content.SetMarginEnd(12)
 	content.SetSpacing(12)
 
+	// Accounts that can be linked from GNOME Online Accounts
+	onlineBox := gtk.NewBox(gtk.OrientationVertical, 6)
+	content.Append(onlineBox)
+
 	// Account type selection
 	typeLabel := gtk.NewLabel("Account Type:")
 	typeLabel.SetXAlign(0)
 	content.Append(typeLabel)
 
+	regs := providers.Registered()
 	typeCombo := gtk.NewComboBoxText()
-	typeCombo.AppendText("Local Calendar")
-	typeCombo.AppendText("Google Calendar (CalDAV)")
-	typeCombo.AppendText("Apple iCloud (CalDAV)")
-	typeCombo.AppendText("CalDAV Server")
+	for _, reg := range regs {
+		typeCombo.AppendText(reg.DisplayName)
+	}
 	typeCombo.SetActive(0)
 	content.Append(typeCombo)
 
 	// Info label
-	infoLabel := gtk.NewLabel("Create a local calendar stored on this device.")
+	infoLabel := gtk.NewLabel("")
 	infoLabel.SetXAlign(0)
 	infoLabel.SetWrap(true)
 	infoLabel.AddCSSClass("dim-label")
 	content.Append(infoLabel)
 
-	// CalDAV fields container
-	caldavBox := gtk.NewBox(gtk.OrientationVertical, 8)
-	caldavBox.SetVisible(false)
-
-	// Server URL (for CalDAV)
-	serverLabel := gtk.NewLabel("Server URL:")
-	serverLabel.SetXAlign(0)
-	caldavBox.Append(serverLabel)
-	serverEntry := gtk.NewEntry()
-	serverEntry.SetPlaceholderText("https://caldav.example.com/")
-	caldavBox.Append(serverEntry)
-
-	// Username
-	userLabel := gtk.NewLabel("Username/Email:")
-	userLabel.SetXAlign(0)
-	caldavBox.Append(userLabel)
-	userEntry := gtk.NewEntry()
-	userEntry.SetPlaceholderText("user@example.com")
-	caldavBox.Append(userEntry)
-
-	// Password/App Password
-	passLabel := gtk.NewLabel("App Password:")
-	passLabel.SetXAlign(0)
-	caldavBox.Append(passLabel)
-	passEntry := gtk.NewEntry()
-	passEntry.SetVisibility(false)
-	passEntry.SetPlaceholderText("App-specific password")
-	caldavBox.Append(passEntry)
-
-	content.Append(caldavBox)
+	app.fillOnlineAccounts(onlineBox, dialog, infoLabel)
+
+	// Credential fields container, rebuilt for the selected provider
+	fieldsBox := gtk.NewBox(gtk.OrientationVertical, 8)
+	fieldsBox.SetVisible(false)
+	content.Append(fieldsBox)
+	fieldEntries := make(map[string]*gtk.Entry)
 
 	// Action button
-	actionBtn := gtk.NewButtonWithLabel("Create Local Calendar")
+	actionBtn := gtk.NewButtonWithLabel("")
 	actionBtn.AddCSSClass("suggested-action")
 	content.Append(actionBtn)
 
+	// Device sign-in for providers that otherwise open a browser
+	codeBtn := gtk.NewButtonWithLabel("Sign in with a code instead")
+	codeBtn.SetTooltipText("Approve the sign-in from another device, e.g. when no browser can be opened here")
+	content.Append(codeBtn)
+
 	// Update UI based on type selection
 	updateUI := func() {
-		active := typeCombo.Active()
-		switch active {
-		case 0: // Local
-			infoLabel.SetText("Create a local calendar stored on this device.")
-			infoLabel.SetVisible(true)
-			caldavBox.SetVisible(false)
-			actionBtn.SetLabel("Create Local Calendar")
-		case 1: // Google CalDAV
-			infoLabel.SetText("Sign in with your Google account to sync calendars.")
-			infoLabel.SetVisible(true)
-			caldavBox.SetVisible(false)
-			actionBtn.SetLabel("Sign in with Google")
-		case 2: // Apple iCloud
-			infoLabel.SetText("For Apple iCloud, you need an app-specific password.\nGo to appleid.apple.com → Security → App-Specific Passwords")
-			infoLabel.SetVisible(true)
-			caldavBox.SetVisible(true)
-			serverEntry.SetText("https://caldav.icloud.com/")
-			serverEntry.SetSensitive(false)
-			actionBtn.SetLabel("Connect Apple iCloud")
-		case 3: // CalDAV
-			infoLabel.SetText("Enter your CalDAV server details.")
-			infoLabel.SetVisible(true)
-			caldavBox.SetVisible(true)
-			serverEntry.SetText("")
-			serverEntry.SetSensitive(true)
-			actionBtn.SetLabel("Connect CalDAV")
+		reg := regs[typeCombo.Active()]
+		infoLabel.SetText(reg.Description)
+
+		for {
+			child := fieldsBox.FirstChild()
+			if child == nil {
+				break
+			}
+			fieldsBox.Remove(child)
+		}
+		fieldEntries = make(map[string]*gtk.Entry)
+
+		for _, field := range reg.Fields {
+			label := gtk.NewLabel(field.Label)
+			label.SetXAlign(0)
+			fieldsBox.Append(label)
+
+			entry := gtk.NewEntry()
+			entry.SetPlaceholderText(field.Placeholder)
+			entry.SetText(field.Default)
+			entry.SetSensitive(!field.Fixed)
+			entry.SetVisibility(!field.Secret)
+			fieldsBox.Append(entry)
+			fieldEntries[field.Key] = entry
+		}
+		fieldsBox.SetVisible(len(reg.Fields) > 0)
+		codeBtn.SetVisible(reg.DeviceSignIn != nil && reg.BrowserSignIn != nil)
+
+		switch reg.Auth {
+		case providers.AuthNone:
+			actionBtn.SetLabel("Create " + reg.DisplayName)
+		case providers.AuthOAuth:
+			actionBtn.SetLabel("Sign in with " + reg.ShortName)
+			if reg.BrowserSignIn == nil {
+				actionBtn.SetLabel("Sign in with a " + reg.ShortName + " code")
+			}
+		case providers.AuthPassword:
+			actionBtn.SetLabel("Connect " + reg.ShortName)
 		}
 	}
 
@@ -1238,16 +1782,42 @@ func (app *App) showAddAccountDialog() {
 	// Initial update
 	updateUI()
 
+	// oauthAccount prepares a new account from the fields of an OAuth provider
+	oauthAccount := func(reg *providers.Registration) *calendar.Account {
+		values := make(map[string]string)
+		for key, entry := range fieldEntries {
+			values[key] = entry.Text()
+		}
+
+		account := &calendar.Account{Type: reg.Type}
+		if err := reg.ApplyFields(account, values); err != nil {
+			infoLabel.SetText(err.Error())
+			return nil
+		}
+		if account.ClientSecret != "" && account.ClientID == "" {
+			infoLabel.SetText("Please enter the OAuth client ID for this client secret.")
+			return nil
+		}
+		return account
+	}
+
+	codeBtn.ConnectClicked(func() {
+		reg := regs[typeCombo.Active()]
+		if account := oauthAccount(reg); account != nil {
+			app.startDeviceSignIn(dialog, infoLabel, reg, account)
+		}
+	})
+
 	// Handle button click
 	actionBtn.ConnectClicked(func() {
-		activeType := typeCombo.Active()
+		reg := regs[typeCombo.Active()]
 
-		switch activeType {
-		case 0: // Local Calendar
+		switch reg.Auth {
+		case providers.AuthNone:
 			account := &calendar.Account{
 				ID:      fmt.Sprintf("acc-%d", time.Now().UnixNano()),
-				Name:    "Local",
-				Type:    calendar.AccountTypeLocal,
+				Name:    reg.ShortName,
+				Type:    reg.Type,
 				Enabled: true,
 			}
 
@@ -1269,40 +1839,36 @@ func (app *App) showAddAccountDialog() {
 			app.loadCalendars()
 			dialog.Close()
 
-		case 1: // Google OAuth
-			app.startGoogleOAuth(dialog, infoLabel)
-
-		case 2, 3: // Apple or CalDAV
-			username := userEntry.Text()
-			password := passEntry.Text()
-			serverURL := serverEntry.Text()
-
-			if username == "" || password == "" || serverURL == "" {
-				infoLabel.SetText("Please fill in all fields.")
+		case providers.AuthOAuth:
+			account := oauthAccount(reg)
+			if account == nil {
 				return
 			}
+			switch {
+			case reg.BrowserSignIn != nil:
+				app.startBrowserSignIn(dialog, infoLabel, reg, account)
+			case reg.DeviceSignIn != nil:
+				app.startDeviceSignIn(dialog, infoLabel, reg, account)
+			default:
+				infoLabel.SetText("Sign-in is not supported for " + reg.DisplayName + " yet.")
+			}
 
-			var accountType calendar.AccountType
-			var accountName string
-			switch activeType {
-			case 2:
-				accountType = calendar.AccountTypeApple
-				accountName = "Apple - " + username
-			case 3:
-				accountType = calendar.AccountTypeCalDAV
-				accountName = "CalDAV - " + username
+		case providers.AuthPassword:
+			values := make(map[string]string)
+			for key, entry := range fieldEntries {
+				values[key] = entry.Text()
 			}
 
 			account := &calendar.Account{
-				ID:          fmt.Sprintf("acc-%d", time.Now().UnixNano()),
-				Name:        accountName,
-				Email:       username,
-				Username:    username,
-				AppPassword: password,
-				ServerURL:   serverURL,
-				Type:        accountType,
-				Enabled:     true,
+				ID:      fmt.Sprintf("acc-%d", time.Now().UnixNano()),
+				Type:    reg.Type,
+				Enabled: true,
 			}
+			if err := reg.ApplyFields(account, values); err != nil {
+				infoLabel.SetText(err.Error())
+				return
+			}
+			account.Name = reg.ShortName + " - " + account.Username
 
 			if err := app.store.SaveAccount(account); err != nil {
 				log.Printf("Error saving account: %v", err)
@@ -1311,7 +1877,7 @@ func (app *App) showAddAccountDialog() {
 			}
 
 			// Try to sync calendars
-			go app.syncCalDAVAccount(account)
+			go app.syncAccount(account)
 
 			app.loadCalendars()
 			dialog.Close()
@@ -1333,701 +1899,284 @@ func (app *App) showAddAccountDialog() {
 	dialog.Show()
 }
 
-// startGoogleOAuth initiates Google OAuth flow
-func (app *App) startGoogleOAuth(parentDialog *gtk.Dialog, statusLabel *gtk.Label) {
-	statusLabel.SetText("Opening browser for Google sign-in...")
-
-	// Create callback channel
-	codeChan := make(chan string, 1)
-	errChan := make(chan error, 1)
-
-	// Create a new mux to avoid handler conflicts
-	mux := http.NewServeMux()
-	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query().Get("code")
-		if code == "" {
-			errChan <- fmt.Errorf("no code received")
-			fmt.Fprintf(w, "<html><body><h1>Error</h1><p>No authorization code received.</p></body></html>")
-			return
-		}
-		codeChan <- code
-		fmt.Fprintf(w, "<html><body><h1>Success!</h1><p>You can close this window and return to SwitchCal.</p><script>window.close();</script></body></html>")
-	})
-
-	// Start local callback server with custom mux
-	server := &http.Server{Addr: fmt.Sprintf(":%d", redirectPort), Handler: mux}
+// startBrowserSignIn signs in through the browser. A new account is
+// created from account when it has no ID yet; otherwise it is an existing
+// account whose tokens are replaced.
+func (app *App) startBrowserSignIn(parentDialog *gtk.Dialog, statusLabel *gtk.Label, reg *providers.Registration, account *calendar.Account) {
+	statusLabel.SetText("Opening browser for " + reg.ShortName + " sign-in...")
 
 	go func() {
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			errChan <- err
+		ctx, cancel := context.WithTimeout(context.Background(), browserSignInTimeout)
+		defer cancel()
+
+		// Sign in on a copy so a failed attempt leaves the account untouched
+		signedIn := *account
+		err := reg.BrowserSignIn(ctx, &signedIn, openBrowser)
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out, please try again")
 		}
-	}()
-
-	// Build OAuth URL
-	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", redirectPort)
-	authURL := fmt.Sprintf("%s?client_id=%s&redirect_uri=%s&response_type=code&scope=%s&access_type=offline&prompt=consent",
-		googleAuthURL,
-		url.QueryEscape(googleClientID),
-		url.QueryEscape(redirectURI),
-		url.QueryEscape(googleScope))
-
-	// Open browser
-	if err := openBrowser(authURL); err != nil {
-		statusLabel.SetText("Failed to open browser: " + err.Error())
-		return
-	}
 
-	// Wait for callback in background
-	go func() {
-		defer server.Shutdown(context.Background())
-
-		select {
-		case code := <-codeChan:
-			// Exchange code for token
-			accessToken, refreshToken, email, err := exchangeGoogleCode(code, redirectURI)
+		glib.IdleAdd(func() {
 			if err != nil {
-				glib.IdleAdd(func() {
-					statusLabel.SetText("Auth failed: " + err.Error())
-				})
+				statusLabel.SetText("Auth failed: " + err.Error())
 				return
 			}
+			*account = signedIn
+			if err := app.saveSignedInAccount(account); err != nil {
+				statusLabel.SetText("Error saving: " + err.Error())
+				return
+			}
+			parentDialog.Close()
+		})
+	}()
+}
 
-			// Create and save account
-			glib.IdleAdd(func() {
-				// Google CalDAV URL includes user email
-				serverURL := fmt.Sprintf("%s%s/", googleCalDAVURL, url.PathEscape(email))
-
-				account := &calendar.Account{
-					ID:           fmt.Sprintf("acc-%d", time.Now().UnixNano()),
-					Name:         "Google - " + email,
-					Email:        email,
-					Type:         calendar.AccountTypeGoogle,
-					ServerURL:    serverURL,
-					AccessToken:  accessToken,
-					RefreshToken: refreshToken,
-					TokenExpiry:  time.Now().Add(time.Hour),
-					Enabled:      true,
-				}
-
-				if err := app.store.SaveAccount(account); err != nil {
-					statusLabel.SetText("Error saving: " + err.Error())
-					return
-				}
-
-				// Sync calendars
-				go app.syncCalDAVAccount(account)
+// startDeviceSignIn signs in with a code the user approves on another
+// device. Like startBrowserSignIn, account is new when it has no ID yet.
+func (app *App) startDeviceSignIn(parentDialog *gtk.Dialog, statusLabel *gtk.Label, reg *providers.Registration, account *calendar.Account) {
+	statusLabel.SetText("Requesting a sign-in code...")
+	statusLabel.SetSelectable(true)
 
-				app.loadCalendars()
-				parentDialog.Close()
-			})
+	// Stop polling when the dialog is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	parentDialog.ConnectCloseRequest(func() bool {
+		cancel()
+		return false
+	})
 
-		case err := <-errChan:
-			glib.IdleAdd(func() {
-				statusLabel.SetText("Error: " + err.Error())
-			})
+	go func() {
+		defer cancel()
 
-		case <-time.After(5 * time.Minute):
+		// Sign in on a copy so a failed attempt leaves the account untouched
+		signedIn := *account
+		err := reg.DeviceSignIn(ctx, &signedIn, func(code *providers.DeviceCode) {
 			glib.IdleAdd(func() {
-				statusLabel.SetText("Timeout - please try again")
+				statusLabel.SetText(fmt.Sprintf("On any device, open %s and enter the code:\n\n%s\n\nThe code expires at %s.",
+					code.VerificationURI, code.UserCode, code.Expires.Local().Format(app.config.TimeFormat())))
 			})
+		})
+		if errors.Is(err, context.Canceled) {
+			return
 		}
+
+		glib.IdleAdd(func() {
+			if err != nil {
+				statusLabel.SetText("Sign-in failed: " + err.Error())
+				return
+			}
+			*account = signedIn
+			if err := app.saveSignedInAccount(account); err != nil {
+				statusLabel.SetText("Error saving: " + err.Error())
+				return
+			}
+			parentDialog.Close()
+		})
 	}()
 }
 
-// exchangeGoogleCode exchanges authorization code for tokens
-func exchangeGoogleCode(code, redirectURI string) (accessToken, refreshToken, email string, err error) {
-	data := url.Values{}
-	data.Set("code", code)
-	data.Set("client_id", googleClientID)
-	data.Set("client_secret", googleClientSecret)
-	data.Set("redirect_uri", redirectURI)
-	data.Set("grant_type", "authorization_code")
-
-	resp, err := http.Post(googleTokenURL, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", "", "", err
-	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-
-	var result struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		Error        string `json:"error"`
-		ErrorDesc    string `json:"error_description"`
+// initSignedInAccount gives an account created by signing in (one without
+// an ID yet) its ID and a name from the signed-in email address
+func initSignedInAccount(account *calendar.Account) {
+	if account.ID != "" {
+		return
 	}
-	json.Unmarshal(body, &result)
-
-	log.Printf("Token exchange - access token received: %v, refresh token received: %v",
-		result.AccessToken != "", result.RefreshToken != "")
-
-	if result.Error != "" {
-		return "", "", "", fmt.Errorf("%s: %s", result.Error, result.ErrorDesc)
+	account.ID = fmt.Sprintf("acc-%d", time.Now().UnixNano())
+	account.Enabled = true
+	account.Name = string(account.Type) + " - " + account.Email
+	if reg, ok := providers.Lookup(account.Type); ok {
+		account.Name = reg.ShortName + " - " + account.Email
 	}
+}
 
-	if result.RefreshToken == "" {
-		log.Printf("WARNING: No refresh token received. Token refresh will fail after 1 hour.")
+// saveSignedInAccount saves an account after signing in and syncs it
+func (app *App) saveSignedInAccount(account *calendar.Account) error {
+	initSignedInAccount(account)
+	if err := app.store.SaveAccount(account); err != nil {
+		return err
 	}
 
-	// Get user email
-	email = getUserEmail(result.AccessToken)
+	// Sync calendars
+	go app.syncAccount(account)
 
-	return result.AccessToken, result.RefreshToken, email, nil
+	app.loadCalendars()
+	return nil
 }
 
-// getUserEmail fetches the user's email from Google
-func getUserEmail(accessToken string) string {
-	req, _ := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	resp, err := http.DefaultClient.Do(req)
+// accountProvider returns an unauthenticated provider for an account, or nil for local accounts.
+// It is used to check optional capabilities before offering UI actions.
+func (app *App) accountProvider(account *calendar.Account) providers.Provider {
+	provider, err := providers.New(account)
 	if err != nil {
-		return "Google Account"
+		return nil
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Email string `json:"email"`
-	}
-	json.NewDecoder(resp.Body).Decode(&result)
-
-	if result.Email != "" {
-		return result.Email
-	}
-	return "Google Account"
+	return provider
 }
 
-// refreshGoogleToken refreshes an expired Google access token
-func (app *App) refreshGoogleToken(account *calendar.Account) error {
-	log.Printf("Attempting token refresh for account: %s", account.Email)
-	log.Printf("Refresh token present: %v", account.RefreshToken != "")
-
-	if account.RefreshToken == "" {
-		return fmt.Errorf("no refresh token available - please re-authenticate")
-	}
-
-	data := url.Values{}
-	data.Set("client_id", googleClientID)
-	data.Set("client_secret", googleClientSecret)
-	data.Set("refresh_token", account.RefreshToken)
-	data.Set("grant_type", "refresh_token")
-
-	resp, err := http.Post(googleTokenURL, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+// calendarProvider returns an unauthenticated provider for a calendar's account, or nil for local calendars
+func (app *App) calendarProvider(calendarID string) providers.Provider {
+	cal, err := app.store.GetCalendar(calendarID)
 	if err != nil {
-		return err
+		return nil
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	account, err := app.store.GetAccount(cal.AccountID)
 	if err != nil {
-		return fmt.Errorf("failed to read refresh response: %w", err)
-	}
-
-	log.Printf("Token refresh response status: %d", resp.StatusCode)
-	if resp.StatusCode != 200 {
-		log.Printf("Token refresh response body: %s", string(body))
+		return nil
 	}
+	return app.accountProvider(account)
+}
 
-	var result struct {
-		AccessToken string `json:"access_token"`
-		ExpiresIn   int    `json:"expires_in"`
-		Error       string `json:"error"`
-		ErrorDesc   string `json:"error_description"`
+// providerForAccount returns an authenticated provider for an account, or nil for local accounts
+func (app *App) providerForAccount(ctx context.Context, account *calendar.Account) (providers.Provider, error) {
+	provider, err := providers.New(account)
+	if err != nil || provider == nil {
+		return nil, err
 	}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return fmt.Errorf("failed to decode refresh response: %w", err)
+	if err := gnome.LoadCredentials(account); err != nil {
+		return nil, err
 	}
-
-	if result.Error != "" {
-		return fmt.Errorf("refresh failed: %s - %s", result.Error, result.ErrorDesc)
+	if err := provider.Authenticate(ctx); err != nil {
+		return nil, err
 	}
-
-	account.AccessToken = result.AccessToken
-	account.TokenExpiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
-	log.Printf("Token refreshed successfully, expires in %d seconds", result.ExpiresIn)
-
-	return app.store.SaveAccount(account)
+	return provider, nil
 }
 
-// syncCalDAVAccount syncs calendars from a CalDAV account
-func (app *App) syncCalDAVAccount(account *calendar.Account) {
-	log.Printf("Syncing CalDAV account: %s", account.Name)
-
-	// For Google, use the Calendar API directly (more reliable)
-	if account.Type == calendar.AccountTypeGoogle {
-		app.syncGoogleCalendarAPI(account)
-		return
-	}
-
+// withAccountProvider runs fn against the provider for an account, doing nothing for local accounts
+func (app *App) withAccountProvider(account *calendar.Account, fn func(ctx context.Context, p providers.Provider) error) error {
 	ctx := context.Background()
 
-	// Create CalDAV client
-	client := caldav.NewClient(account)
-
-	// Authenticate
-	if err := client.Authenticate(ctx); err != nil {
-		log.Printf("CalDAV auth failed: %v", err)
-		return
-	}
-
-	// List calendars
-	calendars, err := client.ListCalendars(ctx)
-	if err != nil {
-		log.Printf("Failed to list calendars: %v", err)
-		return
+	before := *account
+	provider, err := app.providerForAccount(ctx, account)
+	if err != nil || provider == nil {
+		return err
 	}
-
-	log.Printf("Found %d calendars", len(calendars))
-
-	// Save calendars to store
-	for _, cal := range calendars {
-		cal.AccountID = account.ID
-		if err := app.store.SaveCalendar(cal); err != nil {
-			log.Printf("Failed to save calendar %s: %v", cal.Name, err)
-			continue
-		}
-
-		// Fetch events for this calendar (last 30 days to next 90 days)
-		start := time.Now().AddDate(0, -1, 0)
-		end := time.Now().AddDate(0, 3, 0)
-
-		events, err := client.GetEvents(ctx, cal.ID, start, end)
-		if err != nil {
-			log.Printf("Failed to get events for %s: %v", cal.Name, err)
-			continue
-		}
-
-		log.Printf("Found %d events in %s", len(events), cal.Name)
-
-		// Save events and track IDs
-		var activeIDs []string
-		for _, event := range events {
-			event.CalendarID = cal.ID
-			activeIDs = append(activeIDs, event.ID)
-			if err := app.store.SaveEvent(event); err != nil {
-				log.Printf("Failed to save event %s: %v", event.Title, err)
-			}
-		}
-
-		// Remove local events that no longer exist on remote
-		if deleted, err := app.store.DeleteEventsNotIn(cal.ID, activeIDs); err != nil {
-			log.Printf("Failed to clean up deleted events for %s: %v", cal.Name, err)
-		} else if deleted > 0 {
-			log.Printf("Removed %d deleted events from %s", deleted, cal.Name)
-		}
+	if err := fn(ctx, provider); err != nil {
+		return err
 	}
 
-	// Update last sync time
-	account.LastSync = time.Now()
-	app.store.SaveAccount(account)
-
-	// Refresh UI on main thread
-	glib.IdleAdd(func() {
-		app.loadCalendars()
-		app.refreshMonthView()
-	})
+	// Persist any tokens refreshed during the request
+	return app.store.SaveSyncState(&before, provider.GetAccount())
 }
 
-// syncGoogleCalendarAPI syncs using Google Calendar API directly
-func (app *App) syncGoogleCalendarAPI(account *calendar.Account) {
-	// Refresh token if expired
-	if time.Now().After(account.TokenExpiry) {
-		if err := app.refreshGoogleToken(account); err != nil {
-			log.Printf("Failed to refresh token: %v", err)
-			return
-		}
-	}
-
-	// Fetch calendar list
-	req, _ := http.NewRequest("GET", "https://www.googleapis.com/calendar/v3/users/me/calendarList", nil)
-	req.Header.Set("Authorization", "Bearer "+account.AccessToken)
-
-	resp, err := http.DefaultClient.Do(req)
+// withProvider runs fn against the provider for a calendar, doing nothing for local calendars
+func (app *App) withProvider(calendarID string, fn func(ctx context.Context, p providers.Provider) error) error {
+	cal, err := app.store.GetCalendar(calendarID)
 	if err != nil {
-		log.Printf("Failed to fetch calendars: %v", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Calendar list error %d: %s", resp.StatusCode, string(body))
-		return
-	}
-
-	var calList struct {
-		Items []struct {
-			ID              string `json:"id"`
-			Summary         string `json:"summary"`
-			Description     string `json:"description"`
-			BackgroundColor string `json:"backgroundColor"`
-			Primary         bool   `json:"primary"`
-		} `json:"items"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&calList); err != nil {
-		log.Printf("Failed to decode calendar list: %v", err)
-		return
-	}
-
-	log.Printf("Found %d Google calendars", len(calList.Items))
-
-	for _, item := range calList.Items {
-		// Load existing calendar to preserve sync token and visibility
-		existing, _ := app.store.GetCalendar(item.ID)
-
-		cal := &calendar.Calendar{
-			ID:          item.ID,
-			AccountID:   account.ID,
-			Name:        item.Summary,
-			Description: item.Description,
-			Color:       item.BackgroundColor,
-			Visible:     true,
-		}
-		if existing != nil {
-			cal.SyncToken = existing.SyncToken
-			cal.Visible = existing.Visible
-		}
-		if cal.Color == "" {
-			cal.Color = "#4285f4"
-		}
-
-		if err := app.store.SaveCalendar(cal); err != nil {
-			log.Printf("Failed to save calendar %s: %v", cal.Name, err)
-			continue
-		}
-
-		// Fetch events for this calendar
-		app.fetchGoogleEvents(account, cal)
+		return err
 	}
-
-	// Update last sync time
-	account.LastSync = time.Now()
-	app.store.SaveAccount(account)
-
-	// Refresh UI on main thread
-	glib.IdleAdd(func() {
-		app.loadCalendars()
-		app.refreshMonthView()
-	})
-}
-
-// googleEventItem represents an event from the Google Calendar API
-type googleEventItem struct {
-	ID          string `json:"id"`
-	Summary     string `json:"summary"`
-	Description string `json:"description"`
-	Location    string `json:"location"`
-	Start       struct {
-		DateTime string `json:"dateTime"`
-		Date     string `json:"date"`
-	} `json:"start"`
-	End struct {
-		DateTime string `json:"dateTime"`
-		Date     string `json:"date"`
-	} `json:"end"`
-	Status string `json:"status"`
-}
-
-// googleEventList represents a paginated response from the Google Calendar API
-type googleEventList struct {
-	Items         []googleEventItem `json:"items"`
-	NextPageToken string            `json:"nextPageToken"`
-	NextSyncToken string            `json:"nextSyncToken"`
-}
-
-// fetchGoogleEventsPage fetches a single page of events and returns the parsed response
-func (app *App) fetchGoogleEventsPage(account *calendar.Account, eventsURL string) (*googleEventList, int, error) {
-	req, _ := http.NewRequest("GET", eventsURL, nil)
-	req.Header.Set("Authorization", "Bearer "+account.AccessToken)
-
-	resp, err := http.DefaultClient.Do(req)
+	account, err := app.store.GetAccount(cal.AccountID)
 	if err != nil {
-		return nil, 0, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
-	}
-
-	var eventList googleEventList
-	if err := json.NewDecoder(resp.Body).Decode(&eventList); err != nil {
-		return nil, 200, err
+		return err
 	}
-	return &eventList, 200, nil
+	return app.withAccountProvider(account, fn)
 }
 
-// fetchAllGooglePages fetches all pages for a given initial URL
-func (app *App) fetchAllGooglePages(account *calendar.Account, initialURL string) ([]googleEventItem, string, int, error) {
-	var allItems []googleEventItem
-	currentURL := initialURL
-	var syncToken string
-
-	for {
-		result, statusCode, err := app.fetchGoogleEventsPage(account, currentURL)
-		if err != nil {
-			return allItems, "", statusCode, err
-		}
-
-		allItems = append(allItems, result.Items...)
-
-		if result.NextSyncToken != "" {
-			syncToken = result.NextSyncToken
-		}
+// saveEventChange saves a created or edited event locally and queues the
+// change for its calendar's provider, then syncs the account to upload it.
+// Changes that cannot be sent now stay in the outbox until a later sync.
+func (app *App) saveEventChange(event *calendar.Event, isNew bool, oldCalendarID string) {
+	account := app.remoteAccount(event.CalendarID)
+	if account == nil && event.UID == "" {
+		event.UID = event.ID
+	}
 
-		if result.NextPageToken == "" {
-			break
+	// A moved event is a new event in its new calendar
+	if !isNew && oldCalendarID != event.CalendarID {
+		old := app.remoteAccount(oldCalendarID)
+		oldAccountID := ""
+		if old != nil {
+			oldAccountID = old.ID
 		}
-
-		// Add pageToken to URL for next page
-		if strings.Contains(currentURL, "pageToken=") {
-			// Replace existing pageToken (shouldn't happen, but be safe)
-			break
+		if err := providers.MoveEvent(app.store, event, oldCalendarID, oldAccountID); err != nil {
+			log.Printf("Error moving event: %v", err)
+			return
 		}
-		sep := "&"
-		if !strings.Contains(currentURL, "?") {
-			sep = "?"
+		if old != nil {
+			go app.syncAccount(old)
 		}
-		currentURL = initialURL + sep + "pageToken=" + url.QueryEscape(result.NextPageToken)
-	}
-
-	return allItems, syncToken, 200, nil
-}
-
-// fetchGoogleEvents fetches events from a Google calendar using incremental sync when possible
-func (app *App) fetchGoogleEvents(account *calendar.Account, cal *calendar.Calendar) {
-	if cal.SyncToken == "disabled" {
-		app.fetchGoogleEventsFull(account, cal)
+		app.queueEventChange(event.CalendarID, event.ID, calendar.ChangeCreate, nil)
 		return
 	}
 
-	incremental := cal.SyncToken != ""
-	var eventsURL string
-
-	if incremental {
-		eventsURL = fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events?syncToken=%s&maxResults=2500",
-			url.PathEscape(cal.ID), url.QueryEscape(cal.SyncToken))
-	} else {
-		// Full sync with singleEvents=true to expand recurring events
-		timeMin := time.Now().AddDate(0, -1, 0).Format(time.RFC3339)
-		timeMax := time.Now().AddDate(0, 6, 0).Format(time.RFC3339)
-		eventsURL = fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events?timeMin=%s&timeMax=%s&singleEvents=true&maxResults=2500",
-			url.PathEscape(cal.ID), url.QueryEscape(timeMin), url.QueryEscape(timeMax))
-	}
-
-	allItems, syncToken, statusCode, err := app.fetchAllGooglePages(account, eventsURL)
-
-	// 410 Gone means sync token is invalid — permanently disable incremental sync for this calendar
-	if statusCode == 410 && incremental {
-		log.Printf("Sync token invalid for %s, disabling incremental sync", cal.Name)
-		cal.SyncToken = "disabled"
-		app.store.SaveCalendar(cal)
-		app.fetchGoogleEventsFull(account, cal)
-		return
-	}
-
-	if err != nil {
-		log.Printf("Failed to fetch events for %s: %v", cal.Name, err)
+	// The stored copy is the version the edit was made to
+	base, _ := app.store.GetEvent(event.ID)
+	if err := app.store.SaveEvent(event); err != nil {
+		log.Printf("Error saving event: %v", err)
 		return
 	}
-
-	if incremental {
-		if len(allItems) > 0 {
-			log.Printf("Incremental sync: %d changes in %s", len(allItems), cal.Name)
-		}
-	} else {
-		log.Printf("Full sync: %d events in %s", len(allItems), cal.Name)
-	}
-
-	var activeIDs []string
-	for _, item := range allItems {
-		if item.Status == "cancelled" {
-			if incremental {
-				if err := app.store.DeleteEvent(item.ID); err != nil {
-					log.Printf("Failed to delete cancelled event %s: %v", item.ID, err)
-				}
-			}
-			continue
-		}
-
-		activeIDs = append(activeIDs, item.ID)
-		app.saveGoogleEvent(cal, &item)
-	}
-
-	// On full sync, remove events that no longer exist remotely
-	if !incremental {
-		if deleted, err := app.store.DeleteEventsNotIn(cal.ID, activeIDs); err != nil {
-			log.Printf("Failed to clean up deleted events for %s: %v", cal.Name, err)
-		} else if deleted > 0 {
-			log.Printf("Removed %d stale events from %s", deleted, cal.Name)
-		}
+	op := calendar.ChangeUpdate
+	if base == nil || base.RemoteID == "" {
+		op = calendar.ChangeCreate
 	}
+	app.queueEventChange(event.CalendarID, event.ID, op, base)
+}
 
-	// Save sync token for next incremental sync
-	if syncToken != "" {
-		cal.SyncToken = syncToken
-		app.store.SaveCalendar(cal)
+// deleteEventChange moves an event to the trash and queues its removal from
+// the provider. It returns the deleted event, or nil if it could not be deleted.
+func (app *App) deleteEventChange(calendarID, eventID string) *calendar.Event {
+	base, err := app.store.TrashEvent(eventID)
+	if err != nil {
+		log.Printf("Error deleting event locally: %v", err)
+		return nil
 	}
+	app.queueEventChange(calendarID, eventID, calendar.ChangeDelete, base)
+	return base
 }
 
-// fetchGoogleEventsFull does a full sync without saving a sync token (for calendars that don't support incremental sync)
-func (app *App) fetchGoogleEventsFull(account *calendar.Account, cal *calendar.Calendar) {
-	timeMin := time.Now().AddDate(0, -1, 0).Format(time.RFC3339)
-	timeMax := time.Now().AddDate(0, 6, 0).Format(time.RFC3339)
-	eventsURL := fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events?timeMin=%s&timeMax=%s&singleEvents=true&maxResults=2500",
-		url.PathEscape(cal.ID), url.QueryEscape(timeMin), url.QueryEscape(timeMax))
-
-	allItems, _, _, err := app.fetchAllGooglePages(account, eventsURL)
-	if err != nil {
-		log.Printf("Failed to fetch events for %s: %v", cal.Name, err)
+// queueEventChange adds a change made to the base version of an event to
+// the outbox of the calendar's account and starts a sync to upload it. Local
+// calendars have nothing to upload, and deleting an event that was never
+// uploaded only drops its waiting changes.
+func (app *App) queueEventChange(calendarID, eventID string, op calendar.ChangeOp, base *calendar.Event) {
+	account := app.remoteAccount(calendarID)
+	if account == nil {
 		return
 	}
 
-	var activeIDs []string
-	for _, item := range allItems {
-		if item.Status == "cancelled" {
-			continue
+	if op == calendar.ChangeDelete && (base == nil || base.RemoteID == "") {
+		if err := app.store.DropPendingChanges(calendarID, eventID); err != nil {
+			log.Printf("Error dropping changes to %s: %v", eventID, err)
 		}
-		activeIDs = append(activeIDs, item.ID)
-		app.saveGoogleEvent(cal, &item)
-	}
-
-	if deleted, err := app.store.DeleteEventsNotIn(cal.ID, activeIDs); err != nil {
-		log.Printf("Failed to clean up deleted events for %s: %v", cal.Name, err)
-	} else if deleted > 0 {
-		log.Printf("Removed %d stale events from %s", deleted, cal.Name)
-	}
-}
-
-// saveGoogleEvent parses and saves a single Google Calendar event item
-func (app *App) saveGoogleEvent(cal *calendar.Calendar, item *googleEventItem) {
-	event := &calendar.Event{
-		ID:          item.ID,
-		CalendarID:  cal.ID,
-		UID:         item.ID,
-		Title:       item.Summary,
-		Description: item.Description,
-		Location:    item.Location,
-		Status:      calendar.StatusConfirmed,
+		return
 	}
 
-	if item.Start.DateTime != "" {
-		event.Start, _ = time.Parse(time.RFC3339, item.Start.DateTime)
-	} else if item.Start.Date != "" {
-		event.Start, _ = time.ParseInLocation("2006-01-02", item.Start.Date, time.Local)
-		event.AllDay = true
+	change := &calendar.PendingChange{
+		AccountID:  account.ID,
+		CalendarID: calendarID,
+		EventID:    eventID,
+		Op:         op,
 	}
-
-	if item.End.DateTime != "" {
-		event.End, _ = time.Parse(time.RFC3339, item.End.DateTime)
-	} else if item.End.Date != "" {
-		event.End, _ = time.ParseInLocation("2006-01-02", item.End.Date, time.Local)
+	if base != nil {
+		change.RemoteID = base.RemoteID
+		change.BaseETag = base.ETag
+		change.BaseModified = base.Modified
 	}
-
-	if err := app.store.SaveEvent(event); err != nil {
-		log.Printf("Failed to save event %s: %v", event.Title, err)
+	if err := app.store.QueueChange(change); err != nil {
+		log.Printf("Error queueing change to %s: %v", eventID, err)
+		return
 	}
+	go app.syncAccount(account)
 }
 
-// getGoogleAccountForCalendar returns the Google account for a calendar, or nil if it's not a Google calendar
-func (app *App) getGoogleAccountForCalendar(calendarID string) (*calendar.Account, error) {
-	cal, err := app.store.GetCalendar(calendarID)
-	if err != nil {
-		return nil, err
-	}
-	account, err := app.store.GetAccount(cal.AccountID)
-	if err != nil {
-		return nil, err
-	}
-	if account.Type != calendar.AccountTypeGoogle {
-		return nil, nil
-	}
-	return account, nil
+// remoteAccount returns the account of a calendar that syncs with a provider, or nil
+func (app *App) remoteAccount(calendarID string) *calendar.Account {
+	return remoteAccount(app.store, calendarID)
 }
 
-// pushGoogleEventCreate creates an event on Google Calendar and returns the Google-assigned ID
-func (app *App) pushGoogleEventCreate(account *calendar.Account, calendarID string, event *calendar.Event) (string, error) {
-	if time.Now().After(account.TokenExpiry) {
-		if err := app.refreshGoogleToken(account); err != nil {
-			return "", fmt.Errorf("token refresh failed: %w", err)
-		}
-	}
-
-	body := map[string]interface{}{
-		"summary":     event.Title,
-		"description": event.Description,
-		"location":    event.Location,
-	}
-	if event.AllDay {
-		body["start"] = map[string]string{"date": event.Start.Format("2006-01-02")}
-		body["end"] = map[string]string{"date": event.End.Format("2006-01-02")}
-	} else {
-		body["start"] = map[string]string{"dateTime": event.Start.Format(time.RFC3339)}
-		body["end"] = map[string]string{"dateTime": event.End.Format(time.RFC3339)}
-	}
-
-	jsonBody, err := json.Marshal(body)
+// remoteAccount looks up the account of a calendar that syncs with a
+// provider in store, returning nil for local calendars
+func remoteAccount(store *calendar.Store, calendarID string) *calendar.Account {
+	cal, err := store.GetCalendar(calendarID)
 	if err != nil {
-		return "", err
+		return nil
 	}
-
-	apiURL := fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events",
-		url.PathEscape(calendarID))
-	req, _ := http.NewRequest("POST", apiURL, bytes.NewReader(jsonBody))
-	req.Header.Set("Authorization", "Bearer "+account.AccessToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
+	account, err := store.GetAccount(cal.AccountID)
 	if err != nil {
-		return "", err
+		return nil
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 && resp.StatusCode != 201 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Google API error %d: %s", resp.StatusCode, string(respBody))
-	}
-
-	var result struct {
-		ID string `json:"id"`
+	if reg, ok := providers.Lookup(account.Type); !ok || !reg.IsRemote() {
+		return nil
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
-	}
-
-	log.Printf("Created event on Google: %s (%s)", event.Title, result.ID)
-	return result.ID, nil
-}
-
-// pushGoogleEventDelete deletes an event from Google Calendar
-func (app *App) pushGoogleEventDelete(account *calendar.Account, calendarID string, eventID string) error {
-	if time.Now().After(account.TokenExpiry) {
-		if err := app.refreshGoogleToken(account); err != nil {
-			return fmt.Errorf("token refresh failed: %w", err)
-		}
-	}
-
-	apiURL := fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events/%s",
-		url.PathEscape(calendarID), url.PathEscape(eventID))
-	req, _ := http.NewRequest("DELETE", apiURL, nil)
-	req.Header.Set("Authorization", "Bearer "+account.AccessToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	// 200, 204 = success; 404/410 = already gone
-	if resp.StatusCode != 200 && resp.StatusCode != 204 && resp.StatusCode != 404 && resp.StatusCode != 410 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("Google API error %d: %s", resp.StatusCode, string(respBody))
-	}
-
-	log.Printf("Deleted event from Google: %s", eventID)
-	return nil
+	return account
 }
 
 // openBrowser opens a URL in the default browser
@@ -2049,14 +2198,26 @@ func openBrowser(url string) error {
 func (app *App) showEventDialog(event *calendar.Event) {
 	isNew := event == nil
 	if isNew {
+		// New events are scheduled in the zone the calendar is shown in
+		zone := app.config.ViewTimeZone
+		if zone == "" {
+			zone = calendar.LocalTimeZone()
+		}
+		loc := app.viewLocation()
 		event = &calendar.Event{
-			ID:         fmt.Sprintf("evt-%d", time.Now().UnixNano()),
-			Start:      time.Date(app.selectedDate.Year(), app.selectedDate.Month(), app.selectedDate.Day(), 9, 0, 0, 0, app.selectedDate.Location()),
-			End:        time.Date(app.selectedDate.Year(), app.selectedDate.Month(), app.selectedDate.Day(), 10, 0, 0, 0, app.selectedDate.Location()),
-			Status:     calendar.StatusConfirmed,
+			ID:       calendar.NewEventID(),
+			Start:    time.Date(app.selectedDate.Year(), app.selectedDate.Month(), app.selectedDate.Day(), 9, 0, 0, 0, loc),
+			End:      time.Date(app.selectedDate.Year(), app.selectedDate.Month(), app.selectedDate.Day(), 10, 0, 0, 0, loc),
+			TimeZone: zone,
+			Status:   calendar.StatusConfirmed,
 		}
 	}
 
+	// Times are edited in the zones the event was scheduled in
+	shownStart, shownEnd := event.InZone()
+
+	oldCalendarID := event.CalendarID
+
 	dialog := gtk.NewDialog()
 	if isNew {
 		dialog.SetTitle("New Event")
@@ -2090,7 +2251,14 @@ func (app *App) showEventDialog(event *calendar.Event) {
 	content.Append(calLabel)
 
 	calCombo := gtk.NewComboBoxText()
-	calendars, _ := app.store.GetAllCalendars()
+	allCalendars, _ := app.store.GetAllCalendars()
+	var calendars []*calendar.Calendar
+	for _, cal := range allCalendars {
+		// Read-only calendars cannot take new events
+		if !cal.ReadOnly || cal.ID == event.CalendarID {
+			calendars = append(calendars, cal)
+		}
+	}
 	selectedIdx := 0
 	for i, cal := range calendars {
 		calCombo.AppendText(cal.Name)
@@ -2114,7 +2282,7 @@ func (app *App) showEventDialog(event *calendar.Event) {
 	content.Append(dateLabel)
 
 	dateEntry := gtk.NewEntry()
-	dateEntry.SetText(event.Start.Format("02/01/2006"))
+	dateEntry.SetText(shownStart.Format("02/01/2006"))
 	dateEntry.SetPlaceholderText("DD/MM/YYYY")
 	content.Append(dateEntry)
 
@@ -2122,19 +2290,149 @@ func (app *App) showEventDialog(event *calendar.Event) {
 	timeBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
 
 	startEntry := gtk.NewEntry()
-	startEntry.SetText(event.Start.Format(app.config.TimeFormat()))
+	startEntry.SetText(shownStart.Format(app.config.TimeFormat()))
 	startEntry.SetWidthChars(8)
 	timeBox.Append(startEntry)
 
 	timeBox.Append(gtk.NewLabel("to"))
 
 	endEntry := gtk.NewEntry()
-	endEntry.SetText(event.End.Format(app.config.TimeFormat()))
+	endEntry.SetText(shownEnd.Format(app.config.TimeFormat()))
 	endEntry.SetWidthChars(8)
 	timeBox.Append(endEntry)
 
 	content.Append(timeBox)
 
+	// Time zones of the start and end, e.g. for a flight
+	zoneBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	startZoneCombo := newZoneCombo(event.TimeZone, localZoneLabel)
+	startZoneCombo.SetHExpand(true)
+	zoneBox.Append(startZoneCombo)
+	zoneBox.Append(gtk.NewLabel("to"))
+	endZoneCombo := newZoneCombo(event.EndTimeZone, sameZoneLabel)
+	endZoneCombo.SetHExpand(true)
+	zoneBox.Append(endZoneCombo)
+	zoneBox.SetVisible(!event.AllDay)
+	content.Append(zoneBox)
+	allDayCheck.ConnectToggled(func() {
+		zoneBox.SetVisible(!allDayCheck.Active())
+	})
+
+	// readZones returns the chosen start and end zones, falling back to the
+	// current ones for unknown names
+	readZones := func() (startZone, endZone string) {
+		startZone, ok := readZoneCombo(startZoneCombo, localZoneLabel)
+		if !ok {
+			startZone = event.TimeZone
+		}
+		endZone, ok = readZoneCombo(endZoneCombo, sameZoneLabel)
+		if !ok || endZone == startZone {
+			endZone = ""
+		}
+		return startZone, endZone
+	}
+
+	// readTimes parses the date and time entries in the chosen zones, keeping
+	// the current times for invalid input
+	readTimes := func() (start, end time.Time, ok bool) {
+		start, end = event.Start, event.End
+
+		startLoc, endLoc := app.viewLocation(), app.viewLocation()
+		if startZone, endZone := readZones(); calendar.LoadTimeZone(startZone) != nil {
+			startLoc, endLoc = calendar.LoadTimeZone(startZone), calendar.LoadTimeZone(startZone)
+			if loc := calendar.LoadTimeZone(endZone); loc != nil {
+				endLoc = loc
+			}
+		}
+
+		// Parse date - UK format DD/MM/YYYY
+		date, err := time.ParseInLocation("02/01/2006", dateEntry.Text(), startLoc)
+		if err != nil {
+			return start, end, false
+		}
+
+		if startTime, err := time.Parse(app.config.TimeFormat(), startEntry.Text()); err == nil {
+			start = time.Date(date.Year(), date.Month(), date.Day(),
+				startTime.Hour(), startTime.Minute(), 0, 0, startLoc)
+		}
+		if endTime, err := time.Parse(app.config.TimeFormat(), endEntry.Text()); err == nil {
+			end = time.Date(date.Year(), date.Month(), date.Day(),
+				endTime.Hour(), endTime.Minute(), 0, 0, endLoc)
+			if end.Before(start) {
+				// Overnight, e.g. a flight landing the next morning
+				end = end.AddDate(0, 0, 1)
+			}
+		}
+		return start, end, true
+	}
+
+	// Availability check, offered only for calendars whose provider supports free/busy queries
+	availBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	availBtn := gtk.NewButtonWithLabel("Check Availability")
+	availBox.Append(availBtn)
+	availLabel := gtk.NewLabel("")
+	availLabel.SetXAlign(0)
+	availLabel.SetWrap(true)
+	availLabel.AddCSSClass("dim-label")
+	availBox.Append(availLabel)
+	content.Append(availBox)
+
+	updateAvailability := func() {
+		supported := false
+		if idx := calCombo.Active(); idx >= 0 && idx < len(calendars) {
+			_, supported = app.calendarProvider(calendars[idx].ID).(providers.FreeBusyQuerier)
+		}
+		availBox.SetVisible(supported)
+		availLabel.SetText("")
+	}
+	calCombo.Connect("changed", func() {
+		updateAvailability()
+	})
+	updateAvailability()
+
+	availBtn.ConnectClicked(func() {
+		start, end, ok := readTimes()
+		if !ok {
+			availLabel.SetText("Invalid date")
+			return
+		}
+		idx := calCombo.Active()
+		if idx < 0 || idx >= len(calendars) {
+			availLabel.SetText("Choose a calendar")
+			return
+		}
+		calendarID := calendars[idx].ID
+		availLabel.SetText("Checking...")
+
+		go func() {
+			var busy []providers.BusyPeriod
+			err := app.withProvider(calendarID, func(ctx context.Context, p providers.Provider) error {
+				querier, ok := p.(providers.FreeBusyQuerier)
+				if !ok {
+					return fmt.Errorf("free/busy not supported")
+				}
+				result, err := querier.QueryFreeBusy(ctx, []string{calendarID}, start, end)
+				busy = result[calendarID]
+				return err
+			})
+
+			glib.IdleAdd(func() {
+				switch {
+				case err != nil:
+					availLabel.SetText("Error: " + err.Error())
+				case len(busy) == 0:
+					availLabel.SetText("Free")
+				default:
+					var periods []string
+					for _, b := range busy {
+						periods = append(periods, b.Start.In(app.viewLocation()).Format(app.config.TimeFormat())+" — "+b.End.In(app.viewLocation()).Format(app.config.TimeFormat()))
+					}
+					availLabel.SetText("Busy: " + strings.Join(periods, ", "))
+				}
+			})
+		}()
+	})
+
 	// Location
 	locLabel := gtk.NewLabel("Location:")
 	locLabel.SetXAlign(0)
@@ -2155,6 +2453,22 @@ func (app *App) showEventDialog(event *calendar.Event) {
 	descEntry.SetPlaceholderText("Add description")
 	content.Append(descEntry)
 
+	// Guests can be invited to new events and to meetings the user organizes
+	canInvite := isNew || event.Organizer == nil || event.Organizer.Self
+	guestBox, readGuests := app.buildGuestList(event, canInvite)
+	guestBox.SetMarginTop(4)
+	guestBox.SetVisible(canInvite || len(event.Attendees) > 0)
+	content.Append(guestBox)
+
+	// Invitations from others can be answered
+	if !isNew && !canInvite && event.SelfAttendee() != nil {
+		content.Append(app.buildReplyBox(event, func() {
+			dialog.Close()
+			app.refreshMonthView()
+			app.refreshDayDetail()
+		}))
+	}
+
 	// Buttons
 	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
 	btnBox.SetHAlign(gtk.AlignEnd)
@@ -2169,28 +2483,25 @@ func (app *App) showEventDialog(event *calendar.Event) {
 			dialog.Close()
 
 			go func() {
-				// Only push to Google if this event has a real Google ID (not a temp local ID)
-				if !strings.HasPrefix(eventID, "evt-") {
-					account, err := app.getGoogleAccountForCalendar(calendarID)
-					if err != nil {
-						log.Printf("Error looking up account: %v", err)
-					}
-					if account != nil {
-						if err := app.pushGoogleEventDelete(account, calendarID, eventID); err != nil {
-							log.Printf("Error deleting event from Google: %v", err)
-						}
-					}
-				}
-				if err := app.store.DeleteEvent(eventID); err != nil {
-					log.Printf("Error deleting event locally: %v", err)
-				}
+				deleted := app.deleteEventChange(calendarID, eventID)
 				glib.IdleAdd(func() {
 					app.refreshMonthView()
 					app.refreshDayDetail()
+					if deleted != nil {
+						app.offerUndoDelete(deleted)
+					}
 				})
 			}()
 		})
 		btnBox.Append(deleteBtn)
+
+		// The saved event, without unsaved edits
+		copyBtn := gtk.NewButtonWithLabel("Copy as .ics")
+		copyBtn.ConnectClicked(func() {
+			app.copyEventAsICal(event)
+			copyBtn.SetLabel("Copied")
+		})
+		btnBox.Append(copyBtn)
 	}
 
 	cancelBtn := gtk.NewButtonWithLabel("Cancel")
@@ -2206,24 +2517,26 @@ func (app *App) showEventDialog(event *calendar.Event) {
 		event.Title = titleEntry.Text()
 		event.Location = locEntry.Text()
 		event.Description = descEntry.Text()
-		event.AllDay = allDayCheck.Active()
+		event.Attendees = readGuests()
 
-		// Parse date - UK format DD/MM/YYYY
-		dateStr := dateEntry.Text()
-		if date, err := time.Parse("02/01/2006", dateStr); err == nil {
-			// Parse times
-			startStr := startEntry.Text()
-			endStr := endEntry.Text()
-
-			if startTime, err := time.Parse(app.config.TimeFormat(), startStr); err == nil {
-				event.Start = time.Date(date.Year(), date.Month(), date.Day(),
-					startTime.Hour(), startTime.Minute(), 0, 0, date.Location())
-			}
-			if endTime, err := time.Parse(app.config.TimeFormat(), endStr); err == nil {
-				event.End = time.Date(date.Year(), date.Month(), date.Day(),
-					endTime.Hour(), endTime.Minute(), 0, 0, date.Location())
+		days := 1
+		if event.AllDay && allDayCheck.Active() {
+			days = max(1, int(event.End.Sub(event.Start).Hours()+12)/24)
+		}
+		event.AllDay = allDayCheck.Active()
+		event.Start, event.End, _ = readTimes()
+		if !event.AllDay {
+			event.TimeZone, event.EndTimeZone = readZones()
+			if event.TimeZone != "" {
+				event.Floating = false
 			}
 		}
+		if event.AllDay {
+			// All-day events run from midnight to midnight, keeping their number of days
+			day := event.Start
+			event.Start = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.Local)
+			event.End = event.Start.AddDate(0, 0, days)
+		}
 
 		// Set calendar
 		if len(calendars) > 0 && calCombo.Active() >= 0 {
@@ -2233,46 +2546,12 @@ func (app *App) showEventDialog(event *calendar.Event) {
 		event.Modified = time.Now()
 		if isNew {
 			event.Created = time.Now()
-			event.UID = event.ID
 		}
 
 		dialog.Close()
 
 		go func() {
-			account, err := app.getGoogleAccountForCalendar(event.CalendarID)
-			if err != nil {
-				log.Printf("Error looking up account: %v", err)
-			}
-
-			if account != nil {
-				if isNew {
-					googleID, err := app.pushGoogleEventCreate(account, event.CalendarID, event)
-					if err != nil {
-						log.Printf("Error pushing event to Google: %v", err)
-					} else {
-						event.ID = googleID
-						event.UID = googleID
-					}
-				} else {
-					// Update: delete old + create new on Google
-					oldID := event.ID
-					if err := app.pushGoogleEventDelete(account, event.CalendarID, oldID); err != nil {
-						log.Printf("Error deleting old event from Google: %v", err)
-					}
-					googleID, err := app.pushGoogleEventCreate(account, event.CalendarID, event)
-					if err != nil {
-						log.Printf("Error pushing updated event to Google: %v", err)
-					} else {
-						app.store.DeleteEvent(oldID)
-						event.ID = googleID
-						event.UID = googleID
-					}
-				}
-			}
-
-			if err := app.store.SaveEvent(event); err != nil {
-				log.Printf("Error saving event: %v", err)
-			}
+			app.saveEventChange(event, isNew, oldCalendarID)
 
 			glib.IdleAdd(func() {
 				app.refreshMonthView()
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/internal/config"
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers/google"
+	"github.com/djwarf/switchcal/pkg/secrets"
+)
+
+// passphraseEnv can hold the secrets file passphrase to skip the prompt
+const passphraseEnv = "SWITCHCAL_PASSPHRASE"
+
+// googleClientSecretRef is where the secret of the Google OAuth client set
+// in the configuration is kept
+const googleClientSecretRef = "config/google-client-secret"
+
+// openSecretStore connects the Store to the system keyring, falling back to
+// an encrypted file whose passphrase is asked for once per session. onReady
+// runs once account credentials are available.
+func (app *App) openSecretStore(onReady func()) {
+	keyring, err := secrets.NewSecretService()
+	if err == nil {
+		if err := app.store.SetSecretStore(keyring); err != nil {
+			log.Printf("Error moving credentials to the keyring: %v", err)
+		}
+		if err := applyOAuthClientSecrets(app.config, keyring); err != nil {
+			log.Printf("Error loading OAuth client secret: %v", err)
+		}
+		onReady()
+		return
+	}
+	log.Printf("No keyring available, using encrypted file: %v", err)
+
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		if err := app.openSecretsFile(passphrase); err == nil {
+			onReady()
+			return
+		}
+		log.Printf("Passphrase from %s was not accepted", passphraseEnv)
+	}
+
+	app.showPassphraseDialog(onReady)
+}
+
+// openSecretsFile unlocks the encrypted secrets file and hands it to the Store
+func (app *App) openSecretsFile(passphrase string) error {
+	file, err := secrets.OpenFile(app.config.SecretsPath(), passphrase)
+	if err != nil {
+		return err
+	}
+	if err := app.store.SetSecretStore(file); err != nil {
+		log.Printf("Error moving credentials to the secrets file: %v", err)
+	}
+	if err := applyOAuthClientSecrets(app.config, file); err != nil {
+		log.Printf("Error loading OAuth client secret: %v", err)
+	}
+	return nil
+}
+
+// applyOAuthClientSecrets gives the Google OAuth client set in the
+// configuration its secret from secretStore, first moving a secret written
+// into the configuration file there
+func applyOAuthClientSecrets(cfg *config.Config, secretStore calendar.SecretStore) error {
+	if cfg.GoogleClientSecret != "" {
+		if err := secretStore.SetSecret(googleClientSecretRef, "SwitchCal Google OAuth client", cfg.GoogleClientSecret); err != nil {
+			return fmt.Errorf("failed to store Google client secret: %w", err)
+		}
+		cfg.GoogleClientSecret = ""
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to remove Google client secret from the configuration: %w", err)
+		}
+	}
+	if cfg.GoogleClientID == "" {
+		return nil
+	}
+
+	secret, err := secretStore.GetSecret(googleClientSecretRef)
+	if err != nil {
+		return fmt.Errorf("failed to read Google client secret: %w", err)
+	}
+	google.DefaultOAuthConfig = &google.OAuthConfig{ClientID: cfg.GoogleClientID, ClientSecret: secret}
+	return nil
+}
+
+// showPassphraseDialog asks for the passphrase of the encrypted secrets file
+func (app *App) showPassphraseDialog(onReady func()) {
+	creating := !secrets.FileExists(app.config.SecretsPath())
+
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Unlock Accounts")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(380, 180)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	message := "No system keyring is running. Enter the passphrase that protects your account passwords and tokens."
+	if creating {
+		message = "No system keyring is running. Choose a passphrase to protect your account passwords and tokens."
+	}
+	infoLabel := gtk.NewLabel(message)
+	infoLabel.SetXAlign(0)
+	infoLabel.SetWrap(true)
+	content.Append(infoLabel)
+
+	passEntry := gtk.NewPasswordEntry()
+	passEntry.SetShowPeekIcon(true)
+	content.Append(passEntry)
+
+	var confirmEntry *gtk.PasswordEntry
+	if creating {
+		confirmLabel := gtk.NewLabel("Confirm passphrase:")
+		confirmLabel.SetXAlign(0)
+		content.Append(confirmLabel)
+
+		confirmEntry = gtk.NewPasswordEntry()
+		content.Append(confirmEntry)
+	}
+
+	statusLabel := gtk.NewLabel("")
+	statusLabel.SetXAlign(0)
+	statusLabel.SetWrap(true)
+	statusLabel.AddCSSClass("error")
+	content.Append(statusLabel)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	skipBtn := gtk.NewButtonWithLabel("Skip")
+	skipBtn.SetTooltipText("Continue without syncing remote accounts")
+	skipBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(skipBtn)
+
+	unlockBtn := gtk.NewButtonWithLabel("Unlock")
+	unlockBtn.AddCSSClass("suggested-action")
+	unlock := func() {
+		passphrase := passEntry.Text()
+		if passphrase == "" {
+			statusLabel.SetText("Please enter a passphrase.")
+			return
+		}
+		if confirmEntry != nil && confirmEntry.Text() != passphrase {
+			statusLabel.SetText("The passphrases do not match.")
+			return
+		}
+
+		if err := app.openSecretsFile(passphrase); err != nil {
+			if errors.Is(err, secrets.ErrWrongPassphrase) {
+				statusLabel.SetText("Wrong passphrase.")
+			} else {
+				statusLabel.SetText("Error: " + err.Error())
+			}
+			return
+		}
+		dialog.Close()
+		onReady()
+	}
+	unlockBtn.ConnectClicked(unlock)
+	passEntry.ConnectActivate(unlock)
+	btnBox.Append(unlockBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+}
+
+// openSecretStoreCLI returns the keyring, or the encrypted secrets file
+// unlocked with a passphrase from the environment or the terminal
+func openSecretStoreCLI(cfg *config.Config) (calendar.SecretStore, error) {
+	keyring, err := secrets.NewSecretService()
+	if err == nil {
+		return keyring, nil
+	}
+
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" {
+		prompt := "Passphrase for the SwitchCal secrets file: "
+		if !secrets.FileExists(cfg.SecretsPath()) {
+			prompt = "No keyring is running. Choose a passphrase for the SwitchCal secrets file: "
+		}
+		if passphrase, err = readPassphrase(prompt); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := secrets.OpenFile(cfg.SecretsPath(), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// readPassphrase reads a line from the terminal with echo turned off
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	stty := exec.Command("stty", "-echo")
+	stty.Stdin = os.Stdin
+	if stty.Run() == nil {
+		defer func() {
+			restore := exec.Command("stty", "echo")
+			restore.Stdin = os.Stdin
+			restore.Run()
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+	"github.com/djwarf/switchcal/pkg/providers/gnome"
+	calsync "github.com/djwarf/switchcal/pkg/sync"
+)
+
+// startSync starts the background sync engine, which syncs every account
+// right away and then on its own schedule, pausing while the network is down
+func (app *App) startSync() {
+	app.loadCalendars()
+
+	app.syncEngine = calsync.New(app.store, calsync.Config{
+		Interval:       app.config.SyncInterval(),
+		TrashRetention: app.config.TrashRetention(),
+		Connect:        connectAccount,
+	})
+	app.syncEngine.Subscribe(app.onSyncEvent)
+
+	// Pause while offline, on a metered connection or suspended
+	monitor, err := calsync.WatchSystem(app.syncEngine, app.config.SyncOnMetered)
+	if err != nil {
+		log.Printf("Not watching network state: %v", err)
+	} else {
+		app.syncMonitor = monitor
+	}
+
+	if err := app.syncEngine.Start(); err != nil {
+		log.Printf("Error starting background sync: %v", err)
+	}
+
+	if interval := app.config.SyncInterval(); interval > 0 {
+		log.Printf("Background sync enabled: every %s", interval)
+	}
+}
+
+// connectAccount returns the provider to sync an account with, borrowing
+// fresh credentials from GNOME Online Accounts for linked accounts
+func connectAccount(ctx context.Context, account *calendar.Account) (providers.Provider, error) {
+	provider, err := providers.New(account)
+	if err != nil || provider == nil {
+		return nil, err
+	}
+	if err := gnome.LoadCredentials(account); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// syncAccount syncs a remote account now and waits until the sync has ended
+func (app *App) syncAccount(account *calendar.Account) {
+	if app.syncEngine == nil {
+		return
+	}
+	<-app.syncEngine.SyncNow(account.ID)
+}
+
+// onSyncEvent logs sync progress and refreshes the UI; it runs on the sync engine's goroutines
+func (app *App) onSyncEvent(ev calsync.Event) {
+	account := ev.Account
+
+	switch ev.Kind {
+	case calsync.Paused:
+		log.Printf("Background sync paused: %s", ev.Reason)
+		glib.IdleAdd(func() {
+			app.setSyncStatus("Sync paused: "+ev.Reason, "")
+		})
+
+	case calsync.Resumed:
+		log.Printf("Background sync resumed")
+
+	case calsync.Started:
+		log.Printf("Syncing account: %s", account.Name)
+		glib.IdleAdd(func() {
+			app.setSyncStatus(fmt.Sprintf("Syncing %s…", account.Name), "")
+		})
+
+	case calsync.Progress:
+		glib.IdleAdd(func() {
+			app.setSyncStatus(fmt.Sprintf("Syncing %s (%d/%d)…", account.Name, ev.Done, ev.Total), "")
+		})
+
+	case calsync.Finished:
+		if errors.Is(ev.Err, context.Canceled) {
+			// Interrupted by a pause or shutdown; it runs again on resume
+			return
+		}
+		if ev.Err != nil {
+			log.Printf("Sync failed for %s: %v", account.Name, ev.Err)
+		}
+		var firstErr error
+		for _, r := range ev.Results {
+			if r.Failed() {
+				for _, e := range r.Errors {
+					log.Printf("Sync error in %s: %v", account.Name, e)
+				}
+				if firstErr == nil {
+					firstErr = r.Errors[0]
+				}
+			} else if r.EventsCreated+r.EventsUpdated+r.EventsDeleted > 0 {
+				log.Printf("Synced %s: %d created, %d updated, %d deleted",
+					r.CalendarID, r.EventsCreated, r.EventsUpdated, r.EventsDeleted)
+			}
+			if r.Conflicts > 0 {
+				log.Printf("Sync conflicts in %s: %d events changed both here and on the server", r.CalendarID, r.Conflicts)
+			}
+		}
+		if firstErr == nil {
+			firstErr = ev.Err
+		}
+		if firstErr != nil && !ev.NextRun.IsZero() {
+			log.Printf("Retrying %s at %s", account.Name, ev.NextRun.Format("15:04:05"))
+		}
+
+		glib.IdleAdd(func() {
+			if firstErr != nil {
+				app.setSyncStatus("Sync failed for "+account.Name, firstErr.Error())
+			} else {
+				app.setSyncStatus("Synced at "+time.Now().Format(app.config.TimeFormat()), "")
+			}
+			app.loadCalendars()
+			app.refreshMonthView()
+			app.refreshDayDetail()
+		})
+	}
+}
+
+// setSyncStatus shows the state of the background sync under the calendar list
+func (app *App) setSyncStatus(text, errText string) {
+	app.syncStatus.SetText(text)
+	app.syncStatus.SetTooltipText(errText)
+	if errText != "" {
+		app.syncStatus.AddCSSClass("error")
+	} else {
+		app.syncStatus.RemoveCSSClass("error")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+)
+
+// showTasksDialog lists the tasks stored in a calendar on the server
+func (app *App) showTasksDialog(account *calendar.Account, cal *calendar.Calendar) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Tasks — " + cal.Name)
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(420, 360)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	statusLabel := gtk.NewLabel("Loading tasks...")
+	statusLabel.SetXAlign(0)
+	statusLabel.SetWrap(true)
+	statusLabel.AddCSSClass("dim-label")
+	content.Append(statusLabel)
+
+	scrolled := gtk.NewScrolledWindow()
+	scrolled.SetVExpand(true)
+	scrolled.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	content.Append(scrolled)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	closeBtn := gtk.NewButtonWithLabel("Close")
+	closeBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(closeBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+
+	go func() {
+		var tasks []*calendar.Task
+		err := app.withAccountProvider(account, func(ctx context.Context, p providers.Provider) error {
+			tasker, ok := p.(providers.TaskProvider)
+			if !ok {
+				return fmt.Errorf("%s does not support tasks", account.Name)
+			}
+			var err error
+			tasks, err = tasker.GetTasks(ctx, cal.ID)
+			return err
+		})
+
+		glib.IdleAdd(func() {
+			if err != nil {
+				statusLabel.SetText("Error: " + err.Error())
+				return
+			}
+			statusLabel.SetVisible(false)
+
+			list := gtk.NewBox(gtk.OrientationVertical, 8)
+			if len(tasks) == 0 {
+				label := gtk.NewLabel("No tasks")
+				label.AddCSSClass("dim-label")
+				label.SetMarginTop(20)
+				list.Append(label)
+			}
+			sortTasks(tasks)
+			for _, task := range tasks {
+				list.Append(app.taskRow(task))
+			}
+			scrolled.SetChild(list)
+		})
+	}()
+}
+
+// sortTasks puts open tasks first, then orders by due date with undated
+// tasks last
+func sortTasks(tasks []*calendar.Task) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		if a.Completed.IsZero() != b.Completed.IsZero() {
+			return a.Completed.IsZero()
+		}
+		if a.Due.IsZero() != b.Due.IsZero() {
+			return !a.Due.IsZero()
+		}
+		return a.Due.Before(b.Due)
+	})
+}
+
+// taskRow renders one task with its due date or completion
+func (app *App) taskRow(task *calendar.Task) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationVertical, 2)
+
+	title := task.Title
+	if title == "" {
+		title = "Untitled task"
+	}
+	name := gtk.NewLabel(title)
+	name.SetXAlign(0)
+	name.SetEllipsize(3) // PANGO_ELLIPSIZE_END
+	row.Append(name)
+
+	dateFormat := "Mon 2 Jan 2006, " + app.config.TimeFormat()
+	var detail string
+	switch {
+	case !task.Completed.IsZero():
+		detail = "Completed " + task.Completed.In(app.viewLocation()).Format(dateFormat)
+		name.AddCSSClass("dim-label")
+	case !task.Due.IsZero():
+		detail = "Due " + task.Due.In(app.viewLocation()).Format(dateFormat)
+	}
+	if detail != "" {
+		detailLabel := gtk.NewLabel(detail)
+		detailLabel.SetXAlign(0)
+		detailLabel.AddCSSClass("dim-label")
+		row.Append(detailLabel)
+	}
+
+	return row
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// Labels of the empty choice in time zone pickers
+const (
+	localZoneLabel = "Local time"
+	noZoneLabel    = "None"
+	sameZoneLabel  = "Same as start"
+)
+
+// viewLocation returns the zone the calendar is shown in: the one chosen
+// with "Show calendar in", or the system zone
+func (app *App) viewLocation() *time.Location {
+	if loc := calendar.LoadTimeZone(app.config.ViewTimeZone); loc != nil {
+		return loc
+	}
+	return time.Local
+}
+
+// secondaryLocation returns the zone shown alongside the calendar, or nil if
+// there is none
+func (app *App) secondaryLocation() *time.Location {
+	loc := calendar.LoadTimeZone(app.config.SecondaryTimeZone)
+	if loc == nil || loc.String() == app.viewLocation().String() {
+		return nil
+	}
+	return loc
+}
+
+// zoneName returns a short name for the zone a time is in, e.g. "CET"
+func zoneName(t time.Time) string {
+	return t.Format("MST")
+}
+
+// timeRangeText formats the times of an event, marking an end on a later day
+func (app *App) timeRangeText(start, end time.Time) string {
+	text := start.Format(app.config.TimeFormat()) + " — " + end.Format(app.config.TimeFormat())
+	if days := daysBetween(start, end); days > 0 {
+		text += fmt.Sprintf(" (+%d)", days)
+	}
+	return text
+}
+
+// daysBetween returns the number of calendar days from a's date to b's
+func daysBetween(a, b time.Time) int {
+	da := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	db := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da).Hours() / 24)
+}
+
+// secondaryTimeText formats an event's times in the secondary zone, or
+// returns an empty string if there is none or the event is all-day or floating
+func (app *App) secondaryTimeText(event *calendar.Event) string {
+	loc := app.secondaryLocation()
+	if loc == nil || event.WallClock() {
+		return ""
+	}
+	start, end := event.In(loc)
+	text := app.timeRangeText(start, end) + " " + zoneName(start)
+	if daysBetween(event.Start, start) != 0 {
+		// Already the next day there, or still the previous one
+		text += " " + start.Format("Mon")
+	}
+	return text
+}
+
+// eventTooltip describes an event's times in the view zone, the zones it was
+// scheduled in and the secondary zone
+func (app *App) eventTooltip(event *calendar.Event) string {
+	lines := []string{event.Title}
+	if event.AllDay {
+		lines = append(lines, "All day")
+	} else {
+		lines = append(lines, app.timeRangeText(event.Start, event.End)+" "+zoneName(event.Start))
+		if event.Floating {
+			lines = append(lines, "Same time in every time zone")
+		}
+
+		// The times where the event was scheduled, if that is elsewhere
+		start, end := event.InZone()
+		if !event.Floating && (zoneName(start) != zoneName(event.Start) || zoneName(end) != zoneName(event.End)) {
+			lines = append(lines, start.Format(app.config.TimeFormat())+" "+zoneName(start)+" — "+
+				end.Format(app.config.TimeFormat())+" "+zoneName(end))
+		}
+		if text := app.secondaryTimeText(event); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	if event.Location != "" {
+		lines = append(lines, event.Location)
+	}
+	if summary := guestSummary(event); summary != "" {
+		lines = append(lines, summary)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// zoneButtonText labels the header's time zone button with the view zone
+func (app *App) zoneButtonText() string {
+	text := zoneName(time.Now().In(app.viewLocation()))
+	if app.config.ViewTimeZone != "" {
+		text = "✈ " + text
+	}
+	return text
+}
+
+// newZoneCombo returns a time zone picker showing current, which also takes
+// typed zone names. emptyLabel names the choice of no zone.
+func newZoneCombo(current, emptyLabel string) *gtk.ComboBoxText {
+	combo := gtk.NewComboBoxTextWithEntry()
+	combo.AppendText(emptyLabel)
+	names := calendar.TimeZoneNames()
+	active := 0
+	for i, name := range names {
+		combo.AppendText(name)
+		if name == current {
+			active = i + 1
+		}
+	}
+	if current != "" && active == 0 {
+		// Not in the system's list, but known to Go
+		combo.AppendText(current)
+		active = len(names) + 1
+	}
+	combo.SetActive(active)
+	return combo
+}
+
+// readZoneCombo returns the zone chosen in a picker, an empty string for
+// none, or false if the typed name is not a known time zone
+func readZoneCombo(combo *gtk.ComboBoxText, emptyLabel string) (string, bool) {
+	name := strings.TrimSpace(combo.ActiveText())
+	if name == "" || name == emptyLabel {
+		return "", true
+	}
+	if calendar.LoadTimeZone(name) == nil {
+		return "", false
+	}
+	return name, true
+}
+
+// showTimeZoneDialog lets the user show the calendar in another zone, e.g.
+// while travelling, and pick a secondary zone to show alongside it
+func (app *App) showTimeZoneDialog(button *gtk.Button) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Time Zones")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(360, -1)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	viewLabel := gtk.NewLabel("Show calendar in:")
+	viewLabel.SetXAlign(0)
+	content.Append(viewLabel)
+	viewCombo := newZoneCombo(app.config.ViewTimeZone, localZoneLabel)
+	content.Append(viewCombo)
+
+	viewHint := gtk.NewLabel("Events keep the zone they were scheduled in. All-day events stay on their dates.")
+	viewHint.AddCSSClass("dim-label")
+	viewHint.SetXAlign(0)
+	viewHint.SetWrap(true)
+	content.Append(viewHint)
+
+	secondaryLabel := gtk.NewLabel("Secondary time zone:")
+	secondaryLabel.SetXAlign(0)
+	secondaryLabel.SetMarginTop(8)
+	content.Append(secondaryLabel)
+	secondaryCombo := newZoneCombo(app.config.SecondaryTimeZone, noZoneLabel)
+	content.Append(secondaryCombo)
+
+	errorLabel := gtk.NewLabel("")
+	errorLabel.SetXAlign(0)
+	errorLabel.SetWrap(true)
+	content.Append(errorLabel)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	cancelBtn := gtk.NewButtonWithLabel("Cancel")
+	cancelBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(cancelBtn)
+
+	saveBtn := gtk.NewButtonWithLabel("Apply")
+	saveBtn.AddCSSClass("suggested-action")
+	saveBtn.ConnectClicked(func() {
+		viewZone, ok := readZoneCombo(viewCombo, localZoneLabel)
+		if !ok {
+			errorLabel.SetText("Unknown time zone: " + viewCombo.ActiveText())
+			return
+		}
+		secondaryZone, ok := readZoneCombo(secondaryCombo, noZoneLabel)
+		if !ok {
+			errorLabel.SetText("Unknown time zone: " + secondaryCombo.ActiveText())
+			return
+		}
+
+		app.config.ViewTimeZone = viewZone
+		app.config.SecondaryTimeZone = secondaryZone
+		if err := app.config.Save(); err != nil {
+			log.Printf("Error saving config: %v", err)
+		}
+		button.SetLabel(app.zoneButtonText())
+		dialog.Close()
+
+		app.refreshMonthView()
+		app.refreshDayDetail()
+	})
+	btnBox.Append(saveBtn)
+	content.Append(btnBox)
+
+	dialog.Show()
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+)
+
+// toastSeconds is how long the undo toast stays up
+const toastSeconds = 8
+
+// buildToast builds the toast shown at the bottom of the window after an
+// event is deleted
+func (app *App) buildToast() *gtk.Revealer {
+	revealer := gtk.NewRevealer()
+	revealer.SetTransitionType(gtk.RevealerTransitionTypeSlideUp)
+	revealer.SetHAlign(gtk.AlignCenter)
+	revealer.SetVAlign(gtk.AlignEnd)
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 12)
+	box.AddCSSClass("sc-toast")
+
+	app.toastLabel = gtk.NewLabel("")
+	app.toastLabel.SetEllipsize(3) // PANGO_ELLIPSIZE_END
+	app.toastLabel.SetMaxWidthChars(40)
+	box.Append(app.toastLabel)
+
+	undoBtn := gtk.NewButtonWithLabel("Undo")
+	undoBtn.AddCSSClass("suggested-action")
+	undoBtn.ConnectClicked(func() {
+		undo := app.toastUndo
+		app.hideToast()
+		if undo != nil {
+			undo()
+		}
+	})
+	box.Append(undoBtn)
+
+	closeBtn := gtk.NewButtonFromIconName("window-close-symbolic")
+	closeBtn.AddCSSClass("flat")
+	closeBtn.ConnectClicked(app.hideToast)
+	box.Append(closeBtn)
+
+	revealer.SetChild(box)
+	return revealer
+}
+
+// showUndoToast shows text with an Undo button that calls undo, replacing
+// any toast already shown
+func (app *App) showUndoToast(text string, undo func()) {
+	if app.toastTimeout != 0 {
+		glib.SourceRemove(app.toastTimeout)
+	}
+	app.toastLabel.SetText(text)
+	app.toastUndo = undo
+	app.toast.SetRevealChild(true)
+	app.toastTimeout = glib.TimeoutSecondsAdd(toastSeconds, func() {
+		app.toastTimeout = 0
+		app.hideToast()
+	})
+}
+
+// hideToast hides the undo toast
+func (app *App) hideToast() {
+	if app.toastTimeout != 0 {
+		glib.SourceRemove(app.toastTimeout)
+		app.toastTimeout = 0
+	}
+	app.toastUndo = nil
+	app.toast.SetRevealChild(false)
+}
+
+// offerUndoDelete shows a toast that puts a deleted event back
+func (app *App) offerUndoDelete(event *calendar.Event) {
+	text := "Event deleted"
+	if event.Title != "" {
+		text = "Deleted " + event.Title
+	}
+	app.showUndoToast(text, func() {
+		go func() {
+			if err := app.restoreEvent(event.ID); err != nil {
+				log.Printf("Error restoring %s: %v", event.ID, err)
+			}
+			glib.IdleAdd(func() {
+				app.refreshMonthView()
+				app.refreshDayDetail()
+			})
+		}()
+	})
+}
+
+// restoreEvent moves an event back from the trash and puts it back on its
+// provider
+func (app *App) restoreEvent(eventID string) error {
+	trashed, err := app.store.GetTrashedEvent(eventID)
+	if err != nil {
+		return fmt.Errorf("failed to load trashed event: %w", err)
+	}
+	account := app.remoteAccount(trashed.Event.CalendarID)
+	accountID := ""
+	if account != nil {
+		accountID = account.ID
+	}
+
+	if _, err := providers.RestoreEvent(app.store, eventID, accountID); err != nil {
+		return fmt.Errorf("failed to restore event: %w", err)
+	}
+	if account != nil {
+		go app.syncAccount(account)
+	}
+	return nil
+}
+
+// purgeTrash permanently deletes the events that have been in the trash for
+// longer than the configured retention
+func (app *App) purgeTrash() {
+	retention := app.config.TrashRetention()
+	if retention == 0 {
+		return
+	}
+	n, err := app.store.PurgeTrash(time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("Error purging trash: %v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Purged %d events from the trash", n)
+	}
+}
+
+// showTrashDialog lists the deleted events, to restore them or delete them
+// for good
+func (app *App) showTrashDialog() {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Trash")
+	dialog.SetTransientFor(&app.window.Window)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(420, 360)
+
+	content := dialog.ContentArea()
+	content.SetMarginTop(12)
+	content.SetMarginBottom(12)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetSpacing(8)
+
+	introText := "Deleted events stay here until you empty the trash."
+	if days := app.config.TrashRetentionDays; days > 0 {
+		introText = fmt.Sprintf("Deleted events are removed for good after %d days.", days)
+	}
+	intro := gtk.NewLabel(introText)
+	intro.SetXAlign(0)
+	intro.SetWrap(true)
+	intro.AddCSSClass("dim-label")
+	content.Append(intro)
+
+	scrolled := gtk.NewScrolledWindow()
+	scrolled.SetVExpand(true)
+	scrolled.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	content.Append(scrolled)
+
+	btnBox := gtk.NewBox(gtk.OrientationHorizontal, 8)
+	btnBox.SetHAlign(gtk.AlignEnd)
+	btnBox.SetMarginTop(12)
+
+	emptyBtn := gtk.NewButtonWithLabel("Empty Trash")
+	emptyBtn.AddCSSClass("destructive-action")
+	btnBox.Append(emptyBtn)
+
+	var reload func()
+	reload = func() {
+		list := gtk.NewBox(gtk.OrientationVertical, 8)
+		trashed, err := app.store.GetTrash()
+		if err != nil {
+			log.Printf("Error loading trash: %v", err)
+		}
+		if len(trashed) == 0 {
+			label := gtk.NewLabel("The trash is empty")
+			label.AddCSSClass("dim-label")
+			label.SetMarginTop(20)
+			list.Append(label)
+		}
+		for _, t := range trashed {
+			list.Append(app.trashRow(t, reload))
+		}
+		emptyBtn.SetSensitive(len(trashed) > 0)
+		scrolled.SetChild(list)
+	}
+	reload()
+
+	emptyBtn.ConnectClicked(func() {
+		if err := app.store.EmptyTrash(); err != nil {
+			log.Printf("Error emptying trash: %v", err)
+		}
+		reload()
+	})
+
+	closeBtn := gtk.NewButtonWithLabel("Close")
+	closeBtn.ConnectClicked(func() {
+		dialog.Close()
+	})
+	btnBox.Append(closeBtn)
+
+	content.Append(btnBox)
+	dialog.Show()
+}
+
+// trashRow renders one deleted event with buttons to restore it or delete it
+// for good
+func (app *App) trashRow(t *calendar.TrashedEvent, reload func()) *gtk.Box {
+	row := gtk.NewBox(gtk.OrientationHorizontal, 8)
+
+	shown := *t.Event
+	shown.Start, shown.End = t.Event.In(app.viewLocation())
+
+	info := gtk.NewBox(gtk.OrientationVertical, 2)
+	info.SetHExpand(true)
+	title := shown.Title
+	if title == "" {
+		title = "Untitled event"
+	}
+	name := gtk.NewLabel(title)
+	name.SetXAlign(0)
+	name.SetEllipsize(3) // PANGO_ELLIPSIZE_END
+	info.Append(name)
+
+	when := shown.Start.Format("Mon 2 Jan 2006")
+	if !shown.AllDay {
+		when += ", " + app.timeRangeText(shown.Start, shown.End)
+	}
+	if cal, err := app.store.GetCalendar(shown.CalendarID); err == nil {
+		when = cal.Name + " — " + when
+	}
+	whenLabel := gtk.NewLabel(when)
+	whenLabel.SetXAlign(0)
+	whenLabel.SetEllipsize(3)
+	whenLabel.AddCSSClass("dim-label")
+	info.Append(whenLabel)
+
+	deleted := gtk.NewLabel("Deleted " + t.DeletedAt.Format("2 Jan "+app.config.TimeFormat()))
+	deleted.SetXAlign(0)
+	deleted.AddCSSClass("dim-label")
+	info.Append(deleted)
+	row.Append(info)
+
+	restoreBtn := gtk.NewButtonWithLabel("Restore")
+	restoreBtn.SetVAlign(gtk.AlignCenter)
+	restoreBtn.ConnectClicked(func() {
+		restoreBtn.SetSensitive(false)
+		go func() {
+			if err := app.restoreEvent(t.Event.ID); err != nil {
+				log.Printf("Error restoring %s: %v", t.Event.ID, err)
+			}
+			glib.IdleAdd(func() {
+				reload()
+				app.refreshMonthView()
+				app.refreshDayDetail()
+			})
+		}()
+	})
+	row.Append(restoreBtn)
+
+	deleteBtn := gtk.NewButtonFromIconName("user-trash-symbolic")
+	deleteBtn.SetTooltipText("Delete permanently")
+	deleteBtn.SetVAlign(gtk.AlignCenter)
+	deleteBtn.ConnectClicked(func() {
+		if err := app.store.DeleteFromTrash(t.Event.ID); err != nil {
+			log.Printf("Error deleting %s from the trash: %v", t.Event.ID, err)
+		}
+		reload()
+	})
+	row.Append(deleteBtn)
+
+	return row
+}
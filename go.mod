@@ -2,18 +2,21 @@ module github.com/djwarf/switchcal
 
 go 1.25.5
 
+require (
+	github.com/diamondburned/gotk4/pkg v0.3.1
+	github.com/emersion/go-ical v0.0.0-20250609112844-439c63cef608
+	github.com/emersion/go-webdav v0.7.0
+	github.com/godbus/dbus/v5 v5.2.2
+	github.com/google/uuid v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/oauth2 v0.34.0
+)
+
 require (
 	cloud.google.com/go/compute/metadata v0.3.0 // indirect
 	github.com/KarpelesLab/weak v0.1.1 // indirect
-	github.com/diamondburned/gotk4/pkg v0.3.1 // indirect
-	github.com/emersion/go-ical v0.0.0-20250609112844-439c63cef608 // indirect
-	github.com/emersion/go-webdav v0.7.0 // indirect
-	github.com/godbus/dbus/v5 v5.2.2 // indirect
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/mattn/go-sqlite3 v1.14.33 // indirect
 	github.com/teambition/rrule-go v1.8.2 // indirect
 	go4.org/unsafe/assume-no-moving-gc v0.0.0-20231121144256-b99613f794b6 // indirect
-	golang.org/x/oauth2 v0.34.0 // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
 	golang.org/x/sys v0.27.0 // indirect
 )
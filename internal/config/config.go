@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 )
 
+// minSyncInterval keeps a small sync_interval_seconds from hammering servers
+const minSyncInterval = time.Minute
+
 // Config holds application configuration
 type Config struct {
 	// Data directory
@@ -14,23 +18,43 @@ type Config struct {
 	// Sync settings
 	SyncIntervalSeconds int  `json:"sync_interval_seconds"`
 	SyncOnStartup       bool `json:"sync_on_startup"`
+	SyncOnMetered       bool `json:"sync_on_metered"` // Keep syncing on metered connections
 
 	// UI settings
-	Theme           string `json:"theme"` // "light", "dark", "system"
-	DefaultView     string `json:"default_view"` // "month", "week", "day"
+	Theme           string `json:"theme"`          // "light", "dark", "system"
+	DefaultView     string `json:"default_view"`   // "month", "week", "day"
 	WeekStartsOn    int    `json:"week_starts_on"` // 0=Sunday, 1=Monday
 	ShowWeekNumbers bool   `json:"show_week_numbers"`
 	Use24HourTime   bool   `json:"use_24h_time"`
+	HideDeclined    bool   `json:"hide_declined"` // Hide events the user declined instead of dimming them
+
+	// Time zones, empty for the system zone and none
+	ViewTimeZone      string `json:"view_time_zone,omitempty"`      // Zone the calendar is shown in, e.g. while travelling
+	SecondaryTimeZone string `json:"secondary_time_zone,omitempty"` // Zone shown alongside event times
+
+	// Days deleted events stay in the trash, or 0 to keep them until emptied
+	TrashRetentionDays int `json:"trash_retention_days"`
+
+	// Google OAuth client used instead of the built-in one, e.g. a
+	// Workspace organisation's internal app. Accounts may set their own.
+	// A secret written here is moved to the keyring or secrets file.
+	GoogleClientID     string `json:"google_client_id,omitempty"`
+	GoogleClientSecret string `json:"google_client_secret,omitempty"`
+
+	// Azure application used to sign in to Microsoft accounts. SwitchCal
+	// ships none; the tenant defaults to "common".
+	MicrosoftClientID string `json:"microsoft_client_id,omitempty"`
+	MicrosoftTenant   string `json:"microsoft_tenant,omitempty"`
 
 	// Notification settings
 	NotificationsEnabled bool `json:"notifications_enabled"`
 	DefaultReminderMins  int  `json:"default_reminder_mins"`
 
 	// Window state
-	WindowWidth  int `json:"window_width"`
-	WindowHeight int `json:"window_height"`
-	WindowX      int `json:"window_x"`
-	WindowY      int `json:"window_y"`
+	WindowWidth  int  `json:"window_width"`
+	WindowHeight int  `json:"window_height"`
+	WindowX      int  `json:"window_x"`
+	WindowY      int  `json:"window_y"`
 	Maximized    bool `json:"maximized"`
 }
 
@@ -38,7 +62,7 @@ type Config struct {
 func DefaultConfig() *Config {
 	return &Config{
 		DataDir:              getDefaultDataDir(),
-		SyncIntervalSeconds:  5,
+		SyncIntervalSeconds:  300,
 		SyncOnStartup:        true,
 		Theme:                "system",
 		DefaultView:          "month",
@@ -46,6 +70,7 @@ func DefaultConfig() *Config {
 		ShowWeekNumbers:      false,
 		NotificationsEnabled: true,
 		DefaultReminderMins:  30,
+		TrashRetentionDays:   30,
 		WindowWidth:          900,
 		WindowHeight:         600,
 	}
@@ -103,11 +128,34 @@ func (c *Config) TimeFormat() string {
 	return "3:04 PM"
 }
 
+// SyncInterval returns the time between background syncs of an account, or
+// zero if they are disabled
+func (c *Config) SyncInterval() time.Duration {
+	if c.SyncIntervalSeconds <= 0 {
+		return 0
+	}
+	return max(time.Duration(c.SyncIntervalSeconds)*time.Second, minSyncInterval)
+}
+
+// TrashRetention returns how long deleted events are kept in the trash, or
+// zero if they are kept until the trash is emptied
+func (c *Config) TrashRetention() time.Duration {
+	if c.TrashRetentionDays <= 0 {
+		return 0
+	}
+	return time.Duration(c.TrashRetentionDays) * 24 * time.Hour
+}
+
 // DatabasePath returns the path to the SQLite database
 func (c *Config) DatabasePath() string {
 	return filepath.Join(c.DataDir, "switchcal.db")
 }
 
+// SecretsPath returns the path to the encrypted secrets file used when no keyring is available
+func (c *Config) SecretsPath() string {
+	return filepath.Join(c.DataDir, "secrets.enc")
+}
+
 // getConfigPath returns the path to the config file
 func getConfigPath() string {
 	configDir, err := os.UserConfigDir()
@@ -0,0 +1,69 @@
+package calendar
+
+import "time"
+
+// Conflict is an event that was changed both locally and on the server
+// since the last sync. The local version is the stored event, which is nil
+// when it was deleted locally; Remote is nil when the server deleted it.
+type Conflict struct {
+	AccountID  string    `json:"account_id"`
+	CalendarID string    `json:"calendar_id"`
+	EventID    string    `json:"event_id"`
+	Remote     *Event    `json:"remote"`
+	Detected   time.Time `json:"detected"`
+}
+
+// ConflictField is a group of event fields resolved together when merging a conflict
+type ConflictField string
+
+const (
+	ConflictTitle       ConflictField = "title"
+	ConflictTime        ConflictField = "time" // Start, end and all-day
+	ConflictLocation    ConflictField = "location"
+	ConflictDescription ConflictField = "description"
+)
+
+// ConflictFields lists the fields of a conflict in display order
+var ConflictFields = []ConflictField{ConflictTitle, ConflictTime, ConflictLocation, ConflictDescription}
+
+// DiffEvents returns the fields that differ between two versions of an event
+func DiffEvents(local, remote *Event) []ConflictField {
+	var fields []ConflictField
+	if local.Title != remote.Title {
+		fields = append(fields, ConflictTitle)
+	}
+	if !local.Start.Equal(remote.Start) || !local.End.Equal(remote.End) || local.AllDay != remote.AllDay ||
+		local.Floating != remote.Floating {
+		fields = append(fields, ConflictTime)
+	}
+	if local.Location != remote.Location {
+		fields = append(fields, ConflictLocation)
+	}
+	if local.Description != remote.Description {
+		fields = append(fields, ConflictDescription)
+	}
+	return fields
+}
+
+// MergeEvents returns the remote version of an event with the given fields
+// taken from the local version
+func MergeEvents(local, remote *Event, fromLocal []ConflictField) *Event {
+	merged := *remote
+	for _, f := range fromLocal {
+		switch f {
+		case ConflictTitle:
+			merged.Title = local.Title
+		case ConflictTime:
+			merged.Start, merged.End, merged.AllDay = local.Start, local.End, local.AllDay
+			merged.TimeZone, merged.EndTimeZone, merged.Floating = local.TimeZone, local.EndTimeZone, local.Floating
+		case ConflictLocation:
+			merged.Location = local.Location
+		case ConflictDescription:
+			merged.Description = local.Description
+		}
+	}
+	if len(DiffEvents(&merged, remote)) > 0 {
+		merged.Modified = time.Now()
+	}
+	return &merged
+}
@@ -1,14 +1,24 @@
 package calendar
 
 import (
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
-// Event represents a calendar event
+// Event represents a calendar event. ID is assigned locally and never
+// changes; on the server the event is identified by its calendar, RemoteID
+// and RecurrenceID, so the same meeting in two calendars is two events.
 type Event struct {
-	ID          string    `json:"id"`
-	CalendarID  string    `json:"calendar_id"`
-	UID         string    `json:"uid"` // iCal UID
+	ID         string `json:"id"`
+	CalendarID string `json:"calendar_id"`
+	UID        string `json:"uid"` // iCal UID
+
+	// Server identity, empty until the event has been uploaded
+	RemoteID     string `json:"remote_id,omitempty"`     // Provider's ID for the event
+	RecurrenceID string `json:"recurrence_id,omitempty"` // Original start of a single occurrence: UTC RFC 3339, or a date if all-day
+
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	Location    string    `json:"location"`
@@ -17,6 +27,16 @@ type Event struct {
 	AllDay      bool      `json:"all_day"`
 	Color       string    `json:"color"`
 
+	// Start and End are shown in the local zone. All-day dates and floating
+	// times keep their wall-clock time wherever the computer is.
+	TimeZone    string `json:"time_zone,omitempty"`     // IANA zone the event was scheduled in
+	EndTimeZone string `json:"end_time_zone,omitempty"` // Zone of End if it differs, e.g. for a flight
+	Floating    bool   `json:"floating,omitempty"`      // Times without a zone, e.g. "9:00 wherever I am"
+
+	// People invited to a meeting; both are empty for personal events
+	Organizer *Attendee  `json:"organizer,omitempty"`
+	Attendees []Attendee `json:"attendees,omitempty"`
+
 	// Recurrence
 	Recurrence *RecurrenceRule `json:"recurrence,omitempty"`
 
@@ -42,15 +62,69 @@ const (
 	StatusCancelled EventStatus = "cancelled"
 )
 
+// ParticipationStatus is an attendee's reply to an invitation
+type ParticipationStatus string
+
+const (
+	ParticipationNeedsAction ParticipationStatus = "needs-action"
+	ParticipationAccepted    ParticipationStatus = "accepted"
+	ParticipationTentative   ParticipationStatus = "tentative"
+	ParticipationDeclined    ParticipationStatus = "declined"
+)
+
+// Attendee is a person invited to an event, or its organizer
+type Attendee struct {
+	Email    string              `json:"email"`
+	Name     string              `json:"name,omitempty"`
+	Status   ParticipationStatus `json:"status,omitempty"`
+	Optional bool                `json:"optional,omitempty"`
+	Self     bool                `json:"self,omitempty"` // The account's own user
+}
+
+// DisplayName returns the attendee's name, or their email address if it is unknown
+func (a *Attendee) DisplayName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return a.Email
+}
+
+// SelfAttendee returns the account's own user among the attendees, or nil if
+// they are not invited
+func (e *Event) SelfAttendee() *Attendee {
+	for i := range e.Attendees {
+		if e.Attendees[i].Self {
+			return &e.Attendees[i]
+		}
+	}
+	return nil
+}
+
+// MarkSelf flags the attendees and organizer whose address is email as the
+// account's own user
+func (e *Event) MarkSelf(email string) {
+	if email == "" {
+		return
+	}
+	for i := range e.Attendees {
+		if strings.EqualFold(e.Attendees[i].Email, email) {
+			e.Attendees[i].Self = true
+		}
+	}
+	if e.Organizer != nil && strings.EqualFold(e.Organizer.Email, email) {
+		e.Organizer.Self = true
+	}
+}
+
 // RecurrenceRule defines how an event repeats
 type RecurrenceRule struct {
 	Frequency  Frequency `json:"frequency"`
-	Interval   int       `json:"interval"`   // Every N days/weeks/months/years
-	Count      int       `json:"count"`      // Number of occurrences (0 = infinite)
-	Until      time.Time `json:"until"`      // End date (zero = no end)
-	ByDay      []Weekday `json:"by_day"`     // For weekly: which days
+	Interval   int       `json:"interval"`    // Every N days/weeks/months/years
+	Count      int       `json:"count"`       // Number of occurrences (0 = infinite)
+	Until      time.Time `json:"until"`       // End date (zero = no end)
+	ByDay      []Weekday `json:"by_day"`      // For weekly: which days
 	ByMonthDay []int     `json:"by_monthday"` // For monthly: which days of month
-	ByMonth    []int     `json:"by_month"`   // For yearly: which months
+	ByMonth    []int     `json:"by_month"`    // For yearly: which months
 }
 
 // Frequency represents recurrence frequency
@@ -76,6 +150,19 @@ const (
 	Sunday    Weekday = "SU"
 )
 
+// Task represents a to-do item (iCal VTODO)
+type Task struct {
+	ID          string    `json:"id"`
+	CalendarID  string    `json:"calendar_id"`
+	UID         string    `json:"uid"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Due         time.Time `json:"due"`       // Zero = no due date
+	Completed   time.Time `json:"completed"` // Zero = not completed
+	Priority    int       `json:"priority"`  // 1 (highest) to 9, 0 = undefined
+	ETag        string    `json:"etag"`
+}
+
 // Calendar represents a calendar (container for events)
 type Calendar struct {
 	ID          string `json:"id"`
@@ -85,6 +172,7 @@ type Calendar struct {
 	Color       string `json:"color"`
 	Visible     bool   `json:"visible"`
 	ReadOnly    bool   `json:"read_only"`
+	Order       int    `json:"order"` // Position among the account's calendars
 
 	// Sync metadata
 	SyncToken string    `json:"sync_token"`
@@ -93,39 +181,74 @@ type Calendar struct {
 
 // Account represents a calendar account (Google, Apple, etc.)
 type Account struct {
-	ID       string      `json:"id"`
-	Name     string      `json:"name"`
-	Type     AccountType `json:"type"`
-	Email    string      `json:"email"`
-	Enabled  bool        `json:"enabled"`
+	ID      string      `json:"id"`
+	Name    string      `json:"name"`
+	Type    AccountType `json:"type"`
+	Email   string      `json:"email"`
+	Enabled bool        `json:"enabled"`
 
 	// Connection details
 	ServerURL string `json:"server_url"`
 	Username  string `json:"username"`
 
-	// OAuth tokens (encrypted at rest)
+	// OAuth client used instead of the application default, if set
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"` // Kept in the SecretStore
+
+	// OAuth tokens (kept in the SecretStore, not the database)
 	AccessToken  string    `json:"access_token,omitempty"`
 	RefreshToken string    `json:"refresh_token,omitempty"`
 	TokenExpiry  time.Time `json:"token_expiry,omitempty"`
 
-	// App password (for non-OAuth providers)
+	// App password for non-OAuth providers (kept in the SecretStore)
 	AppPassword string `json:"app_password,omitempty"`
 
+	// GNOME Online Accounts ID of a linked account, whose credentials are
+	// borrowed from the desktop on each use and never stored
+	GOAID string `json:"goa_id,omitempty"`
+
 	LastSync time.Time `json:"last_sync"`
+
+	// Whether the credentials above were read from the SecretStore; an
+	// account loaded without them must not overwrite the stored ones
+	secretsLoaded bool
+}
+
+// SyncRecord is an entry in an account's sync history
+type SyncRecord struct {
+	ID            int64         `json:"id"`
+	AccountID     string        `json:"account_id"`
+	CalendarID    string        `json:"calendar_id"` // Empty for account-level failures
+	Started       time.Time     `json:"started"`
+	Duration      time.Duration `json:"duration"`
+	EventsCreated int           `json:"events_created"`
+	EventsUpdated int           `json:"events_updated"`
+	EventsDeleted int           `json:"events_deleted"`
+	Errors        []string      `json:"errors,omitempty"`
+}
+
+// Failed returns true if the sync reported any error
+func (r *SyncRecord) Failed() bool {
+	return len(r.Errors) > 0
 }
 
 // AccountType represents the type of calendar account
 type AccountType string
 
 const (
-	AccountTypeGoogle    AccountType = "google"
-	AccountTypeApple     AccountType = "apple"
-	AccountTypeOutlook   AccountType = "outlook"
-	AccountTypeSamsung   AccountType = "samsung"
-	AccountTypeCalDAV    AccountType = "caldav"
-	AccountTypeLocal     AccountType = "local"
+	AccountTypeGoogle  AccountType = "google"
+	AccountTypeApple   AccountType = "apple"
+	AccountTypeOutlook AccountType = "outlook"
+	AccountTypeSamsung AccountType = "samsung"
+	AccountTypeCalDAV  AccountType = "caldav"
+	AccountTypeLocal   AccountType = "local"
 )
 
+// NewEventID returns a new local event ID
+func NewEventID() string {
+	return "evt-" + uuid.NewString()
+}
+
 // Duration returns the duration of the event
 func (e *Event) Duration() time.Duration {
 	return e.End.Sub(e.Start)
@@ -152,3 +275,44 @@ func (e *Event) IsOnDate(date time.Time) bool {
 	dateEnd := dateStart.Add(24 * time.Hour)
 	return e.Start.Before(dateEnd) && e.End.After(dateStart)
 }
+
+// ChangeOp is the kind of a change waiting to be sent to a provider
+type ChangeOp string
+
+const (
+	ChangeCreate ChangeOp = "create"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// PendingChange is a local event change queued in the outbox until the
+// account's provider accepts it
+type PendingChange struct {
+	ID          int64     `json:"id"`
+	AccountID   string    `json:"account_id"`
+	CalendarID  string    `json:"calendar_id"`
+	EventID     string    `json:"event_id"`
+	Op          ChangeOp  `json:"op"`
+	Created     time.Time `json:"created"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"` // Zero when it can be sent right away
+	LastError   string    `json:"last_error,omitempty"`
+
+	// Provider's ID for the event, needed to delete it once the local copy is gone
+	RemoteID string `json:"remote_id,omitempty"`
+
+	// Server version the change was made to, used to detect conflicting remote edits
+	BaseETag     string    `json:"base_etag,omitempty"`
+	BaseModified time.Time `json:"base_modified,omitempty"`
+}
+
+// Failed returns true if the last attempt to send the change failed
+func (c *PendingChange) Failed() bool {
+	return c.LastError != ""
+}
+
+// TrashedEvent is a deleted event kept in the trash until it is restored or purged
+type TrashedEvent struct {
+	Event     *Event    `json:"event"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
@@ -0,0 +1,728 @@
+package calendar
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// iCalendar date and time layouts (RFC 5545 section 3.3)
+const (
+	icalDate          = "20060102"
+	icalDateTime      = "20060102T150405"
+	icalDateTimeUTC   = "20060102T150405Z"
+	icalPropXLocation = "X-LIC-LOCATION" // IANA name some clients add to VTIMEZONE
+	icalProductID     = "-//UniCal//EN"
+)
+
+// NewICalendar returns an empty VCALENDAR
+func NewICalendar() *ical.Calendar {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, icalProductID)
+	return cal
+}
+
+// EventToICal returns a VCALENDAR holding one event
+func EventToICal(e *Event) *ical.Calendar {
+	cal := NewICalendar()
+	AddICalEvent(cal, e)
+	return cal
+}
+
+// WriteICal writes events to w as one VCALENDAR, e.g. to export a calendar
+func WriteICal(w io.Writer, events []*Event) error {
+	if len(events) == 0 {
+		// A VCALENDAR needs at least one component
+		return fmt.Errorf("no events to export")
+	}
+	cal := NewICalendar()
+	for _, e := range events {
+		AddICalEvent(cal, e)
+	}
+	return ical.NewEncoder(w).Encode(cal)
+}
+
+// AddICalEvent adds an event to cal as a VEVENT with its recurrence,
+// reminders and guests, and the VTIMEZONEs of its zones
+func AddICalEvent(cal *ical.Calendar, e *Event) *ical.Component {
+	vevent := ical.NewComponent(ical.CompEvent)
+	uid := e.UID
+	if uid == "" {
+		uid = e.ID
+	}
+	vevent.Props.SetText(ical.PropUID, uid)
+	vevent.Props.SetText(ical.PropSummary, e.Title)
+	if e.Description != "" {
+		vevent.Props.SetText(ical.PropDescription, e.Description)
+	}
+	if e.Location != "" {
+		vevent.Props.SetText(ical.PropLocation, e.Location)
+	}
+
+	SetICalTimes(cal, vevent, e)
+	SetICalAttendees(vevent, e)
+	vevent.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	if !e.Created.IsZero() {
+		vevent.Props.SetDateTime(ical.PropCreated, e.Created.UTC())
+	}
+	if !e.Modified.IsZero() {
+		vevent.Props.SetDateTime(ical.PropLastModified, e.Modified.UTC())
+	}
+
+	if e.RecurrenceID != "" {
+		if t, err := time.Parse(time.RFC3339, e.RecurrenceID); err == nil {
+			vevent.Props.SetDateTime(ical.PropRecurrenceID, t.UTC())
+		} else if t, err := time.Parse("2006-01-02", e.RecurrenceID); err == nil {
+			vevent.Props.SetDate(ical.PropRecurrenceID, t)
+		}
+	}
+	if e.Recurrence != nil {
+		setPropValue(vevent.Props, ical.PropRecurrenceRule, formatICalRecurrence(e.Recurrence, e.AllDay))
+	}
+
+	switch e.Status {
+	case StatusConfirmed:
+		vevent.Props.SetText(ical.PropStatus, "CONFIRMED")
+	case StatusTentative:
+		vevent.Props.SetText(ical.PropStatus, "TENTATIVE")
+	case StatusCancelled:
+		vevent.Props.SetText(ical.PropStatus, "CANCELLED")
+	}
+
+	// One display alarm per reminder, before the start
+	for _, mins := range e.Reminders {
+		alarm := ical.NewComponent(ical.CompAlarm)
+		alarm.Props.SetText(ical.PropAction, "DISPLAY")
+		alarm.Props.SetText(ical.PropDescription, e.Title)
+		setPropValue(alarm.Props, ical.PropTrigger, fmt.Sprintf("-PT%dM", mins))
+		vevent.Children = append(vevent.Children, alarm)
+	}
+
+	cal.Children = append(cal.Children, vevent)
+	return vevent
+}
+
+// formatICalRecurrence writes a recurrence rule as an RRULE value
+func formatICalRecurrence(r *RecurrenceRule, allDay bool) string {
+	parts := []string{"FREQ=" + strings.ToUpper(string(r.Frequency))}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	} else if !r.Until.IsZero() {
+		if allDay {
+			parts = append(parts, "UNTIL="+r.Until.Format(icalDate))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format(icalDateTimeUTC))
+		}
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = string(d)
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		parts = append(parts, "BYMONTHDAY="+joinInts(r.ByMonthDay))
+	}
+	if len(r.ByMonth) > 0 {
+		parts = append(parts, "BYMONTH="+joinInts(r.ByMonth))
+	}
+	return strings.Join(parts, ";")
+}
+
+// parseICalRecurrence reads an RRULE value, returning nil for frequencies
+// RecurrenceRule cannot hold
+func parseICalRecurrence(value string) *RecurrenceRule {
+	r := &RecurrenceRule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, val, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Frequency = Frequency(strings.ToLower(val))
+		case "INTERVAL":
+			if n, err := strconv.Atoi(val); err == nil && n > 0 {
+				r.Interval = n
+			}
+		case "COUNT":
+			r.Count, _ = strconv.Atoi(val)
+		case "UNTIL":
+			for _, layout := range []string{icalDateTimeUTC, icalDateTime, icalDate} {
+				if t, err := time.Parse(layout, val); err == nil {
+					r.Until = t
+					break
+				}
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(val, ",") {
+				r.ByDay = append(r.ByDay, Weekday(strings.ToUpper(d)))
+			}
+		case "BYMONTHDAY":
+			r.ByMonthDay = splitInts(val)
+		case "BYMONTH":
+			r.ByMonth = splitInts(val)
+		}
+	}
+	switch r.Frequency {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+		return r
+	}
+	return nil
+}
+
+// parseICalReminders returns the minutes before the start at which a
+// VEVENT's alarms go off, skipping alarms at fixed times or after the start
+func parseICalReminders(vevent *ical.Component) []int {
+	var reminders []int
+	for _, child := range vevent.Children {
+		if child.Name != ical.CompAlarm {
+			continue
+		}
+		trigger := child.Props.Get(ical.PropTrigger)
+		if trigger == nil || strings.EqualFold(trigger.Params.Get(ical.ParamRelated), "END") {
+			continue
+		}
+		d, err := trigger.Duration()
+		if err != nil || d > 0 {
+			continue
+		}
+		reminders = append(reminders, int(-d/time.Minute))
+	}
+	return reminders
+}
+
+// joinInts formats numbers as a comma-separated list
+func joinInts(nums []int) string {
+	s := make([]string, len(nums))
+	for i, n := range nums {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+// splitInts reads a comma-separated list of numbers, skipping invalid ones
+func splitInts(s string) []int {
+	var nums []int
+	for _, part := range strings.Split(s, ",") {
+		if n, err := strconv.Atoi(part); err == nil {
+			nums = append(nums, n)
+		}
+	}
+	return nums
+}
+
+// ParseICalEvent reads an event from a VEVENT of cal, leaving its local ID,
+// calendar and RemoteID for the caller to set
+func ParseICalEvent(cal *ical.Calendar, vevent *ical.Component) (*Event, error) {
+	e := &Event{
+		UID:         propValue(vevent.Props, ical.PropUID),
+		Title:       textValue(vevent.Props, ical.PropSummary),
+		Description: textValue(vevent.Props, ical.PropDescription),
+		Location:    textValue(vevent.Props, ical.PropLocation),
+		Status:      StatusConfirmed,
+	}
+	if prop := vevent.Props.Get(ical.PropRecurrenceID); prop != nil {
+		e.RecurrenceID = ICalRecurrenceID(cal, prop)
+	}
+
+	// Times, resolving TZIDs through the calendar's VTIMEZONEs
+	if err := ParseICalTimes(cal, vevent, e); err != nil {
+		return nil, fmt.Errorf("failed to parse event times: %w", err)
+	}
+
+	ParseICalAttendees(vevent, e)
+
+	if rule := propValue(vevent.Props, ical.PropRecurrenceRule); rule != "" {
+		e.Recurrence = parseICalRecurrence(rule)
+	}
+	e.Reminders = parseICalReminders(vevent)
+
+	if prop := vevent.Props.Get(ical.PropCreated); prop != nil {
+		if t, err := prop.DateTime(nil); err == nil {
+			e.Created = t
+		}
+	}
+	if prop := vevent.Props.Get(ical.PropLastModified); prop != nil {
+		if t, err := prop.DateTime(nil); err == nil {
+			e.Modified = t
+		}
+	}
+
+	switch strings.ToUpper(propValue(vevent.Props, ical.PropStatus)) {
+	case "TENTATIVE":
+		e.Status = StatusTentative
+	case "CANCELLED":
+		e.Status = StatusCancelled
+		e.Cancelled = true
+	}
+	return e, nil
+}
+
+// ICalRecurrenceID formats a RECURRENCE-ID the way Event.RecurrenceID holds
+// it, resolving its TZID like the event's times
+func ICalRecurrenceID(cal *ical.Calendar, prop *ical.Prop) string {
+	t, _, _, allDay, err := parseICalTime(cal, prop)
+	if err != nil {
+		return ""
+	}
+	if allDay {
+		return t.Format("2006-01-02")
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// ParseICalTimes sets an event's start, end, all-day flag, time zones and
+// floating flag from a VEVENT. TZIDs are resolved as IANA names or through
+// the VTIMEZONE definitions in cal.
+func ParseICalTimes(cal *ical.Calendar, vevent *ical.Component, e *Event) error {
+	startProp := vevent.Props.Get(ical.PropDateTimeStart)
+	if startProp == nil {
+		return fmt.Errorf("event has no start")
+	}
+
+	start, tz, floating, allDay, err := parseICalTime(cal, startProp)
+	if err != nil {
+		return fmt.Errorf("invalid start: %w", err)
+	}
+	e.Start, e.TimeZone, e.Floating, e.AllDay = start, tz, floating, allDay
+	e.EndTimeZone = ""
+
+	switch {
+	case vevent.Props.Get(ical.PropDateTimeEnd) != nil:
+		var endTZ string
+		e.End, endTZ, _, _, err = parseICalTime(cal, vevent.Props.Get(ical.PropDateTimeEnd))
+		if err != nil {
+			return fmt.Errorf("invalid end: %w", err)
+		}
+		if endTZ != tz {
+			e.EndTimeZone = endTZ
+		}
+	case vevent.Props.Get(ical.PropDuration) != nil:
+		d, err := vevent.Props.Get(ical.PropDuration).Duration()
+		if err != nil {
+			return fmt.Errorf("invalid duration: %w", err)
+		}
+		e.End = e.Start.Add(d)
+		if allDay {
+			e.End = e.Start.AddDate(0, 0, int(d.Hours()/24))
+		}
+	case allDay:
+		e.End = e.Start.AddDate(0, 0, 1)
+	default:
+		e.End = e.Start
+	}
+	return nil
+}
+
+// parseICalTime parses a DATE or DATE-TIME property. Dates and floating
+// times are returned as wall-clock times in the local zone.
+func parseICalTime(cal *ical.Calendar, prop *ical.Prop) (t time.Time, tz string, floating, allDay bool, err error) {
+	value := prop.Value
+	if prop.ValueType() == ical.ValueDate || len(value) == len(icalDate) {
+		t, err = time.ParseInLocation(icalDate, value, time.Local)
+		return t, "", false, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse(icalDateTimeUTC, value)
+		return t.Local(), "", false, false, err
+	}
+
+	tzid := prop.Params.Get(ical.ParamTimezoneID)
+	if tzid == "" {
+		t, err = time.ParseInLocation(icalDateTime, value, time.Local)
+		return t, "", true, false, err
+	}
+
+	loc, name := resolveTZID(cal, tzid)
+	t, err = time.ParseInLocation(icalDateTime, value, loc)
+	return t.Local(), name, false, false, err
+}
+
+// resolveTZID finds the location of a TZID and its IANA name, if it has
+// one. Besides IANA names, it understands prefixed names such as
+// "/mozilla.org/20050126_1/Europe/Berlin" and falls back to the standard
+// offset of the calendar's VTIMEZONE.
+func resolveTZID(cal *ical.Calendar, tzid string) (*time.Location, string) {
+	if loc := LoadTimeZone(tzid); loc != nil {
+		return loc, tzid
+	}
+
+	var vtimezone *ical.Component
+	if cal != nil {
+		for _, child := range cal.Children {
+			if child.Name == ical.CompTimezone && propValue(child.Props, ical.PropTimezoneID) == tzid {
+				vtimezone = child
+				break
+			}
+		}
+	}
+	if vtimezone != nil {
+		if name := propValue(vtimezone.Props, icalPropXLocation); LoadTimeZone(name) != nil {
+			return LoadTimeZone(name), name
+		}
+	}
+
+	// Try the trailing "Area/City" of prefixed names
+	parts := strings.Split(strings.Trim(tzid, "/"), "/")
+	for i := range parts {
+		name := strings.Join(parts[i:], "/")
+		if loc := LoadTimeZone(name); loc != nil {
+			return loc, name
+		}
+	}
+
+	if vtimezone != nil {
+		for _, child := range vtimezone.Children {
+			if child.Name != ical.CompTimezoneStandard {
+				continue
+			}
+			if offset, err := parseUTCOffset(propValue(child.Props, ical.PropTimezoneOffsetTo)); err == nil {
+				return time.FixedZone(tzid, offset), ""
+			}
+		}
+	}
+	return time.UTC, ""
+}
+
+// SetICalTimes writes an event's start and end to a VEVENT: all-day events
+// as dates, floating times without a zone, and other times in the zones they
+// were scheduled in, whose VTIMEZONEs are added to cal, or in UTC without one
+func SetICalTimes(cal *ical.Calendar, vevent *ical.Component, e *Event) {
+	vevent.Props.Del(ical.PropDateTimeStart)
+	vevent.Props.Del(ical.PropDateTimeEnd)
+	vevent.Props.Del(ical.PropDuration)
+
+	if e.AllDay {
+		vevent.Props.SetDate(ical.PropDateTimeStart, e.Start)
+		vevent.Props.SetDate(ical.PropDateTimeEnd, e.End)
+		return
+	}
+	if e.Floating {
+		for name, t := range map[string]time.Time{ical.PropDateTimeStart: e.Start, ical.PropDateTimeEnd: e.End} {
+			prop := ical.NewProp(name)
+			prop.SetValueType(ical.ValueDateTime)
+			prop.Value = t.Format(icalDateTime)
+			vevent.Props.Set(prop)
+		}
+		return
+	}
+
+	for _, zoned := range []struct {
+		name string
+		t    time.Time
+		zone string
+	}{
+		{ical.PropDateTimeStart, e.Start, e.TimeZone},
+		{ical.PropDateTimeEnd, e.End, e.EndZone()},
+	} {
+		loc := LoadTimeZone(zoned.zone)
+		if loc == nil || loc == time.UTC {
+			vevent.Props.SetDateTime(zoned.name, zoned.t.UTC())
+			continue
+		}
+		prop := ical.NewProp(zoned.name)
+		prop.SetValueType(ical.ValueDateTime)
+		prop.Params.Set(ical.ParamTimezoneID, zoned.zone)
+		prop.Value = zoned.t.In(loc).Format(icalDateTime)
+		vevent.Props.Set(prop)
+		addVTimezone(cal, loc, e.Start, e.End)
+	}
+}
+
+// addVTimezone adds the definition of a zone to cal, covering its offset
+// changes from a year before start to a year after end. Changes that recur
+// every year are written as RRULEs, the latest of which has no end, so
+// recurring events stay covered. A definition already in cal is widened to
+// cover start and end.
+func addVTimezone(cal *ical.Calendar, loc *time.Location, start, end time.Time) {
+	from, until := start.AddDate(-1, 0, 0), end.AddDate(1, 0, 0)
+	index := -1
+	for i, child := range cal.Children {
+		if child.Name == ical.CompTimezone && propValue(child.Props, ical.PropTimezoneID) == loc.String() {
+			first, last, open := observanceSpan(child)
+			if !from.Before(first) && (open || !until.After(last)) {
+				return
+			}
+			index = i
+			if first.Before(from) {
+				from = first
+			}
+			if last.After(until) {
+				until = last
+			}
+			break
+		}
+	}
+
+	vtimezone := ical.NewComponent(ical.CompTimezone)
+	setPropValue(vtimezone.Props, ical.PropTimezoneID, loc.String())
+	setPropValue(vtimezone.Props, icalPropXLocation, loc.String())
+	for _, rule := range zoneRules(loc, from, until) {
+		kind := ical.CompTimezoneStandard
+		if rule.dst {
+			kind = ical.CompTimezoneDaylight
+		}
+		observance := ical.NewComponent(kind)
+		// The onset is given in the local time in effect before it
+		setPropValue(observance.Props, ical.PropDateTimeStart, rule.onset.Format(icalDateTime))
+		setPropValue(observance.Props, ical.PropTimezoneOffsetFrom, formatUTCOffset(rule.from))
+		setPropValue(observance.Props, ical.PropTimezoneOffsetTo, formatUTCOffset(rule.to))
+		setPropValue(observance.Props, ical.PropTimezoneName, rule.name)
+		if rule.years > 1 {
+			rrule := fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", rule.onset.Month(), rule.week,
+				strings.ToUpper(rule.onset.Weekday().String()[:2]))
+			if !rule.last.IsZero() {
+				rrule += ";UNTIL=" + rule.last.UTC().Format(icalDateTimeUTC)
+			}
+			setPropValue(observance.Props, ical.PropRecurrenceRule, rrule)
+		}
+		vtimezone.Children = append(vtimezone.Children, observance)
+	}
+
+	if index >= 0 {
+		cal.Children[index] = vtimezone
+		return
+	}
+	// Zone definitions come before the events that use them
+	cal.Children = append([]*ical.Component{vtimezone}, cal.Children...)
+}
+
+// zoneRule is an offset change of a zone, repeated on the same weekday of
+// the same month at the same local time for a number of consecutive years
+type zoneRule struct {
+	onset    time.Time // First change, in the local time in effect before it
+	from, to int       // UTC offsets in seconds
+	name     string
+	dst      bool
+	week     int       // Week of the month, -1 for the last
+	years    int       // Number of changes
+	last     time.Time // Last change, zero if the rule has not ended
+}
+
+// matches reports whether a change a year after the rule's latest one
+// continues it
+func (r *zoneRule) matches(c *zoneRule) bool {
+	latest := r.onset.AddDate(r.years-1, 0, 0)
+	return c.from == r.from && c.to == r.to && c.name == r.name && c.dst == r.dst && c.week == r.week &&
+		c.onset.Year() == latest.Year()+1 && c.onset.Month() == latest.Month() && c.onset.Weekday() == r.onset.Weekday() &&
+		c.onset.Hour() == r.onset.Hour() && c.onset.Minute() == r.onset.Minute() && c.onset.Second() == r.onset.Second()
+}
+
+// zoneRules returns the offset changes of a zone between from and until,
+// starting with the one in effect at from, merged into yearly rules
+func zoneRules(loc *time.Location, from, until time.Time) []*zoneRule {
+	var rules []*zoneRule
+	current := make(map[bool]*zoneRule) // Latest rule for daylight and standard time
+	t := from.In(loc)
+	for {
+		onset, next := t.ZoneBounds()
+		name, offset := t.Zone()
+		prevOffset := offset
+		if !onset.IsZero() {
+			_, prevOffset = onset.Add(-time.Second).Zone()
+		} else {
+			onset = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC).Add(-time.Duration(offset) * time.Second)
+		}
+		local := onset.UTC().Add(time.Duration(prevOffset) * time.Second)
+		week := (local.Day()-1)/7 + 1
+		if local.Day()+7 > time.Date(local.Year(), local.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day() {
+			week = -1
+		}
+		change := &zoneRule{onset: local, from: prevOffset, to: offset, name: name, dst: t.IsDST(), week: week, years: 1, last: onset}
+
+		if r := current[change.dst]; r != nil && r.matches(change) {
+			r.years++
+			r.last = onset
+		} else {
+			rules = append(rules, change)
+			current[change.dst] = change
+		}
+
+		if next.IsZero() {
+			// No more changes, so every rule has ended
+			return rules
+		}
+		// Past until, go on until the latest rules have been seen twice
+		if next.After(until) && (settled(current) || next.After(until.AddDate(5, 0, 0))) {
+			break
+		}
+		t = next.In(loc)
+	}
+
+	// The latest rules go on after until
+	for _, r := range current {
+		if r.years > 1 {
+			r.last = time.Time{}
+		}
+	}
+	return rules
+}
+
+// settled reports whether each latest rule has repeated at least once
+func settled(current map[bool]*zoneRule) bool {
+	for _, r := range current {
+		if r.years < 2 {
+			return false
+		}
+	}
+	return true
+}
+
+// observanceSpan returns the earliest and latest offset changes written in a
+// VTIMEZONE, and whether its latest rule goes on indefinitely
+func observanceSpan(vtimezone *ical.Component) (first, last time.Time, open bool) {
+	for _, child := range vtimezone.Children {
+		onset, err := time.Parse(icalDateTime, propValue(child.Props, ical.PropDateTimeStart))
+		if err != nil {
+			continue
+		}
+		latest := onset
+		if rrule := propValue(child.Props, ical.PropRecurrenceRule); rrule != "" {
+			_, until, ok := strings.Cut(rrule, "UNTIL=")
+			if !ok {
+				open = true
+			} else if t, err := time.Parse(icalDateTimeUTC, strings.SplitN(until, ";", 2)[0]); err == nil {
+				latest = t
+			}
+		}
+		if first.IsZero() || onset.Before(first) {
+			first = onset
+		}
+		if latest.After(last) {
+			last = latest
+		}
+	}
+	return first, last, open
+}
+
+// ParseICalAttendees sets an event's organizer and attendees from a VEVENT
+func ParseICalAttendees(vevent *ical.Component, e *Event) {
+	e.Organizer = nil
+	e.Attendees = nil
+	if prop := vevent.Props.Get(ical.PropOrganizer); prop != nil {
+		organizer := parseICalAddress(prop)
+		e.Organizer = &organizer
+	}
+	for _, prop := range vevent.Props.Values(ical.PropAttendee) {
+		attendee := parseICalAddress(&prop)
+		attendee.Status = ParticipationNeedsAction
+		switch strings.ToUpper(prop.Params.Get(ical.ParamParticipationStatus)) {
+		case "ACCEPTED":
+			attendee.Status = ParticipationAccepted
+		case "TENTATIVE":
+			attendee.Status = ParticipationTentative
+		case "DECLINED":
+			attendee.Status = ParticipationDeclined
+		}
+		attendee.Optional = strings.EqualFold(prop.Params.Get(ical.ParamRole), "OPT-PARTICIPANT")
+		e.Attendees = append(e.Attendees, attendee)
+	}
+}
+
+// parseICalAddress reads the address and common name of an ORGANIZER or ATTENDEE
+func parseICalAddress(prop *ical.Prop) Attendee {
+	email := prop.Value
+	if len(email) >= len("mailto:") && strings.EqualFold(email[:len("mailto:")], "mailto:") {
+		email = email[len("mailto:"):]
+	}
+	return Attendee{Email: email, Name: prop.Params.Get(ical.ParamCommonName)}
+}
+
+// SetICalAttendees writes an event's organizer and attendees to a VEVENT
+func SetICalAttendees(vevent *ical.Component, e *Event) {
+	vevent.Props.Del(ical.PropOrganizer)
+	vevent.Props.Del(ical.PropAttendee)
+	if e.Organizer != nil {
+		vevent.Props.Add(icalAddress(ical.PropOrganizer, e.Organizer))
+	}
+	for i := range e.Attendees {
+		a := &e.Attendees[i]
+		prop := icalAddress(ical.PropAttendee, a)
+		prop.Params.Set(ical.ParamRole, "REQ-PARTICIPANT")
+		if a.Optional {
+			prop.Params.Set(ical.ParamRole, "OPT-PARTICIPANT")
+		}
+		switch a.Status {
+		case ParticipationAccepted:
+			prop.Params.Set(ical.ParamParticipationStatus, "ACCEPTED")
+		case ParticipationTentative:
+			prop.Params.Set(ical.ParamParticipationStatus, "TENTATIVE")
+		case ParticipationDeclined:
+			prop.Params.Set(ical.ParamParticipationStatus, "DECLINED")
+		default:
+			prop.Params.Set(ical.ParamParticipationStatus, "NEEDS-ACTION")
+			prop.Params.Set(ical.ParamRSVP, "TRUE")
+		}
+		vevent.Props.Add(prop)
+	}
+}
+
+// icalAddress returns an ORGANIZER or ATTENDEE property for a person
+func icalAddress(name string, a *Attendee) *ical.Prop {
+	prop := ical.NewProp(name)
+	prop.Value = "mailto:" + a.Email
+	if a.Name != "" {
+		prop.Params.Set(ical.ParamCommonName, a.Name)
+	}
+	return prop
+}
+
+// propValue returns the raw value of a property, or an empty string if it is missing
+func propValue(props ical.Props, name string) string {
+	if prop := props.Get(name); prop != nil {
+		return prop.Value
+	}
+	return ""
+}
+
+// textValue returns the unescaped value of a TEXT property, or an empty
+// string if it is missing
+func textValue(props ical.Props, name string) string {
+	text, err := props.Text(name)
+	if err != nil {
+		return propValue(props, name)
+	}
+	return text
+}
+
+// setPropValue sets a property to a raw value of its default type
+func setPropValue(props ical.Props, name, value string) {
+	prop := ical.NewProp(name)
+	prop.Value = value
+	props.Set(prop)
+}
+
+// formatUTCOffset formats an offset in seconds as "+hhmm"
+func formatUTCOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+// parseUTCOffset parses an offset given as "+hhmm" or "+hhmmss" into seconds
+func parseUTCOffset(s string) (int, error) {
+	if len(s) != 5 && len(s) != 7 || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("invalid UTC offset %q", s)
+	}
+	digits, err := strconv.Atoi(s[1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid UTC offset %q", s)
+	}
+	if len(s) == 5 {
+		digits *= 100
+	}
+	offset := digits/10000*3600 + digits/100%100*60 + digits%100
+	if s[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
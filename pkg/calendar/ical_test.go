@@ -0,0 +1,229 @@
+package calendar
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// zonedEvent returns an hour-long event starting at the given local time in a zone
+func zonedEvent(t *testing.T, zone string, year int, month time.Month, day int) *Event {
+	t.Helper()
+	loc := LoadTimeZone(zone)
+	if loc == nil {
+		t.Skipf("time zone %s not available", zone)
+	}
+	start := time.Date(year, month, day, 9, 0, 0, 0, loc)
+	return &Event{ID: "ev", Title: "Meeting", Start: start, End: start.Add(time.Hour), TimeZone: zone}
+}
+
+// vtimezone returns the VTIMEZONE of a zone in cal
+func vtimezone(t *testing.T, cal *ical.Calendar, zone string) *ical.Component {
+	t.Helper()
+	for _, child := range cal.Children {
+		if child.Name == ical.CompTimezone && propValue(child.Props, ical.PropTimezoneID) == zone {
+			return child
+		}
+	}
+	t.Fatalf("no VTIMEZONE for %s", zone)
+	return nil
+}
+
+// observanceRules returns the RRULEs of a VTIMEZONE's observances by kind
+func observanceRules(vtimezone *ical.Component) map[string][]string {
+	rules := make(map[string][]string)
+	for _, child := range vtimezone.Children {
+		rules[child.Name] = append(rules[child.Name], propValue(child.Props, ical.PropRecurrenceRule))
+	}
+	return rules
+}
+
+func TestVTimezoneUsesYearlyRules(t *testing.T) {
+	tests := []struct {
+		zone               string
+		daylight, standard string
+	}{
+		{"Europe/London", "FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU", "FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU"},
+		{"America/New_York", "FREQ=YEARLY;BYMONTH=3;BYDAY=2SU", "FREQ=YEARLY;BYMONTH=11;BYDAY=1SU"},
+	}
+	for _, tt := range tests {
+		cal := EventToICal(zonedEvent(t, tt.zone, 2026, time.June, 1))
+		rules := observanceRules(vtimezone(t, cal, tt.zone))
+		if got := rules[ical.CompTimezoneDaylight]; len(got) != 1 || got[0] != tt.daylight {
+			t.Errorf("%s daylight rules = %q, want %q", tt.zone, got, tt.daylight)
+		}
+		if got := rules[ical.CompTimezoneStandard]; len(got) != 1 || got[0] != tt.standard {
+			t.Errorf("%s standard rules = %q, want %q", tt.zone, got, tt.standard)
+		}
+	}
+}
+
+func TestVTimezoneEndsReplacedRules(t *testing.T) {
+	// The United States moved its changes in 2007
+	cal := EventToICal(zonedEvent(t, "America/New_York", 2006, time.June, 1))
+	rules := observanceRules(vtimezone(t, cal, "America/New_York"))
+	want := []string{
+		"FREQ=YEARLY;BYMONTH=4;BYDAY=1SU;UNTIL=20060402T070000Z",
+		"FREQ=YEARLY;BYMONTH=3;BYDAY=2SU",
+	}
+	got := rules[ical.CompTimezoneDaylight]
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("daylight rules = %q, want %q", got, want)
+	}
+}
+
+func TestVTimezoneCoversAllEvents(t *testing.T) {
+	cal := NewICalendar()
+	AddICalEvent(cal, zonedEvent(t, "America/New_York", 2026, time.June, 1))
+	first, _, _ := observanceSpan(vtimezone(t, cal, "America/New_York"))
+
+	earlier := zonedEvent(t, "America/New_York", 2001, time.June, 1)
+	earlier.ID = "earlier"
+	AddICalEvent(cal, earlier)
+
+	zones := 0
+	for _, child := range cal.Children {
+		if child.Name == ical.CompTimezone {
+			zones++
+		}
+	}
+	if zones != 1 {
+		t.Fatalf("%d VTIMEZONEs for one zone", zones)
+	}
+	widened, _, open := observanceSpan(vtimezone(t, cal, "America/New_York"))
+	if !widened.Before(earlier.Start.AddDate(-1, 0, 0)) || !widened.Before(first) {
+		t.Errorf("zone definition starts %v, after the earlier event", widened)
+	}
+	if !open {
+		t.Error("zone definition no longer covers later years")
+	}
+}
+
+func TestICalRoundTrip(t *testing.T) {
+	meeting := zonedEvent(t, "Europe/Berlin", 2026, time.March, 2)
+	meeting.UID = "meeting@example.com"
+	meeting.Description = "Weekly sync, with a comma, and a; semicolon"
+	meeting.Location = "Room 4"
+	meeting.Status = StatusTentative
+	meeting.Reminders = []int{10, 60}
+	meeting.Recurrence = &RecurrenceRule{Frequency: FrequencyWeekly, Interval: 2, ByDay: []Weekday{Monday, Thursday}, Until: time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)}
+	meeting.Organizer = &Attendee{Email: "ann@example.com", Name: "Ann"}
+	meeting.Attendees = []Attendee{
+		{Email: "bob@example.com", Name: "Bob", Status: ParticipationAccepted},
+		{Email: "cy@example.com", Status: ParticipationNeedsAction, Optional: true},
+	}
+
+	holiday := &Event{ID: "holiday", UID: "holiday@example.com", Title: "Holiday", AllDay: true,
+		Start: time.Date(2026, 8, 3, 0, 0, 0, 0, time.Local), End: time.Date(2026, 8, 8, 0, 0, 0, 0, time.Local)}
+	floating := &Event{ID: "floating", UID: "floating@example.com", Title: "Stretch", Floating: true,
+		Start: time.Date(2026, 3, 2, 7, 0, 0, 0, time.Local), End: time.Date(2026, 3, 2, 7, 15, 0, 0, time.Local)}
+
+	var buf bytes.Buffer
+	if err := WriteICal(&buf, []*Event{meeting, holiday, floating}); err != nil {
+		t.Fatal(err)
+	}
+	events, skipped, err := ReadICalEvents(&buf)
+	if err != nil || skipped != 0 {
+		t.Fatalf("ReadICalEvents: %v (%d skipped)", err, skipped)
+	}
+	if len(events) != 3 {
+		t.Fatalf("read %d events, want 3", len(events))
+	}
+
+	got := events[0]
+	if got.UID != meeting.UID || got.Title != meeting.Title || got.Description != meeting.Description || got.Location != meeting.Location {
+		t.Errorf("text fields = %q, %q, %q, %q", got.UID, got.Title, got.Description, got.Location)
+	}
+	if !got.Start.Equal(meeting.Start) || !got.End.Equal(meeting.End) || got.TimeZone != "Europe/Berlin" {
+		t.Errorf("times = %v – %v in %q, want %v – %v in Europe/Berlin", got.Start, got.End, got.TimeZone, meeting.Start, meeting.End)
+	}
+	if got.Status != StatusTentative {
+		t.Errorf("Status = %q", got.Status)
+	}
+	if !reflect.DeepEqual(got.Reminders, meeting.Reminders) {
+		t.Errorf("Reminders = %v, want %v", got.Reminders, meeting.Reminders)
+	}
+	if r := got.Recurrence; r == nil || r.Frequency != FrequencyWeekly || r.Interval != 2 ||
+		!reflect.DeepEqual(r.ByDay, meeting.Recurrence.ByDay) || !r.Until.Equal(meeting.Recurrence.Until) {
+		t.Errorf("Recurrence = %+v, want %+v", got.Recurrence, meeting.Recurrence)
+	}
+	if got.Organizer == nil || *got.Organizer != *meeting.Organizer {
+		t.Errorf("Organizer = %+v", got.Organizer)
+	}
+	if !reflect.DeepEqual(got.Attendees, meeting.Attendees) {
+		t.Errorf("Attendees = %+v, want %+v", got.Attendees, meeting.Attendees)
+	}
+
+	if got := events[1]; !got.AllDay || !got.Start.Equal(holiday.Start) || !got.End.Equal(holiday.End) {
+		t.Errorf("all-day event = %v – %v (all day %v)", got.Start, got.End, got.AllDay)
+	}
+	if got := events[2]; !got.Floating || got.Start.Hour() != 7 || got.End.Minute() != 15 {
+		t.Errorf("floating event = %v – %v (floating %v)", got.Start, got.End, got.Floating)
+	}
+}
+
+func TestReadICalEventsGivesStableUIDs(t *testing.T) {
+	data := `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//Test//EN
+BEGIN:VEVENT
+SUMMARY:No UID
+DTSTART:20260302T090000Z
+DTEND:20260302T100000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:broken
+SUMMARY:No start
+END:VEVENT
+END:VCALENDAR
+`
+	first, skipped, err := ReadICalEvents(bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || skipped != 1 {
+		t.Fatalf("read %d events and skipped %d, want 1 and 1", len(first), skipped)
+	}
+	again, _, _ := ReadICalEvents(bytes.NewBufferString(data))
+	if first[0].UID == "" || first[0].UID != again[0].UID {
+		t.Errorf("UIDs %q and %q differ between imports", first[0].UID, again[0].UID)
+	}
+}
+
+func TestICalRecurrenceID(t *testing.T) {
+	data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Outlook//EN\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:W. Europe Standard Time\r\n" +
+		"BEGIN:STANDARD\r\nDTSTART:16010101T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\n" +
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10\r\nEND:STANDARD\r\n" +
+		"BEGIN:DAYLIGHT\r\nDTSTART:16010101T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\n" +
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3\r\nEND:DAYLIGHT\r\nEND:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\nUID:weekly\r\nDTSTAMP:20260301T000000Z\r\n" +
+		"RECURRENCE-ID;TZID=W. Europe Standard Time:20260302T090000\r\n" +
+		"DTSTART;TZID=W. Europe Standard Time:20260302T100000\r\n" +
+		"DTEND;TZID=W. Europe Standard Time:20260302T110000\r\nSUMMARY:Weekly, later\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:daily\r\nDTSTAMP:20260301T000000Z\r\nRECURRENCE-ID;VALUE=DATE:20260303\r\n" +
+		"DTSTART;VALUE=DATE:20260304\r\nSUMMARY:Moved a day\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	cal, err := ical.NewDecoder(bytes.NewBufferString(data)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, child := range cal.Children {
+		if child.Name != ical.CompEvent {
+			continue
+		}
+		e, err := ParseICalEvent(cal, child)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e.RecurrenceID)
+	}
+	want := []string{"2026-03-02T08:00:00Z", "2026-03-03"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recurrence IDs = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package calendar
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// ImportPreview sorts the events of an iCalendar file by whether they would
+// be added to a calendar
+type ImportPreview struct {
+	New        []*Event
+	Duplicates []*Event // Already in the calendar or earlier in the file, by UID
+	Skipped    int      // Events that could not be read
+}
+
+// ReadICalEvents reads the events of an iCalendar file, which may hold
+// several VCALENDARs. Events without a UID are given one made from their
+// title and times, so importing the file again finds them as duplicates.
+// Events that cannot be read are counted in skipped.
+func ReadICalEvents(r io.Reader) (events []*Event, skipped int, err error) {
+	dec := ical.NewDecoder(r)
+	for {
+		cal, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse calendar file: %w", err)
+		}
+
+		for _, child := range cal.Children {
+			if child.Name != ical.CompEvent {
+				continue
+			}
+			event, err := ParseICalEvent(cal, child)
+			if err != nil {
+				skipped++
+				continue
+			}
+			if event.UID == "" {
+				sum := sha1.Sum([]byte(event.Title + "\x00" + event.Start.UTC().Format(time.RFC3339) + "\x00" + event.End.UTC().Format(time.RFC3339)))
+				event.UID = fmt.Sprintf("%x@switchcal", sum)
+			}
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 && skipped == 0 {
+		return nil, 0, fmt.Errorf("no events in calendar file")
+	}
+	return events, skipped, nil
+}
@@ -0,0 +1,147 @@
+package calendar
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"github.com/emersion/go-ical"
+)
+
+// ITIPMethod is what a scheduling message asks of its recipient (RFC 5546)
+type ITIPMethod string
+
+const (
+	ITIPPublish ITIPMethod = "PUBLISH" // Events shared without scheduling
+	ITIPRequest ITIPMethod = "REQUEST" // A new or changed meeting
+	ITIPCancel  ITIPMethod = "CANCEL"  // A cancelled meeting or occurrence
+	ITIPReply   ITIPMethod = "REPLY"   // An attendee's answer to the organizer
+)
+
+// Invitation is a scheduling message, such as a meeting invite sent by email
+type Invitation struct {
+	Method ITIPMethod
+	Events []*Event // One per VEVENT; changed occurrences have a RecurrenceID
+}
+
+// ReadInvitation reads an invitation from an iCalendar file or from an email
+// carrying one as an attachment (iMIP, RFC 6047)
+func ReadInvitation(r io.Reader) (*Invitation, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read invitation: %w", err)
+	}
+
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if !bytes.HasPrefix(bytes.ToUpper(trimmed), []byte("BEGIN:VCALENDAR")) {
+		if data, err = emailCalendar(data); err != nil {
+			return nil, err
+		}
+	}
+
+	cal, err := ical.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse invitation: %w", err)
+	}
+	return ParseInvitation(cal)
+}
+
+// ParseInvitation reads the method and events of a VCALENDAR. Calendars
+// without a METHOD are treated as published events.
+func ParseInvitation(cal *ical.Calendar) (*Invitation, error) {
+	inv := &Invitation{Method: ITIPMethod(strings.ToUpper(propValue(cal.Props, ical.PropMethod)))}
+	switch inv.Method {
+	case "":
+		inv.Method = ITIPPublish
+	case ITIPPublish, ITIPRequest, ITIPCancel, ITIPReply:
+	default:
+		return nil, fmt.Errorf("unsupported invitation method %s", inv.Method)
+	}
+
+	for _, child := range cal.Children {
+		if child.Name != ical.CompEvent {
+			continue
+		}
+		event, err := ParseICalEvent(cal, child)
+		if err != nil {
+			return nil, err
+		}
+		if event.UID == "" {
+			return nil, fmt.Errorf("event %q has no UID", event.Title)
+		}
+		inv.Events = append(inv.Events, event)
+	}
+	if len(inv.Events) == 0 {
+		return nil, fmt.Errorf("invitation has no events")
+	}
+	return inv, nil
+}
+
+// emailCalendar returns the iCalendar part of an email
+func emailCalendar(data []byte) ([]byte, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("not an iCalendar file or email: %w", err)
+	}
+
+	part, err := findCalendarPart(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	if part == nil {
+		return nil, fmt.Errorf("email has no calendar attachment")
+	}
+	return part, nil
+}
+
+// findCalendarPart searches a MIME entity and its parts for a calendar,
+// returning nil if there is none
+func findCalendarPart(contentType, encoding string, body io.Reader) ([]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read email: %w", err)
+			}
+			contentType := p.Header.Get("Content-Type")
+			if filename := p.FileName(); strings.HasSuffix(strings.ToLower(filename), ".ics") {
+				contentType = "text/calendar"
+			}
+			data, err := findCalendarPart(contentType, p.Header.Get("Content-Transfer-Encoding"), p)
+			if data != nil || err != nil {
+				return data, err
+			}
+		}
+	}
+
+	if mediaType != "text/calendar" && mediaType != "application/ics" {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode calendar attachment: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,111 @@
+package calendar
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+const invitationICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//EN\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:review@example.com\r\n" +
+	"SUMMARY:Design review\r\n" +
+	"DTSTART:20260302T140000Z\r\n" +
+	"DTEND:20260302T150000Z\r\n" +
+	"ORGANIZER;CN=Ann:mailto:ann@example.com\r\n" +
+	"ATTENDEE;CN=Bob;PARTSTAT=NEEDS-ACTION;ROLE=REQ-PARTICIPANT:mailto:bob@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:review@example.com\r\n" +
+	"RECURRENCE-ID:20260309T140000Z\r\n" +
+	"SUMMARY:Design review (moved)\r\n" +
+	"DTSTART:20260309T160000Z\r\n" +
+	"DTEND:20260309T170000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestReadInvitation(t *testing.T) {
+	inv, err := ReadInvitation(strings.NewReader(invitationICS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Method != ITIPRequest {
+		t.Errorf("Method = %q, want REQUEST", inv.Method)
+	}
+	if len(inv.Events) != 2 {
+		t.Fatalf("read %d events, want 2", len(inv.Events))
+	}
+
+	meeting := inv.Events[0]
+	if meeting.UID != "review@example.com" || !meeting.Start.Equal(time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("meeting = %q at %v", meeting.UID, meeting.Start)
+	}
+	if meeting.Organizer == nil || meeting.Organizer.Email != "ann@example.com" || meeting.Organizer.Name != "Ann" {
+		t.Errorf("Organizer = %+v", meeting.Organizer)
+	}
+	if len(meeting.Attendees) != 1 || meeting.Attendees[0].Email != "bob@example.com" {
+		t.Errorf("Attendees = %+v", meeting.Attendees)
+	}
+	if moved := inv.Events[1]; moved.RecurrenceID != "2026-03-09T14:00:00Z" {
+		t.Errorf("changed occurrence RecurrenceID = %q", moved.RecurrenceID)
+	}
+}
+
+func TestReadInvitationFromEmail(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString([]byte(invitationICS))
+	email := "From: Ann <ann@example.com>\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: Invitation: Design review\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"You have been invited.\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/calendar; charset=utf-8; method=REQUEST\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		encoded + "\r\n" +
+		"--inner--\r\n" +
+		"--outer--\r\n"
+
+	inv, err := ReadInvitation(strings.NewReader(email))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Method != ITIPRequest || len(inv.Events) != 2 || inv.Events[0].Title != "Design review" {
+		t.Errorf("invitation = %s with %d events", inv.Method, len(inv.Events))
+	}
+}
+
+func TestReadInvitationRejects(t *testing.T) {
+	tests := map[string]string{
+		"unsupported method":     strings.Replace(invitationICS, "METHOD:REQUEST", "METHOD:ADD", 1),
+		"event without UID":      strings.ReplaceAll(invitationICS, "UID:review@example.com\r\n", ""),
+		"email without calendar": "From: ann@example.com\r\nContent-Type: text/plain\r\n\r\nHello\r\n",
+	}
+	for name, data := range tests {
+		if _, err := ReadInvitation(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestParseInvitationDefaultsToPublish(t *testing.T) {
+	inv, err := ReadInvitation(strings.NewReader(strings.Replace(invitationICS, "METHOD:REQUEST\r\n", "", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Method != ITIPPublish {
+		t.Errorf("Method = %q, want PUBLISH", inv.Method)
+	}
+}
@@ -0,0 +1,389 @@
+package calendar
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrNewerDatabase is returned when the database was upgraded by a newer
+// version of SwitchCal than this one
+var ErrNewerDatabase = errors.New("database was created by a newer version of SwitchCal")
+
+// migrations upgrade the schema one version at a time: migrations[i] brings
+// a database from version i to i+1, recorded in PRAGMA user_version. Only
+// ever append to this list; released migrations must not change.
+var migrations = []func(tx *sql.Tx) error{
+	migrateBaseSchema,       // 1
+	migrateRemoteIdentities, // 2
+	migrateEventTimeZones,   // 3
+	migrateEndTimeZones,     // 4
+	migrateAttendees,        // 5
+	migrateTrash,            // 6
+	migrateSyncTokens,       // 7
+	migrateCalDAVHrefs,      // 8
+}
+
+// migrate brings the database up to the latest schema version, copying it
+// aside first. Each migration runs in its own transaction, so a failed one
+// leaves the database at the previous version.
+func (s *Store) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	latest := len(migrations)
+	if version > latest {
+		return fmt.Errorf("%w (schema version %d, this version supports %d)", ErrNewerDatabase, version, latest)
+	}
+	if version == latest {
+		return nil
+	}
+
+	if err := s.backup(version); err != nil {
+		return fmt.Errorf("failed to back up database before migrating: %w", err)
+	}
+
+	// Tables are rebuilt with foreign keys off, which cannot change inside a
+	// transaction; each migration is checked for dangling references instead
+	if _, err := s.db.Exec(`PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	defer s.db.Exec(`PRAGMA foreign_keys = ON`)
+
+	for ; version < latest; version++ {
+		if err := s.runMigration(version); err != nil {
+			return fmt.Errorf("failed to migrate to schema version %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+// runMigration applies migrations[from] and records the new version
+func (s *Store) runMigration(from int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := migrations[from](tx); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return err
+	}
+	dangling := rows.Next()
+	rows.Close()
+	if dangling {
+		return errors.New("migration left rows referencing missing parents")
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, from+1)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// backup copies a database that is about to be migrated next to it, as
+// switchcal.db.v<version>.bak, readable only by the user. New databases are
+// not copied. Credentials still in plaintext columns are removed from the
+// copy by SetSecretStore once they have moved to the secret store.
+func (s *Store) backup(version int) error {
+	var tables int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		return nil
+	}
+
+	path := fmt.Sprintf("%s.v%d.bak", s.path, version)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// VACUUM INTO accepts an existing empty file and keeps its permissions
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	if _, err := s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// migrateBaseSchema creates the schema as it was when versioning was
+// introduced. Databases from before then are at version 0 whatever their
+// age, so it also adds the columns older releases lacked.
+func migrateBaseSchema(tx *sql.Tx) error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS accounts (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		email TEXT,
+		enabled INTEGER DEFAULT 1,
+		server_url TEXT,
+		username TEXT,
+		token_expiry DATETIME,
+		last_sync DATETIME,
+		secret_ref TEXT,
+		oauth_client_id TEXT,
+		goa_id TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS calendars (
+		id TEXT PRIMARY KEY,
+		account_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT,
+		color TEXT DEFAULT '#4285f4',
+		visible INTEGER DEFAULT 1,
+		read_only INTEGER DEFAULT 0,
+		sync_token TEXT,
+		last_sync DATETIME,
+		sort_order INTEGER DEFAULT 0,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS events (
+		id TEXT PRIMARY KEY,
+		calendar_id TEXT NOT NULL,
+		uid TEXT,
+		title TEXT NOT NULL,
+		description TEXT,
+		location TEXT,
+		start_time DATETIME NOT NULL,
+		end_time DATETIME NOT NULL,
+		all_day INTEGER DEFAULT 0,
+		color TEXT,
+		recurrence TEXT,
+		reminders TEXT,
+		created DATETIME,
+		modified DATETIME,
+		etag TEXT,
+		status TEXT DEFAULT 'confirmed',
+		cancelled INTEGER DEFAULT 0,
+		FOREIGN KEY (calendar_id) REFERENCES calendars(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS sync_history (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id TEXT NOT NULL,
+		calendar_id TEXT,
+		started DATETIME NOT NULL,
+		duration_ms INTEGER DEFAULT 0,
+		events_created INTEGER DEFAULT 0,
+		events_updated INTEGER DEFAULT 0,
+		events_deleted INTEGER DEFAULT 0,
+		errors TEXT,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		account_id TEXT NOT NULL,
+		calendar_id TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		op TEXT NOT NULL,
+		created DATETIME NOT NULL,
+		attempts INTEGER DEFAULT 0,
+		next_attempt DATETIME,
+		last_error TEXT,
+		base_etag TEXT,
+		base_modified DATETIME,
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	);
+
+	CREATE TABLE IF NOT EXISTS conflicts (
+		account_id TEXT NOT NULL,
+		calendar_id TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		remote TEXT,
+		detected DATETIME NOT NULL,
+		PRIMARY KEY (calendar_id, event_id),
+		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_events_calendar ON events(calendar_id);
+	CREATE INDEX IF NOT EXISTS idx_events_start ON events(start_time);
+	CREATE INDEX IF NOT EXISTS idx_events_end ON events(end_time);
+	CREATE INDEX IF NOT EXISTS idx_calendars_account ON calendars(account_id);
+	CREATE INDEX IF NOT EXISTS idx_sync_history_account ON sync_history(account_id, started);
+	CREATE INDEX IF NOT EXISTS idx_outbox_account ON outbox(account_id, id);
+	`
+
+	if _, err := tx.Exec(schema); err != nil {
+		return err
+	}
+
+	columns := []struct{ table, column, definition string }{
+		{"calendars", "sort_order", "INTEGER DEFAULT 0"},
+		{"accounts", "secret_ref", "TEXT"},
+		{"accounts", "oauth_client_id", "TEXT"},
+		{"accounts", "goa_id", "TEXT"},
+		{"outbox", "base_etag", "TEXT"},
+		{"outbox", "base_modified", "DATETIME"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(tx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateRemoteIdentities separates an event's local ID from its identity on
+// the server. Events of remote calendars that were uploaded keep their ID,
+// which until now was the provider's ID, as both.
+func migrateRemoteIdentities(tx *sql.Tx) error {
+	steps := []string{
+		`ALTER TABLE events ADD COLUMN remote_id TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN recurrence_id TEXT NOT NULL DEFAULT ''`,
+		`UPDATE events SET remote_id = id
+			WHERE id NOT LIKE 'evt-%' AND calendar_id IN (
+				SELECT c.id FROM calendars c JOIN accounts a ON c.account_id = a.id
+				WHERE a.type != 'local')`,
+		`CREATE UNIQUE INDEX idx_events_remote ON events(calendar_id, remote_id, recurrence_id)
+			WHERE remote_id != ''`,
+		`ALTER TABLE outbox ADD COLUMN remote_id TEXT NOT NULL DEFAULT ''`,
+		`UPDATE outbox SET remote_id = event_id WHERE op = 'delete'`,
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateEventTimeZones stores event times independently of the local zone:
+// instants in UTC, and all-day events as the dates they were saved with
+func migrateEventTimeZones(tx *sql.Tx) error {
+	steps := []string{
+		`ALTER TABLE events ADD COLUMN time_zone TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN floating INTEGER NOT NULL DEFAULT 0`,
+		`UPDATE events SET start_time = datetime(start_time), end_time = datetime(end_time) WHERE all_day = 0`,
+		`UPDATE events SET start_time = substr(start_time, 1, 10) || ' 00:00:00',
+			end_time = substr(end_time, 1, 10) || ' 00:00:00' WHERE all_day = 1`,
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateEndTimeZones lets an event end in another zone than it starts in
+func migrateEndTimeZones(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE events ADD COLUMN end_time_zone TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// migrateAttendees stores the organizer and attendees of events as JSON
+func migrateAttendees(tx *sql.Tx) error {
+	steps := []string{
+		`ALTER TABLE events ADD COLUMN attendees TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE events ADD COLUMN organizer TEXT NOT NULL DEFAULT ''`,
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTrash keeps deleted events so they can be restored
+func migrateTrash(tx *sql.Tx) error {
+	steps := []string{
+		`CREATE TABLE trash (
+			event_id TEXT PRIMARY KEY,
+			calendar_id TEXT NOT NULL,
+			data TEXT NOT NULL,
+			deleted_at DATETIME NOT NULL,
+			FOREIGN KEY (calendar_id) REFERENCES calendars(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX idx_trash_deleted ON trash(deleted_at)`,
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateSyncTokens clears the marker that used to turn off incremental
+// sync for good after a sync token expired, so those calendars get a fresh token
+func migrateSyncTokens(tx *sql.Tx) error {
+	_, err := tx.Exec(`UPDATE calendars SET sync_token = '' WHERE sync_token = 'disabled'`)
+	return err
+}
+
+// migrateCalDAVHrefs identifies CalDAV events by the href of their calendar
+// object rather than their UID, from which the href used to be built
+func migrateCalDAVHrefs(tx *sql.Tx) error {
+	const caldavCalendars = `SELECT c.id FROM calendars c JOIN accounts a ON c.account_id = a.id
+		WHERE a.type IN ('apple', 'caldav')`
+	steps := []string{
+		`UPDATE events SET remote_id = rtrim(calendar_id, '/') || '/' || remote_id || '.ics'
+			WHERE remote_id != '' AND calendar_id IN (` + caldavCalendars + `)`,
+		`UPDATE outbox SET remote_id = rtrim(calendar_id, '/') || '/' || remote_id || '.ics'
+			WHERE remote_id != '' AND calendar_id IN (` + caldavCalendars + `)`,
+		`UPDATE trash SET data = json_set(data, '$.remote_id',
+				rtrim(calendar_id, '/') || '/' || json_extract(data, '$.remote_id') || '.ics')
+			WHERE json_extract(data, '$.remote_id') != '' AND calendar_id IN (` + caldavCalendars + `)`,
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// querier runs queries on a database or inside a transaction
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// hasColumn reports whether a table has a column
+func hasColumn(q querier, table, column string) (bool, error) {
+	rows, err := q.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// addColumnIfMissing adds a column to a table created by an older version
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	exists, err := hasColumn(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,180 @@
+package calendar
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// unversionedSchema is the schema of releases from before migrations
+const unversionedSchema = `
+CREATE TABLE accounts (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	email TEXT,
+	enabled INTEGER DEFAULT 1,
+	server_url TEXT,
+	username TEXT,
+	access_token TEXT,
+	refresh_token TEXT,
+	token_expiry DATETIME,
+	app_password TEXT,
+	last_sync DATETIME
+);
+CREATE TABLE calendars (
+	id TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	description TEXT,
+	color TEXT DEFAULT '#4285f4',
+	visible INTEGER DEFAULT 1,
+	read_only INTEGER DEFAULT 0,
+	sync_token TEXT,
+	last_sync DATETIME,
+	FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+);
+CREATE TABLE events (
+	id TEXT PRIMARY KEY,
+	calendar_id TEXT NOT NULL,
+	uid TEXT,
+	title TEXT NOT NULL,
+	description TEXT,
+	location TEXT,
+	start_time DATETIME NOT NULL,
+	end_time DATETIME NOT NULL,
+	all_day INTEGER DEFAULT 0,
+	color TEXT,
+	recurrence TEXT,
+	reminders TEXT,
+	created DATETIME,
+	modified DATETIME,
+	etag TEXT,
+	status TEXT DEFAULT 'confirmed',
+	cancelled INTEGER DEFAULT 0,
+	FOREIGN KEY (calendar_id) REFERENCES calendars(id) ON DELETE CASCADE
+);
+`
+
+// createDatabase writes a database with the given statements outside the Store
+func createDatabase(t *testing.T, path string, statements ...string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+}
+
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "switchcal.db")
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	createDatabase(t, path, unversionedSchema,
+		`INSERT INTO accounts (id, name, type, enabled, access_token, refresh_token) VALUES ('acc', 'Work', 'google', 1, 'plaintext-access', 'plaintext-refresh')`,
+		`INSERT INTO calendars (id, account_id, name, sync_token) VALUES ('cal', 'acc', 'Work', 'disabled')`,
+		`INSERT INTO accounts (id, name, type, enabled) VALUES ('dav', 'Home', 'caldav', 1)`,
+		`INSERT INTO calendars (id, account_id, name) VALUES ('/dav/home/', 'dav', 'Home')`,
+		`INSERT INTO events (id, calendar_id, uid, title, start_time, end_time) VALUES ('dav-ev', '/dav/home/', 'dav-ev', 'Dinner', '`+
+			start.Format(time.RFC3339)+`', '`+start.Add(time.Hour).Format(time.RFC3339)+`')`,
+		`INSERT INTO events (id, calendar_id, uid, title, start_time, end_time) VALUES ('ev', 'cal', 'ev@example.com', 'Standup', '`+
+			start.Format(time.RFC3339)+`', '`+start.Add(time.Hour).Format(time.RFC3339)+`')`,
+	)
+
+	store := openTestStore(t, path)
+
+	var version int
+	if err := store.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("schema version %d, want %d", version, len(migrations))
+	}
+	backup := path + ".v0.bak"
+	if info, err := os.Stat(backup); err != nil {
+		t.Errorf("no backup of the old database: %v", err)
+	} else if info.Mode().Perm() != 0600 {
+		t.Errorf("backup mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	event, err := store.GetEvent("ev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Events of remote accounts were stored under their server IDs
+	if event.Title != "Standup" || !event.Start.Equal(start) || event.RemoteID != "ev" {
+		t.Errorf("event after migrating = %q at %v, remote ID %q", event.Title, event.Start, event.RemoteID)
+	}
+	// CalDAV events are addressed by the href they used to be uploaded to
+	if event, err := store.GetEvent("dav-ev"); err != nil || event.RemoteID != "/dav/home/dav-ev.ics" {
+		t.Errorf("CalDAV event after migrating: %+v, %v", event, err)
+	}
+	cal, err := store.GetCalendar("cal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal.SyncToken != "" {
+		t.Errorf("SyncToken = %q, want the old marker cleared", cal.SyncToken)
+	}
+
+	// Credentials left in plaintext move to the secret store
+	secrets := memSecrets{}
+	if err := store.SetSecretStore(secrets); err != nil {
+		t.Fatal(err)
+	}
+	account, err := store.GetAccount("acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.AccessToken != "plaintext-access" || account.RefreshToken != "plaintext-refresh" || len(secrets) != 1 {
+		t.Errorf("credentials after migrating: %q, %q in %d secrets", account.AccessToken, account.RefreshToken, len(secrets))
+	}
+
+	// and are no longer readable in the database or its backup
+	for _, file := range []string{path, backup} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("plaintext-")) {
+			t.Errorf("%s still holds plaintext credentials", filepath.Base(file))
+		}
+	}
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "switchcal.db")
+	store := openTestStore(t, path)
+	store.Close()
+
+	// Opening it again changes nothing
+	store = openTestStore(t, path)
+	if _, err := os.Stat(path + ".v0.bak"); !os.IsNotExist(err) {
+		t.Errorf("new database backed up: %v", err)
+	}
+	if err := store.SaveAccount(&Account{ID: "acc", Name: "Local", Type: AccountTypeLocal, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefuseNewerDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "switchcal.db")
+	createDatabase(t, path, unversionedSchema, `PRAGMA user_version = 1000`)
+
+	store, err := NewStore(path)
+	if err == nil {
+		store.Close()
+		t.Fatal("opened a database from a newer version")
+	}
+	if !errors.Is(err, ErrNewerDatabase) {
+		t.Errorf("got %v, want ErrNewerDatabase", err)
+	}
+}
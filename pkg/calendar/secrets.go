@@ -0,0 +1,300 @@
+package calendar
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SecretStore keeps account credentials outside the database, e.g. in the
+// system keyring. Secrets are addressed by an opaque reference.
+type SecretStore interface {
+	// GetSecret returns the secret stored under ref, or an empty string if there is none
+	GetSecret(ref string) (string, error)
+
+	// SetSecret stores or replaces the secret under ref; label is shown to the user by keyring managers
+	SetSecret(ref, label, secret string) error
+
+	// DeleteSecret removes the secret under ref, if any
+	DeleteSecret(ref string) error
+}
+
+// ErrNoSecretStore is returned when credentials are saved before a SecretStore is configured
+var ErrNoSecretStore = errors.New("no secret store configured")
+
+// accountSecrets is the credential bundle stored for each account
+type accountSecrets struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	AppPassword  string `json:"app_password,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// accountSecretRef returns the secret reference of an account
+func accountSecretRef(accountID string) string {
+	return "account/" + accountID
+}
+
+// SetSecretStore configures where account credentials are kept and moves
+// credentials left in plaintext columns by older versions into it
+func (s *Store) SetSecretStore(secrets SecretStore) error {
+	s.secretMu.Lock()
+	s.secrets = secrets
+	s.secretCache = make(map[string]string)
+	s.secretMu.Unlock()
+
+	if err := s.migratePlaintextSecrets(); err != nil {
+		return err
+	}
+	return s.scrubBackups()
+}
+
+// saveAccountSecrets writes an account's credentials to the secret store and
+// returns the reference to keep in the database. Unchanged credentials are
+// not rewritten, and an account loaded without its credentials, e.g. while
+// no secret store is configured, keeps the reference it has.
+func (s *Store) saveAccountSecrets(a *Account) (string, error) {
+	bundle := accountSecrets{
+		AccessToken:  a.AccessToken,
+		RefreshToken: a.RefreshToken,
+		AppPassword:  a.AppPassword,
+		ClientSecret: a.ClientSecret,
+	}
+	if a.GOAID != "" {
+		// Borrowed credentials stay with GNOME Online Accounts
+		bundle = accountSecrets{}
+	}
+
+	var data string
+	if bundle != (accountSecrets{}) {
+		encoded, err := json.Marshal(bundle)
+		if err != nil {
+			return "", err
+		}
+		data = string(encoded)
+	}
+
+	ref := accountSecretRef(a.ID)
+
+	if data == "" && !a.secretsLoaded && a.GOAID == "" {
+		var existing sql.NullString
+		err := s.db.QueryRow(`SELECT secret_ref FROM accounts WHERE id = ?`, a.ID).Scan(&existing)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+		return existing.String, nil
+	}
+
+	s.secretMu.Lock()
+	defer s.secretMu.Unlock()
+
+	if cached, ok := s.secretCache[ref]; ok && cached == data {
+		if data == "" {
+			return "", nil
+		}
+		return ref, nil
+	}
+
+	if s.secrets == nil {
+		if data == "" {
+			return "", nil
+		}
+		return "", ErrNoSecretStore
+	}
+
+	if data == "" {
+		if err := s.secrets.DeleteSecret(ref); err != nil {
+			return "", err
+		}
+		s.secretCache[ref] = ""
+		a.secretsLoaded = true
+		return "", nil
+	}
+
+	if err := s.secrets.SetSecret(ref, "SwitchCal: "+a.Name, data); err != nil {
+		return "", err
+	}
+	s.secretCache[ref] = data
+	a.secretsLoaded = true
+	return ref, nil
+}
+
+// loadAccountSecrets fills in an account's credentials from the secret store
+func (s *Store) loadAccountSecrets(a *Account, ref string) error {
+	if ref == "" {
+		a.secretsLoaded = true
+		return nil
+	}
+
+	s.secretMu.Lock()
+	defer s.secretMu.Unlock()
+
+	data, ok := s.secretCache[ref]
+	if !ok {
+		if s.secrets == nil {
+			return nil // Left empty; saving the account keeps the stored ones
+		}
+		var err error
+		data, err = s.secrets.GetSecret(ref)
+		if err != nil {
+			return fmt.Errorf("failed to load credentials for %s: %w", a.Name, err)
+		}
+		s.secretCache[ref] = data
+	}
+	a.secretsLoaded = true
+	if data == "" {
+		return nil
+	}
+
+	var bundle accountSecrets
+	if err := json.Unmarshal([]byte(data), &bundle); err != nil {
+		return fmt.Errorf("failed to decode credentials for %s: %w", a.Name, err)
+	}
+	a.AccessToken = bundle.AccessToken
+	a.RefreshToken = bundle.RefreshToken
+	a.AppPassword = bundle.AppPassword
+	a.ClientSecret = bundle.ClientSecret
+	return nil
+}
+
+// deleteSecret removes a secret and forgets any cached copy
+func (s *Store) deleteSecret(ref string) error {
+	if ref == "" {
+		return nil
+	}
+
+	s.secretMu.Lock()
+	defer s.secretMu.Unlock()
+
+	delete(s.secretCache, ref)
+	if s.secrets == nil {
+		return nil
+	}
+	return s.secrets.DeleteSecret(ref)
+}
+
+// migratePlaintextSecrets moves credentials from the plaintext columns used
+// by older versions into the secret store, then drops those columns
+func (s *Store) migratePlaintextSecrets() error {
+	legacy, err := hasColumn(s.db, "accounts", "access_token")
+	if err != nil || !legacy {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows, err := s.db.Query(`SELECT id, name, access_token, refresh_token, app_password FROM accounts`)
+	if err != nil {
+		return err
+	}
+
+	var accounts []*Account
+	for rows.Next() {
+		a := &Account{}
+		var accessToken, refreshToken, appPassword sql.NullString
+		if err := rows.Scan(&a.ID, &a.Name, &accessToken, &refreshToken, &appPassword); err != nil {
+			rows.Close()
+			return err
+		}
+		a.AccessToken = accessToken.String
+		a.RefreshToken = refreshToken.String
+		a.AppPassword = appPassword.String
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Copy every credential into the secret store before touching the table,
+	// so a failure part-way leaves the plaintext columns intact
+	refs := make(map[string]string)
+	for _, a := range accounts {
+		ref, err := s.saveAccountSecrets(a)
+		if err != nil {
+			return fmt.Errorf("failed to migrate credentials for %s: %w", a.Name, err)
+		}
+		refs[a.ID] = ref
+	}
+
+	// Overwrite the dropped values rather than leave them in free pages
+	if _, err := s.db.Exec(`PRAGMA secure_delete = ON`); err != nil {
+		return err
+	}
+	defer s.db.Exec(`PRAGMA secure_delete = OFF`)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, ref := range refs {
+		if _, err := tx.Exec(`UPDATE accounts SET secret_ref = ? WHERE id = ?`, ref, id); err != nil {
+			return err
+		}
+	}
+	for _, column := range plaintextSecretColumns {
+		if _, err := tx.Exec(`ALTER TABLE accounts DROP COLUMN ` + column); err != nil {
+			return fmt.Errorf("failed to drop plaintext column %s: %w", column, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// plaintextSecretColumns are the account columns older versions kept
+// credentials in
+var plaintextSecretColumns = []string{"access_token", "refresh_token", "app_password"}
+
+// scrubBackups clears the plaintext credentials from copies of the database
+// made before migrating, now that they are kept in the secret store
+func (s *Store) scrubBackups() error {
+	paths, err := filepath.Glob(s.path + ".v*.bak")
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := scrubBackup(path); err != nil {
+			return fmt.Errorf("failed to remove credentials from %s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// scrubBackup clears the plaintext credential columns of a database copy and
+// rewrites it so the old values do not linger in free pages
+func scrubBackup(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	var columns []string
+	for _, column := range plaintextSecretColumns {
+		exists, err := hasColumn(db, "accounts", column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			columns = append(columns, column+" = NULL")
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(`PRAGMA secure_delete = ON`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE accounts SET ` + strings.Join(columns, ", ")); err != nil {
+		return err
+	}
+	_, err = db.Exec(`VACUUM`)
+	return err
+}
@@ -0,0 +1,96 @@
+package calendar
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// memSecrets is a SecretStore kept in memory
+type memSecrets map[string]string
+
+func (m memSecrets) GetSecret(ref string) (string, error) { return m[ref], nil }
+
+func (m memSecrets) SetSecret(ref, label, secret string) error {
+	m[ref] = secret
+	return nil
+}
+
+func (m memSecrets) DeleteSecret(ref string) error {
+	delete(m, ref)
+	return nil
+}
+
+// openTestStore opens a store in a temporary directory
+func openTestStore(t *testing.T, path string) *Store {
+	t.Helper()
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "switchcal.db")
+	}
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSaveAccountWithoutSecretStoreKeepsCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "switchcal.db")
+	secrets := memSecrets{}
+
+	store := openTestStore(t, path)
+	if err := store.SetSecretStore(secrets); err != nil {
+		t.Fatal(err)
+	}
+	account := &Account{ID: "acc", Name: "Work", Type: AccountTypeGoogle, Enabled: true, RefreshToken: "refresh"}
+	if err := store.SaveAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Opened with the secret store skipped, the account loads without its
+	// credentials; saving it must not cut it off from them
+	store = openTestStore(t, path)
+	loaded, err := store.GetAccount("acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.RefreshToken != "" {
+		t.Fatalf("credentials loaded without a secret store: %q", loaded.RefreshToken)
+	}
+	loaded.Enabled = false
+	if err := store.SaveAccount(loaded); err != nil {
+		t.Fatalf("SaveAccount: %v", err)
+	}
+
+	loaded.AppPassword = "new"
+	if err := store.SaveAccount(loaded); !errors.Is(err, ErrNoSecretStore) {
+		t.Fatalf("saving new credentials without a secret store: got %v, want ErrNoSecretStore", err)
+	}
+	store.Close()
+
+	store = openTestStore(t, path)
+	if err := store.SetSecretStore(secrets); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = store.GetAccount("acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.RefreshToken != "refresh" {
+		t.Errorf("RefreshToken = %q, want %q", loaded.RefreshToken, "refresh")
+	}
+	if loaded.Enabled {
+		t.Error("the change made without the secret store was not saved")
+	}
+
+	// Once loaded, clearing the credentials removes them
+	loaded.RefreshToken = ""
+	if err := store.SaveAccount(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 0 {
+		t.Errorf("secrets left after clearing the credentials: %v", secrets)
+	}
+}
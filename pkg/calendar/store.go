@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,8 +16,14 @@ import (
 
 // Store manages calendar data persistence
 type Store struct {
-	db *sql.DB
-	mu sync.Mutex
+	db   *sql.DB
+	mu   sync.Mutex
+	path string
+
+	// Account credentials live outside the database
+	secretMu    sync.Mutex
+	secrets     SecretStore
+	secretCache map[string]string
 }
 
 // NewStore creates a new calendar store
@@ -43,7 +50,7 @@ func NewStore(dbPath string) (*Store, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	store := &Store{db: db}
+	store := &Store{db: db, path: dbPath, secretCache: make(map[string]string)}
 	if err := store.migrate(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
@@ -57,78 +64,24 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
-// migrate runs database migrations
-func (s *Store) migrate() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS accounts (
-		id TEXT PRIMARY KEY,
-		name TEXT NOT NULL,
-		type TEXT NOT NULL,
-		email TEXT,
-		enabled INTEGER DEFAULT 1,
-		server_url TEXT,
-		username TEXT,
-		access_token TEXT,
-		refresh_token TEXT,
-		token_expiry DATETIME,
-		app_password TEXT,
-		last_sync DATETIME
-	);
-
-	CREATE TABLE IF NOT EXISTS calendars (
-		id TEXT PRIMARY KEY,
-		account_id TEXT NOT NULL,
-		name TEXT NOT NULL,
-		description TEXT,
-		color TEXT DEFAULT '#4285f4',
-		visible INTEGER DEFAULT 1,
-		read_only INTEGER DEFAULT 0,
-		sync_token TEXT,
-		last_sync DATETIME,
-		FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
-	);
-
-	CREATE TABLE IF NOT EXISTS events (
-		id TEXT PRIMARY KEY,
-		calendar_id TEXT NOT NULL,
-		uid TEXT,
-		title TEXT NOT NULL,
-		description TEXT,
-		location TEXT,
-		start_time DATETIME NOT NULL,
-		end_time DATETIME NOT NULL,
-		all_day INTEGER DEFAULT 0,
-		color TEXT,
-		recurrence TEXT,
-		reminders TEXT,
-		created DATETIME,
-		modified DATETIME,
-		etag TEXT,
-		status TEXT DEFAULT 'confirmed',
-		cancelled INTEGER DEFAULT 0,
-		FOREIGN KEY (calendar_id) REFERENCES calendars(id) ON DELETE CASCADE
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_events_calendar ON events(calendar_id);
-	CREATE INDEX IF NOT EXISTS idx_events_start ON events(start_time);
-	CREATE INDEX IF NOT EXISTS idx_events_end ON events(end_time);
-	CREATE INDEX IF NOT EXISTS idx_calendars_account ON calendars(account_id);
-	`
-
-	_, err := s.db.Exec(schema)
-	return err
-}
-
 // --- Account Operations ---
 
-// SaveAccount saves an account to the database
+// accountColumns lists the account columns in the order scanAccount expects
+const accountColumns = `id, name, type, email, enabled, server_url, username, token_expiry, last_sync, secret_ref, oauth_client_id, goa_id`
+
+// SaveAccount saves an account to the database and its credentials to the secret store
 func (s *Store) SaveAccount(a *Account) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	ref, err := s.saveAccountSecrets(a)
+	if err != nil {
+		return fmt.Errorf("failed to save credentials: %w", err)
+	}
+
 	// Use ON CONFLICT DO UPDATE instead of REPLACE to avoid triggering CASCADE deletes
-	_, err := s.db.Exec(`
-		INSERT INTO accounts (id, name, type, email, enabled, server_url, username, access_token, refresh_token, token_expiry, app_password, last_sync)
+	_, err = s.db.Exec(`
+		INSERT INTO accounts (id, name, type, email, enabled, server_url, username, token_expiry, last_sync, secret_ref, oauth_client_id, goa_id)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			name = excluded.name,
@@ -137,45 +90,113 @@ func (s *Store) SaveAccount(a *Account) error {
 			enabled = excluded.enabled,
 			server_url = excluded.server_url,
 			username = excluded.username,
-			access_token = excluded.access_token,
-			refresh_token = excluded.refresh_token,
 			token_expiry = excluded.token_expiry,
-			app_password = excluded.app_password,
-			last_sync = excluded.last_sync`,
+			last_sync = excluded.last_sync,
+			secret_ref = excluded.secret_ref,
+			oauth_client_id = excluded.oauth_client_id,
+			goa_id = excluded.goa_id`,
 		a.ID, a.Name, a.Type, a.Email, a.Enabled, a.ServerURL, a.Username,
-		a.AccessToken, a.RefreshToken, a.TokenExpiry, a.AppPassword, a.LastSync)
+		a.TokenExpiry, a.LastSync, ref, a.ClientID, a.GOAID)
+	return err
+}
+
+// SaveSyncState records what a sync or request changed on an account
+// loaded as before: a new last sync time and refreshed OAuth tokens. Other
+// fields, which the user may have changed meanwhile, are left as stored, and
+// so are tokens replaced meanwhile, e.g. by signing in again.
+func (s *Store) SaveSyncState(before, after *Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ref, err := scanAccount(s.db.QueryRow(`SELECT `+accountColumns+` FROM accounts WHERE id = ?`, after.ID))
+	if err == sql.ErrNoRows {
+		return nil // Removed meanwhile
+	}
+	if err != nil {
+		return err
+	}
+
+	lastSync := current.LastSync
+	if after.LastSync.After(lastSync) {
+		lastSync = after.LastSync
+	}
+
+	tokenExpiry := current.TokenExpiry
+	refreshed := after.AccessToken != before.AccessToken || after.RefreshToken != before.RefreshToken
+	if refreshed && after.GOAID == "" {
+		if err := s.loadAccountSecrets(current, ref); err != nil {
+			return err
+		}
+		if current.AccessToken == before.AccessToken && current.RefreshToken == before.RefreshToken {
+			current.AccessToken = after.AccessToken
+			current.RefreshToken = after.RefreshToken
+			if ref, err = s.saveAccountSecrets(current); err != nil {
+				return fmt.Errorf("failed to save credentials: %w", err)
+			}
+			tokenExpiry = after.TokenExpiry
+		}
+	}
+
+	_, err = s.db.Exec(`UPDATE accounts SET last_sync = ?, token_expiry = ?, secret_ref = ? WHERE id = ?`,
+		lastSync, tokenExpiry, ref, after.ID)
 	return err
 }
 
 // GetAccount retrieves an account by ID
 func (s *Store) GetAccount(id string) (*Account, error) {
-	row := s.db.QueryRow(`SELECT * FROM accounts WHERE id = ?`, id)
-	return scanAccount(row)
+	row := s.db.QueryRow(`SELECT `+accountColumns+` FROM accounts WHERE id = ?`, id)
+	a, ref, err := scanAccount(row)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadAccountSecrets(a, ref); err != nil {
+		return nil, err
+	}
+	return a, nil
 }
 
 // GetAllAccounts retrieves all accounts
 func (s *Store) GetAllAccounts() ([]*Account, error) {
-	rows, err := s.db.Query(`SELECT * FROM accounts ORDER BY name`)
+	rows, err := s.db.Query(`SELECT ` + accountColumns + ` FROM accounts ORDER BY name`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	var accounts []*Account
+	var refs []string
 	for rows.Next() {
-		a, err := scanAccountRows(rows)
+		a, ref, err := scanAccountRows(rows)
 		if err != nil {
 			return nil, err
 		}
 		accounts = append(accounts, a)
+		refs = append(refs, ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-	return accounts, rows.Err()
+	rows.Close()
+
+	for i, a := range accounts {
+		if err := s.loadAccountSecrets(a, refs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return accounts, nil
 }
 
-// DeleteAccount deletes an account and its calendars/events
+// DeleteAccount deletes an account, its calendars/events and its credentials
 func (s *Store) DeleteAccount(id string) error {
-	_, err := s.db.Exec(`DELETE FROM accounts WHERE id = ?`, id)
-	return err
+	var ref sql.NullString
+	if err := s.db.QueryRow(`SELECT secret_ref FROM accounts WHERE id = ?`, id).Scan(&ref); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM accounts WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return s.deleteSecret(ref.String)
 }
 
 // --- Calendar Operations ---
@@ -187,8 +208,8 @@ func (s *Store) SaveCalendar(c *Calendar) error {
 
 	// Use ON CONFLICT DO UPDATE instead of REPLACE to avoid triggering CASCADE deletes
 	_, err := s.db.Exec(`
-		INSERT INTO calendars (id, account_id, name, description, color, visible, read_only, sync_token, last_sync)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO calendars (id, account_id, name, description, color, visible, read_only, sync_token, last_sync, sort_order)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			account_id = excluded.account_id,
 			name = excluded.name,
@@ -197,8 +218,9 @@ func (s *Store) SaveCalendar(c *Calendar) error {
 			visible = excluded.visible,
 			read_only = excluded.read_only,
 			sync_token = excluded.sync_token,
-			last_sync = excluded.last_sync`,
-		c.ID, c.AccountID, c.Name, c.Description, c.Color, c.Visible, c.ReadOnly, c.SyncToken, c.LastSync)
+			last_sync = excluded.last_sync,
+			sort_order = excluded.sort_order`,
+		c.ID, c.AccountID, c.Name, c.Description, c.Color, c.Visible, c.ReadOnly, c.SyncToken, c.LastSync, c.Order)
 	return err
 }
 
@@ -210,7 +232,7 @@ func (s *Store) GetCalendar(id string) (*Calendar, error) {
 
 // GetCalendarsByAccount retrieves all calendars for an account
 func (s *Store) GetCalendarsByAccount(accountID string) ([]*Calendar, error) {
-	rows, err := s.db.Query(`SELECT * FROM calendars WHERE account_id = ? ORDER BY name`, accountID)
+	rows, err := s.db.Query(`SELECT * FROM calendars WHERE account_id = ? ORDER BY sort_order, name`, accountID)
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +251,7 @@ func (s *Store) GetCalendarsByAccount(accountID string) ([]*Calendar, error) {
 
 // GetAllCalendars retrieves all calendars
 func (s *Store) GetAllCalendars() ([]*Calendar, error) {
-	rows, err := s.db.Query(`SELECT * FROM calendars ORDER BY name`)
+	rows, err := s.db.Query(`SELECT * FROM calendars ORDER BY sort_order, name`)
 	if err != nil {
 		return nil, err
 	}
@@ -246,9 +268,13 @@ func (s *Store) GetAllCalendars() ([]*Calendar, error) {
 	return calendars, rows.Err()
 }
 
-// GetVisibleCalendars retrieves all visible calendars
+// GetVisibleCalendars retrieves all visible calendars of enabled accounts
 func (s *Store) GetVisibleCalendars() ([]*Calendar, error) {
-	rows, err := s.db.Query(`SELECT * FROM calendars WHERE visible = 1 ORDER BY name`)
+	rows, err := s.db.Query(`
+		SELECT c.* FROM calendars c
+		JOIN accounts a ON c.account_id = a.id
+		WHERE c.visible = 1 AND a.enabled = 1
+		ORDER BY c.sort_order, c.name`)
 	if err != nil {
 		return nil, err
 	}
@@ -273,18 +299,50 @@ func (s *Store) DeleteCalendar(id string) error {
 
 // --- Event Operations ---
 
-// SaveEvent saves an event to the database
+// SaveEvent saves an event to the database. An event without an ID takes
+// the ID of the stored event with the same remote identity, or a new one.
 func (s *Store) SaveEvent(e *Event) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	return saveEvent(s.db, e)
+}
+
+// execer runs statements on the database or in a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// saveEvent inserts or updates an event through db
+func saveEvent(db execer, e *Event) error {
+	if e.ID == "" && e.RemoteID != "" {
+		err := db.QueryRow(`SELECT id FROM events WHERE calendar_id = ? AND remote_id = ? AND recurrence_id = ?`,
+			e.CalendarID, e.RemoteID, e.RecurrenceID).Scan(&e.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	if e.ID == "" {
+		e.ID = NewEventID()
+	}
+
 	recurrence, _ := json.Marshal(e.Recurrence)
 	reminders, _ := json.Marshal(e.Reminders)
+	var attendees, organizer []byte
+	if len(e.Attendees) > 0 {
+		attendees, _ = json.Marshal(e.Attendees)
+	}
+	if e.Organizer != nil {
+		organizer, _ = json.Marshal(e.Organizer)
+	}
+	start := storedTime(e.Start, e.WallClock())
+	end := storedTime(e.End, e.WallClock())
 
 	// Use ON CONFLICT DO UPDATE instead of REPLACE to avoid issues with foreign keys
-	_, err := s.db.Exec(`
-		INSERT INTO events (id, calendar_id, uid, title, description, location, start_time, end_time, all_day, color, recurrence, reminders, created, modified, etag, status, cancelled)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	_, err := db.Exec(`
+		INSERT INTO events (id, calendar_id, uid, title, description, location, start_time, end_time, all_day, color, recurrence, reminders, created, modified, etag, status, cancelled, remote_id, recurrence_id, time_zone, floating, end_time_zone, attendees, organizer)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			calendar_id = excluded.calendar_id,
 			uid = excluded.uid,
@@ -301,10 +359,18 @@ func (s *Store) SaveEvent(e *Event) error {
 			modified = excluded.modified,
 			etag = excluded.etag,
 			status = excluded.status,
-			cancelled = excluded.cancelled`,
+			cancelled = excluded.cancelled,
+			remote_id = excluded.remote_id,
+			recurrence_id = excluded.recurrence_id,
+			time_zone = excluded.time_zone,
+			floating = excluded.floating,
+			end_time_zone = excluded.end_time_zone,
+			attendees = excluded.attendees,
+			organizer = excluded.organizer`,
 		e.ID, e.CalendarID, e.UID, e.Title, e.Description, e.Location,
-		e.Start, e.End, e.AllDay, e.Color, string(recurrence), string(reminders),
-		e.Created, e.Modified, e.ETag, e.Status, e.Cancelled)
+		start, end, e.AllDay, e.Color, string(recurrence), string(reminders),
+		e.Created, e.Modified, e.ETag, e.Status, e.Cancelled, e.RemoteID, e.RecurrenceID,
+		e.TimeZone, e.Floating, e.EndTimeZone, string(attendees), string(organizer))
 	return err
 }
 
@@ -314,6 +380,43 @@ func (s *Store) GetEvent(id string) (*Event, error) {
 	return scanEvent(row)
 }
 
+// GetEventByRemoteID retrieves the event of a calendar with the given
+// provider ID and recurrence ID, which is empty unless it is a single occurrence
+func (s *Store) GetEventByRemoteID(calendarID, remoteID, recurrenceID string) (*Event, error) {
+	if remoteID == "" {
+		return nil, sql.ErrNoRows // Events that were never uploaded have no remote identity
+	}
+	row := s.db.QueryRow(`SELECT * FROM events WHERE calendar_id = ? AND remote_id = ? AND recurrence_id = ?`,
+		calendarID, remoteID, recurrenceID)
+	return scanEvent(row)
+}
+
+// GetEventByUID retrieves the event of a calendar with the given iCal UID
+// and recurrence ID, such as the meeting an emailed update is for
+func (s *Store) GetEventByUID(calendarID, uid, recurrenceID string) (*Event, error) {
+	if uid == "" {
+		return nil, sql.ErrNoRows
+	}
+	row := s.db.QueryRow(`SELECT * FROM events WHERE calendar_id = ? AND uid = ? AND recurrence_id = ?`,
+		calendarID, uid, recurrenceID)
+	return scanEvent(row)
+}
+
+// GetEventsByRemoteID retrieves the events of a calendar with the given
+// provider ID, including its single occurrences
+func (s *Store) GetEventsByRemoteID(calendarID, remoteID string) ([]*Event, error) {
+	if remoteID == "" {
+		return nil, nil
+	}
+	rows, err := s.db.Query(`SELECT * FROM events WHERE calendar_id = ? AND remote_id = ?`, calendarID, remoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanEvents(rows)
+}
+
 // GetEventsByCalendar retrieves all events for a calendar
 func (s *Store) GetEventsByCalendar(calendarID string) ([]*Event, error) {
 	rows, err := s.db.Query(`SELECT * FROM events WHERE calendar_id = ? AND cancelled = 0 ORDER BY start_time`, calendarID)
@@ -325,21 +428,38 @@ func (s *Store) GetEventsByCalendar(calendarID string) ([]*Event, error) {
 	return scanEvents(rows)
 }
 
-// GetEventsInRange retrieves all events within a time range
+// GetEventsInRange retrieves all events within a time range, with their times
+// in the location of start. All-day and floating events are placed by their
+// wall-clock time there.
 func (s *Store) GetEventsInRange(start, end time.Time) ([]*Event, error) {
+	// Wall-clock times may be up to a zone's offset either side of the instants
+	// they are compared with, so the query is padded and its result trimmed
 	rows, err := s.db.Query(`
 		SELECT e.* FROM events e
 		JOIN calendars c ON e.calendar_id = c.id
-		WHERE c.visible = 1 AND e.cancelled = 0
+		JOIN accounts a ON c.account_id = a.id
+		WHERE c.visible = 1 AND a.enabled = 1 AND e.cancelled = 0
 		AND e.start_time < ? AND e.end_time > ?
 		ORDER BY e.start_time`,
-		end, start)
+		end.UTC().Add(maxZoneOffset), start.UTC().Add(-maxZoneOffset))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	return scanEvents(rows)
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	inRange := events[:0]
+	for _, e := range events {
+		e.Start, e.End = e.In(start.Location())
+		if e.Start.Before(end) && e.End.After(start) {
+			inRange = append(inRange, e)
+		}
+	}
+	sort.SliceStable(inRange, func(i, j int) bool { return inRange[i].Start.Before(inRange[j].Start) })
+	return inRange, nil
 }
 
 // GetEventsForDate retrieves all events for a specific date
@@ -349,6 +469,48 @@ func (s *Store) GetEventsForDate(date time.Time) ([]*Event, error) {
 	return s.GetEventsInRange(start, end)
 }
 
+// PreviewImport sorts events read from a file into those a calendar does not
+// have yet and duplicates, matched by UID and recurrence ID
+func (s *Store) PreviewImport(calendarID string, events []*Event) (*ImportPreview, error) {
+	preview := &ImportPreview{}
+	seen := make(map[string]bool)
+	for _, e := range events {
+		key := e.UID + "\x00" + e.RecurrenceID
+		existing, err := s.GetEventByUID(calendarID, e.UID, e.RecurrenceID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to look for duplicates: %w", err)
+		}
+		if existing != nil || seen[key] {
+			preview.Duplicates = append(preview.Duplicates, e)
+			continue
+		}
+		seen[key] = true
+		preview.New = append(preview.New, e)
+	}
+	return preview, nil
+}
+
+// ImportEvents adds events to a calendar as new events. If accountID is set,
+// they are queued for upload to that account's provider.
+func (s *Store) ImportEvents(calendarID, accountID string, events []*Event) error {
+	for _, e := range events {
+		e.ID = NewEventID()
+		e.CalendarID = calendarID
+		e.RemoteID, e.ETag = "", ""
+		if err := s.SaveEvent(e); err != nil {
+			return fmt.Errorf("failed to save %q: %w", e.Title, err)
+		}
+		if accountID == "" {
+			continue
+		}
+		change := &PendingChange{AccountID: accountID, CalendarID: calendarID, EventID: e.ID, Op: ChangeCreate}
+		if err := s.QueueChange(change); err != nil {
+			return fmt.Errorf("failed to queue %q for upload: %w", e.Title, err)
+		}
+	}
+	return nil
+}
+
 // DeleteEvent deletes an event
 func (s *Store) DeleteEvent(id string) error {
 	_, err := s.db.Exec(`DELETE FROM events WHERE id = ?`, id)
@@ -361,15 +523,16 @@ func (s *Store) DeleteEventsByCalendar(calendarID string) error {
 	return err
 }
 
-// DeleteEventsNotIn deletes events for a calendar that are not in the given ID list.
-// This is used during sync to remove events that were deleted from the remote calendar.
+// DeleteEventsNotIn deletes the uploaded events of a calendar that are not in
+// the given ID list. This is used during sync to remove events that were
+// deleted from the remote calendar; events never uploaded are kept.
 func (s *Store) DeleteEventsNotIn(calendarID string, keepIDs []string) (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if len(keepIDs) == 0 {
 		// If no events returned, delete all events for this calendar
-		result, err := s.db.Exec(`DELETE FROM events WHERE calendar_id = ?`, calendarID)
+		result, err := s.db.Exec(`DELETE FROM events WHERE calendar_id = ? AND remote_id != ''`, calendarID)
 		if err != nil {
 			return 0, err
 		}
@@ -385,7 +548,7 @@ func (s *Store) DeleteEventsNotIn(calendarID string, keepIDs []string) (int64, e
 		args[i+1] = id
 	}
 
-	query := fmt.Sprintf(`DELETE FROM events WHERE calendar_id = ? AND id NOT IN (%s)`,
+	query := fmt.Sprintf(`DELETE FROM events WHERE calendar_id = ? AND remote_id != '' AND id NOT IN (%s)`,
 		strings.Join(placeholders, ","))
 	result, err := s.db.Exec(query, args...)
 	if err != nil {
@@ -394,61 +557,606 @@ func (s *Store) DeleteEventsNotIn(calendarID string, keepIDs []string) (int64, e
 	return result.RowsAffected()
 }
 
+// --- Trash Operations ---
+
+// TrashEvent moves an event to the trash and returns it
+func (s *Store) TrashEvent(id string) (*Event, error) {
+	e, err := s.GetEvent(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT INTO trash (event_id, calendar_id, data, deleted_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(event_id) DO UPDATE SET calendar_id = excluded.calendar_id, data = excluded.data, deleted_at = excluded.deleted_at`,
+		e.ID, e.CalendarID, string(data), time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM events WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	return e, tx.Commit()
+}
+
+// GetTrash retrieves the events in the trash, most recently deleted first
+func (s *Store) GetTrash() ([]*TrashedEvent, error) {
+	rows, err := s.db.Query(`SELECT data, deleted_at FROM trash ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trashed []*TrashedEvent
+	for rows.Next() {
+		var data string
+		t := &TrashedEvent{}
+		if err := rows.Scan(&data, &t.DeletedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &t.Event); err != nil {
+			return nil, fmt.Errorf("failed to decode trashed event: %w", err)
+		}
+		t.DeletedAt = t.DeletedAt.Local()
+		trashed = append(trashed, t)
+	}
+	return trashed, rows.Err()
+}
+
+// MoveEvent saves an event moved from another calendar, where it leaves
+// nothing behind. If the old calendar belongs to the remote account
+// oldAccountID, the copy uploaded there is queued for deletion, by the remote
+// ID stored when the event is moved. The event itself becomes a new event in
+// its calendar, without a remote identity.
+func (s *Store) MoveEvent(e *Event, oldCalendarID, oldAccountID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if oldAccountID != "" {
+		var remoteID, etag sql.NullString
+		var modified sql.NullTime
+		err := tx.QueryRow(`SELECT remote_id, etag, modified FROM events WHERE id = ?`, e.ID).Scan(&remoteID, &etag, &modified)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM outbox WHERE calendar_id = ? AND event_id = ?`, oldCalendarID, e.ID); err != nil {
+			return err
+		}
+		// Never uploaded, so dropping its changes is enough
+		if remoteID.String != "" {
+			change := &PendingChange{
+				AccountID:    oldAccountID,
+				CalendarID:   oldCalendarID,
+				EventID:      e.ID,
+				Op:           ChangeDelete,
+				RemoteID:     remoteID.String,
+				BaseETag:     etag.String,
+				BaseModified: modified.Time,
+			}
+			if err := insertChange(tx, change); err != nil {
+				return err
+			}
+		}
+	}
+
+	e.RemoteID, e.RecurrenceID, e.ETag = "", "", ""
+	if err := saveEvent(tx, e); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTrashedEvent retrieves an event in the trash
+func (s *Store) GetTrashedEvent(id string) (*TrashedEvent, error) {
+	var data string
+	t := &TrashedEvent{}
+	if err := s.db.QueryRow(`SELECT data, deleted_at FROM trash WHERE event_id = ?`, id).Scan(&data, &t.DeletedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &t.Event); err != nil {
+		return nil, fmt.Errorf("failed to decode trashed event: %w", err)
+	}
+	t.DeletedAt = t.DeletedAt.Local()
+	return t, nil
+}
+
+// RestoreEvent moves an event from the trash back into its calendar and
+// returns it. For a calendar of a remote account, the event is queued for
+// upload in the same transaction: a delete still waiting in the outbox is
+// replaced by an update carrying the edits it covered, and an event already
+// deleted on the server comes back as a new one. An empty accountID restores
+// it locally only.
+func (s *Store) RestoreEvent(id, accountID string) (*Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var data string
+	if err := tx.QueryRow(`SELECT data FROM trash WHERE event_id = ?`, id).Scan(&data); err != nil {
+		return nil, err
+	}
+	e := &Event{}
+	if err := json.Unmarshal([]byte(data), e); err != nil {
+		return nil, fmt.Errorf("failed to decode trashed event: %w", err)
+	}
+
+	if accountID != "" {
+		change := &PendingChange{AccountID: accountID, CalendarID: e.CalendarID, EventID: e.ID, Op: ChangeCreate}
+		if e.RemoteID != "" {
+			var deletes int
+			if err := tx.QueryRow(`SELECT COUNT(*) FROM outbox WHERE calendar_id = ? AND event_id = ? AND op = ?`,
+				e.CalendarID, e.ID, ChangeDelete).Scan(&deletes); err != nil {
+				return nil, err
+			}
+			if deletes > 0 {
+				// The server still has it
+				change.Op = ChangeUpdate
+				change.RemoteID, change.BaseETag, change.BaseModified = e.RemoteID, e.ETag, e.Modified
+			} else {
+				// Like a moved event, it comes back as a new event on the server
+				e.RemoteID, e.RecurrenceID, e.ETag = "", "", ""
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM outbox WHERE calendar_id = ? AND event_id = ?`, e.CalendarID, e.ID); err != nil {
+			return nil, err
+		}
+		if err := insertChange(tx, change); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := saveEvent(tx, e); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM trash WHERE event_id = ?`, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetEvent(id)
+}
+
+// DeleteFromTrash permanently deletes an event in the trash
+func (s *Store) DeleteFromTrash(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`DELETE FROM trash WHERE event_id = ?`, id)
+	return err
+}
+
+// EmptyTrash permanently deletes every event in the trash
+func (s *Store) EmptyTrash() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`DELETE FROM trash`)
+	return err
+}
+
+// PurgeTrash permanently deletes the events moved to the trash before a
+// time and returns how many there were
+func (s *Store) PurgeTrash(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec(`DELETE FROM trash WHERE deleted_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// --- Outbox Operations ---
+
+// QueueChange records a local event change for upload, folding it into the
+// changes already waiting for the same event: an edit is covered by a
+// pending create or update, and deleting an event that was never uploaded
+// drops its pending changes altogether
+func (s *Store) QueueChange(c *PendingChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, op FROM outbox WHERE account_id = ? AND calendar_id = ? AND event_id = ? ORDER BY id`,
+		c.AccountID, c.CalendarID, c.EventID)
+	if err != nil {
+		return err
+	}
+	pending := make(map[ChangeOp]int64)
+	for rows.Next() {
+		var id int64
+		var op ChangeOp
+		if err := rows.Scan(&id, &op); err != nil {
+			rows.Close()
+			return err
+		}
+		pending[op] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	switch c.Op {
+	case ChangeCreate, ChangeUpdate:
+		// The replay sends the event as it is stored, so an earlier change
+		// already carries this edit; retry it right away
+		if id, ok := pending[ChangeCreate]; ok {
+			return retryChangeNow(tx, id)
+		}
+		if id, ok := pending[c.Op]; ok {
+			return retryChangeNow(tx, id)
+		}
+	case ChangeDelete:
+		_, created := pending[ChangeCreate]
+		if _, err := tx.Exec(`DELETE FROM outbox WHERE account_id = ? AND calendar_id = ? AND event_id = ?`,
+			c.AccountID, c.CalendarID, c.EventID); err != nil {
+			return err
+		}
+		if created {
+			return tx.Commit()
+		}
+	}
+
+	if err := insertChange(tx, c); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertChange adds a change to the end of the outbox and sets its ID
+func insertChange(tx *sql.Tx, c *PendingChange) error {
+	if c.Created.IsZero() {
+		c.Created = time.Now()
+	}
+	result, err := tx.Exec(`
+		INSERT INTO outbox (account_id, calendar_id, event_id, op, created, remote_id, base_etag, base_modified)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.AccountID, c.CalendarID, c.EventID, c.Op, c.Created, c.RemoteID, c.BaseETag, c.BaseModified)
+	if err != nil {
+		return err
+	}
+	c.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// DropPendingChanges removes the queued changes to an event in a calendar
+func (s *Store) DropPendingChanges(calendarID, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`DELETE FROM outbox WHERE calendar_id = ? AND event_id = ?`, calendarID, eventID)
+	return err
+}
+
+// retryChangeNow clears a pending change's backoff so the next sync sends it
+func retryChangeNow(tx *sql.Tx, id int64) error {
+	if _, err := tx.Exec(`UPDATE outbox SET attempts = 0, next_attempt = NULL, last_error = '' WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPendingChanges retrieves an account's queued changes in the order they were made
+func (s *Store) GetPendingChanges(accountID string) ([]*PendingChange, error) {
+	rows, err := s.db.Query(`
+		SELECT id, account_id, calendar_id, event_id, op, created, attempts, next_attempt, last_error, remote_id, base_etag, base_modified
+		FROM outbox WHERE account_id = ? ORDER BY id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPendingChanges(rows)
+}
+
+// GetPendingEvents retrieves the latest queued change of every event with
+// changes that have not been uploaded yet, keyed by event ID
+func (s *Store) GetPendingEvents() (map[string]*PendingChange, error) {
+	rows, err := s.db.Query(`
+		SELECT id, account_id, calendar_id, event_id, op, created, attempts, next_attempt, last_error, remote_id, base_etag, base_modified
+		FROM outbox ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes, err := scanPendingChanges(rows)
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[string]*PendingChange, len(changes))
+	for _, c := range changes {
+		pending[c.EventID] = c
+	}
+	return pending, nil
+}
+
+// CompleteChange removes a change from the outbox once the provider accepted it
+func (s *Store) CompleteChange(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`DELETE FROM outbox WHERE id = ?`, id)
+	return err
+}
+
+// FailChange records a failed attempt to send a change and when to try again
+func (s *Store) FailChange(id int64, cause error, retryAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`
+		UPDATE outbox SET attempts = attempts + 1, next_attempt = ?, last_error = ? WHERE id = ?`,
+		retryAt, cause.Error(), id)
+	return err
+}
+
+// --- Conflict Operations ---
+
+// SaveConflict records an event that changed both locally and on the server,
+// replacing an earlier conflict for the same event
+func (s *Store) SaveConflict(c *Conflict) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	remote, _ := json.Marshal(c.Remote)
+	if c.Detected.IsZero() {
+		c.Detected = time.Now()
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO conflicts (account_id, calendar_id, event_id, remote, detected)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(calendar_id, event_id) DO UPDATE SET
+			remote = excluded.remote`,
+		c.AccountID, c.CalendarID, c.EventID, string(remote), c.Detected)
+	return err
+}
+
+// GetConflicts retrieves all unresolved conflicts, oldest first
+func (s *Store) GetConflicts() ([]*Conflict, error) {
+	rows, err := s.db.Query(`
+		SELECT account_id, calendar_id, event_id, remote, detected
+		FROM conflicts ORDER BY detected`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conflicts []*Conflict
+	for rows.Next() {
+		c := &Conflict{}
+		var remote sql.NullString
+		if err := rows.Scan(&c.AccountID, &c.CalendarID, &c.EventID, &remote, &c.Detected); err != nil {
+			return nil, err
+		}
+		if remote.String != "" && remote.String != "null" {
+			json.Unmarshal([]byte(remote.String), &c.Remote)
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
+
+// AcceptRemote resolves a conflict by keeping the server's version of the
+// event and dropping the local changes
+func (s *Store) AcceptRemote(c *Conflict) error {
+	if err := s.DropPendingChanges(c.CalendarID, c.EventID); err != nil {
+		return err
+	}
+	var err error
+	if c.Remote == nil {
+		err = s.DeleteEvent(c.EventID)
+	} else {
+		err = s.SaveEvent(c.Remote)
+	}
+	if err != nil {
+		return err
+	}
+	return s.deleteConflict(c)
+}
+
+// ResolveConflict resolves a conflict with the given version of the event,
+// queued for upload over the server's version. A nil version deletes it.
+func (s *Store) ResolveConflict(c *Conflict, resolved *Event) error {
+	if err := s.DropPendingChanges(c.CalendarID, c.EventID); err != nil {
+		return err
+	}
+
+	change := &PendingChange{
+		AccountID:  c.AccountID,
+		CalendarID: c.CalendarID,
+		EventID:    c.EventID,
+		Op:         ChangeUpdate,
+	}
+	if c.Remote != nil {
+		change.BaseETag = c.Remote.ETag
+		change.BaseModified = c.Remote.Modified
+	} else {
+		change.Op = ChangeCreate
+	}
+
+	if resolved == nil {
+		change.Op = ChangeDelete
+		if c.Remote != nil {
+			change.RemoteID = c.Remote.RemoteID
+		}
+		if err := s.DeleteEvent(c.EventID); err != nil {
+			return err
+		}
+	} else {
+		if c.Remote != nil {
+			resolved.ETag = c.Remote.ETag
+		} else {
+			// Deleted on the server, so it is uploaded as a new event
+			resolved.RemoteID, resolved.RecurrenceID, resolved.ETag = "", "", ""
+		}
+		if err := s.SaveEvent(resolved); err != nil {
+			return err
+		}
+	}
+
+	// An event deleted on both sides needs nothing more
+	if c.Remote != nil || resolved != nil {
+		if err := s.QueueChange(change); err != nil {
+			return err
+		}
+	}
+	return s.deleteConflict(c)
+}
+
+// deleteConflict removes a resolved conflict
+func (s *Store) deleteConflict(c *Conflict) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`DELETE FROM conflicts WHERE calendar_id = ? AND event_id = ?`, c.CalendarID, c.EventID)
+	return err
+}
+
+// --- Sync History Operations ---
+
+// syncHistoryLimit is the number of sync records kept per account
+const syncHistoryLimit = 200
+
+// SaveSyncRecord appends a record to an account's sync history, pruning old entries
+func (s *Store) SaveSyncRecord(r *SyncRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errors, _ := json.Marshal(r.Errors)
+	result, err := s.db.Exec(`
+		INSERT INTO sync_history (account_id, calendar_id, started, duration_ms, events_created, events_updated, events_deleted, errors)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.AccountID, r.CalendarID, r.Started, r.Duration.Milliseconds(),
+		r.EventsCreated, r.EventsUpdated, r.EventsDeleted, string(errors))
+	if err != nil {
+		return err
+	}
+	r.ID, _ = result.LastInsertId()
+
+	_, err = s.db.Exec(`
+		DELETE FROM sync_history WHERE account_id = ? AND id NOT IN (
+			SELECT id FROM sync_history WHERE account_id = ? ORDER BY started DESC LIMIT ?
+		)`, r.AccountID, r.AccountID, syncHistoryLimit)
+	return err
+}
+
+// GetSyncHistory retrieves the most recent sync records for an account, newest first
+func (s *Store) GetSyncHistory(accountID string, limit int) ([]*SyncRecord, error) {
+	rows, err := s.db.Query(`
+		SELECT id, account_id, calendar_id, started, duration_ms, events_created, events_updated, events_deleted, errors
+		FROM sync_history WHERE account_id = ? ORDER BY started DESC, id DESC LIMIT ?`,
+		accountID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*SyncRecord
+	for rows.Next() {
+		r := &SyncRecord{}
+		var calendarID, errors sql.NullString
+		var durationMs int64
+		err := rows.Scan(&r.ID, &r.AccountID, &calendarID, &r.Started, &durationMs,
+			&r.EventsCreated, &r.EventsUpdated, &r.EventsDeleted, &errors)
+		if err != nil {
+			return nil, err
+		}
+		r.CalendarID = calendarID.String
+		r.Duration = time.Duration(durationMs) * time.Millisecond
+		if errors.String != "" && errors.String != "null" {
+			json.Unmarshal([]byte(errors.String), &r.Errors)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
 // --- Scan helpers ---
 
-func scanAccount(row *sql.Row) (*Account, error) {
+func scanAccount(row *sql.Row) (*Account, string, error) {
 	a := &Account{}
-	var email, serverURL, username, accessToken, refreshToken, appPassword sql.NullString
+	var email, serverURL, username, secretRef, clientID, goaID sql.NullString
 	var tokenExpiry, lastSync sql.NullTime
 	err := row.Scan(&a.ID, &a.Name, &a.Type, &email, &a.Enabled, &serverURL, &username,
-		&accessToken, &refreshToken, &tokenExpiry, &appPassword, &lastSync)
+		&tokenExpiry, &lastSync, &secretRef, &clientID, &goaID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	a.Email = email.String
 	a.ServerURL = serverURL.String
 	a.Username = username.String
-	a.AccessToken = accessToken.String
-	a.RefreshToken = refreshToken.String
-	a.AppPassword = appPassword.String
+	a.ClientID = clientID.String
+	a.GOAID = goaID.String
 	if tokenExpiry.Valid {
 		a.TokenExpiry = tokenExpiry.Time
 	}
 	if lastSync.Valid {
 		a.LastSync = lastSync.Time
 	}
-	return a, nil
+	return a, secretRef.String, nil
 }
 
-func scanAccountRows(rows *sql.Rows) (*Account, error) {
+func scanAccountRows(rows *sql.Rows) (*Account, string, error) {
 	a := &Account{}
-	var email, serverURL, username, accessToken, refreshToken, appPassword sql.NullString
+	var email, serverURL, username, secretRef, clientID, goaID sql.NullString
 	var tokenExpiry, lastSync sql.NullTime
 	err := rows.Scan(&a.ID, &a.Name, &a.Type, &email, &a.Enabled, &serverURL, &username,
-		&accessToken, &refreshToken, &tokenExpiry, &appPassword, &lastSync)
+		&tokenExpiry, &lastSync, &secretRef, &clientID, &goaID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	a.Email = email.String
 	a.ServerURL = serverURL.String
 	a.Username = username.String
-	a.AccessToken = accessToken.String
-	a.RefreshToken = refreshToken.String
-	a.AppPassword = appPassword.String
+	a.ClientID = clientID.String
+	a.GOAID = goaID.String
 	if tokenExpiry.Valid {
 		a.TokenExpiry = tokenExpiry.Time
 	}
 	if lastSync.Valid {
 		a.LastSync = lastSync.Time
 	}
-	return a, nil
+	return a, secretRef.String, nil
 }
 
 func scanCalendar(row *sql.Row) (*Calendar, error) {
 	c := &Calendar{}
 	var description, color, syncToken sql.NullString
 	var lastSync sql.NullTime
-	err := row.Scan(&c.ID, &c.AccountID, &c.Name, &description, &color, &c.Visible, &c.ReadOnly, &syncToken, &lastSync)
+	err := row.Scan(&c.ID, &c.AccountID, &c.Name, &description, &color, &c.Visible, &c.ReadOnly, &syncToken, &lastSync, &c.Order)
 	if err != nil {
 		return nil, err
 	}
@@ -468,7 +1176,7 @@ func scanCalendarRows(rows *sql.Rows) (*Calendar, error) {
 	c := &Calendar{}
 	var description, color, syncToken sql.NullString
 	var lastSync sql.NullTime
-	err := rows.Scan(&c.ID, &c.AccountID, &c.Name, &description, &color, &c.Visible, &c.ReadOnly, &syncToken, &lastSync)
+	err := rows.Scan(&c.ID, &c.AccountID, &c.Name, &description, &color, &c.Visible, &c.ReadOnly, &syncToken, &lastSync, &c.Order)
 	if err != nil {
 		return nil, err
 	}
@@ -487,14 +1195,19 @@ func scanCalendarRows(rows *sql.Rows) (*Calendar, error) {
 func scanEvent(row *sql.Row) (*Event, error) {
 	e := &Event{}
 	var uid, description, location, color, recurrence, reminders, etag, status sql.NullString
+	var attendees, organizer string
 	var created, modified sql.NullTime
 	err := row.Scan(&e.ID, &e.CalendarID, &uid, &e.Title, &description, &location,
 		&e.Start, &e.End, &e.AllDay, &color, &recurrence, &reminders,
-		&created, &modified, &etag, &status, &e.Cancelled)
+		&created, &modified, &etag, &status, &e.Cancelled, &e.RemoteID, &e.RecurrenceID,
+		&e.TimeZone, &e.Floating, &e.EndTimeZone, &attendees, &organizer)
 	if err != nil {
 		return nil, err
 	}
 
+	e.Start = loadedTime(e.Start, e.WallClock())
+	e.End = loadedTime(e.End, e.WallClock())
+
 	e.UID = uid.String
 	e.Description = description.String
 	e.Location = location.String
@@ -517,6 +1230,12 @@ func scanEvent(row *sql.Row) (*Event, error) {
 	if reminders.String != "" && reminders.String != "null" {
 		json.Unmarshal([]byte(reminders.String), &e.Reminders)
 	}
+	if attendees != "" {
+		json.Unmarshal([]byte(attendees), &e.Attendees)
+	}
+	if organizer != "" {
+		json.Unmarshal([]byte(organizer), &e.Organizer)
+	}
 
 	return e, nil
 }
@@ -526,14 +1245,19 @@ func scanEvents(rows *sql.Rows) ([]*Event, error) {
 	for rows.Next() {
 		e := &Event{}
 		var uid, description, location, color, recurrence, reminders, etag, status sql.NullString
+		var attendees, organizer string
 		var created, modified sql.NullTime
 		err := rows.Scan(&e.ID, &e.CalendarID, &uid, &e.Title, &description, &location,
 			&e.Start, &e.End, &e.AllDay, &color, &recurrence, &reminders,
-			&created, &modified, &etag, &status, &e.Cancelled)
+			&created, &modified, &etag, &status, &e.Cancelled, &e.RemoteID, &e.RecurrenceID,
+			&e.TimeZone, &e.Floating, &e.EndTimeZone, &attendees, &organizer)
 		if err != nil {
 			return nil, err
 		}
 
+		e.Start = loadedTime(e.Start, e.WallClock())
+		e.End = loadedTime(e.End, e.WallClock())
+
 		e.UID = uid.String
 		e.Description = description.String
 		e.Location = location.String
@@ -556,8 +1280,34 @@ func scanEvents(rows *sql.Rows) ([]*Event, error) {
 		if reminders.String != "" && reminders.String != "null" {
 			json.Unmarshal([]byte(reminders.String), &e.Reminders)
 		}
+		if attendees != "" {
+			json.Unmarshal([]byte(attendees), &e.Attendees)
+		}
+		if organizer != "" {
+			json.Unmarshal([]byte(organizer), &e.Organizer)
+		}
 
 		events = append(events, e)
 	}
 	return events, rows.Err()
 }
+
+func scanPendingChanges(rows *sql.Rows) ([]*PendingChange, error) {
+	var changes []*PendingChange
+	for rows.Next() {
+		c := &PendingChange{}
+		var nextAttempt, baseModified sql.NullTime
+		var lastError, baseETag sql.NullString
+		err := rows.Scan(&c.ID, &c.AccountID, &c.CalendarID, &c.EventID, &c.Op,
+			&c.Created, &c.Attempts, &nextAttempt, &lastError, &c.RemoteID, &baseETag, &baseModified)
+		if err != nil {
+			return nil, err
+		}
+		c.NextAttempt = nextAttempt.Time
+		c.LastError = lastError.String
+		c.BaseETag = baseETag.String
+		c.BaseModified = baseModified.Time
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
@@ -0,0 +1,169 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaveSyncStateKeepsConcurrentEdits(t *testing.T) {
+	store := openTestStore(t, "")
+	if err := store.SetSecretStore(memSecrets{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveAccount(&Account{ID: "acc", Name: "Work", Type: AccountTypeGoogle, Enabled: true, AccessToken: "old", RefreshToken: "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A sync starts with its own copy of the account...
+	synced, err := store.GetAccount("acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := *synced
+
+	// ...while the user renames and disables it
+	edited, _ := store.GetAccount("acc")
+	edited.Name = "Office"
+	edited.Enabled = false
+	if err := store.SaveAccount(edited); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sync refreshes the access token and finishes
+	synced.AccessToken = "new"
+	synced.TokenExpiry = time.Now().Add(time.Hour).Truncate(time.Second)
+	synced.LastSync = time.Now().Truncate(time.Second)
+	if err := store.SaveSyncState(&before, synced); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetAccount("acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Office" || got.Enabled {
+		t.Errorf("edits made during the sync were lost: name %q, enabled %v", got.Name, got.Enabled)
+	}
+	if got.AccessToken != "new" || got.RefreshToken != "refresh" {
+		t.Errorf("tokens = %q, %q; want the refreshed access token", got.AccessToken, got.RefreshToken)
+	}
+	if !got.LastSync.Equal(synced.LastSync) || !got.TokenExpiry.Equal(synced.TokenExpiry) {
+		t.Errorf("last sync %v, expiry %v not saved", got.LastSync, got.TokenExpiry)
+	}
+}
+
+func TestSaveSyncStateKeepsNewSignIn(t *testing.T) {
+	store := openTestStore(t, "")
+	if err := store.SetSecretStore(memSecrets{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveAccount(&Account{ID: "acc", Name: "Work", Type: AccountTypeGoogle, Enabled: true, AccessToken: "old", RefreshToken: "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	synced, _ := store.GetAccount("acc")
+	before := *synced
+
+	// Signing in again while the sync runs replaces the tokens
+	reauthed, _ := store.GetAccount("acc")
+	reauthed.AccessToken = "signed-in"
+	reauthed.RefreshToken = "signed-in-refresh"
+	if err := store.SaveAccount(reauthed); err != nil {
+		t.Fatal(err)
+	}
+
+	synced.AccessToken = "refreshed"
+	if err := store.SaveSyncState(&before, synced); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := store.GetAccount("acc")
+	if got.AccessToken != "signed-in" || got.RefreshToken != "signed-in-refresh" {
+		t.Errorf("tokens = %q, %q; want those of the new sign-in", got.AccessToken, got.RefreshToken)
+	}
+}
+
+// trashUploadedEvent stores an event uploaded to the server and moves it to
+// the trash, queueing its delete
+func trashUploadedEvent(t *testing.T, store *Store) *Event {
+	t.Helper()
+	if err := store.SaveAccount(&Account{ID: "acc", Name: "Work", Type: AccountTypeCalDAV, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveCalendar(&Calendar{ID: "cal", AccountID: "acc", Name: "Work"}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)
+	event := &Event{ID: "ev", CalendarID: "cal", Title: "Standup", Start: start, End: start.Add(time.Hour), RemoteID: "ev.ics", ETag: "v1"}
+	if err := store.SaveEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.TrashEvent("ev"); err != nil {
+		t.Fatal(err)
+	}
+	change := &PendingChange{AccountID: "acc", CalendarID: "cal", EventID: "ev", Op: ChangeDelete, RemoteID: "ev.ics", BaseETag: "v1"}
+	if err := store.QueueChange(change); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestRestoreEventReplacesPendingDelete(t *testing.T) {
+	store := openTestStore(t, "")
+	trashUploadedEvent(t, store)
+
+	restored, err := store.RestoreEvent("ev", "acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.RemoteID != "ev.ics" {
+		t.Errorf("RemoteID = %q, want the server's copy kept", restored.RemoteID)
+	}
+	changes, err := store.GetPendingChanges("acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Op != ChangeUpdate || changes[0].BaseETag != "v1" {
+		t.Fatalf("pending changes = %+v, want one update over v1", changes)
+	}
+	if trashed, _ := store.GetTrash(); len(trashed) != 0 {
+		t.Errorf("event still in the trash")
+	}
+}
+
+func TestRestoreEventAfterDeleteSent(t *testing.T) {
+	store := openTestStore(t, "")
+	trashUploadedEvent(t, store)
+
+	// The replay sends the delete before the event is restored
+	changes, _ := store.GetPendingChanges("acc")
+	if err := store.CompleteChange(changes[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := store.RestoreEvent("ev", "acc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.RemoteID != "" || restored.ETag != "" {
+		t.Errorf("restored event keeps the identity of the deleted server copy: %q, %q", restored.RemoteID, restored.ETag)
+	}
+	changes, _ = store.GetPendingChanges("acc")
+	if len(changes) != 1 || changes[0].Op != ChangeCreate {
+		t.Fatalf("pending changes = %+v, want one create", changes)
+	}
+}
+
+func TestRestoreEventLocally(t *testing.T) {
+	store := openTestStore(t, "")
+	trashUploadedEvent(t, store)
+
+	if _, err := store.RestoreEvent("ev", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetEvent("ev"); err != nil {
+		t.Errorf("event not restored: %v", err)
+	}
+	if changes, _ := store.GetPendingChanges("acc"); len(changes) != 1 || changes[0].Op != ChangeDelete {
+		t.Errorf("pending changes = %+v, want the outbox left alone", changes)
+	}
+}
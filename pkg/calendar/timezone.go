@@ -0,0 +1,130 @@
+package calendar
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxZoneOffset is the largest UTC offset in use. All-day and floating times
+// are stored as wall-clock time, so queries by instant are padded by it.
+const maxZoneOffset = 14 * time.Hour
+
+// LocalTimeZone returns the IANA name of the system time zone, or an empty
+// string if it cannot be determined
+func LocalTimeZone() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		if _, err := time.LoadLocation(tz); err == nil {
+			return tz
+		}
+	}
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	return ""
+}
+
+// LoadTimeZone returns the location of an IANA time zone name, or nil if it
+// is empty or unknown
+func LoadTimeZone(name string) *time.Location {
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// WallClock reports whether the event's times are wall-clock times that mean
+// the same in every zone: all-day dates and floating times
+func (e *Event) WallClock() bool {
+	return e.AllDay || e.Floating
+}
+
+// EndZone returns the IANA zone of the event's end, which is its start zone
+// unless it ends elsewhere
+func (e *Event) EndZone() string {
+	if e.EndTimeZone != "" {
+		return e.EndTimeZone
+	}
+	return e.TimeZone
+}
+
+// InZone returns the event's start and end in the zones they were scheduled
+// in, or in the local zone if it has none
+func (e *Event) InZone() (start, end time.Time) {
+	start, end = e.Start, e.End
+	if e.WallClock() {
+		return start, end
+	}
+	if loc := LoadTimeZone(e.TimeZone); loc != nil {
+		start = e.Start.In(loc)
+	}
+	if loc := LoadTimeZone(e.EndZone()); loc != nil {
+		end = e.End.In(loc)
+	}
+	return start, end
+}
+
+// In returns the event's start and end in loc. All-day dates and floating
+// times keep their wall-clock time.
+func (e *Event) In(loc *time.Location) (start, end time.Time) {
+	if e.WallClock() {
+		return withLocation(e.Start, loc), withLocation(e.End, loc)
+	}
+	return e.Start.In(loc), e.End.In(loc)
+}
+
+// TimeZoneNames returns the IANA time zone names known to the system, sorted,
+// or nil if the zone database cannot be read
+func TimeZoneNames() []string {
+	data, err := os.ReadFile("/usr/share/zoneinfo/tzdata.zi")
+	if err != nil {
+		return nil
+	}
+
+	// Zones are "Z Name ..." lines and links to them "L Target Name"
+	var names []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 2 && fields[0] == "Z":
+			names = append(names, fields[1])
+		case len(fields) >= 3 && fields[0] == "L":
+			names = append(names, fields[2])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withLocation returns the same wall-clock time in another location
+func withLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// storedTime converts an event time for the database: instants in UTC, and
+// wall-clock times unchanged but labelled UTC
+func storedTime(t time.Time, wallClock bool) time.Time {
+	if wallClock {
+		return withLocation(t, time.UTC)
+	}
+	return t.UTC()
+}
+
+// loadedTime converts a time read from the database for display in the local zone
+func loadedTime(t time.Time, wallClock bool) time.Time {
+	if wallClock {
+		return withLocation(t, time.Local)
+	}
+	return t.Local()
+}
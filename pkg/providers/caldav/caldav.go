@@ -1,10 +1,15 @@
 package caldav
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/djwarf/switchcal/pkg/calendar"
 	"github.com/djwarf/switchcal/pkg/providers"
@@ -21,7 +26,7 @@ type OAuthHTTPClient struct {
 
 func (c *OAuthHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	req.Header.Set("Authorization", "Bearer "+c.token)
-	return http.DefaultClient.Do(req)
+	return providers.HTTPClient.Do(req)
 }
 
 // NewOAuthHTTPClient creates an HTTP client with OAuth Bearer auth
@@ -29,11 +34,31 @@ func NewOAuthHTTPClient(accessToken string) webdav.HTTPClient {
 	return &OAuthHTTPClient{token: accessToken}
 }
 
+// statusClient reports rate-limited (429) and failed (5xx) responses as
+// providers.HTTPError, so a sync can back off as the server asks; go-webdav's
+// own errors do not expose the status or Retry-After header
+type statusClient struct {
+	webdav.HTTPClient
+}
+
+func (c statusClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		defer resp.Body.Close()
+		return nil, providers.NewHTTPError("CalDAV server", resp)
+	}
+	return resp, nil
+}
+
 // Client implements the Provider interface for CalDAV servers
 type Client struct {
 	account      *calendar.Account
 	httpClient   webdav.HTTPClient
 	caldavClient *caldav.Client
+	homeSet      string // Calendar home set of the current user
 }
 
 // NewClient creates a new CalDAV client
@@ -71,10 +96,20 @@ func (c *Client) Authenticate(ctx context.Context) error {
 	if c.account.Type == calendar.AccountTypeGoogle && c.account.AccessToken != "" {
 		httpClient = NewOAuthHTTPClient(c.account.AccessToken)
 	} else {
-		httpClient = webdav.HTTPClientWithBasicAuth(nil, c.account.Username, c.account.AppPassword)
+		httpClient = webdav.HTTPClientWithBasicAuth(providers.HTTPClient, c.account.Username, c.account.AppPassword)
 	}
+	httpClient = statusClient{httpClient}
 	c.httpClient = httpClient
 
+	// Discover the server from the email address when no URL was given
+	if c.account.ServerURL == "" {
+		serverURL, err := DiscoverServerURL(ctx, c.account.Username, c.account.AppPassword, c.account.Username)
+		if err != nil {
+			return err
+		}
+		c.account.ServerURL = serverURL
+	}
+
 	client, err := caldav.NewClient(httpClient, c.account.ServerURL)
 	if err != nil {
 		return fmt.Errorf("failed to create CalDAV client: %w", err)
@@ -87,10 +122,11 @@ func (c *Client) Authenticate(ctx context.Context) error {
 	}
 
 	// Test connection by finding the calendar home
-	_, err = client.FindCalendarHomeSet(ctx, "")
+	homeSet, err := findHomeSet(ctx, client)
 	if err != nil {
 		return fmt.Errorf("failed to authenticate: %w", err)
 	}
+	c.homeSet = homeSet
 
 	return nil
 }
@@ -128,30 +164,10 @@ func (c *Client) ListCalendars(ctx context.Context) ([]*calendar.Calendar, error
 		return calendars, nil
 	}
 
-	// Standard CalDAV discovery
-	homeSet, err := c.caldavClient.FindCalendarHomeSet(ctx, "")
-	if err != nil {
-		return nil, fmt.Errorf("failed to find calendar home: %w", err)
-	}
-
-	cals, err := c.caldavClient.FindCalendars(ctx, homeSet)
+	calendars, err := c.listCalendarCollections(ctx, c.homeSet)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list calendars: %w", err)
 	}
-
-	var calendars []*calendar.Calendar
-	for _, cal := range cals {
-		calendars = append(calendars, &calendar.Calendar{
-			ID:          cal.Path,
-			AccountID:   c.account.ID,
-			Name:        cal.Name,
-			Description: cal.Description,
-			Color:       "#4285f4", // Default color
-			Visible:     true,
-			ReadOnly:    false,
-		})
-	}
-
 	return calendars, nil
 }
 
@@ -179,11 +195,14 @@ func (c *Client) GetEvents(ctx context.Context, calendarID string, start, end ti
 
 	var events []*calendar.Event
 	for _, obj := range objects {
-		event, err := parseICalEvent(&obj, calendarID)
+		parsed, err := parseICalEvents(&obj, calendarID)
 		if err != nil {
 			continue // Skip invalid events
 		}
-		events = append(events, event)
+		for _, event := range parsed {
+			event.MarkSelf(c.selfAddress())
+			events = append(events, event)
+		}
 	}
 
 	return events, nil
@@ -200,183 +219,365 @@ func (c *Client) CreateEvent(ctx context.Context, calendarID string, event *cale
 		event.UID = uuid.New().String()
 	}
 
-	icalData := eventToICal(event)
-	path := fmt.Sprintf("%s/%s.ics", calendarID, event.UID)
+	// Servers that schedule meetings (RFC 6638) invite the attendees of events
+	// the user organizes
+	if len(event.Attendees) > 0 && event.Organizer == nil && c.selfAddress() != "" {
+		event.Organizer = &calendar.Attendee{Email: c.selfAddress(), Name: c.account.Name, Self: true}
+	}
 
-	_, err := c.caldavClient.PutCalendarObject(ctx, path, icalData)
-	if err != nil {
+	href := path.Join(calendarID, objectName(event.UID))
+
+	// Never overwrite another event that has the same UID
+	header := http.Header{"If-None-Match": {"*"}}
+	if err := c.putEvent(ctx, href, event, calendar.EventToICal(event), header); err != nil {
 		return fmt.Errorf("failed to create event: %w", err)
 	}
-
+	event.RemoteID = href
 	return nil
 }
 
-// UpdateEvent updates an existing event
+// objectName returns the name of a new calendar object for an event: its UID
+// when that is safe to use in a URL, otherwise a fresh one
+func objectName(uid string) string {
+	for _, r := range uid {
+		safe := r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_.@", r))
+		if !safe {
+			return uuid.New().String() + ".ics"
+		}
+	}
+	return uid + ".ics"
+}
+
+// UpdateEvent updates an existing event, unless it has changed on the server
+// since the version in event.ETag
 func (c *Client) UpdateEvent(ctx context.Context, calendarID string, event *calendar.Event) error {
 	if c.caldavClient == nil {
 		return fmt.Errorf("not authenticated")
 	}
 
-	icalData := eventToICal(event)
-	path := fmt.Sprintf("%s/%s.ics", calendarID, event.UID)
+	if err := checkHref(calendarID, event.RemoteID); err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
 
-	_, err := c.caldavClient.PutCalendarObject(ctx, path, icalData)
+	data, err := c.eventObject(ctx, event)
 	if err != nil {
 		return fmt.Errorf("failed to update event: %w", err)
 	}
 
+	header := http.Header{}
+	if event.ETag != "" {
+		header.Set("If-Match", strconv.Quote(event.ETag))
+	}
+	if err := c.putEvent(ctx, event.RemoteID, event, data, header); err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
 	return nil
 }
 
+// eventObject returns the calendar object to store an updated event as. The
+// series and its changed occurrences share one object, so the other VEVENTs
+// stored with the event are kept.
+func (c *Client) eventObject(ctx context.Context, event *calendar.Event) (*ical.Calendar, error) {
+	obj, err := c.caldavClient.GetCalendarObject(ctx, event.RemoteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stored event: %w", err)
+	}
+
+	var others []*ical.Component
+	for _, child := range obj.Data.Children {
+		if child.Name != ical.CompEvent {
+			continue
+		}
+		recurrenceID := ""
+		if prop := child.Props.Get(ical.PropRecurrenceID); prop != nil {
+			recurrenceID = calendar.ICalRecurrenceID(obj.Data, prop)
+		}
+		if recurrenceID != event.RecurrenceID {
+			others = append(others, child)
+		}
+	}
+	if len(others) == 0 {
+		return calendar.EventToICal(event), nil
+	}
+
+	// Keep the time zones the other VEVENTs refer to
+	data := calendar.NewICalendar()
+	for _, child := range obj.Data.Children {
+		if child.Name == ical.CompTimezone {
+			data.Children = append(data.Children, child)
+		}
+	}
+	data.Children = append(data.Children, others...)
+	calendar.AddICalEvent(data, event)
+	return data, nil
+}
+
+// putEvent uploads an event as data and sets its ETag to the one of the
+// stored version, fetching it if the server does not return it
+func (c *Client) putEvent(ctx context.Context, path string, event *calendar.Event, data *ical.Calendar, header http.Header) error {
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(data); err != nil {
+		return err
+	}
+	header.Set("Content-Type", ical.MIMEType)
+
+	resp, err := c.request(ctx, http.MethodPut, path, buf.Bytes(), header)
+	if hasStatus(err, http.StatusPreconditionFailed) {
+		return fmt.Errorf("the event has changed on the server: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if etag := parseETag(resp.Header.Get("ETag")); etag != "" {
+		event.ETag = etag
+		return nil
+	}
+	obj, err := c.caldavClient.GetCalendarObject(ctx, path)
+	if err != nil {
+		return fmt.Errorf("failed to read back event: %w", err)
+	}
+	event.ETag = obj.ETag
+	return nil
+}
+
+// parseETag returns the opaque value of an ETag header, "" if there is none
+func parseETag(header string) string {
+	etag := strings.TrimPrefix(strings.TrimSpace(header), "W/")
+	if unquoted, err := strconv.Unquote(etag); err == nil {
+		return unquoted
+	}
+	return etag
+}
+
 // DeleteEvent deletes an event from the CalDAV server
-func (c *Client) DeleteEvent(ctx context.Context, calendarID string, eventID string) error {
+func (c *Client) DeleteEvent(ctx context.Context, calendarID string, remoteID string) error {
+	return c.DeleteEventIfMatch(ctx, calendarID, remoteID, "")
+}
+
+// DeleteEventIfMatch deletes an event from the CalDAV server unless it has
+// changed there since the version with the given ETag. An event already
+// gone from the href it was stored at counts as deleted.
+func (c *Client) DeleteEventIfMatch(ctx context.Context, calendarID, remoteID, etag string) error {
 	if c.caldavClient == nil {
 		return fmt.Errorf("not authenticated")
 	}
-
-	path := fmt.Sprintf("%s/%s.ics", calendarID, eventID)
-	err := c.caldavClient.RemoveAll(ctx, path)
-	if err != nil {
+	if err := checkHref(calendarID, remoteID); err != nil {
 		return fmt.Errorf("failed to delete event: %w", err)
 	}
 
+	header := http.Header{}
+	if etag != "" {
+		header.Set("If-Match", strconv.Quote(etag))
+	}
+	resp, err := c.request(ctx, http.MethodDelete, remoteID, nil, header)
+	switch {
+	case hasStatus(err, http.StatusNotFound):
+		return nil
+	case hasStatus(err, http.StatusPreconditionFailed):
+		return fmt.Errorf("the event has changed on the server: %w", err)
+	case err != nil:
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	resp.Body.Close()
 	return nil
 }
 
-// Sync performs a full sync (placeholder for now)
-func (c *Client) Sync(ctx context.Context) error {
-	c.account.LastSync = time.Now()
+// checkHref makes sure a remote ID is the href of an object in a calendar,
+// as stored from the server, so requests never go to a guessed path
+func checkHref(calendarID, remoteID string) error {
+	collection := strings.TrimSuffix(calendarID, "/") + "/"
+	if !strings.HasPrefix(remoteID, collection) || len(remoteID) == len(collection) {
+		return fmt.Errorf("%q is not an object in calendar %s", remoteID, calendarID)
+	}
 	return nil
 }
 
-// parseICalEvent parses a CalDAV object into an Event
-func parseICalEvent(obj *caldav.CalendarObject, calendarID string) (*calendar.Event, error) {
+// selfAddress returns the user's email address, matched against attendees
+func (c *Client) selfAddress() string {
+	if c.account.Email != "" {
+		return c.account.Email
+	}
+	if strings.Contains(c.account.Username, "@") {
+		return c.account.Username
+	}
+	return ""
+}
+
+// GetTasks returns the tasks (VTODOs) in a calendar
+func (c *Client) GetTasks(ctx context.Context, calendarID string) ([]*calendar.Task, error) {
+	if c.caldavClient == nil {
+		return nil, fmt.Errorf("not authenticated")
+	}
+
+	query := &caldav.CalendarQuery{
+		CompFilter: caldav.CompFilter{
+			Name:  "VCALENDAR",
+			Comps: []caldav.CompFilter{{Name: "VTODO"}},
+		},
+	}
+
+	objects, err := c.caldavClient.QueryCalendar(ctx, calendarID, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tasks: %w", err)
+	}
+
+	var tasks []*calendar.Task
+	for _, obj := range objects {
+		if task := parseICalTask(&obj, calendarID); task != nil {
+			tasks = append(tasks, task)
+		}
+	}
+
+	return tasks, nil
+}
+
+// parseICalEvents parses the events of a CalDAV object: a single event, or
+// a recurring series and its changed occurrences
+func parseICalEvents(obj *caldav.CalendarObject, calendarID string) ([]*calendar.Event, error) {
 	if obj.Data == nil {
 		return nil, fmt.Errorf("no data in calendar object")
 	}
 
+	var events []*calendar.Event
 	for _, component := range obj.Data.Children {
 		if component.Name != ical.CompEvent {
 			continue
 		}
 
-		event := &calendar.Event{
-			CalendarID: calendarID,
-			ETag:       obj.ETag,
-			Status:     calendar.StatusConfirmed,
+		event, err := calendar.ParseICalEvent(obj.Data, component)
+		if err != nil {
+			return nil, err
 		}
+		event.CalendarID = calendarID
+		event.ETag = obj.ETag
 
-		// Get UID
-		if prop := component.Props.Get(ical.PropUID); prop != nil {
-			event.UID = prop.Value
-			event.ID = prop.Value
-		}
+		// The object's href names the event on the server; other clients
+		// do not necessarily name objects after their UID
+		event.RemoteID = obj.Path
+		events = append(events, event)
+	}
 
-		// Get summary/title
-		if prop := component.Props.Get(ical.PropSummary); prop != nil {
-			event.Title = prop.Value
-		}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no VEVENT found")
+	}
+	return events, nil
+}
 
-		// Get description
-		if prop := component.Props.Get(ical.PropDescription); prop != nil {
-			event.Description = prop.Value
-		}
+// parseICalTask parses the first VTODO of a CalDAV object, returning nil if there is none
+func parseICalTask(obj *caldav.CalendarObject, calendarID string) *calendar.Task {
+	if obj.Data == nil {
+		return nil
+	}
 
-		// Get location
-		if prop := component.Props.Get(ical.PropLocation); prop != nil {
-			event.Location = prop.Value
+	for _, component := range obj.Data.Children {
+		if component.Name != ical.CompToDo {
+			continue
 		}
 
-		// Get start time
-		if prop := component.Props.Get(ical.PropDateTimeStart); prop != nil {
-			if t, err := prop.DateTime(nil); err == nil {
-				event.Start = t
-			}
-			// Check if all-day event
-			if val := prop.Params.Get("VALUE"); val == "DATE" {
-				event.AllDay = true
-			}
+		task := &calendar.Task{
+			CalendarID: calendarID,
+			ETag:       obj.ETag,
 		}
 
-		// Get end time
-		if prop := component.Props.Get(ical.PropDateTimeEnd); prop != nil {
-			if t, err := prop.DateTime(nil); err == nil {
-				event.End = t
-			}
+		if prop := component.Props.Get(ical.PropUID); prop != nil {
+			task.UID = prop.Value
+			task.ID = prop.Value
 		}
-
-		// Get created time
-		if prop := component.Props.Get(ical.PropCreated); prop != nil {
+		if prop := component.Props.Get(ical.PropSummary); prop != nil {
+			task.Title = prop.Value
+		}
+		if prop := component.Props.Get(ical.PropDescription); prop != nil {
+			task.Description = prop.Value
+		}
+		if prop := component.Props.Get(ical.PropDue); prop != nil {
 			if t, err := prop.DateTime(nil); err == nil {
-				event.Created = t
+				task.Due = t
 			}
 		}
-
-		// Get last modified time
-		if prop := component.Props.Get(ical.PropLastModified); prop != nil {
+		if prop := component.Props.Get(ical.PropCompleted); prop != nil {
 			if t, err := prop.DateTime(nil); err == nil {
-				event.Modified = t
+				task.Completed = t
 			}
 		}
-
-		// Get status
-		if prop := component.Props.Get(ical.PropStatus); prop != nil {
-			switch prop.Value {
-			case "CONFIRMED":
-				event.Status = calendar.StatusConfirmed
-			case "TENTATIVE":
-				event.Status = calendar.StatusTentative
-			case "CANCELLED":
-				event.Status = calendar.StatusCancelled
-				event.Cancelled = true
+		if prop := component.Props.Get(ical.PropPriority); prop != nil {
+			if p, err := prop.Int(); err == nil {
+				task.Priority = p
 			}
 		}
 
-		return event, nil
+		return task
 	}
 
-	return nil, fmt.Errorf("no VEVENT found")
+	return nil
 }
 
-// eventToICal converts an Event to iCal format
-func eventToICal(event *calendar.Event) *ical.Calendar {
-	cal := ical.NewCalendar()
-	cal.Props.SetText(ical.PropVersion, "2.0")
-	cal.Props.SetText(ical.PropProductID, "-//UniCal//EN")
-
-	vevent := ical.NewComponent(ical.CompEvent)
-	vevent.Props.SetText(ical.PropUID, event.UID)
-	vevent.Props.SetText(ical.PropSummary, event.Title)
+// Ensure Client implements Provider and TaskProvider
+var (
+	_ providers.Provider     = (*Client)(nil)
+	_ providers.TaskProvider = (*Client)(nil)
+)
 
-	if event.Description != "" {
-		vevent.Props.SetText(ical.PropDescription, event.Description)
+func init() {
+	factory := func(account *calendar.Account) (providers.Provider, error) {
+		return NewClient(account), nil
 	}
-	if event.Location != "" {
-		vevent.Props.SetText(ical.PropLocation, event.Location)
+	userField := providers.CredentialField{
+		Key:         providers.FieldUsername,
+		Label:       "Username/Email:",
+		Placeholder: "user@example.com",
 	}
-
-	if event.AllDay {
-		vevent.Props.SetDate(ical.PropDateTimeStart, event.Start)
-		vevent.Props.SetDate(ical.PropDateTimeEnd, event.End)
-	} else {
-		vevent.Props.SetDateTime(ical.PropDateTimeStart, event.Start)
-		vevent.Props.SetDateTime(ical.PropDateTimeEnd, event.End)
+	passField := providers.CredentialField{
+		Key:         providers.FieldPassword,
+		Label:       "App Password:",
+		Placeholder: "App-specific password",
+		Secret:      true,
 	}
 
-	vevent.Props.SetDateTime(ical.PropDateTimeStamp, time.Now())
-
-	switch event.Status {
-	case calendar.StatusConfirmed:
-		vevent.Props.SetText(ical.PropStatus, "CONFIRMED")
-	case calendar.StatusTentative:
-		vevent.Props.SetText(ical.PropStatus, "TENTATIVE")
-	case calendar.StatusCancelled:
-		vevent.Props.SetText(ical.PropStatus, "CANCELLED")
-	}
-
-	cal.Children = append(cal.Children, vevent)
-	return cal
+	providers.Register(providers.Registration{
+		Type:        calendar.AccountTypeApple,
+		DisplayName: "Apple iCloud (CalDAV)",
+		ShortName:   "Apple",
+		Description: "For Apple iCloud, you need an app-specific password.\nGo to appleid.apple.com → Security → App-Specific Passwords",
+		Order:       20,
+		Auth:        providers.AuthPassword,
+		Fields: []providers.CredentialField{
+			{
+				Key:     providers.FieldServerURL,
+				Label:   "Server URL:",
+				Default: providers.CalDAVServers[calendar.AccountTypeApple],
+				Fixed:   true,
+			},
+			userField,
+			passField,
+		},
+		Capabilities: providers.Capabilities{
+			Attendees: true,
+		},
+		New: factory,
+	})
+
+	providers.Register(providers.Registration{
+		Type:        calendar.AccountTypeCalDAV,
+		DisplayName: "CalDAV Server",
+		ShortName:   "CalDAV",
+		Description: "Enter your email address and password. The server is discovered\nautomatically; enter its URL only if discovery fails.",
+		Order:       30,
+		Auth:        providers.AuthPassword,
+		Fields: []providers.CredentialField{
+			{
+				Key:         providers.FieldServerURL,
+				Label:       "Server URL (optional):",
+				Placeholder: "https://caldav.example.com/",
+				Optional:    true,
+			},
+			userField,
+			passField,
+		},
+		Capabilities: providers.Capabilities{
+			Attendees: true,
+		},
+		New: factory,
+	})
 }
-
-// Ensure Client implements Provider
-var _ providers.Provider = (*Client)(nil)
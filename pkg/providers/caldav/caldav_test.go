@@ -0,0 +1,302 @@
+package caldav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// objectServer is a minimal CalDAV collection that versions its objects and
+// honours If-Match and If-None-Match
+type objectServer struct {
+	mu        sync.Mutex
+	objects   map[string]string // path → data
+	versions  map[string]int
+	omitETag  bool // Leave the ETag out of PUT responses
+	lastMatch string
+}
+
+func (s *objectServer) etag(path string) string {
+	return fmt.Sprintf("v%d", s.versions[path])
+}
+
+func (s *objectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	_, exists := s.objects[path]
+	s.lastMatch = r.Header.Get("If-Match")
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" && (!exists || match != strconv.Quote(s.etag(path))) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[path] = string(data)
+		s.versions[path]++
+		if !s.omitETag {
+			w.Header().Set("ETag", strconv.Quote(s.etag(path)))
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Header().Set("ETag", strconv.Quote(s.etag(path)))
+		io.WriteString(w, s.objects[path])
+	case http.MethodDelete:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// newTestClient returns a client connected to a fake CalDAV server
+func newTestClient(t *testing.T) (*Client, *objectServer) {
+	objects := &objectServer{objects: make(map[string]string), versions: make(map[string]int)}
+	server := httptest.NewServer(objects)
+	t.Cleanup(server.Close)
+
+	c := NewClient(&calendar.Account{ID: "acc", Type: calendar.AccountTypeCalDAV, ServerURL: server.URL})
+	c.httpClient = statusClient{http.DefaultClient}
+	client, err := caldav.NewClient(c.httpClient, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.caldavClient = client
+	return c, objects
+}
+
+func testEvent() *calendar.Event {
+	start := time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)
+	return &calendar.Event{ID: "local", Title: "Standup", Start: start, End: start.Add(30 * time.Minute)}
+}
+
+func TestCreateAndUpdateEventKeepServerETag(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+
+	event := testEvent()
+	if err := c.CreateEvent(ctx, "/cal", event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ETag != "v1" {
+		t.Fatalf("ETag after create = %q, want v1", event.ETag)
+	}
+
+	// Two edits in a row each apply to the version the previous one stored
+	for _, want := range []string{"v2", "v3"} {
+		event.Title += "!"
+		if err := c.UpdateEvent(ctx, "/cal", event); err != nil {
+			t.Fatal(err)
+		}
+		if event.ETag != want {
+			t.Fatalf("ETag after update = %q, want %s", event.ETag, want)
+		}
+	}
+}
+
+func TestCreateEventDoesNotOverwrite(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+
+	event := testEvent()
+	if err := c.CreateEvent(ctx, "/cal", event); err != nil {
+		t.Fatal(err)
+	}
+	other := testEvent()
+	other.UID = event.UID
+	other.Title = "Other"
+	if err := c.CreateEvent(ctx, "/cal", other); err == nil {
+		t.Fatal("create replaced an existing event with the same UID")
+	}
+}
+
+func TestUpdateEventRejectedWhenChangedOnServer(t *testing.T) {
+	c, _ := newTestClient(t)
+	ctx := context.Background()
+
+	event := testEvent()
+	if err := c.CreateEvent(ctx, "/cal", event); err != nil {
+		t.Fatal(err)
+	}
+	stale := *event
+	event.Title = "Changed elsewhere"
+	if err := c.UpdateEvent(ctx, "/cal", event); err != nil {
+		t.Fatal(err)
+	}
+
+	stale.Title = "Changed here"
+	err := c.UpdateEvent(ctx, "/cal", &stale)
+	if err == nil || !strings.Contains(err.Error(), "changed on the server") {
+		t.Fatalf("update over a stale ETag: got %v", err)
+	}
+}
+
+func TestCreateEventFetchesMissingETag(t *testing.T) {
+	c, objects := newTestClient(t)
+	objects.omitETag = true
+	ctx := context.Background()
+
+	event := testEvent()
+	if err := c.CreateEvent(ctx, "/cal", event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ETag != "v1" {
+		t.Fatalf("ETag = %q, want v1 read back from the server", event.ETag)
+	}
+}
+
+func TestDeleteEventIfMatch(t *testing.T) {
+	c, objects := newTestClient(t)
+	ctx := context.Background()
+
+	event := testEvent()
+	if err := c.CreateEvent(ctx, "/cal", event); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteEventIfMatch(ctx, "/cal", event.RemoteID, "v0"); err == nil {
+		t.Fatal("deleted an event that changed on the server")
+	}
+	if err := c.DeleteEventIfMatch(ctx, "/cal", event.RemoteID, event.ETag); err != nil {
+		t.Fatal(err)
+	}
+	if objects.lastMatch != strconv.Quote(event.ETag) {
+		t.Errorf("If-Match = %q, want %q", objects.lastMatch, strconv.Quote(event.ETag))
+	}
+	// Already gone counts as deleted
+	if err := c.DeleteEvent(ctx, "/cal", event.RemoteID); err != nil {
+		t.Fatalf("deleting a missing event: %v", err)
+	}
+	// but not when the remote ID is no href in the calendar
+	for _, remoteID := range []string{event.UID, "/other/" + event.UID + ".ics", "/cal/"} {
+		if err := c.DeleteEvent(ctx, "/cal", remoteID); err == nil {
+			t.Errorf("deleting %q reported success", remoteID)
+		}
+	}
+}
+
+func TestEventsAreAddressedByHref(t *testing.T) {
+	c, objects := newTestClient(t)
+	ctx := context.Background()
+
+	// Calendar collections end in a slash; object paths must not double it
+	event := testEvent()
+	event.UID = "standup@example.com"
+	if err := c.CreateEvent(ctx, "/cal/", event); err != nil {
+		t.Fatal(err)
+	}
+	if event.RemoteID != "/cal/standup@example.com.ics" {
+		t.Fatalf("RemoteID = %q", event.RemoteID)
+	}
+	if _, ok := objects.objects[event.RemoteID]; !ok {
+		t.Fatalf("objects on server: %v", objects.objects)
+	}
+
+	// Another client named its object differently from the event's UID
+	data := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Other//EN\r\nBEGIN:VEVENT\r\n" +
+		"UID:review@example.com\r\nDTSTAMP:20260504T080000Z\r\nDTSTART:20260504T100000Z\r\n" +
+		"DTEND:20260504T110000Z\r\nSUMMARY:Review\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	objects.objects["/cal/7F3A-1.ics"] = data
+	objects.versions["/cal/7F3A-1.ics"] = 1
+	obj, err := c.caldavClient.GetCalendarObject(ctx, "/cal/7F3A-1.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := parseICalEvents(obj, "/cal/")
+	if err != nil || len(events) != 1 {
+		t.Fatalf("parsed %d events: %v", len(events), err)
+	}
+	other := events[0]
+	if other.RemoteID != "/cal/7F3A-1.ics" {
+		t.Fatalf("RemoteID = %q, want the object's href", other.RemoteID)
+	}
+
+	other.Title = "Review, moved"
+	if err := c.UpdateEvent(ctx, "/cal/", other); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteEventIfMatch(ctx, "/cal/", other.RemoteID, other.ETag); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects.objects) != 1 {
+		t.Errorf("objects on server after update and delete: %v", objects.objects)
+	}
+}
+
+func TestChangedOccurrencesShareTheirObject(t *testing.T) {
+	c, objects := newTestClient(t)
+	ctx := context.Background()
+
+	const href = "/cal/series.ics"
+	objects.objects[href] = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Other//EN\r\n" +
+		"BEGIN:VEVENT\r\nUID:series\r\nDTSTAMP:20260504T080000Z\r\nDTSTART:20260504T090000Z\r\n" +
+		"DTEND:20260504T093000Z\r\nRRULE:FREQ=DAILY;COUNT=5\r\nSUMMARY:Standup\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:series\r\nDTSTAMP:20260504T080000Z\r\nRECURRENCE-ID:20260506T090000Z\r\n" +
+		"DTSTART:20260506T100000Z\r\nDTEND:20260506T103000Z\r\nSUMMARY:Standup, later\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	objects.versions[href] = 1
+
+	obj, err := c.caldavClient.GetCalendarObject(ctx, href)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := parseICalEvents(obj, "/cal/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].RecurrenceID != "" || events[1].RecurrenceID != "2026-05-06T09:00:00Z" {
+		t.Fatalf("parsed %d events, want the series and its changed occurrence", len(events))
+	}
+	for _, e := range events {
+		if e.RemoteID != href {
+			t.Errorf("RemoteID = %q, want %q", e.RemoteID, href)
+		}
+	}
+
+	// Updating the occurrence keeps the series
+	occurrence := events[1]
+	occurrence.Title = "Standup, later still"
+	if err := c.UpdateEvent(ctx, "/cal/", occurrence); err != nil {
+		t.Fatal(err)
+	}
+	obj, err = c.caldavClient.GetCalendarObject(ctx, href)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err = parseICalEvents(obj, "/cal/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	titles := make(map[string]string)
+	for _, e := range events {
+		titles[e.RecurrenceID] = e.Title
+	}
+	if len(events) != 2 || titles[""] != "Standup" || titles[occurrence.RecurrenceID] != occurrence.Title {
+		t.Errorf("stored after update: %v", titles)
+	}
+}
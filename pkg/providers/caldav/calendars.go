@@ -0,0 +1,332 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+	"github.com/google/uuid"
+)
+
+// XML namespaces used in calendar collection requests
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsApple  = "http://apple.com/ns/ical/"
+)
+
+// resolve returns the absolute URL of a path on the account's server
+func (c *Client) resolve(path string) (string, error) {
+	base, err := url.Parse(c.account.ServerURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid server URL: %w", err)
+	}
+	ref, err := url.Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path %q: %w", path, err)
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// request sends a raw WebDAV request and fails on non-2xx responses. Bodies
+// are XML unless header sets another Content-Type.
+func (c *Client) request(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	if c.httpClient == nil {
+		return nil, fmt.Errorf("not authenticated")
+	}
+
+	target, err := c.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if len(body) > 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &statusError{
+			StatusCode: resp.StatusCode,
+			msg:        fmt.Sprintf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(respBody))),
+		}
+	}
+	return resp, nil
+}
+
+// statusError is a non-2xx response to a raw request
+type statusError struct {
+	StatusCode int
+	msg        string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+// hasStatus reports whether err is a response with the given status code
+func hasStatus(err error, code int) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.StatusCode == code
+}
+
+// escapeXML escapes text for use in an XML element
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// calendarPropsXML renders the writable properties of a calendar collection
+func calendarPropsXML(cal *calendar.Calendar) string {
+	var b strings.Builder
+	b.WriteString("<D:displayname>" + escapeXML(cal.Name) + "</D:displayname>")
+	if cal.Description != "" {
+		b.WriteString("<C:calendar-description>" + escapeXML(cal.Description) + "</C:calendar-description>")
+	}
+	if cal.Color != "" {
+		b.WriteString("<A:calendar-color>" + escapeXML(cal.Color) + "</A:calendar-color>")
+	}
+	return b.String()
+}
+
+// CreateCalendar creates a calendar collection in the user's calendar home with MKCALENDAR
+func (c *Client) CreateCalendar(ctx context.Context, cal *calendar.Calendar) error {
+	if c.caldavClient == nil {
+		return fmt.Errorf("not authenticated")
+	}
+
+	if c.homeSet == "" {
+		return fmt.Errorf("calendar home not found")
+	}
+	path := strings.TrimSuffix(c.homeSet, "/") + "/" + uuid.New().String() + "/"
+
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<C:mkcalendar xmlns:D="` + nsDAV + `" xmlns:C="` + nsCalDAV + `" xmlns:A="` + nsApple + `">` +
+		`<D:set><D:prop>` + calendarPropsXML(cal) +
+		`<C:supported-calendar-component-set><C:comp name="VEVENT"/></C:supported-calendar-component-set>` +
+		`</D:prop></D:set></C:mkcalendar>`
+
+	resp, err := c.request(ctx, "MKCALENDAR", path, []byte(body), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create calendar: %w", err)
+	}
+	resp.Body.Close()
+
+	cal.ID = path
+	return nil
+}
+
+// UpdateCalendar sets a calendar collection's name, description and colour with PROPPATCH
+func (c *Client) UpdateCalendar(ctx context.Context, cal *calendar.Calendar) error {
+	body := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<D:propertyupdate xmlns:D="` + nsDAV + `" xmlns:C="` + nsCalDAV + `" xmlns:A="` + nsApple + `">` +
+		`<D:set><D:prop>` + calendarPropsXML(cal) + `</D:prop></D:set></D:propertyupdate>`
+
+	resp, err := c.request(ctx, "PROPPATCH", cal.ID, []byte(body), nil)
+	if err != nil {
+		return fmt.Errorf("failed to update calendar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// PROPPATCH is atomic; any failed property is reported in the multistatus
+	var ms multiStatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse PROPPATCH response: %w", err)
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200") {
+				return fmt.Errorf("failed to update calendar: %s", strings.TrimSpace(ps.Status))
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteCalendar deletes a calendar collection and the events in it
+func (c *Client) DeleteCalendar(ctx context.Context, calendarID string) error {
+	resp, err := c.request(ctx, http.MethodDelete, calendarID, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete calendar: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Ensure Client implements the calendar management interfaces
+var (
+	_ providers.CalendarCreator = (*Client)(nil)
+	_ providers.CalendarEditor  = (*Client)(nil)
+)
+
+// collectionPropfind requests the properties used to describe calendar collections
+const collectionPropfind = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<D:propfind xmlns:D="` + nsDAV + `" xmlns:C="` + nsCalDAV + `" xmlns:A="` + nsApple + `"><D:prop>` +
+	`<D:resourcetype/><D:displayname/><C:calendar-description/>` +
+	`<A:calendar-color/><A:calendar-order/><D:current-user-privilege-set/>` +
+	`</D:prop></D:propfind>`
+
+// multiStatus is a WebDAV multistatus response (RFC 4918 section 14.16)
+type multiStatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string         `xml:"DAV: status"`
+			Prop   collectionProp `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// collectionProp holds the properties of a collection returned by PROPFIND
+type collectionProp struct {
+	ResourceType struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	DisplayName  string `xml:"DAV: displayname"`
+	Description  string `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
+	Color        string `xml:"http://apple.com/ns/ical/ calendar-color"`
+	Order        string `xml:"http://apple.com/ns/ical/ calendar-order"`
+	PrivilegeSet *struct {
+		Privileges []struct {
+			Names []struct {
+				XMLName xml.Name
+			} `xml:",any"`
+		} `xml:"DAV: privilege"`
+	} `xml:"DAV: current-user-privilege-set"`
+}
+
+// writable reports whether the privilege set allows changing the calendar's
+// events (RFC 3744 section 5.4). Servers that do not report privileges are
+// assumed to allow writes.
+func (p *collectionProp) writable() bool {
+	if p.PrivilegeSet == nil {
+		return true
+	}
+	for _, priv := range p.PrivilegeSet.Privileges {
+		for _, name := range priv.Names {
+			if name.XMLName.Space != nsDAV {
+				continue
+			}
+			switch name.XMLName.Local {
+			case "all", "write", "write-content", "bind":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listCalendarCollections lists the calendars in a calendar home set together
+// with their colour, order and the current user's write privileges
+func (c *Client) listCalendarCollections(ctx context.Context, homeSet string) ([]*calendar.Calendar, error) {
+	header := http.Header{"Depth": []string{"1"}}
+	resp, err := c.request(ctx, "PROPFIND", homeSet, []byte(collectionPropfind), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ms multiStatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to parse PROPFIND response: %w", err)
+	}
+
+	var calendars []*calendar.Calendar
+	for _, r := range ms.Responses {
+		// Merge the properties the server found; others come back as 404
+		var prop collectionProp
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200") {
+				continue
+			}
+			if ps.Prop.ResourceType.Calendar != nil {
+				prop.ResourceType = ps.Prop.ResourceType
+			}
+			if ps.Prop.DisplayName != "" {
+				prop.DisplayName = ps.Prop.DisplayName
+			}
+			if ps.Prop.Description != "" {
+				prop.Description = ps.Prop.Description
+			}
+			if ps.Prop.Color != "" {
+				prop.Color = ps.Prop.Color
+			}
+			if ps.Prop.Order != "" {
+				prop.Order = ps.Prop.Order
+			}
+			if ps.Prop.PrivilegeSet != nil {
+				prop.PrivilegeSet = ps.Prop.PrivilegeSet
+			}
+		}
+		if prop.ResourceType.Calendar == nil {
+			continue
+		}
+
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+
+		name := prop.DisplayName
+		if name == "" {
+			name = path.Base(strings.TrimSuffix(href.Path, "/"))
+		}
+
+		color := normalizeColor(prop.Color)
+		if color == "" {
+			color = "#4285f4" // Default color
+		}
+
+		order, _ := strconv.Atoi(strings.TrimSpace(prop.Order))
+
+		calendars = append(calendars, &calendar.Calendar{
+			ID:          href.Path,
+			AccountID:   c.account.ID,
+			Name:        name,
+			Description: prop.Description,
+			Color:       color,
+			Visible:     true,
+			ReadOnly:    !prop.writable(),
+			Order:       order,
+		})
+	}
+	return calendars, nil
+}
+
+// normalizeColor converts Apple's #RRGGBBAA calendar colours to #rrggbb
+func normalizeColor(color string) string {
+	color = strings.ToLower(strings.TrimSpace(color))
+	if !strings.HasPrefix(color, "#") {
+		return ""
+	}
+	switch len(color) {
+	case 7:
+		return color
+	case 9:
+		return color[:7]
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package caldav
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/djwarf/switchcal/pkg/providers"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// maxRedirects limits how many redirects are followed while resolving a context URL
+const maxRedirects = 5
+
+// principalPropfind asks for the current user principal (RFC 5397)
+const principalPropfind = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:current-user-principal/></D:prop></D:propfind>`
+
+// DiscoverServerURL finds the CalDAV context URL for an email address or
+// domain as described in RFC 6764: the _caldavs._tcp SRV and TXT records are
+// consulted first, then https://<domain>/.well-known/caldav. Redirects are
+// followed so the returned URL can be used directly as a server URL.
+func DiscoverServerURL(ctx context.Context, username, password, emailOrDomain string) (string, error) {
+	domain := emailOrDomain
+	if i := strings.LastIndex(domain, "@"); i >= 0 {
+		domain = domain[i+1:]
+	}
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if domain == "" {
+		return "", fmt.Errorf("no domain in %q", emailOrDomain)
+	}
+
+	httpClient := &http.Client{
+		Timeout: providers.HTTPTimeout,
+		// Redirects are followed by hand: net/http turns PROPFIND into GET
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var candidates []string
+	if srvURL, err := caldav.DiscoverContextURL(ctx, domain); err == nil {
+		candidates = append(candidates, srvURL)
+	}
+	candidates = append(candidates, "https://"+domain+"/.well-known/caldav")
+
+	var lastErr error
+	for _, candidate := range candidates {
+		resolved, err := resolveContextURL(ctx, httpClient, candidate, username, password)
+		if err == nil {
+			return resolved, nil
+		}
+		lastErr = err
+	}
+	return "", fmt.Errorf("failed to discover CalDAV server for %s: %w", domain, lastErr)
+}
+
+// resolveContextURL follows redirects from a candidate context URL until it
+// reaches a resource that answers as a WebDAV collection. Like net/http, it
+// only follows redirects to https and stops sending the password once
+// redirected away from the candidate's host and its subdomains.
+func resolveContextURL(ctx context.Context, httpClient *http.Client, rawURL, username, password string) (string, error) {
+	origin, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	sendAuth := true
+
+	for i := 0; i <= maxRedirects; i++ {
+		req, err := http.NewRequestWithContext(ctx, "PROPFIND", rawURL, strings.NewReader(principalPropfind))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+		req.Header.Set("Depth", "0")
+		if sendAuth {
+			req.SetBasicAuth(username, password)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode >= 300 && resp.StatusCode < 400:
+			location, err := resp.Location()
+			if err != nil {
+				return "", fmt.Errorf("redirect from %s without location: %w", rawURL, err)
+			}
+			if location.Scheme != "https" {
+				return "", fmt.Errorf("%s redirects to insecure %s", hostOf(rawURL), location.Redacted())
+			}
+			if !isDomainOrSubdomain(location.Hostname(), origin.Hostname()) {
+				sendAuth = false
+			}
+			rawURL = location.String()
+		case resp.StatusCode == http.StatusMultiStatus, resp.StatusCode == http.StatusOK:
+			return rawURL, nil
+		case resp.StatusCode == http.StatusUnauthorized && !sendAuth:
+			return "", fmt.Errorf("%s redirects to %s; enter %s as the server address if you trust it", origin.Hostname(), hostOf(rawURL), rawURL)
+		case resp.StatusCode == http.StatusUnauthorized:
+			return "", fmt.Errorf("%s rejected the username or password", hostOf(rawURL))
+		default:
+			return "", fmt.Errorf("%s returned %s", rawURL, resp.Status)
+		}
+	}
+	return "", fmt.Errorf("too many redirects resolving %s", rawURL)
+}
+
+// isDomainOrSubdomain reports whether host is parent or one of its
+// subdomains, the hosts net/http keeps sending credentials to on redirects
+func isDomainOrSubdomain(host, parent string) bool {
+	host, parent = strings.ToLower(host), strings.ToLower(parent)
+	return host == parent || strings.HasSuffix(host, "."+parent)
+}
+
+// hostOf returns the host part of a URL for error messages
+func hostOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// findHomeSet follows current-user-principal to the principal's calendar home
+// set (RFC 4791 section 6.2.1). Servers that do not report a principal are
+// queried at the context URL itself.
+func findHomeSet(ctx context.Context, client *caldav.Client) (string, error) {
+	principal, err := client.FindCurrentUserPrincipal(ctx)
+	if err != nil {
+		principal = ""
+	}
+	return client.FindCalendarHomeSet(ctx, principal)
+}
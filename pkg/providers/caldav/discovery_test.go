@@ -0,0 +1,103 @@
+package caldav
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// discoveryClient trusts the test servers whatever host name they are reached by
+func discoveryClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// davServer answers PROPFIND with a multistatus, recording whether a password was sent
+func davServer(t *testing.T, gotAuth *bool) *httptest.Server {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, ok := r.BasicAuth()
+		*gotAuth = ok
+		w.WriteHeader(http.StatusMultiStatus)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// redirectServer redirects every request to target
+func redirectServer(t *testing.T, target string) *httptest.Server {
+	server := httptest.NewTLSServer(http.RedirectHandler(target, http.StatusMovedPermanently))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestResolveContextURLFollowsSameHostRedirect(t *testing.T) {
+	var gotAuth bool
+	dav := davServer(t, &gotAuth)
+	start := redirectServer(t, dav.URL+"/dav/")
+
+	resolved, err := resolveContextURL(context.Background(), discoveryClient(), start.URL+"/.well-known/caldav", "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != dav.URL+"/dav/" {
+		t.Errorf("resolved %s, want %s/dav/", resolved, dav.URL)
+	}
+	if !gotAuth {
+		t.Error("password not sent to the same host")
+	}
+}
+
+func TestResolveContextURLDropsPasswordOnCrossHostRedirect(t *testing.T) {
+	var gotAuth bool
+	dav := davServer(t, &gotAuth)
+	// The same server by another name is another host
+	other := strings.Replace(dav.URL, "127.0.0.1", "localhost", 1)
+	start := redirectServer(t, other+"/dav/")
+
+	resolved, err := resolveContextURL(context.Background(), discoveryClient(), start.URL+"/.well-known/caldav", "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != other+"/dav/" {
+		t.Errorf("resolved %s, want %s/dav/", resolved, other)
+	}
+	if gotAuth {
+		t.Error("password sent to another host")
+	}
+}
+
+func TestResolveContextURLRejectsInsecureRedirect(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request sent over plain HTTP")
+	}))
+	defer plain.Close()
+	start := redirectServer(t, plain.URL+"/dav/")
+
+	if _, err := resolveContextURL(context.Background(), discoveryClient(), start.URL+"/.well-known/caldav", "user", "secret"); err == nil {
+		t.Fatal("redirect to http:// was followed")
+	}
+}
+
+func TestIsDomainOrSubdomain(t *testing.T) {
+	tests := []struct {
+		host, parent string
+		want         bool
+	}{
+		{"example.com", "example.com", true},
+		{"caldav.Example.com", "example.com", true},
+		{"evilexample.com", "example.com", false},
+		{"example.com", "caldav.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := isDomainOrSubdomain(tt.host, tt.parent); got != tt.want {
+			t.Errorf("isDomainOrSubdomain(%q, %q) = %v, want %v", tt.host, tt.parent, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+	"github.com/emersion/go-ical"
+)
+
+// iCalendar participation statuses by ParticipationStatus
+var partStats = map[calendar.ParticipationStatus]string{
+	calendar.ParticipationNeedsAction: "NEEDS-ACTION",
+	calendar.ParticipationAccepted:    "ACCEPTED",
+	calendar.ParticipationTentative:   "TENTATIVE",
+	calendar.ParticipationDeclined:    "DECLINED",
+}
+
+// outboxPropfind asks a principal for its scheduling outbox (RFC 6638 section 2.1)
+const outboxPropfind = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<D:propfind xmlns:D="` + nsDAV + `" xmlns:C="` + nsCalDAV + `"><D:prop><C:schedule-outbox-URL/></D:prop></D:propfind>`
+
+// RespondToInvitation sets the user's PARTSTAT on an event they are invited
+// to. Servers that schedule meetings (RFC 6638) send the reply to the
+// organizer themselves; otherwise it is posted to the user's scheduling
+// outbox if the server has one.
+func (c *Client) RespondToInvitation(ctx context.Context, calendarID string, event *calendar.Event, status calendar.ParticipationStatus, comment string) error {
+	if c.caldavClient == nil {
+		return fmt.Errorf("not authenticated")
+	}
+	if event.RemoteID == "" {
+		return fmt.Errorf("event has not been uploaded")
+	}
+
+	address := c.selfAddress()
+	self := event.SelfAttendee()
+	if self != nil {
+		address = self.Email
+	}
+	if address == "" {
+		return fmt.Errorf("you are not invited to this event")
+	}
+
+	obj, err := c.caldavClient.GetCalendarObject(ctx, event.RemoteID)
+	if err != nil {
+		return fmt.Errorf("failed to get event: %w", err)
+	}
+
+	vevent := findOccurrence(obj.Data, event.RecurrenceID)
+	if vevent == nil {
+		return fmt.Errorf("event not found on the server")
+	}
+	if !setPartStat(vevent, address, partStats[status]) {
+		return fmt.Errorf("you are not invited to this event")
+	}
+	vevent.Props.Del(ical.PropComment)
+	if comment != "" {
+		vevent.Props.SetText(ical.PropComment, comment)
+	}
+	vevent.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+
+	saved, err := c.caldavClient.PutCalendarObject(ctx, event.RemoteID, obj.Data)
+	if err != nil {
+		return fmt.Errorf("failed to save reply: %w", err)
+	}
+	event.ETag = saved.ETag
+	if self != nil {
+		self.Status = status
+	}
+
+	if c.autoSchedules(ctx, calendarID) {
+		return nil
+	}
+	if err := c.sendReply(ctx, obj.Data, vevent, address); err != nil {
+		return fmt.Errorf("saved your reply, but failed to send it to the organizer: %w", err)
+	}
+	return nil
+}
+
+// findOccurrence returns the VEVENT of an occurrence, falling back to the
+// whole series when the occurrence has not been changed on its own
+func findOccurrence(cal *ical.Calendar, recurrence string) *ical.Component {
+	var master *ical.Component
+	for _, child := range cal.Children {
+		if child.Name != ical.CompEvent {
+			continue
+		}
+		prop := child.Props.Get(ical.PropRecurrenceID)
+		switch {
+		case prop == nil:
+			master = child
+		case recurrence != "" && calendar.ICalRecurrenceID(cal, prop) == recurrence:
+			return child
+		}
+	}
+	return master
+}
+
+// setPartStat sets the participation status of the attendee with an address,
+// reporting whether they were found
+func setPartStat(vevent *ical.Component, address, partStat string) bool {
+	found := false
+	attendees := vevent.Props[ical.PropAttendee]
+	for i := range attendees {
+		if !isAddress(&attendees[i], address) {
+			continue
+		}
+		attendees[i].Params.Set(ical.ParamParticipationStatus, partStat)
+		attendees[i].Params.Del(ical.ParamRSVP)
+		found = true
+	}
+	return found
+}
+
+// isAddress reports whether an ATTENDEE or ORGANIZER has an email address
+func isAddress(prop *ical.Prop, address string) bool {
+	return strings.TrimPrefix(strings.ToLower(prop.Value), "mailto:") == strings.ToLower(address)
+}
+
+// autoSchedules reports whether the server sends replies to organizers itself
+func (c *Client) autoSchedules(ctx context.Context, calendarID string) bool {
+	resp, err := c.request(ctx, http.MethodOptions, calendarID, nil, nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	for _, dav := range resp.Header.Values("DAV") {
+		if strings.Contains(dav, "calendar-auto-schedule") {
+			return true
+		}
+	}
+	return false
+}
+
+// sendReply posts an iTIP REPLY (RFC 5546 section 3.2.3) carrying the
+// attendee's status to their scheduling outbox. On servers without one the
+// reply is only kept in the user's own calendar.
+func (c *Client) sendReply(ctx context.Context, cal *ical.Calendar, vevent *ical.Component, address string) error {
+	outbox, err := c.scheduleOutbox(ctx)
+	if err != nil || outbox == "" {
+		return nil
+	}
+	organizer := vevent.Props.Get(ical.PropOrganizer)
+	if organizer == nil {
+		return fmt.Errorf("event has no organizer")
+	}
+
+	reply := calendar.NewICalendar()
+	reply.Props.SetText(ical.PropMethod, "REPLY")
+
+	// Zones used by the event's times
+	for _, child := range cal.Children {
+		if child.Name == ical.CompTimezone {
+			reply.Children = append(reply.Children, child)
+		}
+	}
+
+	comp := ical.NewComponent(ical.CompEvent)
+	for _, name := range []string{ical.PropUID, ical.PropSequence, ical.PropRecurrenceID, ical.PropDateTimeStart,
+		ical.PropDateTimeEnd, ical.PropSummary, ical.PropOrganizer, ical.PropComment} {
+		if props, ok := vevent.Props[name]; ok {
+			comp.Props[name] = props
+		}
+	}
+	for _, attendee := range vevent.Props.Values(ical.PropAttendee) {
+		if isAddress(&attendee, address) {
+			comp.Props.Add(&attendee)
+		}
+	}
+	comp.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	reply.Children = append(reply.Children, comp)
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(reply); err != nil {
+		return fmt.Errorf("failed to encode reply: %w", err)
+	}
+
+	header := http.Header{
+		"Content-Type": []string{"text/calendar; charset=utf-8; method=REPLY"},
+		"Originator":   []string{"mailto:" + address},
+		"Recipient":    []string{organizer.Value},
+	}
+	resp, err := c.request(ctx, http.MethodPost, outbox, buf.Bytes(), header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// scheduleOutbox returns the URL of the user's scheduling outbox, or an
+// empty string if the server has none
+func (c *Client) scheduleOutbox(ctx context.Context) (string, error) {
+	principal, err := c.caldavClient.FindCurrentUserPrincipal(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	header := http.Header{"Depth": []string{"0"}}
+	resp, err := c.request(ctx, "PROPFIND", principal, []byte(outboxPropfind), header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var ms struct {
+		Responses []struct {
+			Propstats []struct {
+				Prop struct {
+					Outbox struct {
+						Href string `xml:"DAV: href"`
+					} `xml:"urn:ietf:params:xml:ns:caldav schedule-outbox-URL"`
+				} `xml:"DAV: prop"`
+			} `xml:"DAV: propstat"`
+		} `xml:"DAV: response"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return "", fmt.Errorf("failed to parse PROPFIND response: %w", err)
+	}
+	for _, r := range ms.Responses {
+		for _, ps := range r.Propstats {
+			if href := strings.TrimSpace(ps.Prop.Outbox.Href); href != "" {
+				return href, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// Ensure Client can reply to invitations
+var _ providers.InvitationResponder = (*Client)(nil)
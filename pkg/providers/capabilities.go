@@ -0,0 +1,80 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// Optional interfaces a Provider may implement. Callers type-assert on a
+// provider to find out whether an action is supported before offering it.
+
+// IncrementalSyncer is implemented by providers that can return only the
+// events that changed since a previous sync
+type IncrementalSyncer interface {
+	// GetEventChanges returns the changes to a calendar since syncToken. An
+	// empty syncToken requests a full listing of events between start and end.
+	// ErrSyncTokenExpired is returned when the token is no longer accepted.
+	GetEventChanges(ctx context.Context, calendarID, syncToken string, start, end time.Time) (*EventChanges, error)
+}
+
+// EventChanges is the result of an incremental sync request
+type EventChanges struct {
+	Events    []*calendar.Event // Created or updated events
+	Deleted   []string          // Remote IDs of events removed remotely
+	SyncToken string            // Token to pass to the next request
+	Full      bool              // Events is the complete set for the requested range
+}
+
+// ErrSyncTokenExpired is returned by IncrementalSyncer when a full sync is required
+var ErrSyncTokenExpired = errors.New("sync token expired")
+
+// ConditionalDeleter is implemented by providers that can delete an event
+// only if it has not changed on the server since a given version
+type ConditionalDeleter interface {
+	// DeleteEventIfMatch deletes an event unless its ETag on the server is no longer etag
+	DeleteEventIfMatch(ctx context.Context, calendarID, remoteID, etag string) error
+}
+
+// FreeBusyQuerier is implemented by providers that can report when calendars are busy
+type FreeBusyQuerier interface {
+	// QueryFreeBusy returns the busy periods of each calendar between start and end
+	QueryFreeBusy(ctx context.Context, calendarIDs []string, start, end time.Time) (map[string][]BusyPeriod, error)
+}
+
+// BusyPeriod is a span of time in which a calendar is busy
+type BusyPeriod struct {
+	Start time.Time
+	End   time.Time
+}
+
+// InvitationResponder is implemented by providers that can reply to meeting invitations
+type InvitationResponder interface {
+	// RespondToInvitation sets the user's participation status on an event,
+	// optionally attaching a comment for the organizer
+	RespondToInvitation(ctx context.Context, calendarID string, event *calendar.Event, status calendar.ParticipationStatus, comment string) error
+}
+
+// CalendarCreator is implemented by providers that can create new calendars
+type CalendarCreator interface {
+	// CreateCalendar creates a calendar on the server and sets its ID
+	CreateCalendar(ctx context.Context, cal *calendar.Calendar) error
+}
+
+// CalendarEditor is implemented by providers that can change and remove calendars
+type CalendarEditor interface {
+	// UpdateCalendar saves a calendar's name, description and colour on the server
+	UpdateCalendar(ctx context.Context, cal *calendar.Calendar) error
+
+	// DeleteCalendar removes a calendar, or unsubscribes from it when the
+	// user does not own it
+	DeleteCalendar(ctx context.Context, calendarID string) error
+}
+
+// TaskProvider is implemented by providers that store tasks alongside events
+type TaskProvider interface {
+	// GetTasks returns the tasks (VTODOs) in a calendar
+	GetTasks(ctx context.Context, calendarID string) ([]*calendar.Task, error)
+}
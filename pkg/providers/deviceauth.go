@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"golang.org/x/oauth2"
+)
+
+// DeviceCode is what the user needs to approve a device sign-in from
+// another device (RFC 8628)
+type DeviceCode struct {
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string // Verification URI with the code included, if the server offers one
+	Expires                 time.Time
+}
+
+// BrowserSignInFunc signs an account in through the system browser. open is
+// called with the sign-in page, and the redirect back is awaited until the
+// user finishes or ctx ends. On success the account's tokens and email
+// address are filled in.
+type BrowserSignInFunc func(ctx context.Context, account *calendar.Account, open func(url string) error) error
+
+// DeviceSignInFunc signs an account in with the OAuth device authorization
+// grant. prompt is called with the code to show the user; the token endpoint
+// is then polled until the user approves, the code expires or ctx ends. On
+// success the account's tokens and email address are filled in.
+type DeviceSignInFunc func(ctx context.Context, account *calendar.Account, prompt func(*DeviceCode)) error
+
+// DeviceFlow runs the device authorization grant for an OAuth client and
+// returns the issued token
+func DeviceFlow(ctx context.Context, conf *oauth2.Config, prompt func(*DeviceCode)) (*oauth2.Token, error) {
+	if conf.Endpoint.DeviceAuthURL == "" {
+		return nil, fmt.Errorf("the OAuth endpoint does not support device sign-in")
+	}
+	ctx = OAuthContext(ctx)
+
+	resp, err := conf.DeviceAuth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request device code: %w", err)
+	}
+
+	prompt(&DeviceCode{
+		UserCode:                resp.UserCode,
+		VerificationURI:         resp.VerificationURI,
+		VerificationURIComplete: resp.VerificationURIComplete,
+		Expires:                 resp.Expiry,
+	})
+
+	token, err := conf.DeviceAccessToken(ctx, resp)
+	if err != nil {
+		return nil, fmt.Errorf("device sign-in failed: %w", err)
+	}
+	return token, nil
+}
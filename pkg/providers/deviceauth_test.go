@@ -0,0 +1,85 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestDeviceFlow(t *testing.T) {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"device_code":      "device-123",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": "https://example.com/device",
+			"expires_in":       600,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if got := r.Form.Get("device_code"); got != "device-123" {
+			t.Errorf("device_code = %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		polls++
+		if polls == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	conf := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: server.URL + "/device",
+			TokenURL:      server.URL + "/token",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+	}
+
+	var shown *DeviceCode
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	token, err := DeviceFlow(ctx, conf, func(code *DeviceCode) { shown = code })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shown == nil || shown.UserCode != "ABCD-EFGH" || shown.VerificationURI != "https://example.com/device" {
+		t.Errorf("prompted with %+v", shown)
+	}
+	if token.AccessToken != "access" || token.RefreshToken != "refresh" {
+		t.Errorf("token = %+v", token)
+	}
+	if polls != 2 {
+		t.Errorf("token endpoint polled %d times, want 2", polls)
+	}
+}
+
+func TestDeviceFlowWithoutDeviceEndpoint(t *testing.T) {
+	conf := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: "https://example.com/token"}}
+	called := false
+	if _, err := DeviceFlow(context.Background(), conf, func(*DeviceCode) { called = true }); err == nil {
+		t.Fatal("device flow ran without a device authorization endpoint")
+	}
+	if called {
+		t.Error("user prompted for a flow that cannot work")
+	}
+}
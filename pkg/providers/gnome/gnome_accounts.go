@@ -1,155 +1,262 @@
+// Package gnome links SwitchCal accounts to GNOME Online Accounts, so
+// credentials are borrowed from the desktop instead of signing in again.
 package gnome
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"time"
 
+	"github.com/djwarf/switchcal/pkg/calendar"
 	"github.com/godbus/dbus/v5"
 )
 
+// GNOME Online Accounts D-Bus names
+const (
+	goaService    = "org.gnome.OnlineAccounts"
+	goaRoot       = "/org/gnome/OnlineAccounts"
+	objectManager = "org.freedesktop.DBus.ObjectManager"
+
+	accountIface  = "org.gnome.OnlineAccounts.Account"
+	oauth2Iface   = "org.gnome.OnlineAccounts.OAuth2Based"
+	passwordIface = "org.gnome.OnlineAccounts.PasswordBased"
+	calendarIface = "org.gnome.OnlineAccounts.Calendar"
+)
+
+// ErrAccountNotFound is returned when a linked account no longer exists in GNOME Online Accounts
+var ErrAccountNotFound = errors.New("account not found in GNOME Online Accounts")
+
+// providerTypes maps GNOME Online Accounts providers to SwitchCal account types
+var providerTypes = map[string]calendar.AccountType{
+	"google":       calendar.AccountTypeGoogle,
+	"ms_graph":     calendar.AccountTypeOutlook,
+	"windows_live": calendar.AccountTypeOutlook,
+	"owncloud":     calendar.AccountTypeCalDAV, // Nextcloud
+	"webdav":       calendar.AccountTypeCalDAV,
+}
+
 // OnlineAccount represents a GNOME Online Account
 type OnlineAccount struct {
-	ID           string
-	ProviderType string
-	ProviderName string
-	Identity     string // email
-	CalendarURL  string
+	ID                   string // Stable account ID, e.g. "account_1700000000_0"
+	Path                 dbus.ObjectPath
+	ProviderType         string
+	ProviderName         string
+	Identity             string // Usually the email address or username
+	PresentationIdentity string // Identity as shown in GNOME Settings
+	CalendarURL          string
+	CalendarDisabled     bool // The user turned calendars off for this account
+	AttentionNeeded      bool // Credentials must be refreshed in GNOME Settings
+	OAuth2               bool // Implements OAuth2Based
+	PasswordBased        bool // Implements PasswordBased
 }
 
-// GetGoogleAccounts returns Google accounts from GNOME Online Accounts
-func GetGoogleAccounts() ([]*OnlineAccount, error) {
+// AccountType returns the SwitchCal account type for the account and
+// whether SwitchCal can sync it
+func (a *OnlineAccount) AccountType() (calendar.AccountType, bool) {
+	t, ok := providerTypes[a.ProviderType]
+	if !ok {
+		return "", false
+	}
+	// CalDAV accounts need a server; others need borrowed OAuth tokens
+	if t == calendar.AccountTypeCalDAV {
+		return t, a.CalendarURL != "" && a.PasswordBased
+	}
+	return t, a.OAuth2
+}
+
+// NewAccount returns a SwitchCal account linked to the online account. Its
+// credentials are loaded with LoadCredentials before each use.
+func (a *OnlineAccount) NewAccount() (*calendar.Account, error) {
+	t, ok := a.AccountType()
+	if !ok {
+		return nil, fmt.Errorf("%s accounts are not supported", a.ProviderName)
+	}
+
+	account := &calendar.Account{
+		Type:    t,
+		Email:   a.Identity,
+		Enabled: true,
+		GOAID:   a.ID,
+	}
+	if t == calendar.AccountTypeCalDAV {
+		account.ServerURL = a.CalendarURL
+		account.Username = a.Identity
+	}
+	return account, nil
+}
+
+// ListAccounts returns the accounts configured in GNOME Online Accounts
+func ListAccounts() ([]*OnlineAccount, error) {
 	conn, err := dbus.SessionBus()
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
 	}
 
-	// Get account manager
-	obj := conn.Object("org.gnome.OnlineAccounts", "/org/gnome/OnlineAccounts")
-
-	// List all accounts
-	var accountPaths []dbus.ObjectPath
-	err = obj.Call("org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0).Store(&accountPaths)
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	err = conn.Object(goaService, goaRoot).
+		Call(objectManager+".GetManagedObjects", 0).
+		Store(&objects)
 	if err != nil {
-		// Try alternative method - enumerate child objects
-		node, err := introspectNode(conn, "/org/gnome/OnlineAccounts")
-		if err != nil {
-			return nil, fmt.Errorf("failed to list accounts: %w", err)
-		}
-		accountPaths = node
+		return nil, fmt.Errorf("failed to list online accounts: %w", err)
 	}
 
 	var accounts []*OnlineAccount
-	for _, path := range accountPaths {
-		account, err := getAccountInfo(conn, path)
-		if err != nil {
+	for path, ifaces := range objects {
+		props, ok := ifaces[accountIface]
+		if !ok {
 			continue
 		}
-		if account.ProviderType == "google" {
-			accounts = append(accounts, account)
+
+		account := &OnlineAccount{
+			Path:                 path,
+			ID:                   stringProp(props, "Id"),
+			ProviderType:         stringProp(props, "ProviderType"),
+			ProviderName:         stringProp(props, "ProviderName"),
+			Identity:             stringProp(props, "Identity"),
+			PresentationIdentity: stringProp(props, "PresentationIdentity"),
+			CalendarDisabled:     boolProp(props, "CalendarDisabled"),
+			AttentionNeeded:      boolProp(props, "AttentionNeeded"),
+		}
+		if cal, ok := ifaces[calendarIface]; ok {
+			account.CalendarURL = stringProp(cal, "Uri")
 		}
+		_, account.OAuth2 = ifaces[oauth2Iface]
+		_, account.PasswordBased = ifaces[passwordIface]
+
+		accounts = append(accounts, account)
 	}
 
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].ID < accounts[j].ID
+	})
 	return accounts, nil
 }
 
-func introspectNode(conn *dbus.Conn, path string) ([]dbus.ObjectPath, error) {
-	obj := conn.Object("org.gnome.OnlineAccounts", dbus.ObjectPath(path))
-
-	var xmlData string
-	err := obj.Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&xmlData)
+// findAccount returns the online account with the given ID
+func findAccount(id string) (*OnlineAccount, error) {
+	accounts, err := ListAccounts()
 	if err != nil {
 		return nil, err
 	}
+	for _, a := range accounts {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return nil, ErrAccountNotFound
+}
 
-	// Parse XML to find child nodes (simplified - just look for account_*)
-	var paths []dbus.ObjectPath
-	// For GNOME Online Accounts, accounts are at /org/gnome/OnlineAccounts/Accounts/account_*
+// LoadCredentials borrows the current credentials of a linked account from
+// GNOME Online Accounts: a fresh OAuth access token, or the password of
+// CalDAV accounts. It is meant to be called before every sync.
+func LoadCredentials(account *calendar.Account) error {
+	if account.GOAID == "" {
+		return nil
+	}
 
-	accountsObj := conn.Object("org.gnome.OnlineAccounts", "/org/gnome/OnlineAccounts/Accounts")
-	err = accountsObj.Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&xmlData)
+	online, err := findAccount(account.GOAID)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if online.CalendarDisabled {
+		return fmt.Errorf("calendars are turned off for %s in GNOME Online Accounts", online.PresentationIdentity)
+	}
+	if err := ensureCredentials(online.Path); err != nil {
+		return err
 	}
 
-	// Simple parsing - find account paths
-	for i := 0; i < 100; i++ {
-		testPath := dbus.ObjectPath(fmt.Sprintf("/org/gnome/OnlineAccounts/Accounts/account_%d", i))
-		testObj := conn.Object("org.gnome.OnlineAccounts", testPath)
-
-		var providerType string
-		err := testObj.Call("org.freedesktop.DBus.Properties.Get",
-			0, "org.gnome.OnlineAccounts.Account", "ProviderType").Store(&providerType)
-		if err == nil {
-			paths = append(paths, testPath)
+	if online.OAuth2 {
+		token, expiry, err := GetOAuthToken(string(online.Path))
+		if err != nil {
+			return err
 		}
+		account.AccessToken = token
+		account.RefreshToken = ""
+		account.TokenExpiry = expiry
+		return nil
 	}
-
-	return paths, nil
+	if online.PasswordBased {
+		password, err := getPassword(online.Path)
+		if err != nil {
+			return err
+		}
+		account.AppPassword = password
+		return nil
+	}
+	return fmt.Errorf("%s accounts do not provide credentials SwitchCal can use", online.ProviderName)
 }
 
-func getAccountInfo(conn *dbus.Conn, path dbus.ObjectPath) (*OnlineAccount, error) {
-	obj := conn.Object("org.gnome.OnlineAccounts", path)
-
-	account := &OnlineAccount{
-		ID: string(path),
+// ensureCredentials asks GNOME Online Accounts to check (and refresh) an
+// account's credentials, which fails if the user has to sign in again
+func ensureCredentials(path dbus.ObjectPath) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect to session bus: %w", err)
 	}
 
-	// Get ProviderType
-	var providerType dbus.Variant
-	err := obj.Call("org.freedesktop.DBus.Properties.Get",
-		0, "org.gnome.OnlineAccounts.Account", "ProviderType").Store(&providerType)
+	var expiresIn int32
+	err = conn.Object(goaService, path).Call(accountIface+".EnsureCredentials", 0).Store(&expiresIn)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("GNOME Online Accounts needs you to sign in again in Settings: %w", err)
 	}
-	account.ProviderType = providerType.Value().(string)
+	return nil
+}
 
-	// Get ProviderName
-	var providerName dbus.Variant
-	err = obj.Call("org.freedesktop.DBus.Properties.Get",
-		0, "org.gnome.OnlineAccounts.Account", "ProviderName").Store(&providerName)
-	if err == nil {
-		account.ProviderName = providerName.Value().(string)
+// GetOAuthToken gets the current OAuth access token of an account and when it expires
+func GetOAuthToken(accountPath string) (string, time.Time, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to connect to session bus: %w", err)
 	}
 
-	// Get Identity (email)
-	var identity dbus.Variant
-	err = obj.Call("org.freedesktop.DBus.Properties.Get",
-		0, "org.gnome.OnlineAccounts.Account", "Identity").Store(&identity)
-	if err == nil {
-		account.Identity = identity.Value().(string)
+	var token string
+	var expiresIn int32
+	err = conn.Object(goaService, dbus.ObjectPath(accountPath)).
+		Call(oauth2Iface+".GetAccessToken", 0).
+		Store(&token, &expiresIn)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get access token: %w", err)
 	}
 
-	// Get Calendar URL if available
-	var calendarURL dbus.Variant
-	err = obj.Call("org.freedesktop.DBus.Properties.Get",
-		0, "org.gnome.OnlineAccounts.Calendar", "Uri").Store(&calendarURL)
-	if err == nil {
-		account.CalendarURL = calendarURL.Value().(string)
+	// Zero means the lifetime is unknown; assume a short one so it is fetched again
+	if expiresIn <= 0 {
+		expiresIn = 300
 	}
-
-	return account, nil
+	return token, time.Now().Add(time.Duration(expiresIn) * time.Second), nil
 }
 
-// GetOAuthToken gets the OAuth access token for an account
-func GetOAuthToken(accountPath string) (string, error) {
+// getPassword returns the password of a password-based account
+func getPassword(path dbus.ObjectPath) (string, error) {
 	conn, err := dbus.SessionBus()
 	if err != nil {
 		return "", fmt.Errorf("failed to connect to session bus: %w", err)
 	}
 
-	obj := conn.Object("org.gnome.OnlineAccounts", dbus.ObjectPath(accountPath))
-
-	var token string
-	err = obj.Call("org.gnome.OnlineAccounts.OAuthBased.GetAccessToken", 0).Store(&token)
+	var password string
+	err = conn.Object(goaService, path).Call(passwordIface+".GetPassword", 0, "password").Store(&password)
 	if err != nil {
-		// Try OAuth2Based interface
-		var accessToken string
-		var expiresIn int32
-		err = obj.Call("org.gnome.OnlineAccounts.OAuth2Based.GetAccessToken", 0).Store(&accessToken, &expiresIn)
-		if err != nil {
-			return "", fmt.Errorf("failed to get access token: %w", err)
+		return "", fmt.Errorf("failed to get password: %w", err)
+	}
+	return password, nil
+}
+
+// stringProp returns a string property, or "" if it is missing
+func stringProp(props map[string]dbus.Variant, name string) string {
+	if v, ok := props[name]; ok {
+		if s, ok := v.Value().(string); ok {
+			return s
 		}
-		return accessToken, nil
 	}
+	return ""
+}
 
-	return token, nil
+// boolProp returns a boolean property, or false if it is missing
+func boolProp(props map[string]dbus.Variant, name string) bool {
+	if v, ok := props[name]; ok {
+		if b, ok := v.Value().(bool); ok {
+			return b
+		}
+	}
+	return false
 }
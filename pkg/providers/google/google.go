@@ -1,10 +1,13 @@
 package google
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/djwarf/switchcal/pkg/calendar"
@@ -17,13 +20,19 @@ const (
 	// Google Calendar API scopes
 	CalendarScope         = "https://www.googleapis.com/auth/calendar"
 	CalendarReadOnlyScope = "https://www.googleapis.com/auth/calendar.readonly"
+	UserInfoEmailScope    = "https://www.googleapis.com/auth/userinfo.email"
+
+	// OAuth client shipped with SwitchCal
+	DefaultClientID     = "707683257072-qhapb7fq21cc2too73ovopdobrpigdr9.apps.googleusercontent.com"
+	DefaultClientSecret = "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"
+
+	apiBaseURL = "https://www.googleapis.com/calendar/v3"
 )
 
 // Client implements the Provider interface for Google Calendar
 type Client struct {
 	account     *calendar.Account
 	oauthConfig *oauth2.Config
-	token       *oauth2.Token
 	httpClient  *http.Client
 }
 
@@ -34,19 +43,41 @@ type OAuthConfig struct {
 	RedirectURL  string
 }
 
-// NewClient creates a new Google Calendar client
-func NewClient(account *calendar.Account, cfg *OAuthConfig) *Client {
-	oauthConfig := &oauth2.Config{
+// DefaultOAuthConfig is used for accounts without their own OAuth client.
+// The application replaces it when a client is set in its configuration.
+var DefaultOAuthConfig = &OAuthConfig{
+	ClientID:     DefaultClientID,
+	ClientSecret: DefaultClientSecret,
+}
+
+// OAuthConfigFor returns the OAuth client an account signs in with: its own
+// client if one was given, otherwise DefaultOAuthConfig
+func OAuthConfigFor(account *calendar.Account) *OAuthConfig {
+	if account.ClientID != "" {
+		return &OAuthConfig{
+			ClientID:     account.ClientID,
+			ClientSecret: account.ClientSecret,
+		}
+	}
+	return DefaultOAuthConfig
+}
+
+// oauth2Config returns the golang.org/x/oauth2 configuration for the given scopes
+func (cfg *OAuthConfig) oauth2Config(scopes ...string) *oauth2.Config {
+	return &oauth2.Config{
 		ClientID:     cfg.ClientID,
 		ClientSecret: cfg.ClientSecret,
 		RedirectURL:  cfg.RedirectURL,
-		Scopes:       []string{CalendarScope},
+		Scopes:       scopes,
 		Endpoint:     google.Endpoint,
 	}
+}
 
+// NewClient creates a new Google Calendar client
+func NewClient(account *calendar.Account, cfg *OAuthConfig) *Client {
 	return &Client{
 		account:     account,
-		oauthConfig: oauthConfig,
+		oauthConfig: cfg.oauth2Config(CalendarScope),
 	}
 }
 
@@ -70,201 +101,401 @@ func (c *Client) SetAccount(account *calendar.Account) {
 	c.account = account
 }
 
-// GetAuthURL returns the URL for OAuth authorization
-func (c *Client) GetAuthURL(state string) string {
-	return c.oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+// GetAuthURL returns the URL for OAuth authorization. verifier is the PKCE
+// code verifier later passed to ExchangeCode.
+func (c *Client) GetAuthURL(state, verifier string) string {
+	return c.oauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(verifier))
 }
 
 // ExchangeCode exchanges an authorization code for a token
-func (c *Client) ExchangeCode(ctx context.Context, code string) error {
-	token, err := c.oauthConfig.Exchange(ctx, code)
+func (c *Client) ExchangeCode(ctx context.Context, code, verifier string) error {
+	token, err := c.oauthConfig.Exchange(providers.OAuthContext(ctx), code, oauth2.VerifierOption(verifier))
 	if err != nil {
 		return fmt.Errorf("failed to exchange code: %w", err)
 	}
 
-	c.token = token
-	c.httpClient = c.oauthConfig.Client(ctx, token)
-
-	// Save token to account
-	tokenJSON, _ := json.Marshal(token)
-	c.account.AccessToken = string(tokenJSON)
+	c.account.AccessToken = token.AccessToken
+	c.account.RefreshToken = token.RefreshToken
+	c.account.TokenExpiry = token.Expiry
 
-	return nil
+	return c.Authenticate(ctx)
 }
 
-// SetToken sets the OAuth token from saved credentials
-func (c *Client) SetToken(tokenJSON string) error {
-	var token oauth2.Token
-	if err := json.Unmarshal([]byte(tokenJSON), &token); err != nil {
-		return fmt.Errorf("failed to parse token: %w", err)
+// Authenticate prepares an HTTP client from the account's saved tokens.
+// Expired access tokens are refreshed on demand and written back to the account.
+func (c *Client) Authenticate(ctx context.Context) error {
+	if c.account.AccessToken == "" && c.account.RefreshToken == "" {
+		return fmt.Errorf("no access token - OAuth flow required")
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  c.account.AccessToken,
+		RefreshToken: c.account.RefreshToken,
+		Expiry:       c.account.TokenExpiry,
+		TokenType:    "Bearer",
 	}
-	c.token = &token
-	c.httpClient = c.oauthConfig.Client(context.Background(), &token)
+	ts := &accountTokenSource{
+		account: c.account,
+		src:     c.oauthConfig.TokenSource(providers.OAuthContext(context.Background()), token),
+	}
+	c.httpClient = oauth2.NewClient(providers.OAuthContext(context.Background()), ts)
+	c.httpClient.Timeout = providers.HTTPTimeout
 	return nil
 }
 
-// Authenticate authenticates with Google Calendar
-func (c *Client) Authenticate(ctx context.Context) error {
-	if c.account.AccessToken != "" {
-		// Try to use existing token
-		if err := c.SetToken(c.account.AccessToken); err != nil {
-			return fmt.Errorf("invalid saved token: %w", err)
+// accountTokenSource copies refreshed tokens back onto the account so the
+// caller can persist them
+type accountTokenSource struct {
+	account *calendar.Account
+	src     oauth2.TokenSource
+}
+
+func (s *accountTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, fmt.Errorf("token refresh failed: %w", err)
+	}
+	if token.AccessToken != s.account.AccessToken {
+		s.account.AccessToken = token.AccessToken
+		s.account.TokenExpiry = token.Expiry
+		if token.RefreshToken != "" {
+			s.account.RefreshToken = token.RefreshToken
 		}
-		return nil
 	}
-	return fmt.Errorf("no access token - OAuth flow required")
+	return token, nil
 }
 
-// ListCalendars returns all calendars from Google Calendar
-func (c *Client) ListCalendars(ctx context.Context) ([]*calendar.Calendar, error) {
+// do sends a request to the Calendar API, encoding body and decoding the response into out
+func (c *Client) do(ctx context.Context, method, apiURL string, body, out interface{}) error {
 	if c.httpClient == nil {
-		return nil, fmt.Errorf("not authenticated")
+		return fmt.Errorf("not authenticated")
 	}
 
-	resp, err := c.httpClient.Get("https://www.googleapis.com/calendar/v3/users/me/calendarList")
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, reader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list calendars: %w", err)
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("calendar list failed: %s", resp.Status)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
 
-	var result struct {
-		Items []struct {
-			ID              string `json:"id"`
-			Summary         string `json:"summary"`
-			Description     string `json:"description"`
-			BackgroundColor string `json:"backgroundColor"`
-			Primary         bool   `json:"primary"`
-			AccessRole      string `json:"accessRole"`
-		} `json:"items"`
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return providers.NewHTTPError("Google API", resp)
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to parse calendars: %w", err)
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
 	}
+	return nil
+}
 
+// ListCalendars returns all calendars from Google Calendar
+func (c *Client) ListCalendars(ctx context.Context) ([]*calendar.Calendar, error) {
 	var calendars []*calendar.Calendar
-	for _, item := range result.Items {
-		calendars = append(calendars, &calendar.Calendar{
-			ID:          item.ID,
-			AccountID:   c.account.ID,
-			Name:        item.Summary,
-			Description: item.Description,
-			Color:       item.BackgroundColor,
-			Visible:     true,
-			ReadOnly:    item.AccessRole == "reader" || item.AccessRole == "freeBusyReader",
-		})
+	pageToken := ""
+
+	for {
+		apiURL := apiBaseURL + "/users/me/calendarList"
+		if pageToken != "" {
+			apiURL += "?pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		var result struct {
+			Items []struct {
+				ID              string `json:"id"`
+				Summary         string `json:"summary"`
+				SummaryOverride string `json:"summaryOverride"`
+				Description     string `json:"description"`
+				BackgroundColor string `json:"backgroundColor"`
+				Primary         bool   `json:"primary"`
+				AccessRole      string `json:"accessRole"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := c.do(ctx, http.MethodGet, apiURL, nil, &result); err != nil {
+			return nil, fmt.Errorf("failed to list calendars: %w", err)
+		}
+
+		for _, item := range result.Items {
+			color := item.BackgroundColor
+			if color == "" {
+				color = "#4285f4"
+			}
+			name := item.Summary
+			if item.SummaryOverride != "" {
+				name = item.SummaryOverride
+			}
+			calendars = append(calendars, &calendar.Calendar{
+				ID:          item.ID,
+				AccountID:   c.account.ID,
+				Name:        name,
+				Description: item.Description,
+				Color:       color,
+				Visible:     true,
+				ReadOnly:    item.AccessRole == "reader" || item.AccessRole == "freeBusyReader",
+			})
+		}
+
+		if result.NextPageToken == "" {
+			break
+		}
+		pageToken = result.NextPageToken
 	}
 
 	return calendars, nil
 }
 
-// GetEvents returns events from a calendar within a time range
-func (c *Client) GetEvents(ctx context.Context, calendarID string, start, end time.Time) ([]*calendar.Event, error) {
-	if c.httpClient == nil {
-		return nil, fmt.Errorf("not authenticated")
+// eventItem represents an event from the Google Calendar API
+type eventItem struct {
+	ID          string `json:"id"`
+	ICalUID     string `json:"iCalUID"`
+	ETag        string `json:"etag"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+	Status      string `json:"status"`
+	Start       struct {
+		DateTime string `json:"dateTime"`
+		Date     string `json:"date"`
+		TimeZone string `json:"timeZone"`
+	} `json:"start"`
+	End struct {
+		DateTime string `json:"dateTime"`
+		Date     string `json:"date"`
+		TimeZone string `json:"timeZone"`
+	} `json:"end"`
+	Created string `json:"created"`
+	Updated string `json:"updated"`
+
+	Organizer *person  `json:"organizer,omitempty"`
+	Attendees []person `json:"attendees,omitempty"`
+
+	// Set on single occurrences of a recurring event
+	RecurringEventID  string `json:"recurringEventId"`
+	OriginalStartTime struct {
+		DateTime string `json:"dateTime"`
+		Date     string `json:"date"`
+	} `json:"originalStartTime"`
+}
+
+// person is an event's organizer or one of its attendees
+type person struct {
+	Email          string `json:"email"`
+	DisplayName    string `json:"displayName,omitempty"`
+	ResponseStatus string `json:"responseStatus,omitempty"` // needsAction, accepted, tentative or declined
+	Optional       bool   `json:"optional,omitempty"`
+	Self           bool   `json:"self,omitempty"`
+	Comment        string `json:"comment,omitempty"` // Note with the attendee's reply
+}
+
+// Google response statuses by participation status
+var responseStatuses = map[calendar.ParticipationStatus]string{
+	calendar.ParticipationNeedsAction: "needsAction",
+	calendar.ParticipationAccepted:    "accepted",
+	calendar.ParticipationTentative:   "tentative",
+	calendar.ParticipationDeclined:    "declined",
+}
+
+// parsePerson converts an organizer or attendee from the API
+func parsePerson(p *person) calendar.Attendee {
+	a := calendar.Attendee{
+		Email:    p.Email,
+		Name:     p.DisplayName,
+		Status:   calendar.ParticipationNeedsAction,
+		Optional: p.Optional,
+		Self:     p.Self,
+	}
+	for status, response := range responseStatuses {
+		if response == p.ResponseStatus {
+			a.Status = status
+		}
 	}
+	return a
+}
+
+// eventList represents a paginated response from the Google Calendar API
+type eventList struct {
+	Items         []eventItem `json:"items"`
+	NextPageToken string      `json:"nextPageToken"`
+	NextSyncToken string      `json:"nextSyncToken"`
+}
 
-	url := fmt.Sprintf(
-		"https://www.googleapis.com/calendar/v3/calendars/%s/events?timeMin=%s&timeMax=%s&singleEvents=true&orderBy=startTime",
-		calendarID,
-		start.Format(time.RFC3339),
-		end.Format(time.RFC3339),
-	)
+// listEvents fetches all pages of an events query and returns the items and next sync token
+func (c *Client) listEvents(ctx context.Context, calendarID string, query url.Values) ([]eventItem, string, error) {
+	var items []eventItem
+	var syncToken string
+
+	query.Set("maxResults", "2500")
+	for {
+		apiURL := fmt.Sprintf("%s/calendars/%s/events?%s", apiBaseURL, url.PathEscape(calendarID), query.Encode())
+
+		var result eventList
+		if err := c.do(ctx, http.MethodGet, apiURL, nil, &result); err != nil {
+			return items, "", err
+		}
+
+		items = append(items, result.Items...)
+		if result.NextSyncToken != "" {
+			syncToken = result.NextSyncToken
+		}
+
+		if result.NextPageToken == "" {
+			break
+		}
+		query.Set("pageToken", result.NextPageToken)
+	}
+
+	return items, syncToken, nil
+}
+
+// GetEvents returns events from a calendar within a time range
+func (c *Client) GetEvents(ctx context.Context, calendarID string, start, end time.Time) ([]*calendar.Event, error) {
+	query := url.Values{}
+	query.Set("timeMin", start.Format(time.RFC3339))
+	query.Set("timeMax", end.Format(time.RFC3339))
+	query.Set("singleEvents", "true")
 
-	resp, err := c.httpClient.Get(url)
+	items, _, err := c.listEvents(ctx, calendarID, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get events: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("events request failed: %s", resp.Status)
+	var events []*calendar.Event
+	for i := range items {
+		if items[i].Status == "cancelled" {
+			continue
+		}
+		events = append(events, parseEvent(&items[i], calendarID))
 	}
 
-	var result struct {
-		Items []struct {
-			ID          string `json:"id"`
-			Summary     string `json:"summary"`
-			Description string `json:"description"`
-			Location    string `json:"location"`
-			Status      string `json:"status"`
-			Start       struct {
-				DateTime string `json:"dateTime"`
-				Date     string `json:"date"`
-			} `json:"start"`
-			End struct {
-				DateTime string `json:"dateTime"`
-				Date     string `json:"date"`
-			} `json:"end"`
-			Created string `json:"created"`
-			Updated string `json:"updated"`
-		} `json:"items"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to parse events: %w", err)
+	return events, nil
+}
+
+// GetEventChanges returns the changes to a calendar since syncToken
+func (c *Client) GetEventChanges(ctx context.Context, calendarID, syncToken string, start, end time.Time) (*providers.EventChanges, error) {
+	// Recurring events are expanded; a sync token is only accepted with the
+	// singleEvents value of the request that issued it
+	query := url.Values{}
+	query.Set("singleEvents", "true")
+	if syncToken != "" {
+		query.Set("syncToken", syncToken)
+	} else {
+		query.Set("timeMin", start.Format(time.RFC3339))
+		query.Set("timeMax", end.Format(time.RFC3339))
 	}
 
-	var events []*calendar.Event
-	for _, item := range result.Items {
-		event := &calendar.Event{
-			ID:          item.ID,
-			UID:         item.ID,
-			CalendarID:  calendarID,
-			Title:       item.Summary,
-			Description: item.Description,
-			Location:    item.Location,
+	items, nextToken, err := c.listEvents(ctx, calendarID, query)
+	if err != nil {
+		// 410 Gone means the sync token is no longer valid
+		if apiErr, ok := err.(*providers.HTTPError); ok && apiErr.StatusCode == http.StatusGone && syncToken != "" {
+			return nil, providers.ErrSyncTokenExpired
 		}
+		return nil, fmt.Errorf("failed to get events: %w", err)
+	}
 
-		// Parse dates
-		if item.Start.DateTime != "" {
-			if t, err := time.Parse(time.RFC3339, item.Start.DateTime); err == nil {
-				event.Start = t
-			}
-		} else if item.Start.Date != "" {
-			if t, err := time.Parse("2006-01-02", item.Start.Date); err == nil {
-				event.Start = t
-				event.AllDay = true
+	changes := &providers.EventChanges{
+		SyncToken: nextToken,
+		Full:      syncToken == "",
+	}
+	for i := range items {
+		if items[i].Status == "cancelled" {
+			if !changes.Full {
+				changes.Deleted = append(changes.Deleted, items[i].ID)
 			}
+			continue
 		}
+		changes.Events = append(changes.Events, parseEvent(&items[i], calendarID))
+	}
 
-		if item.End.DateTime != "" {
-			if t, err := time.Parse(time.RFC3339, item.End.DateTime); err == nil {
-				event.End = t
-			}
-		} else if item.End.Date != "" {
-			if t, err := time.Parse("2006-01-02", item.End.Date); err == nil {
-				event.End = t
-			}
+	return changes, nil
+}
+
+// parseEvent converts an API event item into an Event
+func parseEvent(item *eventItem, calendarID string) *calendar.Event {
+	event := &calendar.Event{
+		RemoteID:    item.ID,
+		CalendarID:  calendarID,
+		UID:         item.ICalUID,
+		Title:       item.Summary,
+		Description: item.Description,
+		Location:    item.Location,
+		ETag:        item.ETag,
+		Status:      calendar.StatusConfirmed,
+	}
+
+	if event.UID == "" {
+		event.UID = item.ID
+	}
+	if item.RecurringEventID != "" {
+		event.RecurrenceID = item.OriginalStartTime.Date
+		if t, err := time.Parse(time.RFC3339, item.OriginalStartTime.DateTime); err == nil {
+			event.RecurrenceID = t.UTC().Format(time.RFC3339)
 		}
+	}
 
-		// Parse status
-		switch item.Status {
-		case "confirmed":
-			event.Status = calendar.StatusConfirmed
-		case "tentative":
-			event.Status = calendar.StatusTentative
-		case "cancelled":
-			event.Status = calendar.StatusCancelled
-			event.Cancelled = true
+	if item.Start.DateTime != "" {
+		event.Start, _ = time.Parse(time.RFC3339, item.Start.DateTime)
+		event.Start = event.Start.Local()
+		if calendar.LoadTimeZone(item.Start.TimeZone) != nil {
+			event.TimeZone = item.Start.TimeZone
 		}
+	} else if item.Start.Date != "" {
+		event.Start, _ = time.ParseInLocation("2006-01-02", item.Start.Date, time.Local)
+		event.AllDay = true
+	}
 
-		events = append(events, event)
+	if item.End.DateTime != "" {
+		event.End, _ = time.Parse(time.RFC3339, item.End.DateTime)
+		event.End = event.End.Local()
+		if item.End.TimeZone != item.Start.TimeZone && calendar.LoadTimeZone(item.End.TimeZone) != nil {
+			event.EndTimeZone = item.End.TimeZone
+		}
+	} else if item.End.Date != "" {
+		event.End, _ = time.ParseInLocation("2006-01-02", item.End.Date, time.Local)
 	}
 
-	return events, nil
-}
+	if t, err := time.Parse(time.RFC3339, item.Created); err == nil {
+		event.Created = t
+	}
+	if t, err := time.Parse(time.RFC3339, item.Updated); err == nil {
+		event.Modified = t
+	}
 
-// CreateEvent creates a new event on Google Calendar
-func (c *Client) CreateEvent(ctx context.Context, calendarID string, event *calendar.Event) error {
-	if c.httpClient == nil {
-		return fmt.Errorf("not authenticated")
+	if item.Status == "tentative" {
+		event.Status = calendar.StatusTentative
+	}
+
+	if item.Organizer != nil {
+		organizer := parsePerson(item.Organizer)
+		organizer.Status = ""
+		event.Organizer = &organizer
+	}
+	for i := range item.Attendees {
+		event.Attendees = append(event.Attendees, parsePerson(&item.Attendees[i]))
 	}
 
+	return event
+}
+
+// eventBody builds the request body for creating or updating an event
+func eventBody(event *calendar.Event) map[string]interface{} {
 	body := map[string]interface{}{
 		"summary":     event.Title,
 		"description": event.Description,
@@ -275,103 +506,324 @@ func (c *Client) CreateEvent(ctx context.Context, calendarID string, event *cale
 		body["start"] = map[string]string{"date": event.Start.Format("2006-01-02")}
 		body["end"] = map[string]string{"date": event.End.Format("2006-01-02")}
 	} else {
-		body["start"] = map[string]string{"dateTime": event.Start.Format(time.RFC3339)}
-		body["end"] = map[string]string{"dateTime": event.End.Format(time.RFC3339)}
+		// Times are sent in the event's zone so recurrences follow its daylight saving
+		start, end := event.InZone()
+		startBody := map[string]string{"dateTime": start.Format(time.RFC3339)}
+		endBody := map[string]string{"dateTime": end.Format(time.RFC3339)}
+		if calendar.LoadTimeZone(event.TimeZone) != nil {
+			startBody["timeZone"] = event.TimeZone
+		}
+		if calendar.LoadTimeZone(event.EndZone()) != nil {
+			endBody["timeZone"] = event.EndZone()
+		}
+		body["start"], body["end"] = startBody, endBody
 	}
 
-	jsonBody, _ := json.Marshal(body)
-	url := fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events", calendarID)
-
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
-	if err != nil {
-		return err
+	// Attendees are only sent when there are some, as a PATCH replaces the list
+	if len(event.Attendees) > 0 {
+		attendees := make([]person, len(event.Attendees))
+		for i, a := range event.Attendees {
+			attendees[i] = person{
+				Email:          a.Email,
+				DisplayName:    a.Name,
+				ResponseStatus: responseStatuses[a.Status],
+				Optional:       a.Optional,
+			}
+		}
+		body["attendees"] = attendees
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Body = http.NoBody
 
-	// Create request with body
-	resp, err := c.httpClient.Post(url, "application/json",
-		http.NoBody)
-	if err != nil {
-		return fmt.Errorf("failed to create event: %w", err)
+	return body
+}
+
+// sendUpdatesQuery asks Google to email the attendees of events the user
+// organizes about changes, as other calendar apps do
+func sendUpdatesQuery(event *calendar.Event) string {
+	if len(event.Attendees) == 0 || (event.Organizer != nil && !event.Organizer.Self) {
+		return ""
 	}
-	defer resp.Body.Close()
+	return "?sendUpdates=all"
+}
 
-	// Actually use the jsonBody
-	_ = jsonBody
+// CreateEvent creates a new event on Google Calendar. The event's RemoteID
+// and UID are set to the ones assigned by Google. Events that already have a
+// UID and no one to invite, such as meetings imported from an email, are
+// imported so they keep it.
+func (c *Client) CreateEvent(ctx context.Context, calendarID string, event *calendar.Event) error {
+	apiURL := fmt.Sprintf("%s/calendars/%s/events", apiBaseURL, url.PathEscape(calendarID)) + sendUpdatesQuery(event)
+	body := eventBody(event)
+	if event.UID != "" && sendUpdatesQuery(event) == "" {
+		apiURL = fmt.Sprintf("%s/calendars/%s/events/import", apiBaseURL, url.PathEscape(calendarID))
+		body["iCalUID"] = event.UID
+		if o := event.Organizer; o != nil {
+			body["organizer"] = person{Email: o.Email, DisplayName: o.Name}
+		}
+	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("create event failed: %s", resp.Status)
+	var result eventItem
+	if err := c.do(ctx, http.MethodPost, apiURL, body, &result); err != nil {
+		return fmt.Errorf("failed to create event: %w", err)
 	}
 
+	event.RemoteID = result.ID
+	event.UID = result.ICalUID
+	event.ETag = result.ETag
+	if result.Organizer != nil && event.Organizer == nil {
+		organizer := parsePerson(result.Organizer)
+		organizer.Status = ""
+		event.Organizer = &organizer
+	}
 	return nil
 }
 
 // UpdateEvent updates an existing event
 func (c *Client) UpdateEvent(ctx context.Context, calendarID string, event *calendar.Event) error {
-	if c.httpClient == nil {
-		return fmt.Errorf("not authenticated")
+	apiURL := fmt.Sprintf("%s/calendars/%s/events/%s", apiBaseURL, url.PathEscape(calendarID), url.PathEscape(event.RemoteID)) +
+		sendUpdatesQuery(event)
+
+	var result eventItem
+	if err := c.do(ctx, http.MethodPatch, apiURL, eventBody(event), &result); err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
 	}
 
-	body := map[string]interface{}{
-		"summary":     event.Title,
-		"description": event.Description,
-		"location":    event.Location,
+	event.ETag = result.ETag
+	return nil
+}
+
+// RespondToInvitation sets the user's reply to an event they are invited to.
+// Google tells the organizer.
+func (c *Client) RespondToInvitation(ctx context.Context, calendarID string, event *calendar.Event, status calendar.ParticipationStatus, comment string) error {
+	if event.RemoteID == "" {
+		return fmt.Errorf("event has not been uploaded")
+	}
+	self := event.SelfAttendee()
+	if self == nil {
+		return fmt.Errorf("you are not invited to this event")
 	}
 
-	if event.AllDay {
-		body["start"] = map[string]string{"date": event.Start.Format("2006-01-02")}
-		body["end"] = map[string]string{"date": event.End.Format("2006-01-02")}
-	} else {
-		body["start"] = map[string]string{"dateTime": event.Start.Format(time.RFC3339)}
-		body["end"] = map[string]string{"dateTime": event.End.Format(time.RFC3339)}
+	// Attendees can only change their own entry, but the whole list is sent
+	attendees := make([]person, len(event.Attendees))
+	for i, a := range event.Attendees {
+		attendees[i] = person{
+			Email:          a.Email,
+			DisplayName:    a.Name,
+			ResponseStatus: responseStatuses[a.Status],
+			Optional:       a.Optional,
+		}
+		if a.Self {
+			attendees[i].ResponseStatus = responseStatuses[status]
+			attendees[i].Comment = comment
+		}
 	}
 
-	jsonBody, _ := json.Marshal(body)
-	url := fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events/%s", calendarID, event.ID)
+	apiURL := fmt.Sprintf("%s/calendars/%s/events/%s?sendUpdates=all", apiBaseURL, url.PathEscape(calendarID), url.PathEscape(event.RemoteID))
+	var result eventItem
+	if err := c.do(ctx, http.MethodPatch, apiURL, map[string]interface{}{"attendees": attendees}, &result); err != nil {
+		return fmt.Errorf("failed to respond to invitation: %w", err)
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "PUT", url, nil)
+	self.Status = status
+	event.ETag = result.ETag
+	return nil
+}
+
+// DeleteEvent deletes an event from Google Calendar
+func (c *Client) DeleteEvent(ctx context.Context, calendarID string, remoteID string) error {
+	apiURL := fmt.Sprintf("%s/calendars/%s/events/%s", apiBaseURL, url.PathEscape(calendarID), url.PathEscape(remoteID))
+
+	err := c.do(ctx, http.MethodDelete, apiURL, nil, nil)
+	if apiErr, ok := err.(*providers.HTTPError); ok {
+		// Already gone
+		if apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusGone {
+			return nil
+		}
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+
+	return nil
+}
+
+// QueryFreeBusy returns the busy periods of each calendar between start and end
+func (c *Client) QueryFreeBusy(ctx context.Context, calendarIDs []string, start, end time.Time) (map[string][]providers.BusyPeriod, error) {
+	type item struct {
+		ID string `json:"id"`
+	}
+	body := struct {
+		TimeMin string `json:"timeMin"`
+		TimeMax string `json:"timeMax"`
+		Items   []item `json:"items"`
+	}{
+		TimeMin: start.Format(time.RFC3339),
+		TimeMax: end.Format(time.RFC3339),
+	}
+	for _, id := range calendarIDs {
+		body.Items = append(body.Items, item{ID: id})
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	_ = jsonBody
+	var result struct {
+		Calendars map[string]struct {
+			Busy []struct {
+				Start time.Time `json:"start"`
+				End   time.Time `json:"end"`
+			} `json:"busy"`
+		} `json:"calendars"`
+	}
+	if err := c.do(ctx, http.MethodPost, apiBaseURL+"/freeBusy", body, &result); err != nil {
+		return nil, fmt.Errorf("failed to query free/busy: %w", err)
+	}
 
-	return fmt.Errorf("update not implemented")
+	busy := make(map[string][]providers.BusyPeriod)
+	for id, cal := range result.Calendars {
+		for _, period := range cal.Busy {
+			busy[id] = append(busy[id], providers.BusyPeriod{Start: period.Start, End: period.End})
+		}
+	}
+	return busy, nil
 }
 
-// DeleteEvent deletes an event from Google Calendar
-func (c *Client) DeleteEvent(ctx context.Context, calendarID string, eventID string) error {
-	if c.httpClient == nil {
-		return fmt.Errorf("not authenticated")
+// CreateCalendar creates a secondary calendar and sets its ID
+func (c *Client) CreateCalendar(ctx context.Context, cal *calendar.Calendar) error {
+	body := map[string]string{
+		"summary":     cal.Name,
+		"description": cal.Description,
 	}
 
-	url := fmt.Sprintf("https://www.googleapis.com/calendar/v3/calendars/%s/events/%s", calendarID, eventID)
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, apiBaseURL+"/calendars", body, &result); err != nil {
+		return fmt.Errorf("failed to create calendar: %w", err)
+	}
+	cal.ID = result.ID
 
-	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
-	if err != nil {
-		return err
+	if cal.Color != "" {
+		return c.setCalendarColor(ctx, cal.ID, cal.Color)
 	}
+	return nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// setCalendarColor sets a calendar's colour in the user's calendar list
+func (c *Client) setCalendarColor(ctx context.Context, calendarID, color string) error {
+	apiURL := fmt.Sprintf("%s/users/me/calendarList/%s?colorRgbFormat=true", apiBaseURL, url.PathEscape(calendarID))
+	body := map[string]string{
+		"backgroundColor": color,
+		"foregroundColor": "#ffffff",
+	}
+	if err := c.do(ctx, http.MethodPatch, apiURL, body, nil); err != nil {
+		return fmt.Errorf("failed to set calendar colour: %w", err)
+	}
+	return nil
+}
+
+// calendarListEntry is the part of a calendarList entry needed to manage a calendar
+type calendarListEntry struct {
+	AccessRole string `json:"accessRole"`
+	Primary    bool   `json:"primary"`
+}
+
+// getCalendarListEntry fetches the user's calendarList entry for a calendar
+func (c *Client) getCalendarListEntry(ctx context.Context, calendarID string) (*calendarListEntry, error) {
+	var entry calendarListEntry
+	apiURL := fmt.Sprintf("%s/users/me/calendarList/%s", apiBaseURL, url.PathEscape(calendarID))
+	if err := c.do(ctx, http.MethodGet, apiURL, nil, &entry); err != nil {
+		return nil, fmt.Errorf("failed to get calendar: %w", err)
+	}
+	return &entry, nil
+}
+
+// UpdateCalendar renames a calendar and sets its colour. Calendars the user
+// does not own are renamed only in their own calendar list.
+func (c *Client) UpdateCalendar(ctx context.Context, cal *calendar.Calendar) error {
+	entry, err := c.getCalendarListEntry(ctx, cal.ID)
 	if err != nil {
-		return fmt.Errorf("failed to delete event: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("delete event failed: %s", resp.Status)
+	if entry.AccessRole == "owner" {
+		apiURL := fmt.Sprintf("%s/calendars/%s", apiBaseURL, url.PathEscape(cal.ID))
+		body := map[string]string{
+			"summary":     cal.Name,
+			"description": cal.Description,
+		}
+		if err := c.do(ctx, http.MethodPatch, apiURL, body, nil); err != nil {
+			return fmt.Errorf("failed to update calendar: %w", err)
+		}
+	} else {
+		apiURL := fmt.Sprintf("%s/users/me/calendarList/%s", apiBaseURL, url.PathEscape(cal.ID))
+		body := map[string]string{"summaryOverride": cal.Name}
+		if err := c.do(ctx, http.MethodPatch, apiURL, body, nil); err != nil {
+			return fmt.Errorf("failed to rename calendar: %w", err)
+		}
 	}
 
+	if cal.Color != "" {
+		return c.setCalendarColor(ctx, cal.ID, cal.Color)
+	}
 	return nil
 }
 
-// Sync performs a full sync
-func (c *Client) Sync(ctx context.Context) error {
-	c.account.LastSync = time.Now()
+// DeleteCalendar deletes an owned calendar or unsubscribes from a shared one
+func (c *Client) DeleteCalendar(ctx context.Context, calendarID string) error {
+	entry, err := c.getCalendarListEntry(ctx, calendarID)
+	if err != nil {
+		return err
+	}
+	if entry.Primary {
+		return fmt.Errorf("the primary calendar cannot be deleted")
+	}
+
+	apiURL := fmt.Sprintf("%s/users/me/calendarList/%s", apiBaseURL, url.PathEscape(calendarID))
+	if entry.AccessRole == "owner" {
+		apiURL = fmt.Sprintf("%s/calendars/%s", apiBaseURL, url.PathEscape(calendarID))
+	}
+	if err := c.do(ctx, http.MethodDelete, apiURL, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete calendar: %w", err)
+	}
 	return nil
 }
 
-// Ensure Client implements Provider
-var _ providers.Provider = (*Client)(nil)
+// Ensure Client implements Provider and its optional interfaces
+var (
+	_ providers.Provider            = (*Client)(nil)
+	_ providers.IncrementalSyncer   = (*Client)(nil)
+	_ providers.FreeBusyQuerier     = (*Client)(nil)
+	_ providers.InvitationResponder = (*Client)(nil)
+	_ providers.CalendarCreator     = (*Client)(nil)
+	_ providers.CalendarEditor      = (*Client)(nil)
+)
+
+func init() {
+	providers.Register(providers.Registration{
+		Type:        calendar.AccountTypeGoogle,
+		DisplayName: "Google Calendar",
+		ShortName:   "Google",
+		Description: "Sign in with your Google account to sync calendars.\nWorkspace organisations can enter their own OAuth client.",
+		Order:       10,
+		Auth:        providers.AuthOAuth,
+		Fields: []providers.CredentialField{
+			{
+				Key:         providers.FieldClientID,
+				Label:       "OAuth client ID (optional):",
+				Placeholder: "Leave empty to use SwitchCal's client",
+				Optional:    true,
+			},
+			{
+				Key:      providers.FieldClientSecret,
+				Label:    "OAuth client secret (optional):",
+				Secret:   true,
+				Optional: true,
+			},
+		},
+		Capabilities: providers.Capabilities{
+			Attendees:       true,
+			IncrementalSync: true,
+		},
+		New: func(account *calendar.Account) (providers.Provider, error) {
+			return NewClient(account, OAuthConfigFor(account)), nil
+		},
+		BrowserSignIn: BrowserSignIn,
+		// No DeviceSignIn: Google's device flow does not grant calendar access
+	})
+}
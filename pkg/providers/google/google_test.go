@@ -0,0 +1,158 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+	"golang.org/x/oauth2"
+)
+
+func TestRegistration(t *testing.T) {
+	reg, ok := providers.Lookup(calendar.AccountTypeGoogle)
+	if !ok {
+		t.Fatal("Google is not registered")
+	}
+	if !reg.IsRemote() || reg.Auth != providers.AuthOAuth {
+		t.Errorf("registration = %+v", reg)
+	}
+	if reg.BrowserSignIn == nil {
+		t.Error("browser sign-in not offered")
+	}
+	if reg.DeviceSignIn != nil {
+		t.Error("device sign-in offered, but Google's device flow cannot grant calendar access")
+	}
+	p, err := providers.New(&calendar.Account{Type: calendar.AccountTypeGoogle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(providers.IncrementalSyncer); !ok {
+		t.Error("Google client does not sync incrementally")
+	}
+}
+
+func TestOAuthConfigFor(t *testing.T) {
+	if cfg := OAuthConfigFor(&calendar.Account{}); cfg != DefaultOAuthConfig {
+		t.Errorf("account without a client got %+v, want the default", cfg)
+	}
+	cfg := OAuthConfigFor(&calendar.Account{ClientID: "own", ClientSecret: "shh"})
+	if cfg.ClientID != "own" || cfg.ClientSecret != "shh" {
+		t.Errorf("account client = %+v", cfg)
+	}
+}
+
+// staticTokens returns the same token every time
+type staticTokens struct{ token *oauth2.Token }
+
+func (s staticTokens) Token() (*oauth2.Token, error) { return s.token, nil }
+
+func TestAccountTokenSourceKeepsRefreshedTokens(t *testing.T) {
+	account := &calendar.Account{AccessToken: "old", RefreshToken: "refresh"}
+	expiry := time.Now().Add(time.Hour)
+	ts := &accountTokenSource{account: account, src: staticTokens{&oauth2.Token{AccessToken: "new", Expiry: expiry}}}
+
+	if _, err := ts.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if account.AccessToken != "new" || !account.TokenExpiry.Equal(expiry) {
+		t.Errorf("account token = %q expiring %v", account.AccessToken, account.TokenExpiry)
+	}
+	if account.RefreshToken != "refresh" {
+		t.Errorf("RefreshToken = %q, want it kept when the refresh returns none", account.RefreshToken)
+	}
+}
+
+const apiEvent = `{
+	"id": "abc_20260504T090000Z",
+	"etag": "\"3181\"",
+	"iCalUID": "abc@google.com",
+	"summary": "Standup",
+	"status": "tentative",
+	"start": {"dateTime": "2026-05-04T10:00:00+01:00", "timeZone": "Europe/London"},
+	"end": {"dateTime": "2026-05-04T10:30:00+01:00", "timeZone": "Europe/London"},
+	"recurringEventId": "abc",
+	"originalStartTime": {"dateTime": "2026-05-04T10:00:00+01:00"},
+	"organizer": {"email": "ann@example.com", "self": true},
+	"attendees": [{"email": "bob@example.com", "responseStatus": "declined", "optional": true}]
+}`
+
+func TestParseEvent(t *testing.T) {
+	var item eventItem
+	if err := json.Unmarshal([]byte(apiEvent), &item); err != nil {
+		t.Fatal(err)
+	}
+	event := parseEvent(&item, "primary")
+
+	if !event.Start.Equal(time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)) || event.End.Sub(event.Start) != 30*time.Minute {
+		t.Errorf("times = %v – %v", event.Start, event.End)
+	}
+	if event.UID != "abc@google.com" || event.RemoteID != "abc_20260504T090000Z" || event.ETag != `"3181"` {
+		t.Errorf("identity = %q, %q, %q", event.UID, event.RemoteID, event.ETag)
+	}
+	if event.RecurrenceID != "2026-05-04T09:00:00Z" {
+		t.Errorf("RecurrenceID = %q", event.RecurrenceID)
+	}
+	if event.TimeZone != "Europe/London" || event.EndTimeZone != "" {
+		t.Errorf("zones = %q, %q", event.TimeZone, event.EndTimeZone)
+	}
+	if event.Status != calendar.StatusTentative {
+		t.Errorf("Status = %q", event.Status)
+	}
+	if event.Organizer == nil || !event.Organizer.Self || event.Organizer.Status != "" {
+		t.Errorf("Organizer = %+v", event.Organizer)
+	}
+	if len(event.Attendees) != 1 || event.Attendees[0].Status != calendar.ParticipationDeclined || !event.Attendees[0].Optional {
+		t.Errorf("Attendees = %+v", event.Attendees)
+	}
+}
+
+func TestEventBodyAllDay(t *testing.T) {
+	start := time.Date(2026, 5, 4, 0, 0, 0, 0, time.Local)
+	body := eventBody(&calendar.Event{Title: "Holiday", AllDay: true, Start: start, End: start.AddDate(0, 0, 1)})
+	if got := body["end"].(map[string]string); got["date"] != "2026-05-05" {
+		t.Errorf("end = %v", got)
+	}
+	if _, ok := body["attendees"]; ok {
+		t.Error("empty attendee list sent, which would clear the event's guests")
+	}
+}
+
+// recordingTransport answers every request with an empty event list and
+// remembers the requested URLs
+type recordingTransport struct{ requests []*http.Request }
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"items": [], "nextSyncToken": "next"}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestEventChangesExpandRecurringEvents(t *testing.T) {
+	transport := &recordingTransport{}
+	c := &Client{account: &calendar.Account{}, httpClient: &http.Client{Transport: transport}}
+	start := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, token := range []string{"", "previous"} {
+		if _, err := c.GetEventChanges(context.Background(), "primary", token, start, start.AddDate(0, 1, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(transport.requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(transport.requests))
+	}
+	for _, req := range transport.requests {
+		if req.URL.Query().Get("singleEvents") != "true" {
+			t.Errorf("request %s does not expand recurring events", req.URL)
+		}
+	}
+}
@@ -2,25 +2,43 @@ package google
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+	"golang.org/x/oauth2"
 )
 
+// userInfoURL returns the signed-in user's profile
+const userInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
+
 // OAuthCallbackServer handles OAuth redirects
 type OAuthCallbackServer struct {
 	server   *http.Server
 	listener net.Listener
 	port     int
+	state    string
 	codeChan chan string
 	errChan  chan error
 	mu       sync.Mutex
 }
 
-// NewOAuthCallbackServer creates a new callback server
-func NewOAuthCallbackServer() (*OAuthCallbackServer, error) {
+// NewOAuthCallbackServer creates a new callback server that only accepts
+// redirects carrying the given state
+func NewOAuthCallbackServer(state string) (*OAuthCallbackServer, error) {
+	if state == "" {
+		return nil, fmt.Errorf("an OAuth state is required")
+	}
+
 	listener, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create listener: %w", err)
@@ -31,6 +49,7 @@ func NewOAuthCallbackServer() (*OAuthCallbackServer, error) {
 	s := &OAuthCallbackServer{
 		listener: listener,
 		port:     port,
+		state:    state,
 		codeChan: make(chan string, 1),
 		errChan:  make(chan error, 1),
 	}
@@ -80,19 +99,36 @@ func (s *OAuthCallbackServer) WaitForCode(ctx context.Context) (string, error) {
 	}
 }
 
+// handleCallback receives the authorization redirect. Requests whose state
+// does not match are rejected without ending the flow, so a forged redirect
+// cannot inject a code or abort the sign-in.
 func (s *OAuthCallbackServer) handleCallback(w http.ResponseWriter, r *http.Request) {
-	code := r.URL.Query().Get("code")
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(s.state)) != 1 {
+		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
+		return
+	}
+
+	code := query.Get("code")
 	if code == "" {
-		errMsg := r.URL.Query().Get("error")
+		errMsg := query.Get("error")
 		if errMsg == "" {
 			errMsg = "no authorization code received"
 		}
-		s.errChan <- fmt.Errorf("OAuth error: %s", errMsg)
+		select {
+		case s.errChan <- fmt.Errorf("OAuth error: %s", errMsg):
+		default:
+		}
 		http.Error(w, "Authorization failed", http.StatusBadRequest)
 		return
 	}
 
-	s.codeChan <- code
+	select {
+	case s.codeChan <- code:
+	default:
+		http.Error(w, "Authorization already completed", http.StatusConflict)
+		return
+	}
 
 	// Show success page
 	w.Header().Set("Content-Type", "text/html")
@@ -100,7 +136,7 @@ func (s *OAuthCallbackServer) handleCallback(w http.ResponseWriter, r *http.Requ
 <!DOCTYPE html>
 <html>
 <head>
-	<title>UniCal - Authorization Successful</title>
+	<title>SwitchCal - Authorization Successful</title>
 	<style>
 		body {
 			font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif;
@@ -126,9 +162,117 @@ func (s *OAuthCallbackServer) handleCallback(w http.ResponseWriter, r *http.Requ
 <body>
 	<div class="container">
 		<h1>Authorization Successful!</h1>
-		<p>You can close this window and return to UniCal.</p>
+		<p>You can close this window and return to SwitchCal.</p>
 	</div>
 </body>
 </html>
 `)
 }
+
+// NewOAuthState returns a random value for the OAuth state parameter
+func NewOAuthState() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate OAuth state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// SignIn runs the authorization code flow with PKCE (S256) through a loopback
+// redirect. openBrowser is called with the authorization URL, and the
+// returned token also grants access to the user's email address.
+func SignIn(ctx context.Context, cfg *OAuthConfig, openBrowser func(authURL string) error) (*oauth2.Token, error) {
+	state, err := NewOAuthState()
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := NewOAuthCallbackServer(state)
+	if err != nil {
+		return nil, err
+	}
+	server.Start()
+	defer server.Stop()
+
+	oauthCfg := *cfg
+	oauthCfg.RedirectURL = server.GetRedirectURL()
+	conf := oauthCfg.oauth2Config(CalendarScope, UserInfoEmailScope)
+
+	verifier := oauth2.GenerateVerifier()
+	authURL := conf.AuthCodeURL(state,
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("prompt", "consent"),
+		oauth2.S256ChallengeOption(verifier))
+	if err := openBrowser(authURL); err != nil {
+		return nil, fmt.Errorf("failed to open browser: %w", err)
+	}
+
+	code, err := server.WaitForCode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := conf.Exchange(providers.OAuthContext(ctx), code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	if token.RefreshToken == "" {
+		log.Printf("WARNING: No refresh token received. Token refresh will fail after 1 hour.")
+	}
+	return token, nil
+}
+
+// BrowserSignIn signs an account in with SignIn, checking that an existing
+// account signs in as the same user
+func BrowserSignIn(ctx context.Context, account *calendar.Account, openBrowser func(authURL string) error) error {
+	token, err := SignIn(ctx, OAuthConfigFor(account), openBrowser)
+	if err != nil {
+		return err
+	}
+
+	email, err := UserEmail(ctx, token)
+	if err != nil {
+		return err
+	}
+	if account.Email != "" && !strings.EqualFold(account.Email, email) {
+		return fmt.Errorf("signed in as %s, but this account belongs to %s", email, account.Email)
+	}
+
+	account.Email = email
+	account.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		account.RefreshToken = token.RefreshToken
+	}
+	account.TokenExpiry = token.Expiry
+	return nil
+}
+
+// UserEmail returns the email address of the user a token belongs to
+func UserEmail(ctx context.Context, token *oauth2.Token) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, userInfoURL, nil)
+	if err != nil {
+		return "", err
+	}
+	token.SetAuthHeader(req)
+
+	resp, err := providers.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch user info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch user info: %s", resp.Status)
+	}
+
+	var result struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode user info: %w", err)
+	}
+	if result.Email == "" {
+		return "", fmt.Errorf("no email address in user info")
+	}
+	return result.Email, nil
+}
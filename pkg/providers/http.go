@@ -0,0 +1,79 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// HTTPTimeout bounds every request made to a provider, including reading the response
+const HTTPTimeout = 60 * time.Second
+
+// HTTPClient is used for all provider requests instead of http.DefaultClient,
+// which never times out
+var HTTPClient = &http.Client{Timeout: HTTPTimeout}
+
+// OAuthContext returns a context that makes golang.org/x/oauth2 use HTTPClient
+// for token requests
+func OAuthContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, HTTPClient)
+}
+
+// HTTPError is returned for non-2xx responses from a provider's server
+type HTTPError struct {
+	Service    string // e.g. "Google API"
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // From the Retry-After header, zero if absent
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s error %d: %s", e.Service, e.StatusCode, e.Body)
+}
+
+// Temporary reports whether the request may succeed when retried later:
+// the server is rate limiting (429) or failing (5xx)
+func (e *HTTPError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// NewHTTPError reads a failed response into an HTTPError
+func NewHTTPError(service string, resp *http.Response) *HTTPError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return &HTTPError{
+		Service:    service,
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter decodes a Retry-After header, given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// RetryAfter returns how long a server asked to wait before retrying, if err
+// comes from a rate-limited or failing request
+func RetryAfter(err error) (time.Duration, bool) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.Temporary() {
+		return httpErr.RetryAfter, true
+	}
+	return 0, false
+}
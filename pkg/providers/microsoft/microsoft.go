@@ -0,0 +1,622 @@
+// Package microsoft syncs Outlook.com and Microsoft 365 calendars through
+// the Microsoft Graph API.
+package microsoft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/microsoft"
+)
+
+const (
+	// Graph scopes; offline_access is needed for a refresh token
+	CalendarsScope = "Calendars.ReadWrite"
+	UserReadScope  = "User.Read"
+	OfflineScope   = "offline_access"
+
+	// Tenant accepting both personal and work or school accounts
+	defaultTenant = "common"
+
+	apiBaseURL = "https://graph.microsoft.com/v1.0"
+
+	// Layout of Graph dateTimeTimeZone values
+	graphTimeLayout = "2006-01-02T15:04:05.9999999"
+
+	// Return times in UTC and bodies as plain text
+	preferHeader = `outlook.timezone="UTC", outlook.body-content-type="text"`
+)
+
+// OAuthConfig holds the Azure application SwitchCal signs in with
+type OAuthConfig struct {
+	ClientID     string
+	ClientSecret string // Only for confidential clients; public clients leave it empty
+	Tenant       string // Defaults to "common"
+}
+
+// DefaultOAuthConfig is used for accounts without their own OAuth client.
+// SwitchCal ships no Azure application, so it is empty until the
+// application configuration provides one.
+var DefaultOAuthConfig = &OAuthConfig{}
+
+// OAuthConfigFor returns the OAuth client an account signs in with
+func OAuthConfigFor(account *calendar.Account) *OAuthConfig {
+	if account.ClientID != "" {
+		return &OAuthConfig{
+			ClientID:     account.ClientID,
+			ClientSecret: account.ClientSecret,
+			Tenant:       DefaultOAuthConfig.Tenant,
+		}
+	}
+	return DefaultOAuthConfig
+}
+
+// oauth2Config returns the golang.org/x/oauth2 configuration for the client
+func (cfg *OAuthConfig) oauth2Config() *oauth2.Config {
+	tenant := cfg.Tenant
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Scopes:       []string{CalendarsScope, UserReadScope, OfflineScope},
+		Endpoint:     microsoft.AzureADEndpoint(tenant),
+	}
+}
+
+// Client implements the Provider interface for Microsoft Graph calendars
+type Client struct {
+	account     *calendar.Account
+	oauthConfig *oauth2.Config
+	httpClient  *http.Client
+}
+
+// NewClient creates a new Microsoft Graph client
+func NewClient(account *calendar.Account, cfg *OAuthConfig) *Client {
+	return &Client{
+		account:     account,
+		oauthConfig: cfg.oauth2Config(),
+	}
+}
+
+// Name returns the provider name
+func (c *Client) Name() string {
+	return c.account.Name
+}
+
+// Type returns the account type
+func (c *Client) Type() calendar.AccountType {
+	return c.account.Type
+}
+
+// GetAccount returns the account
+func (c *Client) GetAccount() *calendar.Account {
+	return c.account
+}
+
+// SetAccount sets the account
+func (c *Client) SetAccount(account *calendar.Account) {
+	c.account = account
+}
+
+// Authenticate prepares an HTTP client from the account's saved tokens.
+// Expired access tokens are refreshed on demand and written back to the account.
+func (c *Client) Authenticate(ctx context.Context) error {
+	if c.account.AccessToken == "" && c.account.RefreshToken == "" {
+		return fmt.Errorf("no access token - sign-in required")
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  c.account.AccessToken,
+		RefreshToken: c.account.RefreshToken,
+		Expiry:       c.account.TokenExpiry,
+		TokenType:    "Bearer",
+	}
+	ts := &accountTokenSource{
+		account: c.account,
+		src:     c.oauthConfig.TokenSource(providers.OAuthContext(context.Background()), token),
+	}
+	c.httpClient = oauth2.NewClient(providers.OAuthContext(context.Background()), ts)
+	c.httpClient.Timeout = providers.HTTPTimeout
+	return nil
+}
+
+// accountTokenSource copies refreshed tokens back onto the account so the
+// caller can persist them
+type accountTokenSource struct {
+	account *calendar.Account
+	src     oauth2.TokenSource
+}
+
+func (s *accountTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, fmt.Errorf("token refresh failed: %w", err)
+	}
+	if token.AccessToken != s.account.AccessToken {
+		s.account.AccessToken = token.AccessToken
+		s.account.TokenExpiry = token.Expiry
+		if token.RefreshToken != "" {
+			s.account.RefreshToken = token.RefreshToken
+		}
+	}
+	return token, nil
+}
+
+// do sends a request to the Graph API, encoding body and decoding the response into out
+func (c *Client) do(ctx context.Context, method, apiURL string, body, out interface{}) error {
+	if c.httpClient == nil {
+		return fmt.Errorf("not authenticated")
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Prefer", preferHeader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return providers.NewHTTPError("Microsoft Graph", resp)
+	}
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListCalendars returns the user's calendars
+func (c *Client) ListCalendars(ctx context.Context) ([]*calendar.Calendar, error) {
+	var calendars []*calendar.Calendar
+
+	apiURL := apiBaseURL + "/me/calendars"
+	for apiURL != "" {
+		var result struct {
+			Value []struct {
+				ID                string `json:"id"`
+				Name              string `json:"name"`
+				HexColor          string `json:"hexColor"`
+				CanEdit           bool   `json:"canEdit"`
+				IsDefaultCalendar bool   `json:"isDefaultCalendar"`
+			} `json:"value"`
+			NextLink string `json:"@odata.nextLink"`
+		}
+		if err := c.do(ctx, http.MethodGet, apiURL, nil, &result); err != nil {
+			return nil, fmt.Errorf("failed to list calendars: %w", err)
+		}
+
+		for _, item := range result.Value {
+			color := item.HexColor
+			if color == "" {
+				color = "#0078d4"
+			}
+			// The default calendar comes first
+			order := len(calendars) + 1
+			if item.IsDefaultCalendar {
+				order = 0
+			}
+			calendars = append(calendars, &calendar.Calendar{
+				ID:        item.ID,
+				AccountID: c.account.ID,
+				Name:      item.Name,
+				Color:     color,
+				Visible:   true,
+				ReadOnly:  !item.CanEdit,
+				Order:     order,
+			})
+		}
+
+		apiURL = result.NextLink
+	}
+
+	return calendars, nil
+}
+
+// dateTimeZone is a Graph dateTimeTimeZone value
+type dateTimeZone struct {
+	DateTime string `json:"dateTime"`
+	TimeZone string `json:"timeZone"`
+}
+
+// eventItem represents an event from the Graph API
+type eventItem struct {
+	ID      string `json:"id"`
+	ETag    string `json:"@odata.etag"`
+	ICalUID string `json:"iCalUId"`
+	Subject string `json:"subject"`
+	Body    struct {
+		Content string `json:"content"`
+	} `json:"body"`
+	Location struct {
+		DisplayName string `json:"displayName"`
+	} `json:"location"`
+	Start                dateTimeZone `json:"start"`
+	End                  dateTimeZone `json:"end"`
+	IsAllDay             bool         `json:"isAllDay"`
+	IsCancelled          bool         `json:"isCancelled"`
+	ShowAs               string       `json:"showAs"`
+	CreatedDateTime      time.Time    `json:"createdDateTime"`
+	LastModifiedDateTime time.Time    `json:"lastModifiedDateTime"`
+
+	// Zones the event was scheduled in, IANA or Windows names
+	OriginalStartTimeZone string `json:"originalStartTimeZone"`
+	OriginalEndTimeZone   string `json:"originalEndTimeZone"`
+
+	// Set on occurrences and exceptions of a recurring event
+	OriginalStart *time.Time `json:"originalStart"`
+
+	Organizer *recipient `json:"organizer"`
+	Attendees []attendee `json:"attendees"`
+}
+
+// recipient is a Graph recipient, such as an event's organizer
+type recipient struct {
+	EmailAddress struct {
+		Name    string `json:"name,omitempty"`
+		Address string `json:"address"`
+	} `json:"emailAddress"`
+}
+
+// attendee is a Graph attendee with their response
+type attendee struct {
+	recipient
+	Type   string `json:"type"` // required, optional or resource
+	Status *struct {
+		Response string `json:"response"` // none, organizer, tentativelyAccepted, accepted, declined or notResponded
+	} `json:"status,omitempty"`
+}
+
+// Graph responses by participation status
+var responses = map[calendar.ParticipationStatus]string{
+	calendar.ParticipationAccepted:  "accepted",
+	calendar.ParticipationTentative: "tentativelyAccepted",
+	calendar.ParticipationDeclined:  "declined",
+}
+
+// GetEvents returns events from a calendar within a time range, with
+// recurring events expanded into occurrences
+func (c *Client) GetEvents(ctx context.Context, calendarID string, start, end time.Time) ([]*calendar.Event, error) {
+	query := url.Values{}
+	query.Set("startDateTime", start.UTC().Format(time.RFC3339))
+	query.Set("endDateTime", end.UTC().Format(time.RFC3339))
+	query.Set("$top", "500")
+	apiURL := fmt.Sprintf("%s/me/calendars/%s/calendarView?%s", apiBaseURL, url.PathEscape(calendarID), query.Encode())
+
+	var events []*calendar.Event
+	for apiURL != "" {
+		var result struct {
+			Value    []eventItem `json:"value"`
+			NextLink string      `json:"@odata.nextLink"`
+		}
+		if err := c.do(ctx, http.MethodGet, apiURL, nil, &result); err != nil {
+			return nil, fmt.Errorf("failed to get events: %w", err)
+		}
+
+		for i := range result.Value {
+			if result.Value[i].IsCancelled {
+				continue
+			}
+			event := parseEvent(&result.Value[i], calendarID)
+			event.MarkSelf(c.account.Email)
+			events = append(events, event)
+		}
+
+		apiURL = result.NextLink
+	}
+
+	return events, nil
+}
+
+// parseGraphTime parses a dateTimeTimeZone value returned in UTC. All-day
+// events are placed at local midnight of their date.
+func parseGraphTime(dt dateTimeZone, allDay bool) time.Time {
+	if allDay {
+		date := dt.DateTime
+		if i := strings.IndexByte(date, 'T'); i >= 0 {
+			date = date[:i]
+		}
+		t, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+		return t
+	}
+	t, _ := time.ParseInLocation(graphTimeLayout, dt.DateTime, time.UTC)
+	return t.Local()
+}
+
+// parseEvent converts an API event item into an Event
+func parseEvent(item *eventItem, calendarID string) *calendar.Event {
+	event := &calendar.Event{
+		RemoteID:    item.ID,
+		CalendarID:  calendarID,
+		UID:         item.ICalUID,
+		Title:       item.Subject,
+		Description: strings.TrimSpace(item.Body.Content),
+		Location:    item.Location.DisplayName,
+		Start:       parseGraphTime(item.Start, item.IsAllDay),
+		End:         parseGraphTime(item.End, item.IsAllDay),
+		AllDay:      item.IsAllDay,
+		Created:     item.CreatedDateTime,
+		Modified:    item.LastModifiedDateTime,
+		ETag:        item.ETag,
+		Status:      calendar.StatusConfirmed,
+	}
+	if event.UID == "" {
+		event.UID = item.ID
+	}
+	if !item.IsAllDay && calendar.LoadTimeZone(item.OriginalStartTimeZone) != nil {
+		event.TimeZone = item.OriginalStartTimeZone
+	}
+	if !item.IsAllDay && item.OriginalEndTimeZone != item.OriginalStartTimeZone && calendar.LoadTimeZone(item.OriginalEndTimeZone) != nil {
+		event.EndTimeZone = item.OriginalEndTimeZone
+	}
+	if item.OriginalStart != nil {
+		event.RecurrenceID = item.OriginalStart.UTC().Format(time.RFC3339)
+	}
+	if item.ShowAs == "tentative" {
+		event.Status = calendar.StatusTentative
+	}
+
+	if item.Organizer != nil && item.Organizer.EmailAddress.Address != "" {
+		event.Organizer = &calendar.Attendee{
+			Email: item.Organizer.EmailAddress.Address,
+			Name:  item.Organizer.EmailAddress.Name,
+		}
+	}
+	for _, a := range item.Attendees {
+		if a.Type == "resource" {
+			continue // Rooms and equipment
+		}
+		status := calendar.ParticipationNeedsAction
+		if a.Status != nil {
+			for s, response := range responses {
+				if response == a.Status.Response {
+					status = s
+				}
+			}
+		}
+		event.Attendees = append(event.Attendees, calendar.Attendee{
+			Email:    a.EmailAddress.Address,
+			Name:     a.EmailAddress.Name,
+			Status:   status,
+			Optional: a.Type == "optional",
+		})
+	}
+	return event
+}
+
+// eventBody builds the request body for creating or updating an event
+func eventBody(event *calendar.Event) map[string]interface{} {
+	body := map[string]interface{}{
+		"subject":  event.Title,
+		"body":     map[string]string{"contentType": "text", "content": event.Description},
+		"location": map[string]string{"displayName": event.Location},
+		"isAllDay": event.AllDay,
+	}
+
+	if event.AllDay {
+		// All-day events must start and end at midnight
+		body["start"] = dateTimeZone{DateTime: event.Start.Format("2006-01-02") + "T00:00:00", TimeZone: "UTC"}
+		body["end"] = dateTimeZone{DateTime: event.End.Format("2006-01-02") + "T00:00:00", TimeZone: "UTC"}
+	} else if calendar.LoadTimeZone(event.TimeZone) != nil {
+		// Scheduled in the event's zone so recurrences follow its daylight saving
+		start, end := event.InZone()
+		body["start"] = dateTimeZone{DateTime: start.Format(graphTimeLayout), TimeZone: event.TimeZone}
+		body["end"] = dateTimeZone{DateTime: end.Format(graphTimeLayout), TimeZone: event.EndZone()}
+	} else {
+		body["start"] = dateTimeZone{DateTime: event.Start.UTC().Format(graphTimeLayout), TimeZone: "UTC"}
+		body["end"] = dateTimeZone{DateTime: event.End.UTC().Format(graphTimeLayout), TimeZone: "UTC"}
+	}
+
+	// Attendees are only sent when there are some, as a PATCH replaces the
+	// list; Graph invites new ones itself, so someone else's meeting is sent
+	// without them
+	if len(event.Attendees) > 0 && (event.Organizer == nil || event.Organizer.Self) {
+		attendees := make([]attendee, len(event.Attendees))
+		for i, a := range event.Attendees {
+			attendees[i].EmailAddress.Address = a.Email
+			attendees[i].EmailAddress.Name = a.Name
+			attendees[i].Type = "required"
+			if a.Optional {
+				attendees[i].Type = "optional"
+			}
+		}
+		body["attendees"] = attendees
+	}
+
+	return body
+}
+
+// CreateEvent creates a new event. The event's RemoteID and UID are set to
+// the ones assigned by the server.
+func (c *Client) CreateEvent(ctx context.Context, calendarID string, event *calendar.Event) error {
+	apiURL := fmt.Sprintf("%s/me/calendars/%s/events", apiBaseURL, url.PathEscape(calendarID))
+
+	var result eventItem
+	if err := c.do(ctx, http.MethodPost, apiURL, eventBody(event), &result); err != nil {
+		return fmt.Errorf("failed to create event: %w", err)
+	}
+
+	event.RemoteID = result.ID
+	event.UID = result.ICalUID
+	event.ETag = result.ETag
+	return nil
+}
+
+// UpdateEvent updates an existing event
+func (c *Client) UpdateEvent(ctx context.Context, calendarID string, event *calendar.Event) error {
+	apiURL := fmt.Sprintf("%s/me/events/%s", apiBaseURL, url.PathEscape(event.RemoteID))
+
+	var result eventItem
+	if err := c.do(ctx, http.MethodPatch, apiURL, eventBody(event), &result); err != nil {
+		return fmt.Errorf("failed to update event: %w", err)
+	}
+
+	event.ETag = result.ETag
+	return nil
+}
+
+// Graph actions replying to an invitation, by participation status
+var responseActions = map[calendar.ParticipationStatus]string{
+	calendar.ParticipationAccepted:  "accept",
+	calendar.ParticipationTentative: "tentativelyAccept",
+	calendar.ParticipationDeclined:  "decline",
+}
+
+// RespondToInvitation replies to an event the user is invited to and
+// sends the reply to the organizer
+func (c *Client) RespondToInvitation(ctx context.Context, calendarID string, event *calendar.Event, status calendar.ParticipationStatus, comment string) error {
+	action, ok := responseActions[status]
+	if !ok {
+		return fmt.Errorf("cannot reply %q to an invitation", status)
+	}
+	if event.RemoteID == "" {
+		return fmt.Errorf("event has not been uploaded")
+	}
+
+	apiURL := fmt.Sprintf("%s/me/events/%s/%s", apiBaseURL, url.PathEscape(event.RemoteID), action)
+	body := map[string]interface{}{"comment": comment, "sendResponse": true}
+	if err := c.do(ctx, http.MethodPost, apiURL, body, nil); err != nil {
+		return fmt.Errorf("failed to respond to invitation: %w", err)
+	}
+
+	if self := event.SelfAttendee(); self != nil {
+		self.Status = status
+	}
+	return nil
+}
+
+// DeleteEvent deletes an event
+func (c *Client) DeleteEvent(ctx context.Context, calendarID string, remoteID string) error {
+	apiURL := fmt.Sprintf("%s/me/events/%s", apiBaseURL, url.PathEscape(remoteID))
+
+	if err := c.do(ctx, http.MethodDelete, apiURL, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	return nil
+}
+
+// DeviceSignIn signs an account in with the device authorization grant. The
+// Azure application must allow public client flows.
+func DeviceSignIn(ctx context.Context, account *calendar.Account, prompt func(*providers.DeviceCode)) error {
+	cfg := OAuthConfigFor(account)
+	if cfg.ClientID == "" {
+		return fmt.Errorf("no Microsoft OAuth client configured; enter the application (client) ID of an Azure app registration")
+	}
+
+	token, err := providers.DeviceFlow(ctx, cfg.oauth2Config(), prompt)
+	if err != nil {
+		return err
+	}
+
+	email, err := userEmail(ctx, token)
+	if err != nil {
+		return err
+	}
+	if account.Email != "" && !strings.EqualFold(account.Email, email) {
+		return fmt.Errorf("signed in as %s, but this account belongs to %s", email, account.Email)
+	}
+
+	account.Email = email
+	account.AccessToken = token.AccessToken
+	if token.RefreshToken != "" {
+		account.RefreshToken = token.RefreshToken
+	}
+	account.TokenExpiry = token.Expiry
+	return nil
+}
+
+// userEmail returns the address of the user a token belongs to
+func userEmail(ctx context.Context, token *oauth2.Token) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiBaseURL+"/me?$select=mail,userPrincipalName", nil)
+	if err != nil {
+		return "", err
+	}
+	token.SetAuthHeader(req)
+
+	resp, err := providers.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch user profile: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch user profile: %s", resp.Status)
+	}
+
+	var result struct {
+		Mail              string `json:"mail"`
+		UserPrincipalName string `json:"userPrincipalName"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode user profile: %w", err)
+	}
+	if result.Mail != "" {
+		return result.Mail, nil
+	}
+	if result.UserPrincipalName != "" {
+		return result.UserPrincipalName, nil
+	}
+	return "", fmt.Errorf("no email address in user profile")
+}
+
+// Ensure Client implements Provider and InvitationResponder
+var (
+	_ providers.Provider            = (*Client)(nil)
+	_ providers.InvitationResponder = (*Client)(nil)
+)
+
+func init() {
+	providers.Register(providers.Registration{
+		Type:        calendar.AccountTypeOutlook,
+		DisplayName: "Microsoft Outlook / 365",
+		ShortName:   "Microsoft",
+		Description: "Sign in with a code on any device with a browser.\nRequires the client ID of an Azure app registration that allows public client flows.",
+		Order:       15,
+		Auth:        providers.AuthOAuth,
+		Fields: []providers.CredentialField{
+			{
+				Key:         providers.FieldClientID,
+				Label:       "Application (client) ID:",
+				Placeholder: "Leave empty to use the configured client",
+				Optional:    true,
+			},
+		},
+		Capabilities: providers.Capabilities{
+			Attendees: true,
+		},
+		New: func(account *calendar.Account) (providers.Provider, error) {
+			return NewClient(account, OAuthConfigFor(account)), nil
+		},
+		DeviceSignIn: DeviceSignIn,
+	})
+}
@@ -0,0 +1,133 @@
+package microsoft
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+)
+
+const graphEvent = `{
+	"id": "AAMk-1",
+	"@odata.etag": "W/\"etag-1\"",
+	"iCalUId": "uid-1@example.com",
+	"subject": "Planning",
+	"body": {"content": "  Agenda  "},
+	"location": {"displayName": "Room 4"},
+	"start": {"dateTime": "2026-03-02T09:30:00.0000000", "timeZone": "UTC"},
+	"end": {"dateTime": "2026-03-02T10:30:00.0000000", "timeZone": "UTC"},
+	"showAs": "tentative",
+	"originalStartTimeZone": "Europe/London",
+	"originalEndTimeZone": "Europe/London",
+	"originalStart": "2026-03-02T09:30:00Z",
+	"organizer": {"emailAddress": {"name": "Ann", "address": "ann@example.com"}},
+	"attendees": [
+		{"type": "required", "emailAddress": {"name": "Bob", "address": "bob@example.com"}, "status": {"response": "accepted"}},
+		{"type": "optional", "emailAddress": {"address": "cy@example.com"}, "status": {"response": "none"}},
+		{"type": "resource", "emailAddress": {"address": "room4@example.com"}}
+	]
+}`
+
+func TestParseEvent(t *testing.T) {
+	var item eventItem
+	if err := json.Unmarshal([]byte(graphEvent), &item); err != nil {
+		t.Fatal(err)
+	}
+	event := parseEvent(&item, "cal")
+
+	wantStart := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	if !event.Start.Equal(wantStart) || !event.End.Equal(wantStart.Add(time.Hour)) {
+		t.Errorf("times = %v – %v", event.Start, event.End)
+	}
+	if event.RemoteID != "AAMk-1" || event.UID != "uid-1@example.com" || event.CalendarID != "cal" {
+		t.Errorf("identity = %q, %q, %q", event.RemoteID, event.UID, event.CalendarID)
+	}
+	if event.Description != "Agenda" || event.Location != "Room 4" {
+		t.Errorf("description %q, location %q", event.Description, event.Location)
+	}
+	if event.Status != calendar.StatusTentative {
+		t.Errorf("Status = %q, want tentative", event.Status)
+	}
+	if event.TimeZone != "Europe/London" || event.EndTimeZone != "" {
+		t.Errorf("zones = %q, %q", event.TimeZone, event.EndTimeZone)
+	}
+	if event.RecurrenceID != "2026-03-02T09:30:00Z" {
+		t.Errorf("RecurrenceID = %q", event.RecurrenceID)
+	}
+	if event.Organizer == nil || event.Organizer.Email != "ann@example.com" {
+		t.Errorf("Organizer = %+v", event.Organizer)
+	}
+	if len(event.Attendees) != 2 {
+		t.Fatalf("attendees = %+v, want the two people without the room", event.Attendees)
+	}
+	if a := event.Attendees[0]; a.Status != calendar.ParticipationAccepted || a.Optional {
+		t.Errorf("first attendee = %+v", a)
+	}
+	if a := event.Attendees[1]; a.Status != calendar.ParticipationNeedsAction || !a.Optional {
+		t.Errorf("second attendee = %+v", a)
+	}
+}
+
+func TestParseEventAllDay(t *testing.T) {
+	item := &eventItem{
+		ID:       "AAMk-2",
+		IsAllDay: true,
+		Start:    dateTimeZone{DateTime: "2026-03-02T00:00:00.0000000", TimeZone: "UTC"},
+		End:      dateTimeZone{DateTime: "2026-03-03T00:00:00.0000000", TimeZone: "UTC"},
+	}
+	event := parseEvent(item, "cal")
+	if !event.AllDay || event.Start.Location() != time.Local || event.Start.Hour() != 0 || event.Start.Day() != 2 {
+		t.Errorf("all-day start = %v", event.Start)
+	}
+	if event.UID != "AAMk-2" {
+		t.Errorf("UID = %q, want the Graph ID when there is no iCalUId", event.UID)
+	}
+}
+
+func TestEventBody(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	event := &calendar.Event{
+		Title: "Planning",
+		Start: start,
+		End:   start.Add(time.Hour),
+		Attendees: []calendar.Attendee{
+			{Email: "bob@example.com"},
+			{Email: "cy@example.com", Optional: true},
+		},
+	}
+
+	body := eventBody(event)
+	if got := body["start"].(dateTimeZone); got.DateTime != "2026-03-02T09:30:00" || got.TimeZone != "UTC" {
+		t.Errorf("start = %+v", got)
+	}
+	attendees, ok := body["attendees"].([]attendee)
+	if !ok || len(attendees) != 2 || attendees[1].Type != "optional" {
+		t.Errorf("attendees = %+v", body["attendees"])
+	}
+
+	// Someone else's meeting is saved without re-inviting its guests
+	event.Organizer = &calendar.Attendee{Email: "ann@example.com"}
+	if _, ok := eventBody(event)["attendees"]; ok {
+		t.Error("attendees sent for a meeting the user does not organize")
+	}
+
+	event.AllDay = true
+	event.Start = time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local)
+	event.End = event.Start.AddDate(0, 0, 1)
+	if got := eventBody(event)["end"].(dateTimeZone); got.DateTime != "2026-03-03T00:00:00" {
+		t.Errorf("all-day end = %+v", got)
+	}
+}
+
+func TestDeviceSignInNeedsClient(t *testing.T) {
+	prompted := false
+	err := DeviceSignIn(context.Background(), &calendar.Account{Type: calendar.AccountTypeOutlook}, func(*providers.DeviceCode) {
+		prompted = true
+	})
+	if err == nil || prompted {
+		t.Fatalf("sign-in without a client: err %v, prompted %v", err, prompted)
+	}
+}
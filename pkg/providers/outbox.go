@@ -0,0 +1,168 @@
+package providers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// Retry policy for changes the provider rejected or could not be reached for
+const (
+	outboxRetryDelay    = 30 * time.Second
+	outboxMaxRetryDelay = time.Hour
+)
+
+// replayMu keeps a change from being sent twice by overlapping syncs
+var replayMu sync.Mutex
+
+// replayOutbox sends an account's queued event changes to its provider in
+// the order they were made. A change that fails is retried on a later replay
+// with exponential backoff, and later changes to the same event wait for it,
+// as do changes to events with an unresolved conflict. The provider must be
+// authenticated. It returns the errors of the changes that failed.
+func replayOutbox(ctx context.Context, p Provider, store *calendar.Store) []error {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+
+	account := p.GetAccount()
+	changes, err := store.GetPendingChanges(account.ID)
+	if err != nil {
+		return []error{fmt.Errorf("failed to load pending changes: %w", err)}
+	}
+	conflicts, err := store.GetConflicts()
+	if err != nil {
+		return []error{fmt.Errorf("failed to load conflicts: %w", err)}
+	}
+
+	// Events whose remaining changes must not be sent yet
+	held := make(map[string]bool)
+	for _, c := range conflicts {
+		held[c.CalendarID+"/"+c.EventID] = true
+	}
+
+	var errs []error
+	for _, c := range changes {
+		key := c.CalendarID + "/" + c.EventID
+		if ctx.Err() != nil || held[key] || time.Now().Before(c.NextAttempt) {
+			held[key] = true
+			continue
+		}
+
+		if err := sendChange(ctx, p, store, c); err != nil {
+			held[key] = true
+			errs = append(errs, fmt.Errorf("failed to upload %s of event %s: %w", c.Op, c.EventID, err))
+			if err := store.FailChange(c.ID, err, time.Now().Add(retryDelay(c.Attempts))); err != nil {
+				errs = append(errs, fmt.Errorf("failed to record pending change: %w", err))
+			}
+			continue
+		}
+		if err := store.CompleteChange(c.ID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove sent change: %w", err))
+		}
+	}
+	return errs
+}
+
+// RestoreEvent moves an event from the trash back into its calendar and
+// queues it for upload to the account, if any. It waits for a replay in
+// progress, so a delete being sent is either undone or already complete.
+func RestoreEvent(store *calendar.Store, eventID, accountID string) (*calendar.Event, error) {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+
+	return store.RestoreEvent(eventID, accountID)
+}
+
+// MoveEvent saves an event moved from another calendar and queues the
+// removal of the copy uploaded there, see calendar.Store.MoveEvent. It waits
+// for a replay in progress, so the old copy is not uploaded again meanwhile.
+func MoveEvent(store *calendar.Store, event *calendar.Event, oldCalendarID, oldAccountID string) error {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+
+	return store.MoveEvent(event, oldCalendarID, oldAccountID)
+}
+
+// pendingChanges returns the first queued change of each event of an
+// account. Its base version tells whether a remote edit conflicts with it.
+func pendingChanges(store *calendar.Store, accountID string) (map[string]*calendar.PendingChange, error) {
+	changes, err := store.GetPendingChanges(accountID)
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[string]*calendar.PendingChange, len(changes))
+	for _, c := range changes {
+		if _, ok := pending[c.EventID]; !ok {
+			pending[c.EventID] = c
+		}
+	}
+	return pending, nil
+}
+
+// remoteChanged reports whether the server's copy of an event is newer than
+// the version a pending change was made to
+func remoteChanged(change *calendar.PendingChange, remote *calendar.Event) bool {
+	if change.Op == calendar.ChangeCreate {
+		return false
+	}
+	if change.BaseETag != "" && remote.ETag != "" {
+		return change.BaseETag != remote.ETag
+	}
+	return !change.BaseModified.IsZero() && remote.Modified.After(change.BaseModified)
+}
+
+// sendChange applies one queued change through the provider and stores what
+// the provider returned
+func sendChange(ctx context.Context, p Provider, store *calendar.Store, c *calendar.PendingChange) error {
+	if c.Op == calendar.ChangeDelete {
+		if c.RemoteID == "" {
+			return nil // Never uploaded
+		}
+		if cd, ok := p.(ConditionalDeleter); ok && c.BaseETag != "" {
+			return cd.DeleteEventIfMatch(ctx, c.CalendarID, c.RemoteID, c.BaseETag)
+		}
+		return p.DeleteEvent(ctx, c.CalendarID, c.RemoteID)
+	}
+
+	// Send the event as it is now; if it has been removed since, a queued
+	// delete takes care of it
+	event, err := store.GetEvent(c.EventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load event: %w", err)
+	}
+
+	if c.Op == calendar.ChangeUpdate && event.RemoteID != "" {
+		// Sent over the version it was made to, e.g. the server's after a
+		// resolved conflict; the provider sets the new version's ETag
+		if c.BaseETag != "" {
+			event.ETag = c.BaseETag
+		}
+		if err := p.UpdateEvent(ctx, c.CalendarID, event); err != nil {
+			return err
+		}
+		return store.SaveEvent(event)
+	}
+
+	// The provider sets the event's remote ID; its local ID stays the same
+	if err := p.CreateEvent(ctx, c.CalendarID, event); err != nil {
+		return err
+	}
+	return store.SaveEvent(event)
+}
+
+// retryDelay returns how long to wait before retrying a change that has failed attempts times
+func retryDelay(attempts int) time.Duration {
+	delay := outboxRetryDelay
+	for i := 0; i < attempts && delay < outboxMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, outboxMaxRetryDelay)
+}
@@ -21,20 +21,18 @@ type Provider interface {
 	// ListCalendars returns all calendars from the provider
 	ListCalendars(ctx context.Context) ([]*calendar.Calendar, error)
 
-	// GetEvents returns events from a calendar within a time range
+	// GetEvents returns events from a calendar within a time range, with
+	// RemoteID set and ID left empty
 	GetEvents(ctx context.Context, calendarID string, start, end time.Time) ([]*calendar.Event, error)
 
-	// CreateEvent creates a new event
+	// CreateEvent creates a new event and sets its RemoteID
 	CreateEvent(ctx context.Context, calendarID string, event *calendar.Event) error
 
-	// UpdateEvent updates an existing event
+	// UpdateEvent updates the event with the event's RemoteID
 	UpdateEvent(ctx context.Context, calendarID string, event *calendar.Event) error
 
-	// DeleteEvent deletes an event
-	DeleteEvent(ctx context.Context, calendarID string, eventID string) error
-
-	// Sync performs a full sync with the provider
-	Sync(ctx context.Context) error
+	// DeleteEvent deletes the event with the given remote ID
+	DeleteEvent(ctx context.Context, calendarID string, remoteID string) error
 
 	// GetAccount returns the provider's account
 	GetAccount() *calendar.Account
@@ -43,13 +41,40 @@ type Provider interface {
 	SetAccount(account *calendar.Account)
 }
 
-// SyncResult contains the result of a sync operation
+// SyncResult contains the result of syncing one calendar. Failures that
+// prevent any calendar from syncing are reported with an empty CalendarID.
 type SyncResult struct {
+	AccountID     string
+	CalendarID    string
 	EventsCreated int
 	EventsUpdated int
 	EventsDeleted int
+	Conflicts     int // Events changed both locally and remotely
 	Errors        []error
-	SyncTime      time.Time
+	SyncTime      time.Time // When the sync started
+	Duration      time.Duration
+}
+
+// Failed returns true if any error occurred
+func (r *SyncResult) Failed() bool {
+	return len(r.Errors) > 0
+}
+
+// Record converts the result into a sync history record for the Store
+func (r *SyncResult) Record() *calendar.SyncRecord {
+	rec := &calendar.SyncRecord{
+		AccountID:     r.AccountID,
+		CalendarID:    r.CalendarID,
+		Started:       r.SyncTime,
+		Duration:      r.Duration,
+		EventsCreated: r.EventsCreated,
+		EventsUpdated: r.EventsUpdated,
+		EventsDeleted: r.EventsDeleted,
+	}
+	for _, err := range r.Errors {
+		rec.Errors = append(rec.Errors, err.Error())
+	}
+	return rec
 }
 
 // AuthConfig contains authentication configuration
@@ -0,0 +1,203 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// AuthMethod describes how a provider obtains its credentials
+type AuthMethod int
+
+const (
+	// AuthNone is used by providers that need no credentials (local calendars)
+	AuthNone AuthMethod = iota
+	// AuthPassword collects a username and (app) password from the user
+	AuthPassword
+	// AuthOAuth runs a browser-based OAuth flow
+	AuthOAuth
+)
+
+// Credential field keys understood by ApplyFields
+const (
+	FieldServerURL = "server_url"
+	FieldUsername  = "username"
+	FieldPassword  = "password"
+
+	// OAuth client overriding the application default
+	FieldClientID     = "client_id"
+	FieldClientSecret = "client_secret"
+)
+
+// CredentialField describes an input the add-account dialog has to collect
+type CredentialField struct {
+	Key         string
+	Label       string
+	Placeholder string
+	Default     string // Pre-filled value
+	Fixed       bool   // Default cannot be edited by the user
+	Secret      bool   // Input should be masked
+	Optional    bool   // May be left empty
+}
+
+// Capabilities describes what a provider supports beyond reading and
+// writing events, recurring ones included, which every provider does
+type Capabilities struct {
+	Attendees       bool // Attendees and organizers are understood
+	IncrementalSync bool // Implements IncrementalSyncer
+}
+
+// Factory creates a provider for an account
+type Factory func(account *calendar.Account) (Provider, error)
+
+// Registration describes a provider known to the application
+type Registration struct {
+	Type        calendar.AccountType
+	DisplayName string // Shown in account pickers, e.g. "Apple iCloud (CalDAV)"
+	ShortName   string // Used to name new accounts, e.g. "Apple"
+	Description string // Help text shown when the provider is selected
+	Order       int    // Position in account pickers (lowest first)
+
+	Auth         AuthMethod
+	Fields       []CredentialField
+	Capabilities Capabilities
+
+	// BrowserSignIn signs accounts in through the system browser. It is
+	// nil if unsupported.
+	BrowserSignIn BrowserSignInFunc
+
+	// DeviceSignIn signs accounts in with a code entered on another device,
+	// for machines without a browser. It is nil if unsupported.
+	DeviceSignIn DeviceSignInFunc
+
+	// New creates a provider for an account. It is nil for account types
+	// whose data only lives in the local Store.
+	New Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[calendar.AccountType]*Registration)
+)
+
+// Register makes a provider available. It is meant to be called from init
+// functions and panics if the account type is registered twice.
+func Register(r Registration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[r.Type]; exists {
+		panic(fmt.Sprintf("providers: %q registered twice", r.Type))
+	}
+	registry[r.Type] = &r
+}
+
+// Lookup returns the registration for an account type
+func Lookup(accountType calendar.AccountType) (*Registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	r, ok := registry[accountType]
+	return r, ok
+}
+
+// Registered returns all registrations in picker order
+func Registered() []*Registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	regs := make([]*Registration, 0, len(registry))
+	for _, r := range registry {
+		regs = append(regs, r)
+	}
+	sort.Slice(regs, func(i, j int) bool {
+		if regs[i].Order != regs[j].Order {
+			return regs[i].Order < regs[j].Order
+		}
+		return regs[i].DisplayName < regs[j].DisplayName
+	})
+	return regs
+}
+
+// New creates a provider for an account. It returns nil without an error
+// for account types that have no remote backend.
+func New(account *calendar.Account) (Provider, error) {
+	r, ok := Lookup(account.Type)
+	if !ok {
+		return nil, fmt.Errorf("no provider registered for account type %q", account.Type)
+	}
+	if r.New == nil {
+		return nil, nil
+	}
+	return r.New(account)
+}
+
+// IsRemote returns true if the registration syncs with a remote backend
+func (r *Registration) IsRemote() bool {
+	return r.New != nil
+}
+
+// ApplyFields copies the values collected for Fields onto an account,
+// filling in defaults and rejecting missing values.
+func (r *Registration) ApplyFields(account *calendar.Account, values map[string]string) error {
+	for _, f := range r.Fields {
+		v := values[f.Key]
+		if f.Fixed || v == "" {
+			v = f.Default
+		}
+		if v == "" && f.Optional {
+			continue
+		}
+		if v == "" {
+			return fmt.Errorf("%s is required", f.Label)
+		}
+
+		switch f.Key {
+		case FieldServerURL:
+			account.ServerURL = v
+		case FieldUsername:
+			account.Username = v
+			account.Email = v
+		case FieldPassword:
+			account.AppPassword = v
+		case FieldClientID:
+			account.ClientID = v
+		case FieldClientSecret:
+			account.ClientSecret = v
+		default:
+			return fmt.Errorf("unknown credential field %q", f.Key)
+		}
+	}
+	return nil
+}
+
+// FieldValue returns the value an account currently holds for a credential field
+func FieldValue(account *calendar.Account, key string) string {
+	switch key {
+	case FieldServerURL:
+		return account.ServerURL
+	case FieldUsername:
+		return account.Username
+	case FieldPassword:
+		return account.AppPassword
+	case FieldClientID:
+		return account.ClientID
+	case FieldClientSecret:
+		return account.ClientSecret
+	}
+	return ""
+}
+
+func init() {
+	// Local calendars live only in the Store
+	Register(Registration{
+		Type:        calendar.AccountTypeLocal,
+		DisplayName: "Local Calendar",
+		ShortName:   "Local",
+		Description: "Create a local calendar stored on this device.",
+		Order:       0,
+		Auth:        AuthNone,
+	})
+}
@@ -0,0 +1,67 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+func TestRegisterTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering an account type twice did not panic")
+		}
+	}()
+	Register(Registration{Type: calendar.AccountTypeLocal})
+}
+
+func TestNewLocalAccount(t *testing.T) {
+	p, err := New(&calendar.Account{Type: calendar.AccountTypeLocal})
+	if err != nil || p != nil {
+		t.Errorf("New(local) = %v, %v; want no provider", p, err)
+	}
+	if _, err := New(&calendar.Account{Type: "unknown"}); err == nil {
+		t.Error("New accepted an unregistered account type")
+	}
+}
+
+func TestApplyFields(t *testing.T) {
+	reg := &Registration{Fields: []CredentialField{
+		{Key: FieldServerURL, Label: "Server", Default: "https://caldav.example.com", Fixed: true},
+		{Key: FieldUsername, Label: "Username"},
+		{Key: FieldPassword, Label: "Password", Secret: true},
+		{Key: FieldClientID, Label: "Client ID", Optional: true},
+	}}
+
+	account := &calendar.Account{}
+	err := reg.ApplyFields(account, map[string]string{
+		FieldServerURL: "https://elsewhere.example.com",
+		FieldUsername:  "ann@example.com",
+		FieldPassword:  "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.ServerURL != "https://caldav.example.com" {
+		t.Errorf("ServerURL = %q, want the fixed default", account.ServerURL)
+	}
+	if account.Username != "ann@example.com" || account.Email != "ann@example.com" || account.AppPassword != "secret" {
+		t.Errorf("account = %+v", account)
+	}
+	if account.ClientID != "" {
+		t.Errorf("ClientID = %q for an optional field left empty", account.ClientID)
+	}
+
+	if err := reg.ApplyFields(&calendar.Account{}, map[string]string{FieldUsername: "ann"}); err == nil {
+		t.Error("missing password accepted")
+	}
+}
+
+func TestRegisteredOrder(t *testing.T) {
+	regs := Registered()
+	for i := 1; i < len(regs); i++ {
+		if regs[i-1].Order > regs[i].Order {
+			t.Errorf("%s (order %d) listed before %s (order %d)", regs[i-1].Type, regs[i-1].Order, regs[i].Type, regs[i].Order)
+		}
+	}
+}
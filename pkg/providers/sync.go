@@ -0,0 +1,256 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// SyncAccount syncs the calendars and events of a provider's account into the
+// store, returning one result per calendar. The events between start and end
+// are fetched; calendars that support it are synced incrementally. Events
+// with changes queued in the outbox keep their local version, and a conflict
+// is recorded when the server's copy changed too; the queued changes are
+// sent afterwards, with failed uploads reported in an account-level entry. An
+// error is returned only when no calendar could be synced, in which case the
+// result list holds a single account-level entry describing the failure.
+func SyncAccount(ctx context.Context, p Provider, store *calendar.Store, start, end time.Time) ([]*SyncResult, error) {
+	return SyncAccountWithProgress(ctx, p, store, start, end, nil)
+}
+
+// SyncProgress is called after each calendar of an account has been synced
+type SyncProgress func(done, total int, result *SyncResult)
+
+// SyncAccountWithProgress is SyncAccount reporting each synced calendar to
+// progress, which may be nil
+func SyncAccountWithProgress(ctx context.Context, p Provider, store *calendar.Store, start, end time.Time, progress SyncProgress) ([]*SyncResult, error) {
+	account := p.GetAccount()
+	began := time.Now()
+
+	fail := func(err error) ([]*SyncResult, error) {
+		return []*SyncResult{{
+			AccountID: account.ID,
+			Errors:    []error{err},
+			SyncTime:  began,
+			Duration:  time.Since(began),
+		}}, err
+	}
+
+	if err := p.Authenticate(ctx); err != nil {
+		return fail(fmt.Errorf("authentication failed: %w", err))
+	}
+
+	calendars, err := p.ListCalendars(ctx)
+	if err != nil {
+		return fail(fmt.Errorf("failed to list calendars: %w", err))
+	}
+
+	pending, err := pendingChanges(store, account.ID)
+	if err != nil {
+		return fail(fmt.Errorf("failed to load pending changes: %w", err))
+	}
+
+	var results []*SyncResult
+	for i, cal := range calendars {
+		if ctx.Err() != nil {
+			break
+		}
+		result := syncCalendar(ctx, p, store, account, cal, start, end, pending)
+		results = append(results, result)
+		if progress != nil {
+			progress(i+1, len(calendars), result)
+		}
+	}
+
+	if errs := replayOutbox(ctx, p, store); len(errs) > 0 {
+		results = append(results, &SyncResult{
+			AccountID: account.ID,
+			Errors:    errs,
+			SyncTime:  began,
+			Duration:  time.Since(began),
+		})
+	}
+
+	account.LastSync = time.Now()
+	return results, nil
+}
+
+// syncCalendar stores a calendar and its events, preferring an incremental
+// sync. Events with pending changes are left as they are.
+func syncCalendar(ctx context.Context, p Provider, store *calendar.Store, account *calendar.Account, cal *calendar.Calendar, start, end time.Time, pending map[string]*calendar.PendingChange) *SyncResult {
+	result := &SyncResult{
+		AccountID:  account.ID,
+		CalendarID: cal.ID,
+		SyncTime:   time.Now(),
+	}
+	defer func() { result.Duration = time.Since(result.SyncTime) }()
+
+	cal.AccountID = account.ID
+
+	// Preserve sync token and visibility from the stored calendar
+	if existing, err := store.GetCalendar(cal.ID); err == nil {
+		cal.SyncToken = existing.SyncToken
+		cal.Visible = existing.Visible
+	}
+
+	if err := store.SaveCalendar(cal); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to save calendar: %w", err))
+		return result
+	}
+
+	if syncer, ok := p.(IncrementalSyncer); ok {
+		syncIncremental(ctx, p, syncer, store, cal, start, end, pending, result)
+	} else {
+		syncFull(ctx, p, store, cal, start, end, pending, result)
+	}
+	return result
+}
+
+// syncFull replaces a calendar's events with everything the provider returns in the range
+func syncFull(ctx context.Context, p Provider, store *calendar.Store, cal *calendar.Calendar, start, end time.Time, pending map[string]*calendar.PendingChange, result *SyncResult) {
+	events, err := p.GetEvents(ctx, cal.ID, start, end)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to get events: %w", err))
+		return
+	}
+	saveEvents(store, cal, events, true, pending, result)
+}
+
+// syncIncremental fetches only the changes since the calendar's last sync token
+func syncIncremental(ctx context.Context, p Provider, syncer IncrementalSyncer, store *calendar.Store, cal *calendar.Calendar, start, end time.Time, pending map[string]*calendar.PendingChange, result *SyncResult) {
+	changes, err := syncer.GetEventChanges(ctx, cal.ID, cal.SyncToken, start, end)
+
+	// The token was rejected; list every event again, which also returns a
+	// fresh token. It is cleared first so a failed listing is not retried
+	// with the rejected token.
+	if errors.Is(err, ErrSyncTokenExpired) && cal.SyncToken != "" {
+		cal.SyncToken = ""
+		if err := store.SaveCalendar(cal); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to clear sync token: %w", err))
+			return
+		}
+		syncIncremental(ctx, p, syncer, store, cal, start, end, pending, result)
+		return
+	}
+
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to get event changes: %w", err))
+		return
+	}
+
+	for _, remoteID := range changes.Deleted {
+		events, err := store.GetEventsByRemoteID(cal.ID, remoteID)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to look up deleted event %s: %w", remoteID, err))
+			continue
+		}
+		for _, event := range events {
+			if change, ok := pending[event.ID]; ok {
+				resolveRemoteDelete(store, cal, change, result)
+				continue
+			}
+			if err := store.DeleteEvent(event.ID); err != nil {
+				result.Errors = append(result.Errors, fmt.Errorf("failed to delete event %s: %w", remoteID, err))
+				continue
+			}
+			result.EventsDeleted++
+		}
+	}
+	saveEvents(store, cal, changes.Events, changes.Full, pending, result)
+
+	// Save sync token for next incremental sync
+	if changes.SyncToken != "" {
+		cal.SyncToken = changes.SyncToken
+		if err := store.SaveCalendar(cal); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to save sync token: %w", err))
+		}
+	}
+}
+
+// saveEvents stores fetched events, counting what changed. Each is matched to
+// its local copy by remote identity. When complete is set, local events
+// missing from the list are removed. Events in pending have local changes that
+// are not uploaded yet and are neither replaced nor removed; a conflict is
+// recorded if the server's copy changed as well.
+func saveEvents(store *calendar.Store, cal *calendar.Calendar, events []*calendar.Event, complete bool, pending map[string]*calendar.PendingChange, result *SyncResult) {
+	activeIDs := make([]string, 0, len(events)+len(pending))
+	for id := range pending {
+		activeIDs = append(activeIDs, id)
+	}
+	for _, event := range events {
+		event.CalendarID = cal.ID
+		existing, err := store.GetEventByRemoteID(cal.ID, event.RemoteID, event.RecurrenceID)
+		if err == nil {
+			event.ID = existing.ID
+			activeIDs = append(activeIDs, event.ID)
+
+			if change, ok := pending[event.ID]; ok {
+				if remoteChanged(change, event) {
+					saveConflict(store, cal, event.ID, event, result)
+				}
+				continue
+			}
+			if existing.ETag != "" && existing.ETag == event.ETag {
+				continue
+			}
+		}
+
+		if err := store.SaveEvent(event); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to save event %q: %w", event.Title, err))
+			continue
+		}
+		if existing != nil {
+			result.EventsUpdated++
+		} else {
+			activeIDs = append(activeIDs, event.ID)
+			result.EventsCreated++
+		}
+	}
+
+	if !complete {
+		return
+	}
+
+	// Remove local events that no longer exist on remote
+	deleted, err := store.DeleteEventsNotIn(cal.ID, activeIDs)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to remove deleted events: %w", err))
+		return
+	}
+	result.EventsDeleted += int(deleted)
+}
+
+// resolveRemoteDelete handles an event deleted on the server while it has
+// local changes: nothing is left to do if it was deleted locally too,
+// otherwise the deletion conflicts with the local edit
+func resolveRemoteDelete(store *calendar.Store, cal *calendar.Calendar, change *calendar.PendingChange, result *SyncResult) {
+	switch change.Op {
+	case calendar.ChangeCreate:
+		return
+	case calendar.ChangeDelete:
+		if err := store.DropPendingChanges(change.CalendarID, change.EventID); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to drop pending changes: %w", err))
+		}
+	default:
+		saveConflict(store, cal, change.EventID, nil, result)
+	}
+}
+
+// saveConflict records a conflict between a local change and the server's
+// copy of an event, which is nil if the server deleted it
+func saveConflict(store *calendar.Store, cal *calendar.Calendar, eventID string, remote *calendar.Event, result *SyncResult) {
+	conflict := &calendar.Conflict{
+		AccountID:  cal.AccountID,
+		CalendarID: cal.ID,
+		EventID:    eventID,
+		Remote:     remote,
+	}
+	if err := store.SaveConflict(conflict); err != nil {
+		result.Errors = append(result.Errors, fmt.Errorf("failed to record conflict for %s: %w", eventID, err))
+		return
+	}
+	result.Conflicts++
+}
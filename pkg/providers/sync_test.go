@@ -0,0 +1,227 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// fakeProvider keeps calendars' events in memory, keyed by remote ID
+type fakeProvider struct {
+	account   *calendar.Account
+	calendars []string
+	events    map[string]*calendar.Event
+	nextID    int
+
+	// Sync tokens the server accepts; others are reported as expired
+	tokens    map[string]bool
+	requested []string // Sync tokens GetEventChanges was called with
+}
+
+func newFakeProvider(account *calendar.Account) *fakeProvider {
+	return &fakeProvider{
+		account:   account,
+		calendars: []string{"cal"},
+		events:    make(map[string]*calendar.Event),
+		tokens:    make(map[string]bool),
+	}
+}
+
+func (p *fakeProvider) Name() string                       { return "Fake" }
+func (p *fakeProvider) Type() calendar.AccountType         { return p.account.Type }
+func (p *fakeProvider) Authenticate(context.Context) error { return nil }
+func (p *fakeProvider) GetAccount() *calendar.Account      { return p.account }
+func (p *fakeProvider) SetAccount(a *calendar.Account)     { p.account = a }
+
+func (p *fakeProvider) ListCalendars(context.Context) ([]*calendar.Calendar, error) {
+	calendars := make([]*calendar.Calendar, len(p.calendars))
+	for i, id := range p.calendars {
+		calendars[i] = &calendar.Calendar{ID: id, Name: id}
+	}
+	return calendars, nil
+}
+
+func (p *fakeProvider) GetEvents(ctx context.Context, calendarID string, start, end time.Time) ([]*calendar.Event, error) {
+	ids := make([]string, 0, len(p.events))
+	for id, e := range p.events {
+		if e.CalendarID == calendarID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	events := make([]*calendar.Event, 0, len(ids))
+	for _, id := range ids {
+		e := *p.events[id]
+		e.ID = ""
+		events = append(events, &e)
+	}
+	return events, nil
+}
+
+func (p *fakeProvider) GetEventChanges(ctx context.Context, calendarID, syncToken string, start, end time.Time) (*EventChanges, error) {
+	p.requested = append(p.requested, syncToken)
+	if syncToken != "" && !p.tokens[syncToken] {
+		return nil, ErrSyncTokenExpired
+	}
+	events, _ := p.GetEvents(ctx, calendarID, start, end)
+	token := "token-" + strconv.Itoa(len(p.tokens)+1)
+	p.tokens[token] = true
+	return &EventChanges{Events: events, SyncToken: token, Full: true}, nil
+}
+
+func (p *fakeProvider) CreateEvent(ctx context.Context, calendarID string, event *calendar.Event) error {
+	p.nextID++
+	event.RemoteID = "remote-" + strconv.Itoa(p.nextID)
+	stored := *event
+	stored.CalendarID = calendarID
+	p.events[event.RemoteID] = &stored
+	return nil
+}
+
+func (p *fakeProvider) UpdateEvent(ctx context.Context, calendarID string, event *calendar.Event) error {
+	if _, ok := p.events[event.RemoteID]; !ok {
+		return &HTTPError{Service: "Fake", StatusCode: http.StatusNotFound}
+	}
+	stored := *event
+	stored.CalendarID = calendarID
+	p.events[event.RemoteID] = &stored
+	return nil
+}
+
+func (p *fakeProvider) DeleteEvent(ctx context.Context, calendarID, remoteID string) error {
+	delete(p.events, remoteID)
+	return nil
+}
+
+// openTestStore opens a store in a temporary directory with one account
+func openTestStore(t *testing.T) (*calendar.Store, *calendar.Account) {
+	t.Helper()
+	store, err := calendar.NewStore(filepath.Join(t.TempDir(), "switchcal.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	account := &calendar.Account{ID: "acc", Name: "Fake", Type: calendar.AccountTypeCalDAV, Enabled: true}
+	if err := store.SaveAccount(account); err != nil {
+		t.Fatal(err)
+	}
+	return store, account
+}
+
+func TestSyncRecoversFromExpiredToken(t *testing.T) {
+	store, account := openTestStore(t)
+	p := newFakeProvider(account)
+	start := time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)
+	p.events["a"] = &calendar.Event{CalendarID: "cal", UID: "a", RemoteID: "a", Title: "A", Start: start, End: start.Add(time.Hour)}
+
+	if err := store.SaveCalendar(&calendar.Calendar{ID: "cal", AccountID: "acc", Name: "Fake", SyncToken: "expired"}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := SyncAccount(context.Background(), p, store, start.AddDate(0, -1, 0), start.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Failed() {
+			t.Fatalf("sync failed: %v", r.Errors)
+		}
+	}
+
+	if len(p.requested) != 2 || p.requested[0] != "expired" || p.requested[1] != "" {
+		t.Errorf("tokens requested = %q, want the expired one then a full listing", p.requested)
+	}
+	cal, err := store.GetCalendar("cal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.tokens[cal.SyncToken] {
+		t.Errorf("stored sync token %q, want the fresh one", cal.SyncToken)
+	}
+	if events, _ := store.GetEventsByRemoteID("cal", "a"); len(events) != 1 {
+		t.Errorf("resync stored %d copies of the event, want 1", len(events))
+	}
+
+	// The next sync is incremental again
+	p.requested = nil
+	if _, err := SyncAccount(context.Background(), p, store, start.AddDate(0, -1, 0), start.AddDate(0, 1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.requested) != 1 || p.requested[0] != cal.SyncToken {
+		t.Errorf("tokens requested = %q, want %q", p.requested, cal.SyncToken)
+	}
+}
+
+// syncOK syncs an account and fails the test on any error
+func syncOK(t *testing.T, p Provider, store *calendar.Store, start time.Time) {
+	t.Helper()
+	results, err := SyncAccount(context.Background(), p, store, start.AddDate(0, -1, 0), start.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Failed() {
+			t.Fatalf("sync failed: %v", r.Errors)
+		}
+	}
+}
+
+func TestMoveEventBetweenCalendars(t *testing.T) {
+	store, account := openTestStore(t)
+	p := newFakeProvider(account)
+	p.calendars = []string{"cal", "other"}
+	for _, id := range p.calendars {
+		if err := store.SaveCalendar(&calendar.Calendar{ID: id, AccountID: "acc", Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Date(2026, 5, 4, 9, 0, 0, 0, time.UTC)
+	event := &calendar.Event{ID: "ev", CalendarID: "cal", UID: "ev", Title: "Standup", Start: start, End: start.Add(time.Hour)}
+	if err := store.SaveEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.QueueChange(&calendar.PendingChange{AccountID: "acc", CalendarID: "cal", EventID: "ev", Op: calendar.ChangeCreate}); err != nil {
+		t.Fatal(err)
+	}
+	syncOK(t, p, store, start)
+	uploaded, err := store.GetEvent("ev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRemoteID := uploaded.RemoteID
+
+	// Move it, from a copy that predates the upload
+	event.CalendarID = "other"
+	if err := MoveEvent(store, event, "cal", "acc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.QueueChange(&calendar.PendingChange{AccountID: "acc", CalendarID: "other", EventID: "ev", Op: calendar.ChangeCreate}); err != nil {
+		t.Fatal(err)
+	}
+	syncOK(t, p, store, start)
+
+	if _, ok := p.events[oldRemoteID]; ok {
+		t.Error("the copy in the old calendar was not deleted from the server")
+	}
+	if len(p.events) != 1 {
+		t.Fatalf("server has %d events, want 1", len(p.events))
+	}
+	moved, err := store.GetEvent("ev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.CalendarID != "other" || moved.RemoteID == "" || moved.RemoteID == oldRemoteID {
+		t.Errorf("moved event: calendar %q, remote ID %q", moved.CalendarID, moved.RemoteID)
+	}
+	if server := p.events[moved.RemoteID]; server == nil || server.CalendarID != "other" {
+		t.Errorf("server copy = %+v, want it in the new calendar", server)
+	}
+}
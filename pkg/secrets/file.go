@@ -0,0 +1,199 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+)
+
+// Key derivation parameters for new files
+const (
+	fileVersion   = 1
+	kdfIterations = 600000
+	saltSize      = 16
+	keySize       = 32 // AES-256
+)
+
+// ErrWrongPassphrase is returned when a secrets file cannot be decrypted
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// fileFormat is the on-disk layout of an encrypted secrets file
+type fileFormat struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// File stores secrets in a file encrypted with AES-256-GCM under a key
+// derived from a passphrase with PBKDF2-SHA256. It is the fallback used when
+// no Secret Service is running.
+type File struct {
+	path       string
+	key        []byte
+	salt       []byte
+	iterations int
+	secrets    map[string]string
+	mu         sync.Mutex
+}
+
+// FileExists reports whether a secrets file has been created at path
+func FileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// OpenFile opens the secrets file at path, creating it protected by
+// passphrase if it does not exist. ErrWrongPassphrase is returned when the
+// passphrase does not decrypt an existing file.
+func OpenFile(path, passphrase string) (*File, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("a passphrase is required")
+	}
+
+	f := &File{path: path, secrets: make(map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		f.iterations = kdfIterations
+		f.salt = make([]byte, saltSize)
+		if _, err := rand.Read(f.salt); err != nil {
+			return nil, err
+		}
+		if f.key, err = deriveKey(passphrase, f.salt, f.iterations); err != nil {
+			return nil, err
+		}
+		if err := f.save(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	var stored fileFormat
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+	if stored.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported secrets file version %d", stored.Version)
+	}
+
+	f.iterations = stored.Iterations
+	f.salt = stored.Salt
+	if f.key, err = deriveKey(passphrase, f.salt, f.iterations); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(f.key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, stored.Nonce, stored.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	if err := json.Unmarshal(plaintext, &f.secrets); err != nil {
+		return nil, fmt.Errorf("failed to decode secrets: %w", err)
+	}
+	return f, nil
+}
+
+// GetSecret returns the secret stored under ref, or an empty string if there is none
+func (f *File) GetSecret(ref string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.secrets[ref], nil
+}
+
+// SetSecret stores or replaces the secret under ref
+func (f *File) SetSecret(ref, label, secret string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.secrets[ref] = secret
+	return f.save()
+}
+
+// DeleteSecret removes the secret under ref, if any
+func (f *File) DeleteSecret(ref string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.secrets[ref]; !ok {
+		return nil
+	}
+	delete(f.secrets, ref)
+	return f.save()
+}
+
+// save encrypts the secrets with a fresh nonce and atomically replaces the file
+func (f *File) save() error {
+	plaintext, err := json.Marshal(f.secrets)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(f.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(fileFormat{
+		Version:    fileVersion,
+		Iterations: f.iterations,
+		Salt:       f.salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace secrets file: %w", err)
+	}
+	return nil
+}
+
+// deriveKey derives the file encryption key from a passphrase
+func deriveKey(passphrase string, salt []byte, iterations int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, iterations, keySize)
+}
+
+// newGCM returns an AES-GCM cipher for key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Ensure File implements calendar.SecretStore
+var _ calendar.SecretStore = (*File)(nil)
@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets", "secrets.json")
+	if FileExists(path) {
+		t.Fatal("FileExists before the file was created")
+	}
+
+	f, err := OpenFile(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !FileExists(path) {
+		t.Fatal("OpenFile did not create the file")
+	}
+	if err := f.SetSecret("account/acc/token", "Token", "s3cret-token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetSecret("account/acc/password", "Password", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.DeleteSecret("account/acc/password"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("s3cret-token")) || bytes.Contains(data, []byte("account/acc")) {
+		t.Error("secrets file holds plaintext")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("secrets file mode = %v, %v", info.Mode().Perm(), err)
+	}
+
+	reopened, err := OpenFile(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reopened.GetSecret("account/acc/token"); got != "s3cret-token" {
+		t.Errorf("token after reopening = %q", got)
+	}
+	if got, _ := reopened.GetSecret("account/acc/password"); got != "" {
+		t.Errorf("deleted password after reopening = %q", got)
+	}
+}
+
+func TestFileWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	f, err := OpenFile(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetSecret("ref", "Label", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenFile(path, "battery staple"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase: got %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := OpenFile(path, ""); err == nil {
+		t.Error("opened with an empty passphrase")
+	}
+}
@@ -0,0 +1,227 @@
+// Package secrets stores account credentials in the freedesktop Secret
+// Service keyring, or in a passphrase-encrypted file when no keyring runs.
+package secrets
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/godbus/dbus/v5"
+)
+
+// Secret Service D-Bus names (https://specifications.freedesktop.org/secret-service/)
+const (
+	serviceName       = "org.freedesktop.secrets"
+	servicePath       = "/org/freedesktop/secrets"
+	defaultCollection = "/org/freedesktop/secrets/aliases/default"
+
+	serviceIface    = "org.freedesktop.Secret.Service"
+	collectionIface = "org.freedesktop.Secret.Collection"
+	itemIface       = "org.freedesktop.Secret.Item"
+	promptIface     = "org.freedesktop.Secret.Prompt"
+)
+
+// Item attributes used to find SwitchCal's secrets
+const (
+	attrApplication = "application"
+	attrRef         = "switchcal-ref"
+	applicationID   = "com.djwarf.switchcal"
+)
+
+// promptTimeout bounds how long to wait for the user to answer an unlock prompt
+const promptTimeout = 5 * time.Minute
+
+// noPrompt is returned in place of a prompt path when none is needed
+const noPrompt = dbus.ObjectPath("/")
+
+// secretValue is the Secret struct of the Secret Service API, (oayays)
+type secretValue struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretService stores secrets in the desktop keyring over D-Bus
+type SecretService struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+	mu      sync.Mutex
+}
+
+// NewSecretService connects to the Secret Service on the session bus. An
+// error means no keyring is available and another store should be used.
+func NewSecretService() (*SecretService, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+
+	// Secrets travel over the local session bus, so no transport encryption is negotiated
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err = conn.Object(serviceName, servicePath).
+		Call(serviceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session)
+	if err != nil {
+		return nil, fmt.Errorf("secret service unavailable: %w", err)
+	}
+
+	return &SecretService{conn: conn, session: session}, nil
+}
+
+// GetSecret returns the secret stored under ref, or an empty string if there is none
+func (s *SecretService) GetSecret(ref string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, err := s.search(ref)
+	if err != nil || len(items) == 0 {
+		return "", err
+	}
+
+	var secret secretValue
+	err = s.conn.Object(serviceName, items[0]).Call(itemIface+".GetSecret", 0, s.session).Store(&secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return string(secret.Value), nil
+}
+
+// SetSecret stores or replaces the secret under ref in the default collection
+func (s *SecretService) SetSecret(ref, label, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.unlock([]dbus.ObjectPath{defaultCollection}); err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		itemIface + ".Label":      dbus.MakeVariant(label),
+		itemIface + ".Attributes": dbus.MakeVariant(attributes(ref)),
+	}
+	value := secretValue{
+		Session:     s.session,
+		Value:       []byte(secret),
+		ContentType: "application/json",
+	}
+
+	var item, prompt dbus.ObjectPath
+	err := s.conn.Object(serviceName, defaultCollection).
+		Call(collectionIface+".CreateItem", 0, properties, value, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to store secret: %w", err)
+	}
+	return s.prompt(prompt)
+}
+
+// DeleteSecret removes the secret under ref, if any
+func (s *SecretService) DeleteSecret(ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, err := s.search(ref)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := s.conn.Object(serviceName, item).Call(itemIface+".Delete", 0).Store(&prompt); err != nil {
+			return fmt.Errorf("failed to delete secret: %w", err)
+		}
+		if err := s.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attributes returns the lookup attributes of a secret
+func attributes(ref string) map[string]string {
+	return map[string]string{
+		attrApplication: applicationID,
+		attrRef:         ref,
+	}
+}
+
+// search finds the items stored under ref, unlocking them if necessary
+func (s *SecretService) search(ref string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := s.conn.Object(serviceName, servicePath).
+		Call(serviceIface+".SearchItems", 0, attributes(ref)).
+		Store(&unlocked, &locked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search keyring: %w", err)
+	}
+
+	if len(locked) > 0 {
+		if err := s.unlock(locked); err != nil {
+			return nil, err
+		}
+		unlocked = append(unlocked, locked...)
+	}
+	return unlocked, nil
+}
+
+// unlock unlocks collections or items, prompting the user if the keyring requires it
+func (s *SecretService) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := s.conn.Object(serviceName, servicePath).
+		Call(serviceIface+".Unlock", 0, objects).
+		Store(&unlocked, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to unlock keyring: %w", err)
+	}
+	return s.prompt(prompt)
+}
+
+// prompt shows a Secret Service prompt and waits for the user to complete it
+func (s *SecretService) prompt(path dbus.ObjectPath) error {
+	if path == "" || path == noPrompt {
+		return nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(promptIface),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := s.conn.AddMatchSignal(match...); err != nil {
+		return fmt.Errorf("failed to watch keyring prompt: %w", err)
+	}
+	defer s.conn.RemoveMatchSignal(match...)
+
+	signals := make(chan *dbus.Signal, 4)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.conn.Object(serviceName, path).Call(promptIface+".Prompt", 0, "").Err; err != nil {
+		return fmt.Errorf("failed to show keyring prompt: %w", err)
+	}
+
+	timeout := time.After(promptTimeout)
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != path || sig.Name != promptIface+".Completed" {
+				continue
+			}
+			if len(sig.Body) > 0 {
+				if dismissed, ok := sig.Body[0].(bool); ok && dismissed {
+					return fmt.Errorf("keyring prompt dismissed")
+				}
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for keyring prompt")
+		}
+	}
+}
+
+// Ensure SecretService implements calendar.SecretStore
+var _ calendar.SecretStore = (*SecretService)(nil)
@@ -0,0 +1,517 @@
+// Package sync runs the background synchronisation of remote accounts. Each
+// account is scheduled on its own, failed runs are retried with exponential
+// backoff (or as long as the server asks with Retry-After), runs of the same
+// account never overlap, and progress is reported to subscribers. The engine
+// can be paused, e.g. while the computer is offline, and syncs everything once
+// resumed.
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdsync "sync"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+)
+
+// Defaults for Config fields left at zero
+const (
+	DefaultMinBackoff = 30 * time.Second
+	DefaultMaxBackoff = 30 * time.Minute
+	DefaultRunTimeout = 10 * time.Minute
+)
+
+// Config controls an Engine
+type Config struct {
+	// Interval between successful syncs of an account; zero only syncs on request
+	Interval time.Duration
+
+	// First and longest delay before retrying a failed sync
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// RunTimeout bounds a single sync of one account
+	RunTimeout time.Duration
+
+	// TrashRetention is how long deleted events stay in the trash before a
+	// sync purges them; zero keeps them until the trash is emptied
+	TrashRetention time.Duration
+
+	// Connect returns the provider to sync an account with, or nil if the
+	// account has nothing to sync. It defaults to providers.New.
+	Connect func(ctx context.Context, account *calendar.Account) (providers.Provider, error)
+}
+
+// EventKind tells what an Event reports
+type EventKind int
+
+const (
+	// Started is sent when a sync of an account begins
+	Started EventKind = iota
+	// Progress is sent after each calendar of the account has been synced
+	Progress
+	// Finished is sent when the sync ends; Err is set if it failed
+	Finished
+	// Paused is sent when the engine is paused; Account is nil
+	Paused
+	// Resumed is sent when a paused engine starts syncing again; Account is nil
+	Resumed
+)
+
+// Event reports the progress of an account's sync to subscribers
+type Event struct {
+	Kind    EventKind
+	Account *calendar.Account
+
+	// Progress: calendars synced so far, out of Total
+	Done   int
+	Total  int
+	Result *providers.SyncResult
+
+	// Finished
+	Results []*providers.SyncResult
+	Err     error
+	NextRun time.Time // Zero if no further sync is scheduled
+
+	// Paused
+	Reason string
+}
+
+// Engine schedules and runs account syncs in the background
+type Engine struct {
+	store *calendar.Store
+	cfg   Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     stdsync.WaitGroup
+
+	mu          stdsync.Mutex
+	accounts    map[string]*accountState
+	subscribers map[int]func(Event)
+	nextSub     int
+	stopped     bool
+	paused      bool
+}
+
+// accountState is the schedule of one account
+type accountState struct {
+	timer    *time.Timer
+	running  bool
+	cancel   context.CancelFunc // Interrupts the current run
+	queued   bool               // Run again as soon as the current run ends
+	waiters  []chan struct{}    // Closed when the next run ends
+	failures int                // Consecutive failed runs
+	holdOff  time.Time          // Until when the server asked not to be contacted
+}
+
+// New creates an engine that syncs the accounts in store. Call Start to begin.
+func New(store *calendar.Store, cfg Config) *Engine {
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(DefaultMaxBackoff, cfg.MinBackoff)
+	}
+	if cfg.RunTimeout <= 0 {
+		cfg.RunTimeout = DefaultRunTimeout
+	}
+	if cfg.Connect == nil {
+		cfg.Connect = func(ctx context.Context, account *calendar.Account) (providers.Provider, error) {
+			return providers.New(account)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Engine{
+		store:       store,
+		cfg:         cfg,
+		ctx:         ctx,
+		cancel:      cancel,
+		accounts:    make(map[string]*accountState),
+		subscribers: make(map[int]func(Event)),
+	}
+}
+
+// Start syncs every enabled remote account now and keeps them scheduled
+func (e *Engine) Start() error {
+	accounts, err := e.store.GetAllAccounts()
+	if err != nil {
+		return fmt.Errorf("failed to load accounts: %w", err)
+	}
+	for _, account := range accounts {
+		if syncable(account) {
+			e.SyncNow(account.ID)
+		}
+	}
+	return nil
+}
+
+// Stop cancels running syncs, waits for them to end and stops scheduling.
+// The engine cannot be restarted.
+func (e *Engine) Stop() {
+	e.mu.Lock()
+	e.stopped = true
+	for _, st := range e.accounts {
+		if st.timer != nil {
+			st.timer.Stop()
+		}
+	}
+	e.mu.Unlock()
+
+	e.cancel()
+	e.wg.Wait()
+
+	// Release callers waiting for runs that will not happen
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, st := range e.accounts {
+		for _, w := range st.waiters {
+			close(w)
+		}
+		st.waiters = nil
+	}
+}
+
+// Subscribe registers fn to receive sync events and returns a function that
+// unregisters it. fn is called from the engine's goroutines and must not block.
+func (e *Engine) Subscribe(fn func(Event)) (unsubscribe func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := e.nextSub
+	e.nextSub++
+	e.subscribers[id] = fn
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.subscribers, id)
+	}
+}
+
+// Pause interrupts running syncs and holds back further ones until Resume.
+// Reason is passed on to subscribers, e.g. "offline".
+func (e *Engine) Pause(reason string) {
+	e.mu.Lock()
+	if e.stopped {
+		e.mu.Unlock()
+		return
+	}
+	e.paused = true
+	for _, st := range e.accounts {
+		if st.timer != nil {
+			st.timer.Stop()
+			st.timer = nil
+		}
+		if st.cancel != nil {
+			st.cancel()
+		}
+	}
+	e.mu.Unlock()
+
+	e.publish(Event{Kind: Paused, Reason: reason})
+}
+
+// Resume ends a pause and syncs every enabled remote account right away
+func (e *Engine) Resume() error {
+	accounts, err := e.store.GetAllAccounts()
+	if err != nil {
+		err = fmt.Errorf("failed to load accounts: %w", err)
+	}
+
+	e.mu.Lock()
+	if !e.paused || e.stopped {
+		e.mu.Unlock()
+		return err
+	}
+	e.paused = false
+	for _, account := range accounts {
+		if syncable(account) {
+			e.state(account.ID)
+		}
+	}
+	// Also runs the syncs asked for while paused
+	for id, st := range e.accounts {
+		e.syncNowLocked(id, st)
+	}
+	e.mu.Unlock()
+
+	e.publish(Event{Kind: Resumed})
+	return err
+}
+
+// SyncNow syncs an account as soon as possible, right after its current run
+// if one is in progress, or once the engine is resumed if it is paused. The
+// returned channel is closed when that sync ends.
+func (e *Engine) SyncNow(accountID string) <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	done := make(chan struct{})
+	if e.stopped {
+		close(done)
+		return done
+	}
+
+	st := e.state(accountID)
+	st.waiters = append(st.waiters, done)
+	e.syncNowLocked(accountID, st)
+	return done
+}
+
+// syncNowLocked starts a run of an account, skipping its backoff but not a
+// wait the server asked for. e.mu must be held.
+func (e *Engine) syncNowLocked(accountID string, st *accountState) {
+	st.failures = 0
+	if wait := time.Until(st.holdOff); wait > 0 && !st.running {
+		if st.timer != nil {
+			st.timer.Stop()
+		}
+		st.timer = time.AfterFunc(wait, func() { e.trigger(accountID) })
+		return
+	}
+	e.triggerLocked(accountID, st)
+}
+
+// state returns the schedule of an account, creating it if needed. e.mu must be held.
+func (e *Engine) state(accountID string) *accountState {
+	st, ok := e.accounts[accountID]
+	if !ok {
+		st = &accountState{}
+		e.accounts[accountID] = st
+	}
+	return st
+}
+
+// trigger starts a scheduled run of an account
+func (e *Engine) trigger(accountID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if st, ok := e.accounts[accountID]; ok && !e.stopped {
+		e.triggerLocked(accountID, st)
+	}
+}
+
+// triggerLocked starts a run of an account unless one is in progress, in
+// which case another run follows it. While paused, the run waits for Resume.
+// e.mu must be held.
+func (e *Engine) triggerLocked(accountID string, st *accountState) {
+	if st.running {
+		st.queued = true
+		return
+	}
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	if e.paused {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(e.ctx)
+	st.running = true
+	st.cancel = cancel
+	waiters := st.waiters
+	st.waiters = nil
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer cancel()
+		e.run(ctx, accountID, waiters)
+	}()
+}
+
+// run syncs an account once, then schedules its next run
+func (e *Engine) run(ctx context.Context, accountID string, waiters []chan struct{}) {
+	defer func() {
+		for _, w := range waiters {
+			close(w)
+		}
+	}()
+
+	account, err := e.store.GetAccount(accountID)
+	if err != nil || !syncable(account) {
+		// Removed or disabled since it was scheduled
+		e.mu.Lock()
+		st := e.accounts[accountID]
+		st.running = false
+		st.cancel = nil
+		if st.queued && !e.stopped {
+			st.queued = false
+			e.triggerLocked(accountID, st)
+		} else {
+			delete(e.accounts, accountID)
+		}
+		e.mu.Unlock()
+		return
+	}
+
+	e.publish(Event{Kind: Started, Account: account})
+	results, err := e.syncAccount(ctx, account)
+	e.purgeTrash()
+
+	e.mu.Lock()
+	st := e.accounts[accountID]
+	st.running = false
+	st.cancel = nil
+
+	// A run interrupted by Pause or Stop is not a failure
+	interrupted := ctx.Err() != nil
+	if interrupted && err == nil {
+		err = ctx.Err()
+	}
+
+	var delay time.Duration
+	switch {
+	case interrupted:
+	case failed(results, err):
+		st.failures++
+		wait := retryAfter(results, err)
+		st.holdOff = time.Now().Add(wait)
+		delay = max(e.backoff(st.failures), wait)
+	default:
+		st.failures = 0
+		delay = e.cfg.Interval
+	}
+
+	var next time.Time
+	switch {
+	case e.stopped || e.paused || e.ctx.Err() != nil:
+		// Resume syncs every account again
+		st.queued = false
+	case st.queued:
+		// Another sync was asked for meanwhile; run it once the server allows
+		st.queued = false
+		if wait := time.Until(st.holdOff); wait > 0 {
+			st.timer = time.AfterFunc(wait, func() { e.trigger(accountID) })
+			next = time.Now().Add(wait)
+		} else {
+			e.triggerLocked(accountID, st)
+			next = time.Now()
+		}
+	case delay > 0:
+		st.timer = time.AfterFunc(delay, func() { e.trigger(accountID) })
+		next = time.Now().Add(delay)
+	}
+	e.mu.Unlock()
+
+	e.publish(Event{Kind: Finished, Account: account, Results: results, Err: err, NextRun: next})
+}
+
+// syncAccount fetches an account's changes, uploads its queued changes and
+// records the outcome in the store
+func (e *Engine) syncAccount(ctx context.Context, account *calendar.Account) ([]*providers.SyncResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.RunTimeout)
+	defer cancel()
+
+	began := time.Now()
+	before := *account
+	provider, err := e.cfg.Connect(ctx, account)
+	if err != nil {
+		result := &providers.SyncResult{AccountID: account.ID, SyncTime: began, Errors: []error{err}}
+		e.store.SaveSyncRecord(result.Record())
+		return []*providers.SyncResult{result}, err
+	}
+	if provider == nil {
+		return nil, nil
+	}
+
+	// Fetch events from the last month to six months ahead
+	start := began.AddDate(0, -1, 0)
+	end := began.AddDate(0, 6, 0)
+
+	results, err := providers.SyncAccountWithProgress(ctx, provider, e.store, start, end,
+		func(done, total int, result *providers.SyncResult) {
+			e.publish(Event{Kind: Progress, Account: account, Done: done, Total: total, Result: result})
+		})
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	for _, r := range results {
+		e.store.SaveSyncRecord(r.Record())
+	}
+	// Persist the last sync time and any refreshed tokens, keeping changes
+	// made to the account while it synced
+	if saveErr := e.store.SaveSyncState(&before, provider.GetAccount()); saveErr != nil && err == nil {
+		err = fmt.Errorf("failed to save account: %w", saveErr)
+	}
+	return results, err
+}
+
+// purgeTrash permanently deletes the events that have been in the trash for
+// longer than the configured retention. A failed purge is retried after the
+// next sync.
+func (e *Engine) purgeTrash() {
+	if e.cfg.TrashRetention <= 0 {
+		return
+	}
+	e.store.PurgeTrash(time.Now().Add(-e.cfg.TrashRetention))
+}
+
+// backoff returns how long to wait after the given number of consecutive
+// failures, doubling from MinBackoff up to MaxBackoff
+func (e *Engine) backoff(failures int) time.Duration {
+	delay := e.cfg.MinBackoff
+	for i := 1; i < failures && delay < e.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, e.cfg.MaxBackoff)
+}
+
+// retryAfter returns the longest wait a rate-limited or failing server asked
+// for in a run's errors, or zero
+func retryAfter(results []*providers.SyncResult, err error) time.Duration {
+	errs := []error{err}
+	for _, r := range results {
+		errs = append(errs, r.Errors...)
+	}
+	var longest time.Duration
+	for _, err := range errs {
+		if wait, ok := providers.RetryAfter(err); ok {
+			longest = max(longest, wait)
+		}
+	}
+	return longest
+}
+
+// publish sends an event to every subscriber
+func (e *Engine) publish(ev Event) {
+	e.mu.Lock()
+	subscribers := make([]func(Event), 0, len(e.subscribers))
+	for _, fn := range e.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	e.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(ev)
+	}
+}
+
+// failed reports whether a run should be retried with backoff
+func failed(results []*providers.SyncResult, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	for _, r := range results {
+		if r.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// syncable reports whether an account is enabled and syncs with a provider
+func syncable(account *calendar.Account) bool {
+	if !account.Enabled {
+		return false
+	}
+	reg, ok := providers.Lookup(account.Type)
+	return ok && reg.IsRemote()
+}
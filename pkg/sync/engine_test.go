@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/djwarf/switchcal/pkg/calendar"
+	"github.com/djwarf/switchcal/pkg/providers"
+)
+
+// testAccountType is a remote account type whose accounts have nothing to sync
+const testAccountType calendar.AccountType = "sync-test"
+
+func init() {
+	providers.Register(providers.Registration{
+		Type:        testAccountType,
+		DisplayName: "Test",
+		New: func(*calendar.Account) (providers.Provider, error) {
+			return nil, nil
+		},
+	})
+}
+
+// openTestStore opens a store in a temporary directory with one enabled
+// test account
+func openTestStore(t *testing.T) *calendar.Store {
+	t.Helper()
+	store, err := calendar.NewStore(filepath.Join(t.TempDir(), "switchcal.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if err := store.SaveAccount(&calendar.Account{ID: "acc", Name: "Test", Type: testAccountType, Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// noProvider connects accounts to nothing
+func noProvider(context.Context, *calendar.Account) (providers.Provider, error) {
+	return nil, nil
+}
+
+func TestSyncPurgesTrash(t *testing.T) {
+	store := openTestStore(t)
+	if err := store.SaveCalendar(&calendar.Calendar{ID: "cal", AccountID: "acc", Name: "Test"}); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Truncate(time.Hour)
+	if err := store.SaveEvent(&calendar.Event{ID: "old", CalendarID: "cal", Title: "Old", Start: start, End: start.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.TrashEvent("old"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	engine := New(store, Config{TrashRetention: time.Millisecond, Connect: noProvider})
+	defer engine.Stop()
+	<-engine.SyncNow("acc")
+
+	trashed, err := store.GetTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trashed) != 0 {
+		t.Errorf("%d events left in the trash after their retention", len(trashed))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	engine := New(nil, Config{MinBackoff: time.Minute, MaxBackoff: 10 * time.Minute})
+	defer engine.Stop()
+
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	for i, w := range want {
+		if got := engine.backoff(i + 1); got != w {
+			t.Errorf("backoff after %d failures = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	limited := func(wait time.Duration) error {
+		return &providers.HTTPError{Service: "Test", StatusCode: http.StatusTooManyRequests, RetryAfter: wait}
+	}
+	results := []*providers.SyncResult{
+		{Errors: []error{limited(30 * time.Second)}},
+		{Errors: []error{
+			fmt.Errorf("failed to fetch events: %w", limited(2*time.Minute)),
+			// A client error is not retried, whatever the server says
+			&providers.HTTPError{Service: "Test", StatusCode: http.StatusForbidden, RetryAfter: time.Hour},
+		}},
+	}
+
+	if got := retryAfter(results, nil); got != 2*time.Minute {
+		t.Errorf("retryAfter = %v, want the longest wait asked for", got)
+	}
+	if got := retryAfter(nil, limited(5*time.Minute)); got != 5*time.Minute {
+		t.Errorf("retryAfter of a failed run = %v, want 5m", got)
+	}
+	if got := retryAfter(nil, errors.New("connection refused")); got != 0 {
+		t.Errorf("retryAfter without a server's answer = %v, want 0", got)
+	}
+}
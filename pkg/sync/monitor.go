@@ -0,0 +1,171 @@
+package sync
+
+import (
+	"fmt"
+	stdsync "sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// NetworkManager and logind D-Bus names
+const (
+	nmService = "org.freedesktop.NetworkManager"
+	nmPath    = "/org/freedesktop/NetworkManager"
+	nmIface   = "org.freedesktop.NetworkManager"
+
+	logindService = "org.freedesktop.login1"
+	logindPath    = "/org/freedesktop/login1"
+	logindManager = "org.freedesktop.login1.Manager"
+
+	propertiesIface = "org.freedesktop.DBus.Properties"
+)
+
+// NetworkManager connectivity states (NMState)
+const (
+	nmStateUnknown        = 0
+	nmStateConnectedLocal = 50
+)
+
+// NetworkManager metered values (NMMetered)
+const (
+	nmMeteredYes      = 1
+	nmMeteredGuessYes = 3
+)
+
+// Monitor pauses an Engine while the computer is offline, asleep or, unless
+// allowed, on a metered connection, and resumes it when that ends
+type Monitor struct {
+	engine       *Engine
+	allowMetered bool
+	conn         *dbus.Conn
+	signals      chan *dbus.Signal
+
+	mu      stdsync.Mutex
+	online  bool
+	metered bool
+	asleep  bool
+	paused  string // Reason the engine is paused for, empty if it is not
+}
+
+// WatchSystem starts pausing engine according to NetworkManager and logind
+// on the system bus. Without NetworkManager the computer is taken to be online.
+func WatchSystem(engine *Engine, allowMetered bool) (*Monitor, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system bus: %w", err)
+	}
+
+	m := &Monitor{
+		engine:       engine,
+		allowMetered: allowMetered,
+		conn:         conn,
+		signals:      make(chan *dbus.Signal, 16),
+		online:       true,
+	}
+
+	rules := [][]dbus.MatchOption{
+		{dbus.WithMatchObjectPath(nmPath), dbus.WithMatchInterface(nmIface), dbus.WithMatchMember("StateChanged")},
+		{dbus.WithMatchObjectPath(nmPath), dbus.WithMatchInterface(propertiesIface), dbus.WithMatchMember("PropertiesChanged")},
+		{dbus.WithMatchObjectPath(logindPath), dbus.WithMatchInterface(logindManager), dbus.WithMatchMember("PrepareForSleep")},
+	}
+	for _, rule := range rules {
+		if err := conn.AddMatchSignal(rule...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to watch the system bus: %w", err)
+		}
+	}
+	conn.Signal(m.signals)
+
+	// Current state; both properties are missing without NetworkManager
+	nm := conn.Object(nmService, nmPath)
+	if v, err := nm.GetProperty(nmIface + ".State"); err == nil {
+		if state, ok := v.Value().(uint32); ok {
+			m.online = isOnline(state)
+		}
+	}
+	if v, err := nm.GetProperty(nmIface + ".Metered"); err == nil {
+		if metered, ok := v.Value().(uint32); ok {
+			m.metered = isMetered(metered)
+		}
+	}
+	m.update()
+
+	go m.listen()
+	return m, nil
+}
+
+// Close stops watching the system. The engine is left as it is.
+func (m *Monitor) Close() error {
+	m.conn.RemoveSignal(m.signals)
+	return m.conn.Close()
+}
+
+// listen applies state changes until the connection is closed
+func (m *Monitor) listen() {
+	for sig := range m.signals {
+		m.mu.Lock()
+		switch sig.Name {
+		case nmIface + ".StateChanged":
+			if len(sig.Body) > 0 {
+				if state, ok := sig.Body[0].(uint32); ok {
+					m.online = isOnline(state)
+				}
+			}
+		case propertiesIface + ".PropertiesChanged":
+			if len(sig.Body) < 2 || sig.Body[0] != nmIface {
+				break
+			}
+			props, _ := sig.Body[1].(map[string]dbus.Variant)
+			if v, ok := props["Metered"]; ok {
+				if metered, ok := v.Value().(uint32); ok {
+					m.metered = isMetered(metered)
+				}
+			}
+		case logindManager + ".PrepareForSleep":
+			if len(sig.Body) > 0 {
+				if sleeping, ok := sig.Body[0].(bool); ok {
+					m.asleep = sleeping
+				}
+			}
+		}
+		m.mu.Unlock()
+		m.update()
+	}
+}
+
+// update pauses or resumes the engine to match the current state
+func (m *Monitor) update() {
+	m.mu.Lock()
+	var reason string
+	switch {
+	case m.asleep:
+		reason = "suspended"
+	case !m.online:
+		reason = "offline"
+	case m.metered && !m.allowMetered:
+		reason = "metered connection"
+	}
+	changed := reason != m.paused
+	m.paused = reason
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if reason != "" {
+		m.engine.Pause(reason)
+	} else {
+		m.engine.Resume()
+	}
+}
+
+// isOnline reports whether a NetworkManager state allows reaching servers.
+// An unknown state means NetworkManager does not manage the network.
+func isOnline(state uint32) bool {
+	return state == nmStateUnknown || state >= nmStateConnectedLocal
+}
+
+// isMetered reports whether a NetworkManager metered value means data is charged for
+func isMetered(metered uint32) bool {
+	return metered == nmMeteredYes || metered == nmMeteredGuessYes
+}